@@ -8,6 +8,7 @@ require (
 	github.com/fatih/color v1.7.0
 	github.com/gobuffalo/packr/v2 v2.0.0-rc.13
 	github.com/google/uuid v1.1.0
+	github.com/klauspost/compress v1.17.0
 	github.com/magiconair/properties v1.8.0
 	github.com/mitchellh/go-homedir v1.0.0
 	github.com/natefinch/lumberjack v2.0.0+incompatible
@@ -16,6 +17,7 @@ require (
 	github.com/spf13/cobra v0.0.3
 	github.com/spf13/viper v1.3.1
 	github.com/stretchr/testify v1.3.0
+	github.com/ulikunitz/xz v0.5.11
 	github.com/vmihailenco/msgpack v4.0.2+incompatible
 	github.com/willf/bloom v2.0.3+incompatible
 	golang.org/x/net v0.0.0-20181220203305-927f97764cc3
@@ -2,8 +2,6 @@ package addressing
 
 import (
 	"bufio"
-	"encoding/binary"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/ekaley/ipv666/internal"
@@ -11,13 +9,14 @@ import (
 	"github.com/ekaley/ipv666/internal/zrandom"
 	"github.com/spf13/viper"
 	"io"
+	"math/rand"
 	"net"
 	"os"
 	"strings"
 )
 
-func GetAdjacentNetworkAddressesFromIPs(toParse []*net.IP, fromNybble int, toNybble int) ([]*net.IP, error) {
-	var toReturn []*net.IP
+func GetAdjacentNetworkAddressesFromIPs(toParse []IPv6, fromNybble int, toNybble int) ([]IPv6, error) {
+	var toReturn []IPv6
 	for _, curIP := range toParse {
 		newIPs, err := GetAdjacentNetworkAddressesFromIP(curIP, fromNybble, toNybble)
 		if err != nil {
@@ -29,7 +28,7 @@ func GetAdjacentNetworkAddressesFromIPs(toParse []*net.IP, fromNybble int, toNyb
 	return GetUniqueIPs(toReturn, viper.GetInt("LogLoopEmitFreq")), nil
 }
 
-func GetAdjacentNetworkAddressesFromIP(toParse *net.IP, fromNybble int, toNybble int) ([]*net.IP, error) {
+func GetAdjacentNetworkAddressesFromIP(toParse IPv6, fromNybble int, toNybble int) ([]IPv6, error) {
 	if fromNybble < 0 {
 		return nil, fmt.Errorf("fromNybble must be >= 0 (got %d)", fromNybble)
 	} else if toNybble > 32 {
@@ -37,7 +36,7 @@ func GetAdjacentNetworkAddressesFromIP(toParse *net.IP, fromNybble int, toNybble
 	} else if fromNybble == toNybble {
 		return nil, fmt.Errorf("fromNybble and toNybble must be at least one apart (got %d, %d)", fromNybble, toNybble)
 	}
-	toReturn := []*net.IP{toParse}
+	toReturn := []IPv6{toParse}
 	ipNybbles := GetNybblesFromIP(toParse, 32)
 	var j uint8
 	curNybbles := make([]uint8, len(ipNybbles))
@@ -59,49 +58,47 @@ func IsAddressIPv4(toCheck *net.IP) bool {
 	return toCheck.To4() != nil
 }
 
-func GetIPsFromStrings(toParse []string) []*net.IP {
-	var toReturn []*net.IP
+func GetIPsFromStrings(toParse []string) []IPv6 {
+	var toReturn []IPv6
 	for _, curParse := range toParse {
-		newIP := net.ParseIP(curParse)
-		if newIP == nil {
+		newIP, ok := ParseIPv6(curParse)
+		if !ok {
 			logging.Warnf("Could not parse IP from string '%s'.", curParse)
 		} else {
-			toReturn = append(toReturn, &newIP)
+			toReturn = append(toReturn, newIP)
 		}
 	}
 	return toReturn
 }
 
-func GetIPSet(ips []*net.IP) map[string]*internal.Empty {
-	toReturn := make(map[string]*internal.Empty)
-	blacklistEntry := &internal.Empty{}
+func GetIPSet(ips []IPv6) map[IPv6]internal.Empty {
+	toReturn := make(map[IPv6]internal.Empty)
 	for _, ip := range ips {
-		toReturn[ip.String()] = blacklistEntry
+		toReturn[ip] = internal.Empty{}
 	}
 	return toReturn
 }
 
-func GetFirst64BitsOfIP(ip *net.IP) uint64 {
-	ipBytes := ([]byte)(*ip)
-	return binary.LittleEndian.Uint64(ipBytes[:8])
+func GetFirst64BitsOfIP(ip IPv6) uint64 {
+	return ip.High
 }
 
-func GetUniqueIPs(ips []*net.IP, updateFreq int) []*net.IP { // TODO refactor this to use addr tree
-	checkMap := make(map[string]bool)
-	var toReturn []*net.IP
+func GetUniqueIPs(ips []IPv6, updateFreq int) []IPv6 {
+	checkMap := make(map[IPv6]internal.Empty)
+	var toReturn []IPv6
 	for i, ip := range ips {
 		if i%updateFreq == 0 {
 			logging.Debugf("Processing %d out of %d for unique IPs.", i, len(ips))
 		}
-		if _, ok := checkMap[ip.String()]; !ok {
-			checkMap[ip.String()] = true
+		if _, ok := checkMap[ip]; !ok {
+			checkMap[ip] = internal.Empty{}
 			toReturn = append(toReturn, ip)
 		}
 	}
 	return toReturn
 }
 
-func WriteIPsToHexFile(filePath string, addrs []*net.IP) error {
+func WriteIPsToHexFile(filePath string, addrs []IPv6) error {
 	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0644)
 	writer := bufio.NewWriter(file)
 	if err != nil {
@@ -115,7 +112,7 @@ func WriteIPsToHexFile(filePath string, addrs []*net.IP) error {
 	return nil
 }
 
-func GetTextLinesFromIPs(addrs []*net.IP) string {
+func GetTextLinesFromIPs(addrs []IPv6) string {
 	var toReturn []string
 	for _, addr := range addrs {
 		toReturn = append(toReturn, fmt.Sprintf("%s\n", addr.String()))
@@ -123,7 +120,7 @@ func GetTextLinesFromIPs(addrs []*net.IP) string {
 	return strings.Join(toReturn, "")
 }
 
-func ReadIPsFromBinaryFile(filePath string) ([]*net.IP, error) {
+func ReadIPsFromBinaryFile(filePath string) ([]IPv6, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
@@ -137,107 +134,61 @@ func ReadIPsFromBinaryFile(filePath string) ([]*net.IP, error) {
 	if fileSize%16 != 0 {
 		return nil, errors.New(fmt.Sprintf("Expected file size to be a multiple of 16 (got %d).", fileSize))
 	}
-	buffer := make([]byte, 16)
-	var toReturn []*net.IP
+	var buffer [16]byte
+	toReturn := make([]IPv6, 0, fileSize/16)
 	for {
-		_, err := file.Read(buffer)
+		_, err := io.ReadFull(file, buffer[:])
 		if err != nil {
 			if err != io.EOF {
 				return nil, err
 			}
 			break
 		}
-		ipBytes := make([]byte, 16)
-		copy(ipBytes, buffer)
-		newIP := net.IP(ipBytes)
-		toReturn = append(toReturn, &newIP)
+		toReturn = append(toReturn, NewIPv6FromBytes(buffer))
 	}
 	return toReturn, nil
 }
 
-func WriteIPsToBinaryFile(filePath string, addrs []*net.IP) error {
-	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	writer := bufio.NewWriter(file)
-
-	for _, addr := range addrs {
-		writer.Write(*addr)
-	}
-	writer.Flush()
-	return nil
-}
-
-func WriteIPsToFatHexFile(filePath string, addrs []*net.IP) error {
-	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0644)
-	writer := bufio.NewWriter(file)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	buffer := make([]byte, 32)
-	for _, addr := range addrs {
-		hex.Encode(buffer, *addr)
-		writer.Write(buffer)
-		writer.Write([]byte("\n"))
-	}
-	writer.Flush()
-	return nil
-}
-
-func GetNybbleFromIP(ip *net.IP, index int) uint8 {
+func GetNybbleFromIP(ip IPv6, index int) uint8 {
 	// TODO fatal error if index > 31
-	byteIndex := index / 2
-	addrBytes := ([]byte)(*ip)
-	addrByte := addrBytes[byteIndex]
-	if index%2 == 0 {
-		return addrByte >> 4
-	} else {
-		return addrByte & 0xf
-	}
+	return ip.Nybble(index)
 }
 
-func GetNybblesFromIP(ip *net.IP, nybbleCount int) []uint8 {
-	var toReturn []uint8
+func GetNybblesFromIP(ip IPv6, nybbleCount int) []uint8 {
+	toReturn := make([]uint8, 0, nybbleCount)
 	for i := 0; i < nybbleCount; i++ {
-		toReturn = append(toReturn, GetNybbleFromIP(ip, i))
+		toReturn = append(toReturn, ip.Nybble(i))
 	}
 	return toReturn
 }
 
-func NybblesToIP(nybbles []uint8) *net.IP {
-	var bytes []byte
-	var curByte byte = 0x0
+func NybblesToIP(nybbles []uint8) IPv6 {
+	var toReturn IPv6
 	for i, curNybble := range nybbles {
-		if i%2 == 0 {
-			curByte ^= curNybble << 4
-		} else {
-			curByte ^= curNybble
-			bytes = append(bytes, curByte)
-			curByte = 0x0
+		if i < 16 {
+			toReturn.High |= uint64(curNybble&0xf) << uint((15-i)*4)
+		} else if i < 32 {
+			toReturn.Low |= uint64(curNybble&0xf) << uint((31-i)*4)
 		}
 	}
-	newIP := net.IP(bytes)
-	return &newIP
+	return toReturn
 }
 
-func GenerateRandomAddress() *net.IP {
-	bytes := zrandom.GenerateHostBits(128)
-	toReturn := net.IP(bytes)
-	return &toReturn
+func GenerateRandomAddress(random *rand.Rand) IPv6 {
+	var ipBytes [16]byte
+	copy(ipBytes[:], zrandom.GenerateHostBits(random, 128))
+	return NewIPv6FromBytes(ipBytes)
 }
 
-func FlipBitsInAddress(toFlip *net.IP, startIndex uint8, endIndex uint8) *net.IP {
-	toFlipBytes := *toFlip
+func FlipBitsInAddress(toFlip IPv6, startIndex uint8, endIndex uint8) IPv6 {
+	toFlipBytes := toFlip.Bytes()
 	endIndex++
 	startByte := startIndex / 8
 	startOffset := startIndex % 8
 	endByte := endIndex / 8
 	endOffset := endIndex % 8
 	var maskBytes []byte
-	var flipBytes []byte
+	var flipBytes [16]byte
 	var i uint8
 
 	if startByte == endByte {
@@ -268,11 +219,10 @@ func FlipBitsInAddress(toFlip *net.IP, startIndex uint8, endIndex uint8) *net.IP
 
 	for i = 0; i < 16; i++ {
 		flippedBits := ^toFlipBytes[i] & ^maskBytes[i]
-		flipBytes = append(flipBytes, toFlipBytes[i]&maskBytes[i]|flippedBits)
+		flipBytes[i] = toFlipBytes[i]&maskBytes[i] | flippedBits
 	}
 
-	toReturn := net.IP(flipBytes)
-	return &toReturn
+	return NewIPv6FromBytes(flipBytes)
 
 }
 
@@ -289,13 +239,6 @@ func AddressToUints(toProcess net.IP) (uint64, uint64) {
 	return first, second
 }
 
-func UintsToAddress(first uint64, second uint64) *net.IP {
-	var addrBytes []byte
-	processBytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(processBytes, first)
-	addrBytes = append(addrBytes, processBytes...)
-	binary.BigEndian.PutUint64(processBytes, second)
-	addrBytes = append(addrBytes, processBytes...)
-	newIP := net.IP(addrBytes)
-	return &newIP
+func UintsToAddress(first uint64, second uint64) IPv6 {
+	return IPv6{High: first, Low: second}
 }
@@ -11,25 +11,20 @@ func init() {
 	config.InitConfig()
 }
 
-func getTestingIP() *net.IP {
-	toReturn := net.ParseIP("2600::1")
-	return &toReturn
+func getTestingIP() IPv6 {
+	return NewIPv6(net.ParseIP("2600::1"))
 }
 
-func getTestingIPs() []*net.IP {
+func getTestingIPs() []IPv6 {
 	ips := []net.IP{
 		net.ParseIP("2600::0"),
 		net.ParseIP("2600::1"),
 		net.ParseIP("2601::1"),
 	}
-	var toReturn []*net.IP
-	for i := 0; i < len(ips); i++ {
-		toReturn = append(toReturn, &ips[i])
-	}
-	return toReturn
+	return IPsToIPv6s(ips)
 }
 
-func getExpectedAdjacentIPs() []*net.IP {
+func getExpectedAdjacentIPs() []IPv6 {
 	ips := []net.IP{
 		net.ParseIP("2600::0"),
 		net.ParseIP("2600::1"),
@@ -48,11 +43,7 @@ func getExpectedAdjacentIPs() []*net.IP {
 		net.ParseIP("2600::e"),
 		net.ParseIP("2600::f"),
 	}
-	var toReturn []*net.IP
-	for i := 0; i < len(ips); i++ {
-		toReturn = append(toReturn, &ips[i])
-	}
-	return toReturn
+	return IPsToIPv6s(ips)
 }
 
 func TestGetAdjacentNetworkAddressesFromIPsBadFromNybble(t *testing.T) {
@@ -115,42 +106,42 @@ func TestGetAdjacentNetworkAddressesFromIPSmallContent(t *testing.T) {
 
 func TestFlipBitsInAddressOnBoundaries(t *testing.T) {
 	testAddr := net.ParseIP("aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa")
-	flipAddr := FlipBitsInAddress(&testAddr, 8, 15)
+	flipAddr := FlipBitsInAddress(NewIPv6(testAddr), 8, 15)
 	expectedAddr := net.ParseIP("aa55:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa")
 	assert.Equal(t, expectedAddr.String(), flipAddr.String())
 }
 
 func TestFlipBitsInAddressOffBoundaryStart(t *testing.T) {
 	testAddr := net.ParseIP("aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa")
-	flipAddr := FlipBitsInAddress(&testAddr, 12, 15)
+	flipAddr := FlipBitsInAddress(NewIPv6(testAddr), 12, 15)
 	expectedAddr := net.ParseIP("aaa5:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa")
 	assert.Equal(t, expectedAddr.String(), flipAddr.String())
 }
 
 func TestFlipBitsInAddressOffBoundaryEnd(t *testing.T) {
 	testAddr := net.ParseIP("aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa")
-	flipAddr := FlipBitsInAddress(&testAddr, 8, 19)
+	flipAddr := FlipBitsInAddress(NewIPv6(testAddr), 8, 19)
 	expectedAddr := net.ParseIP("aa55:5aaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa")
 	assert.Equal(t, expectedAddr.String(), flipAddr.String())
 }
 
 func TestFlipBitsInAddressSameByte(t *testing.T) {
 	testAddr := net.ParseIP("aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa")
-	flipAddr := FlipBitsInAddress(&testAddr, 8, 11)
+	flipAddr := FlipBitsInAddress(NewIPv6(testAddr), 8, 11)
 	expectedAddr := net.ParseIP("aa5a:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa")
 	assert.Equal(t, expectedAddr.String(), flipAddr.String())
 }
 
 func TestFlipBitsInAddressMultiByteAway(t *testing.T) {
 	testAddr := net.ParseIP("aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa")
-	flipAddr := FlipBitsInAddress(&testAddr, 8, 31)
+	flipAddr := FlipBitsInAddress(NewIPv6(testAddr), 8, 31)
 	expectedAddr := net.ParseIP("aa55:5555:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa")
 	assert.Equal(t, expectedAddr.String(), flipAddr.String())
 }
 
 func TestFlipBitsInAddress(t *testing.T) {
 	testAddr := net.ParseIP("aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa")
-	flipAddr := FlipBitsInAddress(&testAddr, 64, 127)
+	flipAddr := FlipBitsInAddress(NewIPv6(testAddr), 64, 127)
 	expectedAddr := net.ParseIP("aaaa:aaaa:aaaa:aaaa:5555:5555:5555:5555")
 	assert.Equal(t, expectedAddr.String(), flipAddr.String())
 }
@@ -194,24 +185,24 @@ func TestAddressToUintsOneSecond(t *testing.T) {
 func TestUintsToAddressZeroes(t *testing.T) {
 	testAddr := net.ParseIP("0000:0000:0000:0000:0000:0000:0000:0000")
 	resultAddr := UintsToAddress(uint64(0), uint64(0))
-	assert.EqualValues(t, testAddr, *resultAddr)
+	assert.EqualValues(t, NewIPv6(testAddr), resultAddr)
 }
 
 func TestUintsToAddressOnes(t *testing.T) {
 	testAddr := net.ParseIP("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff")
 	resultAddr := UintsToAddress(^uint64(0), ^uint64(0))
-	assert.EqualValues(t, testAddr, *resultAddr)
+	assert.EqualValues(t, NewIPv6(testAddr), resultAddr)
 }
 
 func TestUintsToAddressLow(t *testing.T) {
 	testAddr := net.ParseIP("0000:0000:0000:0001:0000:0000:0000:0001")
 	resultAddr := UintsToAddress(uint64(1), uint64(1))
-	assert.EqualValues(t, testAddr, *resultAddr)
+	assert.EqualValues(t, NewIPv6(testAddr), resultAddr)
 }
 
 func TestUintsToAddressHigh(t *testing.T) {
 	testAddr := net.ParseIP("8000:0000:0000:0000:8000:0000:0000:0000")
 	baseUint := uint64(1) << 63
 	resultAddr := UintsToAddress(baseUint, baseUint)
-	assert.EqualValues(t, testAddr, *resultAddr)
+	assert.EqualValues(t, NewIPv6(testAddr), resultAddr)
 }
@@ -0,0 +1,110 @@
+package addressing
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// A compact IPv6 address held as its upper and lower 64 bits (the same pair that AddressToUints
+// produces). Unlike net.IP it is a fixed-size value, so slices of addresses need no per-address heap
+// allocations and addresses can be compared with == and used directly as map keys. Convert to and from
+// net.IP only at the edges (ie: sockets and text parsing).
+type IPv6 struct {
+	High uint64
+	Low  uint64
+}
+
+// Convert a net.IP to an IPv6. IPv4 addresses are converted to their IPv4-mapped form, and anything
+// that isn't a valid IP address becomes the zero address.
+func NewIPv6(ip net.IP) IPv6 {
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return IPv6{}
+	}
+	return IPv6{
+		High: binary.BigEndian.Uint64(ip16[0:8]),
+		Low:  binary.BigEndian.Uint64(ip16[8:16]),
+	}
+}
+
+func NewIPv6FromBytes(ipBytes [16]byte) IPv6 {
+	return IPv6{
+		High: binary.BigEndian.Uint64(ipBytes[0:8]),
+		Low:  binary.BigEndian.Uint64(ipBytes[8:16]),
+	}
+}
+
+// Parse an IPv6 address from its string representation, returning false if it could not be parsed
+func ParseIPv6(toParse string) (IPv6, bool) {
+	ip := net.ParseIP(toParse)
+	if ip == nil {
+		return IPv6{}, false
+	}
+	return NewIPv6(ip), true
+}
+
+func (ip IPv6) Bytes() [16]byte {
+	var toReturn [16]byte
+	binary.BigEndian.PutUint64(toReturn[0:8], ip.High)
+	binary.BigEndian.PutUint64(toReturn[8:16], ip.Low)
+	return toReturn
+}
+
+func (ip IPv6) ToIP() net.IP {
+	ipBytes := ip.Bytes()
+	return net.IP(ipBytes[:])
+}
+
+func (ip IPv6) String() string {
+	return ip.ToIP().String()
+}
+
+// Encode the address as text (ie: in JSON documents) using its string representation
+func (ip IPv6) MarshalText() ([]byte, error) {
+	return []byte(ip.String()), nil
+}
+
+func (ip *IPv6) UnmarshalText(text []byte) error {
+	parsed, ok := ParseIPv6(string(text))
+	if !ok {
+		return errors.New(fmt.Sprintf("Could not parse '%s' as an IPv6 address.", text))
+	}
+	*ip = parsed
+	return nil
+}
+
+// Get the nybble at the given index (0 being the most significant)
+func (ip IPv6) Nybble(index int) uint8 {
+	if index < 16 {
+		return uint8(ip.High>>uint((15-index)*4)) & 0xf
+	}
+	return uint8(ip.Low>>uint((31-index)*4)) & 0xf
+}
+
+// Whether the address is contained within the network
+func (ip IPv6) In(network *net.IPNet) bool {
+	if len(network.Mask) != net.IPv6len {
+		return network.Contains(ip.ToIP())
+	}
+	mask := NewIPv6(net.IP(network.Mask))
+	base := NewIPv6(network.IP)
+	return ip.High&mask.High == base.High&mask.High && ip.Low&mask.Low == base.Low&mask.Low
+}
+
+func IPsToIPv6s(ips []net.IP) []IPv6 {
+	toReturn := make([]IPv6, 0, len(ips))
+	for _, ip := range ips {
+		toReturn = append(toReturn, NewIPv6(ip))
+	}
+	return toReturn
+}
+
+func IPv6sToIPs(ips []IPv6) []net.IP {
+	toReturn := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		toReturn = append(toReturn, ip.ToIP())
+	}
+	return toReturn
+}
@@ -0,0 +1,67 @@
+package addressing
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestIPv6_RoundTrip(t *testing.T) {
+	ip := net.ParseIP("2600:1234:5678:9abc:def0:1234:5678:9abc")
+	assert.True(t, ip.Equal(NewIPv6(ip).ToIP()))
+	assert.Equal(t, ip.String(), NewIPv6(ip).String())
+}
+
+func TestIPv6_MatchesAddressToUints(t *testing.T) {
+	ip := net.ParseIP("8000:0000:0000:0001:8000:0000:0000:0002")
+	first, second := AddressToUints(ip)
+	assert.Equal(t, IPv6{High: first, Low: second}, NewIPv6(ip))
+}
+
+func TestIPv6_BytesRoundTrip(t *testing.T) {
+	ip, ok := ParseIPv6("2600::ff")
+	assert.True(t, ok)
+	assert.Equal(t, ip, NewIPv6FromBytes(ip.Bytes()))
+}
+
+func TestParseIPv6_Invalid(t *testing.T) {
+	_, ok := ParseIPv6("not-an-address")
+	assert.False(t, ok)
+}
+
+func TestIPv6_Nybble(t *testing.T) {
+	ip, _ := ParseIPv6("0123:4567:89ab:cdef:fedc:ba98:7654:3210")
+	nybbles := GetNybblesFromIP(ip, 32)
+	for i := 0; i < 32; i++ {
+		assert.Equal(t, nybbles[i], ip.Nybble(i))
+	}
+	assert.Equal(t, ip, NybblesToIP(nybbles))
+}
+
+func TestIPv6_In(t *testing.T) {
+	_, network, _ := net.ParseCIDR("2600:1234::/36")
+	inside, _ := ParseIPv6("2600:1234:0fff::1")
+	outside, _ := ParseIPv6("2600:1234:1000::1")
+	assert.True(t, inside.In(network))
+	assert.False(t, outside.In(network))
+}
+
+func TestIPv6_MapKey(t *testing.T) {
+	first, _ := ParseIPv6("2600::1")
+	second, _ := ParseIPv6("2600:0:0:0:0:0:0:1")
+	set := GetIPSet([]IPv6{first})
+	_, found := set[second]
+	assert.True(t, found)
+}
+
+func TestIPv6_JSONRoundTrip(t *testing.T) {
+	ip, _ := ParseIPv6("2600::1")
+	b, err := json.Marshal(map[string]IPv6{"addr": ip})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"addr":"2600::1"}`, string(b))
+	var decoded map[string]IPv6
+	assert.Nil(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, ip, decoded["addr"])
+	assert.NotNil(t, json.Unmarshal([]byte(`{"addr":"nope"}`), &decoded))
+}
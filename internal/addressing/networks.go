@@ -13,18 +13,20 @@ import (
 	"math/rand"
 	"net"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 func getFirst64BitsOfNetwork(network *net.IPNet) uint64 {
-	return GetFirst64BitsOfIP(&network.IP)
+	return GetFirst64BitsOfIP(NewIPv6(network.IP))
 }
 
-func GenerateRandomNetworks(toGenerate int, minMaskLen int32) []*net.IPNet {
+func GenerateRandomNetworks(random *rand.Rand, toGenerate int, minMaskLen int32) []*net.IPNet {
 	var toReturn []*net.IPNet
 	for len(toReturn) < toGenerate {
-		addrBytes := zrandom.GenerateRandomBits(128)
-		maskLen := uint8(rand.Int31n(128-minMaskLen) + minMaskLen)
+		addrBytes := zrandom.GenerateRandomBits(random, 128)
+		maskLen := uint8(random.Int31n(128-minMaskLen) + minMaskLen)
 		newNet, _ := GetIPv6NetworkFromBytes(addrBytes, maskLen)
 		toReturn = append(toReturn, newNet)
 	}
@@ -58,28 +60,27 @@ func GetBaseAddressString(network *net.IPNet) string {
 	return fmt.Sprintf("%s/%d", ip, ones)
 }
 
-func GenerateRandomAddressesInNetwork(network *net.IPNet, addrCount int) []*net.IP {
-	var existsMap = make(map[string]bool)
-	var toReturn []*net.IP
+func GenerateRandomAddressesInNetwork(random *rand.Rand, network *net.IPNet, addrCount int) []IPv6 {
+	var existsMap = make(map[IPv6]bool)
+	var toReturn []IPv6
 	for len(toReturn) < addrCount {
-		newAddr := GenerateRandomAddressInNetwork(network)
-		if _, ok := existsMap[newAddr.String()]; !ok {
+		newAddr := GenerateRandomAddressInNetwork(random, network)
+		if _, ok := existsMap[newAddr]; !ok {
 			toReturn = append(toReturn, newAddr)
-			existsMap[newAddr.String()] = true
+			existsMap[newAddr] = true
 		}
 	}
 	return toReturn
 }
 
-func GenerateRandomAddressInNetwork(network *net.IPNet) *net.IP {
+func GenerateRandomAddressInNetwork(random *rand.Rand, network *net.IPNet) IPv6 {
 	ones, _ := network.Mask.Size()
-	randomBytes := zrandom.GenerateHostBits(128 - ones)
-	var newBytes []byte
+	randomBytes := zrandom.GenerateHostBits(random, 128-ones)
+	var newBytes [16]byte
 	for i := range network.IP {
-		newBytes = append(newBytes, (network.IP[i]&network.Mask[i])|randomBytes[i])
+		newBytes[i] = (network.IP[i] & network.Mask[i]) | randomBytes[i]
 	}
-	var genIP = net.IP(newBytes)
-	return &genIP
+	return NewIPv6FromBytes(newBytes)
 }
 
 func GetUniqueNetworks(networks []*net.IPNet, updateFreq int) []*net.IPNet {
@@ -128,26 +129,49 @@ func WriteIPv6NetworksToHexFile(filePath string, networks []*net.IPNet) error {
 	return nil
 }
 
-func ReadIPv6NetworksFromHexFile(filePath string) ([]*net.IPNet, error) {
-	logging.Debugf("Reading IPv6 networks from file at path '%s'.", filePath)
+// Write a count for each network to a text file, one "<network> <count>" pair per line
+func WriteIPv6NetworkCountsToFile(filePath string, counts map[string]int) error {
+	var networks []string
+	for network := range counts {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	for _, network := range networks {
+		writer.WriteString(fmt.Sprintf("%s %d\n", network, counts[network]))
+	}
+	return writer.Flush()
+}
+
+func ReadIPv6NetworkCountsFromFile(filePath string) (map[string]int, error) {
 	fileBytes, err := ioutil.ReadFile(filePath)
 	if err != nil {
 		return nil, err
 	}
-	fileContent := strings.TrimSpace(string(fileBytes))
-	fileLines := strings.Split(fileContent, "\n")
-	var networks []*net.IPNet
-	for _, fileLine := range fileLines {
-		trimmedLine := strings.TrimSpace(fileLine)
-		_, network, err := net.ParseCIDR(trimmedLine)
-		if err != nil {
-			logging.Warnf("Error thrown when parsing '%s' as CIDR: %e", trimmedLine, err)
+	toReturn := make(map[string]int)
+	for i, fileLine := range strings.Split(string(fileBytes), "\n") {
+		fields := strings.Fields(fileLine)
+		if len(fields) == 0 {
 			continue
+		} else if len(fields) != 2 {
+			return nil, errors.New(fmt.Sprintf("Expected a network and a count on line %d of file '%s' (got '%s').", i+1, filePath, fileLine))
 		}
-		networks = append(networks, network)
+		_, network, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		count, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		toReturn[network.String()] += count
 	}
-	logging.Infof("Read %d networks from file '%s'.", len(networks), filePath)
-	return networks, nil
+	return toReturn, nil
 }
 
 func GetIPv6NetworkFromBytes(toProcess []byte, maskLength uint8) (*net.IPNet, error) {
@@ -285,20 +309,18 @@ func GetNetworkFromUints(uints [2]uint64, length uint8) *net.IPNet {
 	return toReturn
 }
 
-func GetBorderAddressesFromNetwork(network *net.IPNet) (*net.IP, *net.IP) {
-	var baseAddrBytes []byte
-	var topAddrBytes []byte
+func GetBorderAddressesFromNetwork(network *net.IPNet) (IPv6, IPv6) {
+	var baseAddrBytes [16]byte
+	var topAddrBytes [16]byte
 	for i := range network.IP {
-		baseAddrBytes = append(baseAddrBytes, network.IP[i]&network.Mask[i])
-		topAddrBytes = append(topAddrBytes, baseAddrBytes[i]|^network.Mask[i])
+		baseAddrBytes[i] = network.IP[i] & network.Mask[i]
+		topAddrBytes[i] = baseAddrBytes[i] | ^network.Mask[i]
 	}
-	baseAddr := net.IP(baseAddrBytes)
-	topAddr := net.IP(topAddrBytes)
-	return &baseAddr, &topAddr
+	return NewIPv6FromBytes(baseAddrBytes), NewIPv6FromBytes(topAddrBytes)
 }
 
 func GetNybblesFromNetwork(network *net.IPNet) []uint8 {
 	ones, _ := network.Mask.Size()
 	nybbleCount := int(math.Ceil(float64(ones) / 4.0))
-	return GetNybblesFromIP(&network.IP, nybbleCount)
+	return GetNybblesFromIP(NewIPv6(network.IP), nybbleCount)
 }
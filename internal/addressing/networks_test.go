@@ -2,6 +2,7 @@ package addressing
 
 import (
 	"math"
+	"math/rand"
 	"testing"
 	"github.com/stretchr/testify/assert"
 	"net"
@@ -67,42 +68,42 @@ func TestGetBorderAddressesFromNetworkMinMaskBase(t *testing.T) {
 	_, network, _ := net.ParseCIDR("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/0")
 	base, _ := GetBorderAddressesFromNetwork(network)
 	expected := []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
-	assert.ElementsMatch(t, expected, *base)
+	assert.ElementsMatch(t, expected, base.ToIP())
 }
 
 func TestGetBorderAddressesFromNetworkMinMaskTop(t *testing.T) {
 	_, network, _ := net.ParseCIDR("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/0")
 	_, top := GetBorderAddressesFromNetwork(network)
 	expected := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
-	assert.ElementsMatch(t, expected, *top)
+	assert.ElementsMatch(t, expected, top.ToIP())
 }
 
 func TestGetBorderAddressesFromNetworkMaxMaskBase(t *testing.T) {
 	_, network, _ := net.ParseCIDR("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/128")
 	base, _ := GetBorderAddressesFromNetwork(network)
 	expected := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
-	assert.ElementsMatch(t, expected, *base)
+	assert.ElementsMatch(t, expected, base.ToIP())
 }
 
 func TestGetBorderAddressesFromNetworkMaxMaskTop(t *testing.T) {
 	_, network, _ := net.ParseCIDR("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/128")
 	_, top := GetBorderAddressesFromNetwork(network)
 	expected := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
-	assert.ElementsMatch(t, expected, *top)
+	assert.ElementsMatch(t, expected, top.ToIP())
 }
 
 func TestGetBorderAddressesFromNetworkMidMaskBase(t *testing.T) {
 	_, network, _ := net.ParseCIDR("ffff:0000:ffff:ffff:ffff:ffff:ffff:ffff/64")
 	base, _ := GetBorderAddressesFromNetwork(network)
 	expected := []byte{0xff, 0xff, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
-	assert.ElementsMatch(t, expected, *base)
+	assert.ElementsMatch(t, expected, base.ToIP())
 }
 
 func TestGetBorderAddressesFromNetworkMidMaskTop(t *testing.T) {
 	_, network, _ := net.ParseCIDR("ffff:0000:ffff:ffff:ffff:ffff:ffff:ffff/64")
 	_, top := GetBorderAddressesFromNetwork(network)
 	expected := []byte{0xff, 0xff, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
-	assert.ElementsMatch(t, expected, *top)
+	assert.ElementsMatch(t, expected, top.ToIP())
 }
 
 func TestNetworkToUintsZeroMaskLowerFirst(t *testing.T) {
@@ -320,3 +321,13 @@ func TestNetworkToUints127MaskUpperSecond(t *testing.T) {
 	_, _, _, upperSecond := NetworkToUints(network)
 	assert.EqualValues(t, (uint(1) << 63) + 1, upperSecond)
 }
+
+func TestGenerateRandomAddressesInNetwork_SameSeedSameAddresses(t *testing.T) {
+	_, network, _ := net.ParseCIDR("2600:1234::/32")
+	first := GenerateRandomAddressesInNetwork(rand.New(rand.NewSource(666)), network, 100)
+	assert.Equal(t, first, GenerateRandomAddressesInNetwork(rand.New(rand.NewSource(666)), network, 100))
+	assert.NotEqual(t, first, GenerateRandomAddressesInNetwork(rand.New(rand.NewSource(667)), network, 100))
+	for _, addr := range first {
+		assert.True(t, network.Contains(addr.ToIP()))
+	}
+}
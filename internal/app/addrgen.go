@@ -3,38 +3,42 @@ package app
 import (
 	"github.com/ekaley/ipv666/internal/addressing"
 	"github.com/ekaley/ipv666/internal/data"
+	"github.com/ekaley/ipv666/internal/fs"
 	"github.com/ekaley/ipv666/internal/logging"
 	"github.com/ekaley/ipv666/internal/modeling"
 	"github.com/spf13/viper"
+	"math/rand"
 	"net"
 )
 
-func RunAddrGen(modelPath string, outputPath string, fromNetwork string, genCount int) {
+func RunAddrGen(random *rand.Rand, generatorType string, modelPaths []string, modelRatios []float64, seedsPath string, outputPath string, fromNetwork string, genCount int) {
 
-	var clusterModel *modeling.ClusterModel
+	var generator modeling.Generator
 	var err error
 
-	if modelPath == "" {
-		logging.Info("No model path specified. Using default model packaged with IPv666.")
-		clusterModel, err = data.GetProbabilisticClusterModel()
+	if modeling.IsSeededGeneratorType(generatorType) {
+		generator, err = loadSeededGenerator(generatorType, seedsPath)
+	} else if len(modelPaths) > 1 {
+		generator, err = loadModelEnsemble(modelPaths, modelRatios)
+	} else if len(modelPaths) == 1 {
+		generator, err = loadClusterModel(modelPaths[0])
 	} else {
-		logging.Infof("Using cluster model found at path '%s'.", modelPath)
-		clusterModel, err = modeling.LoadModelFromFile(modelPath)
+		generator, err = loadClusterModel("")
 	}
 
 	if err != nil {
 		logging.ErrorF(err)
 	}
 
-	var generatedAddrs []*net.IP
+	var generatedAddrs []addressing.IPv6
 
 	if fromNetwork == "" {
 		logging.Info("No network specified. Generating addresses in the global address space.")
-		generatedAddrs = clusterModel.GenerateAddresses(genCount, viper.GetFloat64("ModelGenerationJitter"))
+		generatedAddrs = generator.GenerateAddresses(random, genCount, viper.GetFloat64("ModelGenerationJitter"))
 	} else {
 		_, ipnet, _ := net.ParseCIDR(fromNetwork)
 		logging.Infof("Generating addresses in specified network range of '%s'.", ipnet)
-		generatedAddrs, err = clusterModel.GenerateAddressesFromNetwork(genCount, viper.GetFloat64("ModelGenerationJitter"), ipnet)
+		generatedAddrs, err = generator.GenerateAddressesFromNetwork(random, genCount, viper.GetFloat64("ModelGenerationJitter"), ipnet)
 		if err != nil {
 			logging.ErrorF(err)
 		}
@@ -51,3 +55,34 @@ func RunAddrGen(modelPath string, outputPath string, fromNetwork string, genCoun
 	logging.Infof("Successfully wrote addresses to file '%s'.", outputPath)
 
 }
+
+func loadClusterModel(modelPath string) (*modeling.ClusterModel, error) {
+	if modelPath == "" {
+		logging.Info("No model path specified. Using default model packaged with IPv666.")
+		return data.GetProbabilisticClusterModel()
+	}
+	logging.Infof("Using cluster model found at path '%s'.", modelPath)
+	return modeling.LoadModelFromFile(modelPath)
+}
+
+func loadModelEnsemble(modelPaths []string, modelRatios []float64) (*modeling.ModelEnsemble, error) {
+	var models []*modeling.ClusterModel
+	for _, modelPath := range modelPaths {
+		model, err := loadClusterModel(modelPath)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, model)
+	}
+	logging.Infof("Generating addresses from an ensemble of %d cluster models.", len(models))
+	return modeling.CreateModelEnsemble(models, modelRatios)
+}
+
+func loadSeededGenerator(generatorType string, seedsPath string) (modeling.Generator, error) {
+	logging.Infof("Building %s generator from seed addresses found at path '%s'.", generatorType, seedsPath)
+	seeds, err := fs.ReadIPsFromFile(seedsPath)
+	if err != nil {
+		return nil, err
+	}
+	return modeling.CreateGeneratorFromSeeds(generatorType, seeds)
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"github.com/ekaley/ipv666/internal/addressing"
 	"github.com/ekaley/ipv666/internal/blacklist"
@@ -10,17 +11,18 @@ import (
 	"github.com/ekaley/ipv666/internal/pingscan"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
+	"math/rand"
 	"net"
 )
 
-func RunAlias(targetNetworkString string) {
+func RunAlias(random *rand.Rand, targetNetworkString string) {
 
 	_, targetNetwork, err := net.ParseCIDR(targetNetworkString)
 	if err != nil {
 		logging.ErrorF(err)
 	}
 
-	ip, aliased, err := checkNetworkForAliased(targetNetwork)
+	ip, aliased, err := checkNetworkForAliased(random, targetNetwork)
 
 	if err != nil {
 		logging.ErrorF(err)
@@ -42,13 +44,12 @@ func RunAlias(targetNetworkString string) {
 
 }
 
-func seekAliasedNetwork(inputNet *net.IPNet, inputIP *net.IP) (*net.IPNet, error) {
+func seekAliasedNetwork(inputNet *net.IPNet, inputIP addressing.IPv6) (*net.IPNet, error) {
 
 	logging.Infof("Now seeking aliased network length starting from input range of %s. Addresses that responded will be %s.", inputNet, inputIP)
 
 	ones, _ := inputNet.Mask.Size()
-	acs, err := blacklist.NewAliasCheckStates([]*net.IP{inputIP}, uint8(viper.GetInt("AliasLeftIndexStart")), uint8(ones))
-	var i int
+	acs, err := blacklist.NewAliasCheckStates([]addressing.IPv6{inputIP}, uint8(viper.GetInt("AliasLeftIndexStart")), uint8(ones))
 	var toReturn *net.IPNet
 
 	if err != nil {
@@ -66,23 +67,17 @@ func seekAliasedNetwork(inputNet *net.IPNet, inputIP *net.IP) (*net.IPNet, error
 			return nil, errors.New(fmt.Sprintf("did not generate any test addresses in loop %d", loopCount))
 		}
 		logging.Debugf("%d addresses generated for loop %d.", len(testAddrs), loopCount)
-		var scanAddrs []*net.IP
-		for _, testAddr := range testAddrs {
-			for i = 0; i < viper.GetInt("AliasDuplicateScanCount"); i++ {
-				scanAddrs = append(scanAddrs, testAddr)
-			}
-		}
 		targetsPath := fs.GetTimedFilePath(config.GetNetworkScanTargetsDirPath())
-		logging.Debugf("Writing %d blacklist scan addresses to file '%s'.", len(scanAddrs), targetsPath)
-		err := addressing.WriteIPsToHexFile(targetsPath, scanAddrs)
+		logging.Debugf("Writing %d blacklist scan addresses to file '%s'.", len(testAddrs), targetsPath)
+		err := addressing.WriteIPsToHexFile(targetsPath, testAddrs)
 		if err != nil {
-			logging.Warnf("Error thrown when writing %d addresses to file '%s': %e", len(scanAddrs), targetsPath, err)
+			logging.Warnf("Error thrown when writing %d addresses to file '%s': %e", len(testAddrs), targetsPath, err)
 			return nil, err
 		}
-		logging.Debugf("Successfully wrote %d blacklist scan addresses to file '%s'.", len(scanAddrs), targetsPath)
+		logging.Debugf("Successfully wrote %d blacklist scan addresses to file '%s'.", len(testAddrs), targetsPath)
 		outputPath := fs.GetTimedFilePath(config.GetNetworkScanResultsDirPath())
 		logging.Debugf("Kicking off ping scan from file path '%s' to output path '%s'.", targetsPath, outputPath)
-		_, err = pingscan.ScanFromConfig(targetsPath, outputPath)
+		_, err = pingscan.AliasScanFromConfig(context.Background(), targetsPath, outputPath)
 		if err != nil {
 			logging.Warnf("An error was thrown when trying to run ping scan: %s", err)
 			return nil, err
@@ -120,11 +115,11 @@ func seekAliasedNetwork(inputNet *net.IPNet, inputIP *net.IP) (*net.IPNet, error
 
 }
 
-func checkNetworkForAliased(inputNet *net.IPNet) (*net.IP, bool, error) {
+func checkNetworkForAliased(random *rand.Rand, inputNet *net.IPNet) (addressing.IPv6, bool, error) {
 
 	logging.Infof("Now checking network range %s for aliased status.", inputNet)
 
-	addrs := addressing.GenerateRandomAddressesInNetwork(inputNet, viper.GetInt("NetworkPingCount"))
+	addrs := addressing.GenerateRandomAddressesInNetwork(random, inputNet, viper.GetInt("NetworkPingCount"))
 	addrsPath := fs.GetTimedFilePath(config.GetNetworkScanTargetsDirPath())
 
 	logging.Debugf("Writing %d test addresses to file at path '%s'.", len(addrs), addrsPath)
@@ -132,22 +127,22 @@ func checkNetworkForAliased(inputNet *net.IPNet) (*net.IP, bool, error) {
 	err := addressing.WriteIPsToHexFile(addrsPath, addrs)
 	if err != nil {
 		logging.Warnf("Error thrown when writing %d addresses to file '%s': %e", len(addrs), addrsPath, err)
-		return nil, false, err
+		return addressing.IPv6{}, false, err
 	}
 
 	logging.Debugf("Wrote test addresses to file at path '%s'.", addrsPath)
 	outputPath := fs.GetTimedFilePath(config.GetNetworkScanResultsDirPath())
 
-	_, err = pingscan.ScanFromConfig(addrsPath, outputPath)
+	_, _, err = pingscan.ScanFromConfig(context.Background(), addrsPath, outputPath, 0)
 	if err != nil {
 		logging.Warnf("An error was thrown when trying to run ping scan: %s", err)
-		return nil, false, err
+		return addressing.IPv6{}, false, err
 	}
 
 	foundAddrs, err := fs.ReadIPsFromHexFile(outputPath)
 	if err != nil {
 		logging.Warnf("Error thrown when reading IP addresses from file '%s': %e", outputPath, err)
-		return nil, false, err
+		return addressing.IPv6{}, false, err
 	}
 
 	threshold := (int)(float64(viper.GetInt("NetworkPingCount")) * viper.GetFloat64("NetworkBlacklistPercent"))
@@ -158,7 +153,7 @@ func checkNetworkForAliased(inputNet *net.IPNet) (*net.IP, bool, error) {
 		return addrs[0], true, nil
 	} else {
 		logging.Infof("Initial network of %s does not appear to be aliased.", inputNet)
-		return nil, false, nil
+		return addressing.IPv6{}, false, nil
 	}
 
 }
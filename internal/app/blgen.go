@@ -12,7 +12,7 @@ import (
 	"net"
 )
 
-func RunBlgen(inputPath string) {
+func RunBlgen(inputPath string, inputFormat string) {
 
 	var newBlacklist *blacklist.NetworkBlacklist
 
@@ -32,11 +32,12 @@ func RunBlgen(inputPath string) {
 		newBlacklist = blacklist.NewNetworkBlacklist([]*net.IPNet{})
 	}
 
-	networks, err := addressing.ReadIPv6NetworksFromHexFile(inputPath)
+	networks, err := fs.ReadNetworksFromInput(inputPath, inputFormat)
 
 	if err != nil {
-		logging.ErrorStringFf("Error thrown when reading IPv6 networks from file '%s': %e", inputPath, err)
+		logging.ErrorStringFf("Error thrown when reading IPv6 networks from file '%s': %s", inputPath, err)
 	}
+	logging.Infof("Read %d networks from file '%s'.", len(networks), inputPath)
 
 	uniqueNetworks := addressing.GetUniqueNetworks(networks, viper.GetInt("LogLoopEmitFreq"))
 	logging.Debugf("%d networks trimmed down to %d unique networks.", len(networks), len(uniqueNetworks))
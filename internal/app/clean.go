@@ -8,12 +8,12 @@ import (
 	"github.com/spf13/viper"
 )
 
-func RunClean(inputPath string, outputPath string, blist *blacklist.NetworkBlacklist) {
+func RunClean(inputPath string, inputFormat string, outputPath string, blist *blacklist.NetworkBlacklist) {
 
-	addrs, err := fs.ReadIPsFromHexFile(inputPath)
+	addrs, err := fs.ReadIPsFromInput(inputPath, inputFormat)
 
 	if err != nil {
-		logging.ErrorStringFf("Error thrown when reading input list of IP addresses at path '%s': %e", inputPath, err)
+		logging.ErrorStringFf("Error thrown when reading input list of IP addresses at path '%s': %s", inputPath, err)
 	}
 	logging.Infof("Successfully loaded IP addresses from '%s'.", inputPath)
 
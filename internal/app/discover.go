@@ -1,12 +1,18 @@
 package app
 
 import (
+	"context"
 	"github.com/ekaley/ipv666/internal/config"
 	"github.com/ekaley/ipv666/internal/data"
-	"github.com/ekaley/ipv666/internal/fs"
 	"github.com/ekaley/ipv666/internal/logging"
 	"github.com/ekaley/ipv666/internal/statemachine"
 	"github.com/rcrowley/go-metrics"
+	"math/rand"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -18,46 +24,61 @@ func init() {
 
 // TODO add functionality for writing results in hex format
 
-func RunDiscovery() {
+func RunDiscovery(random *rand.Rand) {
 
-	targetNetwork, _ := config.GetTargetNetwork()
-
-	mostRecentNetworkString, err := data.GetMostRecentTargetNetworkString()
+	targetNetworks, err := config.GetTargetNetworks()
 	if err != nil {
-		logging.ErrorStringFf("Error thrown when reading most recent network string: %e", err)
+		logging.ErrorF(err)
 	}
-	if mostRecentNetworkString != targetNetwork.String() {
-		if mostRecentNetworkString == "" {
-			logging.Infof("No prior record of a scanned network exists. Resetting state machine to scan %s appropriately.", targetNetwork)
-		} else {
-			logging.Infof("Target network (%s) is not the most recently scanned network (%s). Resetting state machine and Bloom filter accordingly.", targetNetwork, mostRecentNetworkString)
-		}
-		err := statemachine.ResetStateFile(config.GetStateFilePath())
-		if err != nil {
-			logging.ErrorStringFf("Error thrown when resetting state file: %e", err)
-		}
-		_, _, err = fs.DeleteAllFilesInDirectory(config.GetBloomDirPath(), []string{})
-		if err != nil {
-			logging.ErrorStringFf("Error thrown when deleting Bloom directory files (path '%s'): %e", config.GetBloomDirPath(), err)
-		}
-		err = data.WriteMostRecentTargetNetwork(targetNetwork)
-		if err != nil {
-			logging.ErrorStringFf("Error thrown when writing most recent target network: %e", err)
-		}
+	targetsString := strings.Join(data.GetTargetNetworkStrings(targetNetworks), ", ")
+
+	checkpoint, err := data.LoadCheckpoint()
+	if err != nil {
+		logging.Warnf("Error thrown when loading checkpoint file (path '%s'): %s. Starting a new run to scan %s.", config.GetCheckpointFilePath(), err, targetsString)
+		checkpoint = data.NewCheckpoint(targetNetworks)
+	} else if checkpoint == nil {
+		logging.Infof("No prior record of a scanned network exists. Starting a new run to scan %s.", targetsString)
+		checkpoint = data.NewCheckpoint(targetNetworks)
+	} else if !reflect.DeepEqual(checkpoint.TargetNetworks, data.GetTargetNetworkStrings(targetNetworks)) {
+		logging.Infof("Target networks (%s) are not the most recently scanned networks (%s). Starting a new run. Bloom filters for each network are kept.", targetsString, strings.Join(checkpoint.TargetNetworks, ", "))
+		checkpoint = data.NewCheckpoint(targetNetworks)
+	} else if checkpoint.ConfigHash != data.GetConfigHash() {
+		logging.Warnf("Configuration has changed since run %s was checkpointed, so its progress is no longer valid. Starting a new run to scan %s.", checkpoint.RunID, targetsString)
+		checkpoint = data.NewCheckpoint(targetNetworks)
 	} else {
-		logging.Infof("The network %s is the last network that was targeted. Picking up from where we left off.", targetNetwork)
+		logging.Infof("The networks %s are the last networks that were targeted. Picking up run %s from where we left off.", targetsString, checkpoint.RunID)
+	}
+	data.SetCheckpoint(checkpoint)
+	err = data.SaveCheckpoint()
+	if err != nil {
+		logging.ErrorStringFf("Error thrown when saving checkpoint file (path '%s'): %e", config.GetCheckpointFilePath(), err)
 	}
 
 	logging.Info("All systems are green. Entering state machine.")
 
+	// Stop gracefully on the first interrupt, saving a checkpoint to resume from. Any further interrupts
+	// fall through to the default behavior of exiting immediately.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		logging.Warnf("Received %s. Finishing in-flight work and saving a checkpoint (interrupt again to exit immediately).", sig)
+		cancel()
+	}()
+
 	start := time.Now()
-	err = statemachine.RunStateMachine()
+	err = statemachine.RunStateMachine(ctx, random)
 	elapsed := time.Since(start)
 	mainLoopRunTimer.Update(elapsed)
 
 	//TODO push metrics
 
-	if err != nil {
+	if err != nil && ctx.Err() != nil {
+		logging.Infof("Progress saved. Run discovery again to resume from where it was interrupted.")
+	} else if err != nil {
 		logging.ErrorF(err)
 	}
 
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"fmt"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/fs"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/oui"
+	"math/rand"
+	"net"
+	"sort"
+)
+
+func RunEUI64Gen(random *rand.Rand, inputPath string, fromNetwork string, ouiList string, vendor string, ouiDBPath string, topCount int, spread int, genCount int, rankOnly bool, outputPath string) {
+
+	var seeds []addressing.IPv6
+	var err error
+
+	if inputPath != "" {
+		logging.Infof("Reading discovered addresses from file at path '%s'.", inputPath)
+		seeds, err = fs.ReadIPsFromFile(inputPath)
+		if err != nil {
+			logging.ErrorF(err)
+		}
+	}
+
+	var db *oui.Database
+
+	if ouiDBPath != "" {
+		logging.Infof("Loading OUI database from file at path '%s'.", ouiDBPath)
+		db, err = oui.LoadDatabase(ouiDBPath)
+		if err != nil {
+			logging.ErrorF(err)
+		}
+		logging.Infof("Loaded %d OUI assignments.", db.Size())
+	}
+
+	ranks := oui.RankOUIs(seeds, db)
+	logging.Infof("Found %d distinct OUIs in %d addresses.", len(ranks), len(seeds))
+
+	if rankOnly {
+		var lines []string
+		for _, rank := range ranks {
+			lines = append(lines, fmt.Sprintf("%s\t%d\t%d\t%s", oui.FormatOUI(rank.OUI), rank.Count, rank.Networks, rank.Vendor))
+		}
+		for i := 0; i < len(ranks) && i < topCount; i++ {
+			logging.Successf("%s  %d addresses in %d /64 networks  %s", oui.FormatOUI(ranks[i].OUI), ranks[i].Count, ranks[i].Networks, ranks[i].Vendor)
+		}
+		if err := fs.WriteStringsToFile(lines, outputPath); err != nil {
+			logging.ErrorF(err)
+		}
+		logging.Infof("Successfully wrote OUI ranking to file '%s'.", outputPath)
+		return
+	}
+
+	ouis, err := getTargetOUIs(ouiList, vendor, db, ranks, topCount)
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	generator, err := oui.CreateEUI64Generator(ouis, seeds, spread)
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	networks, err := getEUI64Networks(fromNetwork, seeds)
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	logging.Infof("Generating %d EUI-64 addresses for %d OUIs in each of %d networks.", genCount, len(ouis), len(networks))
+
+	var generatedAddrs []addressing.IPv6
+
+	for _, network := range networks {
+		addrs, err := generator.GenerateAddressesInNetwork(random, genCount, network)
+		if err != nil {
+			logging.ErrorF(err)
+		}
+		generatedAddrs = append(generatedAddrs, addrs...)
+	}
+
+	logging.Infof("Successfully generated %d IP addresses. Writing results to file at path '%s'.", len(generatedAddrs), outputPath)
+
+	err = addressing.WriteIPsToHexFile(outputPath, generatedAddrs)
+
+	if err != nil {
+		logging.Error(err)
+	}
+
+	logging.Infof("Successfully wrote addresses to file '%s'.", outputPath)
+
+}
+
+// Get the OUIs to generate addresses for: the listed ones, the ones assigned to the vendor, or (if neither
+// were given) the most common ones in the discovered addresses
+func getTargetOUIs(ouiList string, vendor string, db *oui.Database, ranks []*oui.RankedOUI, topCount int) ([]uint32, error) {
+	if ouiList != "" {
+		return oui.ParseOUIs(ouiList)
+	} else if vendor != "" {
+		if db == nil {
+			return nil, fmt.Errorf("choosing OUIs by vendor requires an OUI database")
+		}
+		ouis := db.FindOUIs(vendor)
+		if len(ouis) == 0 {
+			return nil, fmt.Errorf("no OUIs in the database are assigned to a vendor matching '%s'", vendor)
+		}
+		logging.Infof("Found %d OUIs assigned to vendors matching '%s'.", len(ouis), vendor)
+		return ouis, nil
+	}
+	ouis := oui.GetTopOUIs(ranks, topCount)
+	if len(ouis) == 0 {
+		return nil, fmt.Errorf("no OUIs were chosen and none were found in the discovered addresses")
+	}
+	for _, rank := range ranks[:len(ouis)] {
+		logging.Infof("Using OUI %s (%d addresses) %s", oui.FormatOUI(rank.OUI), rank.Count, rank.Vendor)
+	}
+	return ouis, nil
+}
+
+// Get the networks to generate addresses in: the given network, or if there isn't one, the /64 networks
+// that the discovered addresses are in
+func getEUI64Networks(fromNetwork string, seeds []addressing.IPv6) ([]*net.IPNet, error) {
+	if fromNetwork != "" {
+		_, network, err := net.ParseCIDR(fromNetwork)
+		if err != nil {
+			return nil, err
+		}
+		return []*net.IPNet{network}, nil
+	}
+	highSet := make(map[uint64]struct{})
+	for _, seed := range seeds {
+		highSet[seed.High] = struct{}{}
+	}
+	var highs []uint64
+	for high := range highSet {
+		highs = append(highs, high)
+	}
+	sort.Slice(highs, func(i, j int) bool { return highs[i] < highs[j] })
+	var toReturn []*net.IPNet
+	for _, high := range highs {
+		toReturn = append(toReturn, addressing.GetNetworkFromUints([2]uint64{high, 0}, 64))
+	}
+	if len(toReturn) == 0 {
+		return nil, fmt.Errorf("no network was given and there are no discovered addresses to take /64 networks from")
+	}
+	return toReturn, nil
+}
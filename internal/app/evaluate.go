@@ -0,0 +1,178 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/fs"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/modeling"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+const (
+	TextReportFormat = "text"
+	JSONReportFormat = "json"
+)
+
+type EvaluateSettings struct {
+	SplitMethod       string
+	TestShare         float64
+	SplitPrefix       int
+	GeneratorTypes    []string
+	ModelPaths        []string
+	CheckCounts       []int     // ModelCheckCount values to train cluster models with
+	MinNybblePercents []float64 // ModelMinNybblePercent values to generate from cluster models with
+	Jitters           []float64
+	GenerateCount     int
+	Workers           int
+	ReportFormat      string
+}
+
+func RunEvaluate(random *rand.Rand, inputPath string, settings *EvaluateSettings, outputPath string) {
+
+	logging.Infof("Reading addresses from file at path '%s'.", inputPath)
+
+	addrs, err := fs.ReadIPsFromFile(inputPath)
+
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	train, test, err := modeling.SplitAddresses(random, addrs, settings.SplitMethod, settings.TestShare, settings.SplitPrefix)
+
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	if len(train) == 0 || len(test) == 0 {
+		logging.ErrorStringFf("Splitting %d addresses left %d to train on and %d to test against. Please supply more addresses or change the test share.", len(addrs), len(train), len(test))
+	}
+
+	logging.Infof("Split %d addresses (%s split) into %d to train on and %d to test against.", len(addrs), settings.SplitMethod, len(train), len(test))
+
+	// Cluster model settings are read from configuration while training and generating, so put them back afterwards
+
+	originalCheckCount := viper.GetInt("ModelCheckCount")
+	originalMinNybblePercent := viper.GetFloat64("ModelMinNybblePercent")
+	defer viper.Set("ModelCheckCount", originalCheckCount)
+	defer viper.Set("ModelMinNybblePercent", originalMinNybblePercent)
+
+	workers := settings.Workers
+	if workers == 0 {
+		workers = modeling.GetModelWorkerCount()
+	}
+
+	var results []*modeling.EvaluationResult
+
+	for _, generatorType := range settings.GeneratorTypes {
+		if modeling.IsSeededGeneratorType(generatorType) {
+			logging.Infof("Building %s generator from %d training addresses.", generatorType, len(train))
+			generator, err := modeling.CreateGeneratorFromSeeds(generatorType, train)
+			if err != nil {
+				logging.ErrorF(err)
+			}
+			for _, jitter := range settings.Jitters {
+				results = append(results, evaluateGenerator(random, generator, generatorType, generatorType, jitter, settings.GenerateCount, train, test))
+			}
+			continue
+		}
+		for _, checkCount := range settings.CheckCounts {
+			viper.Set("ModelCheckCount", checkCount)
+			logging.Infof("Training cluster model from %d addresses with a check count of %d.", len(train), checkCount)
+			model := modeling.CreateClusteringModelWithWorkers(train, workers)
+			name := fmt.Sprintf("%s (check count %d)", generatorType, checkCount)
+			results = append(results, evaluateClusterModel(random, model, name, settings, train, test)...)
+		}
+	}
+
+	for _, modelPath := range settings.ModelPaths {
+		logging.Infof("Loading cluster model from file at path '%s'.", modelPath)
+		model, err := modeling.LoadModelFromFile(modelPath)
+		if err != nil {
+			logging.ErrorF(err)
+		}
+		name := fmt.Sprintf("%s (%s)", modeling.ClusterGeneratorType, filepath.Base(modelPath))
+		results = append(results, evaluateClusterModel(random, model, name, settings, train, test)...)
+	}
+
+	modeling.SortEvaluationResults(results)
+
+	for _, result := range results {
+		logging.Successf("%s, jitter %.2f: %d of %d candidates hit (%.4f%%), covering %d of %d test /64s and %d of %d test /48s.", result.Name, result.Jitter, result.Hits, result.CandidateCount, result.HitRate*100, result.Covered64Count, result.Test64Count, result.Covered48Count, result.Test48Count)
+	}
+
+	report, err := formatEvaluationReport(results, settings.ReportFormat)
+
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	logging.Infof("Writing evaluation report to file at path '%s'.", outputPath)
+
+	err = ioutil.WriteFile(outputPath, report, 0644)
+
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	logging.Infof("Successfully wrote evaluation report to file '%s'.", outputPath)
+
+}
+
+// Evaluate a cluster model at every configured minimum nybble percent and jitter. The nybble distributions
+// are worked out (and kept) the first time a model generates, so every run generates from a fresh copy.
+func evaluateClusterModel(random *rand.Rand, model *modeling.ClusterModel, name string, settings *EvaluateSettings, train []addressing.IPv6, test []addressing.IPv6) []*modeling.EvaluationResult {
+	var toReturn []*modeling.EvaluationResult
+	for _, minNybblePercent := range settings.MinNybblePercents {
+		viper.Set("ModelMinNybblePercent", minNybblePercent)
+		variantName := fmt.Sprintf("%s, min nybble percent %g", name, minNybblePercent)
+		for _, jitter := range settings.Jitters {
+			copied := *model
+			toReturn = append(toReturn, evaluateGenerator(random, &copied, variantName, modeling.ClusterGeneratorType, jitter, settings.GenerateCount, train, test))
+		}
+	}
+	return toReturn
+}
+
+func evaluateGenerator(random *rand.Rand, generator modeling.Generator, name string, generatorType string, jitter float64, genCount int, train []addressing.IPv6, test []addressing.IPv6) *modeling.EvaluationResult {
+	logging.Infof("Generating %d candidate addresses from %s with a jitter of %.2f.", genCount, name, jitter)
+	candidates := generator.GenerateAddresses(random, genCount, jitter)
+	toReturn := modeling.EvaluateCandidates(candidates, train, test)
+	toReturn.Name = name
+	toReturn.Generator = generatorType
+	toReturn.Jitter = jitter
+	return toReturn
+}
+
+func formatEvaluationReport(results []*modeling.EvaluationResult, format string) ([]byte, error) {
+	switch format {
+	case JSONReportFormat:
+		return json.MarshalIndent(results, "", "  ")
+	case TextReportFormat:
+		var buffer bytes.Buffer
+		writer := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "NAME\tJITTER\tCANDIDATES\tTRAIN OVERLAP\tHITS\tHIT RATE\tRECALL\t/64 COVERAGE\t/48 COVERAGE")
+		for _, result := range results {
+			fmt.Fprintf(writer, "%s\t%.2f\t%d\t%d\t%d\t%.4f%%\t%.4f%%\t%d/%d\t%d/%d\n", result.Name, result.Jitter, result.CandidateCount, result.TrainOverlap, result.Hits, result.HitRate*100, result.Recall*100, result.Covered64Count, result.Test64Count, result.Covered48Count, result.Test48Count)
+		}
+		if err := writer.Flush(); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	default:
+		return nil, ValidateReportFormat(format)
+	}
+}
+
+func ValidateReportFormat(toCheck string) error {
+	if toCheck == TextReportFormat || toCheck == JSONReportFormat {
+		return nil
+	}
+	return fmt.Errorf("'%s' is not a valid report format (expected '%s' or '%s')", toCheck, TextReportFormat, JSONReportFormat)
+}
@@ -1,26 +1,52 @@
 package app
 
 import (
+	"github.com/ekaley/ipv666/internal/addressing"
 	"github.com/ekaley/ipv666/internal/fs"
 	"github.com/ekaley/ipv666/internal/logging"
 	"github.com/ekaley/ipv666/internal/modeling"
+	"github.com/spf13/viper"
+	"math/rand"
 )
 
-func RunModelgen(inputPath string, outputPath string) {
+func RunModelgen(random *rand.Rand, inputPath string, inputFormat string, outputPath string, workers int, corpusSize int) {
 
-	logging.Infof("Reading source addresses from file at path '%s'.", inputPath)
+	if corpusSize == 0 {
+		corpusSize = viper.GetInt("ModelCorpusSize")
+	}
+
+	if corpusSize > 0 {
+		logging.Infof("Sampling up to %d distinct source addresses from input at path '%s'.", corpusSize, inputPath)
+	} else {
+		logging.Infof("Reading distinct source addresses from input at path '%s'.", inputPath)
+	}
 
-	var err error
-	addrs, err := fs.ReadIPsFromFile(inputPath)
+	sampler := modeling.NewAddressSampler(random, corpusSize)
+	emitFreq := viper.GetInt("LogLoopEmitFreq")
+
+	err := fs.ForEachIPInInput(inputPath, inputFormat, func(addr addressing.IPv6) error {
+		sampler.Add(addr)
+		if sampler.GetSeenCount()%emitFreq == 0 {
+			logging.Infof("Read %d addresses from input '%s'.", sampler.GetSeenCount(), inputPath)
+		}
+		return nil
+	})
 
 	if err != nil {
 		logging.ErrorF(err)
 	}
-	logging.Debugf("Successfully read %d addresses from file '%s'.", len(addrs), inputPath)
 
-	logging.Infof("Building cluster set from %d addresses.", len(addrs))
+	addrs := sampler.GetAddresses()
+	logging.Debugf("Successfully read %d addresses from input '%s' and kept %d distinct addresses.", sampler.GetSeenCount(), inputPath, len(addrs))
+
+	if workers == 0 {
+		workers = modeling.GetModelWorkerCount()
+	}
+	logging.Infof("Building cluster set from %d addresses using %d workers.", len(addrs), workers)
 
-	model := modeling.CreateClusteringModel(addrs)
+	metadata := modeling.NewModelMetadata(modeling.ClusterGeneratorType, addrs)
+	model := modeling.CreateClusteringModelWithWorkers(addrs, workers)
+	model.Metadata = metadata
 
 	logging.Infof("Done generating model. Now writing to output path at '%s'.", outputPath)
 
@@ -33,3 +59,54 @@ func RunModelgen(inputPath string, outputPath string) {
 	logging.Successf("Successfully generated model and wrote results to file '%s'.", outputPath)
 
 }
+
+func RunModelMerge(modelPaths []string, outputPath string) {
+
+	var models []*modeling.ClusterModel
+
+	for _, modelPath := range modelPaths {
+		logging.Infof("Loading cluster model from file at path '%s'.", modelPath)
+		model, err := modeling.LoadModelFromFile(modelPath)
+		if err != nil {
+			logging.ErrorF(err)
+		}
+		models = append(models, model)
+	}
+
+	model, err := modeling.MergeModels(models)
+
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	logging.Infof("Done merging %d models. Now writing to output path at '%s'.", len(models), outputPath)
+
+	err = model.Save(outputPath)
+
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	logging.Successf("Successfully merged models into %d clusters and wrote results to file '%s'.", len(model.ClusterSet.Clusters), outputPath)
+
+}
+
+func RunModelMigrate(inputPath string, outputPath string) {
+
+	model, err := loadClusterModel(inputPath)
+
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	logging.Infof("Writing model with %d clusters in model file format version %d to path '%s'.", len(model.ClusterSet.Clusters), modeling.ModelFileFormatVersion, outputPath)
+
+	err = model.Save(outputPath)
+
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	logging.Successf("Successfully migrated model and wrote results to file '%s'.", outputPath)
+
+}
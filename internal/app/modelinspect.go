@@ -0,0 +1,157 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ekaley/ipv666/internal/fs"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/modeling"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func RunModelInspect(modelPath string, topCount int, asJSON bool, outputPath string) {
+
+	model, err := loadClusterModel(modelPath)
+
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	logging.Successf("Model version %d has %d clusters capturing %d addresses in a range of %d (density %f).", model.Version, len(model.ClusterSet.Clusters), model.ClusterSet.Captured, model.ClusterSet.RangeSize, model.ClusterSet.Density)
+
+	if asJSON {
+		logging.Infof("Exporting model to JSON at path '%s'.", outputPath)
+		if err := model.SaveJSON(outputPath); err != nil {
+			logging.ErrorF(err)
+		}
+		logging.Infof("Successfully exported model to file '%s'.", outputPath)
+		return
+	}
+
+	report, err := formatModelReport(model, topCount)
+
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	logging.Infof("Writing model report to file at path '%s'.", outputPath)
+
+	if err := fs.WriteStringsToFile(report, outputPath); err != nil {
+		logging.ErrorF(err)
+	}
+
+	logging.Infof("Successfully wrote model report to file '%s'.", outputPath)
+
+}
+
+func RunModelImport(inputPath string, outputPath string) {
+
+	logging.Infof("Importing model from JSON file at path '%s'.", inputPath)
+
+	model, err := modeling.LoadModelFromJSONFile(inputPath)
+
+	if err != nil {
+		logging.ErrorF(err)
+	}
+
+	logging.Infof("Imported model with %d clusters. Now writing to output path at '%s'.", len(model.ClusterSet.Clusters), outputPath)
+
+	if err := model.Save(outputPath); err != nil {
+		logging.ErrorF(err)
+	}
+
+	logging.Successf("Successfully imported model and wrote it to file '%s'.", outputPath)
+
+}
+
+// Describe the model's clusters (the densest first, up to topCount of them if it is above zero) and the
+// distribution of nybbles in its stardust
+func formatModelReport(model *modeling.ClusterModel, topCount int) ([]string, error) {
+	clusters := model.GetClustersByDensity()
+	toReturn := []string{
+		fmt.Sprintf("Model version %d", model.Version),
+		fmt.Sprintf("Clusters: %d", len(clusters)),
+		fmt.Sprintf("Captured: %d", model.ClusterSet.Captured),
+		fmt.Sprintf("Range size: %d", model.ClusterSet.RangeSize),
+		fmt.Sprintf("Density: %f", model.ClusterSet.Density),
+	}
+	toReturn = append(toReturn, formatModelMetadata(model.Metadata)...)
+	toReturn = append(toReturn, "")
+	if topCount > 0 && topCount < len(clusters) {
+		toReturn = append(toReturn, fmt.Sprintf("Clusters (the %d densest of %d):", topCount, len(clusters)))
+		clusters = clusters[:topCount]
+	} else {
+		toReturn = append(toReturn, "Clusters (densest first):")
+	}
+	clusterRows := []string{"PATTERN\tCAPTURED\tSIZE\tDENSITY"}
+	for _, cluster := range clusters {
+		clusterRows = append(clusterRows, fmt.Sprintf("%s\t%d\t%d\t%f", cluster.Range.GetPattern(), cluster.Captured, cluster.Size, cluster.Density))
+	}
+	clusterTable, err := formatTable(clusterRows)
+	if err != nil {
+		return nil, err
+	}
+	toReturn = append(toReturn, clusterTable...)
+	toReturn = append(toReturn, "", "Stardust nybble counts (by position in the address):")
+	header := []string{"POSITION"}
+	for nybble := 0; nybble < 16; nybble++ {
+		header = append(header, fmt.Sprintf("%x", nybble))
+	}
+	histogramRows := []string{strings.Join(append(header, "TOTAL"), "\t")}
+	for position, counts := range model.GetNybbleHistogram() {
+		row := []string{fmt.Sprintf("%d", position)}
+		total := 0
+		for _, count := range counts {
+			row = append(row, fmt.Sprintf("%d", count))
+			total += count
+		}
+		histogramRows = append(histogramRows, strings.Join(append(row, fmt.Sprintf("%d", total)), "\t"))
+	}
+	histogramTable, err := formatTable(histogramRows)
+	if err != nil {
+		return nil, err
+	}
+	return append(toReturn, histogramTable...), nil
+}
+
+// Describe what the model file said about how the model was trained
+func formatModelMetadata(metadata *modeling.ModelMetadata) []string {
+	if metadata == nil {
+		return []string{"Metadata: none (the model file is from before model file headers were added)"}
+	}
+	toReturn := []string{
+		fmt.Sprintf("Generator type: %s", metadata.GeneratorType),
+		fmt.Sprintf("Created at: %s", metadata.CreatedAt.Format(time.RFC3339)),
+	}
+	if metadata.InputSize > 0 {
+		toReturn = append(toReturn, fmt.Sprintf("Training addresses: %d", metadata.InputSize))
+	}
+	if metadata.TrainingHash != "" {
+		toReturn = append(toReturn, fmt.Sprintf("Training set hash: %s", metadata.TrainingHash))
+	}
+	var keys []string
+	for key := range metadata.Parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		toReturn = append(toReturn, fmt.Sprintf("Training parameter %s: %s", key, metadata.Parameters[key]))
+	}
+	return toReturn
+}
+
+// Line up the tab-separated columns of the rows
+func formatTable(rows []string) ([]string, error) {
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(writer, row)
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(buffer.String(), "\n"), "\n"), nil
+}
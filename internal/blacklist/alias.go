@@ -11,14 +11,14 @@ import (
 )
 
 type AliasCheckState struct {
-	baseAddress   *net.IP
+	baseAddress   addressing.IPv6
 	leftPosition  uint8
 	rightPosition uint8
 	found         bool
-	testAddr      *net.IP
+	testAddr      addressing.IPv6
 }
 
-func NewAliasCheckState(addr *net.IP, left uint8, right uint8) (*AliasCheckState, error) {
+func NewAliasCheckState(addr addressing.IPv6, left uint8, right uint8) (*AliasCheckState, error) {
 	if right > 127 {
 		return nil, errors.New(fmt.Sprintf("Right must be less than 128 (got %d).", right))
 	}
@@ -30,7 +30,6 @@ func NewAliasCheckState(addr *net.IP, left uint8, right uint8) (*AliasCheckState
 		leftPosition:  left,
 		rightPosition: right,
 		found:         false,
-		testAddr:      nil,
 	}
 	return toReturn, nil
 }
@@ -51,12 +50,12 @@ func (state *AliasCheckState) GetFound() bool {
 }
 
 // Get the IPv6 address being used to test against for this alias check
-func (state *AliasCheckState) GetTestAddr() *net.IP {
+func (state *AliasCheckState) GetTestAddr() addressing.IPv6 {
 	return state.testAddr
 }
 
 // Get the base IPv6 address that is being permuted against for this alias check
-func (state *AliasCheckState) GetBaseAddress() *net.IP {
+func (state *AliasCheckState) GetBaseAddress() addressing.IPv6 {
 	return state.baseAddress
 }
 
@@ -110,12 +109,11 @@ func (state *AliasCheckState) GenerateTestAddress() {
 	state.testAddr = addressing.FlipBitsInAddress(state.baseAddress, state.GetLeftTestIndex(), state.GetRightTestIndex())
 }
 
-func (state *AliasCheckState) Update(foundAddrs map[string]*internal.Empty) {
-	// TODO for set membership checks, i'm guessing strings are expensive. how about 128bit int?
+func (state *AliasCheckState) Update(foundAddrs map[addressing.IPv6]internal.Empty) {
 	// TODO by only checking for a single address, we risk marking ranges as aliased when they aren't. small amount of error, but could be a lot of effort to fix.
 	// TODO as we iterate checking different values we're going to duplicate work (as /96s that are unique at first are both part of the same /64, etc)
 
-	if _, ok := foundAddrs[state.testAddr.String()]; ok {
+	if _, ok := foundAddrs[state.testAddr]; ok {
 		// The bit flipped address responded, meaning the range is aliased
 		state.rightPosition = state.GetLeftTestIndex()
 	} else {
@@ -128,9 +126,6 @@ func (state *AliasCheckState) Update(foundAddrs map[string]*internal.Empty) {
 		state.found = true
 	}
 
-	// Empty out the list of test addresses to preserve memory
-	state.testAddr = nil
-
 }
 
 func (state *AliasCheckState) GetAliasedNetwork() (*net.IPNet, error) {
@@ -147,7 +142,7 @@ type AliasCheckStates struct {
 	checks []*AliasCheckState
 }
 
-func NewAliasCheckStates(addrs []*net.IP, left uint8, right uint8) (*AliasCheckStates, error) {
+func NewAliasCheckStates(addrs []addressing.IPv6, left uint8, right uint8) (*AliasCheckStates, error) {
 	var checkStates []*AliasCheckState
 	for _, addr := range addrs {
 		newState, err := NewAliasCheckState(addr, left, right)
@@ -185,9 +180,9 @@ func (states *AliasCheckStates) GenerateTestAddresses() {
 }
 
 // TODO unit test
-func (states *AliasCheckStates) GetTestAddresses() []*net.IP {
+func (states *AliasCheckStates) GetTestAddresses() []addressing.IPv6 {
 	states.GenerateTestAddresses()
-	var toReturn []*net.IP
+	var toReturn []addressing.IPv6
 	for _, check := range states.checks {
 		if !check.found {
 			toReturn = append(toReturn, check.GetTestAddr())
@@ -215,7 +210,7 @@ func (states *AliasCheckStates) GetAliasedNetworks() ([]*net.IPNet, error) {
 	return toReturn, nil
 }
 
-func (states *AliasCheckStates) Update(foundAddrs map[string]*internal.Empty) {
+func (states *AliasCheckStates) Update(foundAddrs map[addressing.IPv6]internal.Empty) {
 	for _, check := range states.checks {
 		if !check.found {
 			check.Update(foundAddrs)
@@ -223,6 +218,43 @@ func (states *AliasCheckStates) Update(foundAddrs map[string]*internal.Empty) {
 	}
 }
 
+// A snapshot of the progress of a single alias check, used to resume alias checking later on
+type AliasCheckRecord struct {
+	BaseAddress addressing.IPv6 `msgpack:"b" json:"base_address"`
+	Left        uint8           `msgpack:"l" json:"left"`
+	Right       uint8           `msgpack:"r" json:"right"`
+	Found       bool            `msgpack:"f" json:"found"`
+}
+
+func (states *AliasCheckStates) GetRecords() []*AliasCheckRecord {
+	var toReturn []*AliasCheckRecord
+	for _, check := range states.checks {
+		toReturn = append(toReturn, &AliasCheckRecord{
+			BaseAddress: check.baseAddress,
+			Left:        check.leftPosition,
+			Right:       check.rightPosition,
+			Found:       check.found,
+		})
+	}
+	return toReturn
+}
+
+// Recreate alias check states from the records returned by GetRecords
+func NewAliasCheckStatesFromRecords(records []*AliasCheckRecord) *AliasCheckStates {
+	var checkStates []*AliasCheckState
+	for _, record := range records {
+		checkStates = append(checkStates, &AliasCheckState{
+			baseAddress:   record.BaseAddress,
+			leftPosition:  record.Left,
+			rightPosition: record.Right,
+			found:         record.Found,
+		})
+	}
+	return &AliasCheckStates{
+		checks: checkStates,
+	}
+}
+
 func (states *AliasCheckStates) PrintAliasedNetworks() error {
 	networks, err := states.GetAliasedNetworks()
 	if err != nil {
@@ -1,5 +1,37 @@
 package blacklist
 
+import (
+	"github.com/ekaley/ipv666/internal"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/persist"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAliasCheckStates_RecordsRoundTrip(t *testing.T) {
+	addr1, _ := addressing.ParseIPv6("aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa")
+	addr2, _ := addressing.ParseIPv6("aaaa:aaaa:aaaa:aaaa:ffff:ffff:ffff:ffff")
+	acs, err := NewAliasCheckStates([]addressing.IPv6{addr1, addr2}, 10, 97)
+	assert.Nil(t, err)
+	acs.GetTestAddresses()
+	acs.Update(map[addressing.IPv6]internal.Empty{acs.checks[0].GetTestAddr(): {}})
+	acs.checks[1].found = true
+
+	b, err := persist.Marshal(acs.GetRecords())
+	assert.Nil(t, err)
+	var records []*AliasCheckRecord
+	assert.Nil(t, persist.Unmarshal(b, &records))
+	restored := NewAliasCheckStatesFromRecords(records)
+	assert.Equal(t, acs.GetChecksCount(), restored.GetChecksCount())
+	assert.Equal(t, 1, restored.GetFoundCount())
+	assert.Equal(t, acs.GetTestAddresses(), restored.GetTestAddresses())
+	for i, check := range acs.checks {
+		assert.Equal(t, check.GetBaseAddress(), restored.checks[i].GetBaseAddress())
+		assert.Equal(t, check.GetLeft(), restored.checks[i].GetLeft())
+		assert.Equal(t, check.GetRight(), restored.checks[i].GetRight())
+	}
+}
+
 //func getTestAddress() (*net.IP) {
 //	toReturn := net.ParseIP("2001:0:4137:9e76:38c1:3e16:6ac9:506a")
 //	return &toReturn
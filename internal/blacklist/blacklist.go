@@ -91,8 +91,8 @@ func (blacklist *NetworkBlacklist) AddNetwork(toAdd *net.IPNet) bool {
 
 }
 
-func (blacklist *NetworkBlacklist) CleanIPList(toClean []*net.IP, emitFreq int) []*net.IP {
-	var toReturn []*net.IP
+func (blacklist *NetworkBlacklist) CleanIPList(toClean []addressing.IPv6, emitFreq int) []addressing.IPv6 {
+	var toReturn []addressing.IPv6
 	for i, curClean := range toClean {
 		if i%emitFreq == 0 && i != 0 {
 			logging.Debugf("Cleaning entry %d out of %d.", i, len(toClean))
@@ -109,12 +109,9 @@ func (blacklist *NetworkBlacklist) updateMaskLengths(maskLength int) {
 	sort.Ints(blacklist.maskLengths)
 }
 
-func (blacklist *NetworkBlacklist) getNetworkFromAddress(toTest *net.IP) ([2]uint64, int, bool) {
+func (blacklist *NetworkBlacklist) getNetworkFromAddress(toTest addressing.IPv6) ([2]uint64, int, bool) {
 
-	ipUints := [2]uint64{
-		binary.BigEndian.Uint64((*toTest)[0:8]),
-		binary.BigEndian.Uint64((*toTest)[8:16]),
-	}
+	ipUints := [2]uint64{toTest.High, toTest.Low}
 
 	// Check the IP against each network length
 	for _, maskLength := range blacklist.maskLengths {
@@ -143,12 +140,12 @@ func (blacklist *NetworkBlacklist) IsNetworkBlacklisted(toTest *net.IPNet) bool
 	return blacklist.IsIPBlacklisted(top) && blacklist.IsIPBlacklisted(bottom)
 }
 
-func (blacklist *NetworkBlacklist) IsIPBlacklisted(toTest *net.IP) bool {
+func (blacklist *NetworkBlacklist) IsIPBlacklisted(toTest addressing.IPv6) bool {
 	_, _, found := blacklist.getNetworkFromAddress(toTest)
 	return found
 }
 
-func (blacklist *NetworkBlacklist) GetBlacklistingNetworkFromIP(toTest *net.IP) *net.IPNet {
+func (blacklist *NetworkBlacklist) GetBlacklistingNetworkFromIP(toTest addressing.IPv6) *net.IPNet {
 	uints, length, found := blacklist.getNetworkFromAddress(toTest)
 	if !found {
 		return nil
@@ -171,6 +168,31 @@ func (blacklist *NetworkBlacklist) GetBlacklistingNetworkFromNetwork(toTest *net
 	}
 }
 
+// A set of blacklists that blacklists whatever any one of them does
+type Blacklists []*NetworkBlacklist
+
+func (blacklists Blacklists) IsNetworkBlacklisted(toTest *net.IPNet) bool {
+	return blacklists.GetBlacklistingNetworkFromNetwork(toTest) != nil
+}
+
+func (blacklists Blacklists) IsIPBlacklisted(toTest addressing.IPv6) bool {
+	for _, blacklist := range blacklists {
+		if blacklist.IsIPBlacklisted(toTest) {
+			return true
+		}
+	}
+	return false
+}
+
+func (blacklists Blacklists) GetBlacklistingNetworkFromNetwork(toTest *net.IPNet) *net.IPNet {
+	for _, blacklist := range blacklists {
+		if network := blacklist.GetBlacklistingNetworkFromNetwork(toTest); network != nil {
+			return network
+		}
+	}
+	return nil
+}
+
 func (blacklist *NetworkBlacklist) GetCount() int {
 	return blacklist.count
 }
@@ -3,6 +3,7 @@ package blacklist
 import (
 	"github.com/ekaley/ipv666/internal/addressing"
 	"github.com/stretchr/testify/assert"
+	"math/rand"
 	"net"
 	"testing"
 )
@@ -645,7 +646,7 @@ func TestNetworkBlacklist_AddNetworkLongLongFails(t *testing.T) {
 func TestNetworkBlacklist_AddNetworkWith100Fails(t *testing.T) {
 	_, net1, _ := net.ParseCIDR("2001:0:4137:9e76:101c:b89:ce63:392a/96")
 	_, net2, _ := net.ParseCIDR("2001:0:4137:9e76:101c:b89:ce63:392a/96")
-	nets := addressing.GenerateRandomNetworks(99, 96)
+	nets := addressing.GenerateRandomNetworks(rand.New(rand.NewSource(666)), 99, 96)
 	nets = append(nets, net1)
 	blacklist := NewNetworkBlacklist(nets)
 	added := blacklist.AddNetwork(net2)
@@ -655,7 +656,7 @@ func TestNetworkBlacklist_AddNetworkWith100Fails(t *testing.T) {
 func TestNetworkBlacklist_AddNetworkWith1000Fails(t *testing.T) {
 	_, net1, _ := net.ParseCIDR("2001:0:4137:9e76:101c:b89:ce63:392a/96")
 	_, net2, _ := net.ParseCIDR("2001:0:4137:9e76:101c:b89:ce63:392a/96")
-	nets := addressing.GenerateRandomNetworks(999, 96)
+	nets := addressing.GenerateRandomNetworks(rand.New(rand.NewSource(666)), 999, 96)
 	nets = append(nets, net1)
 	blacklist := NewNetworkBlacklist(nets)
 	added := blacklist.AddNetwork(net2)
@@ -665,7 +666,7 @@ func TestNetworkBlacklist_AddNetworkWith1000Fails(t *testing.T) {
 func TestNetworkBlacklist_AddNetworkWith10000Fails(t *testing.T) {
 	_, net1, _ := net.ParseCIDR("2001:0:4137:9e76:101c:b89:ce63:392a/96")
 	_, net2, _ := net.ParseCIDR("2001:0:4137:9e76:101c:b89:ce63:392a/96")
-	nets := addressing.GenerateRandomNetworks(9999, 96)
+	nets := addressing.GenerateRandomNetworks(rand.New(rand.NewSource(666)), 9999, 96)
 	nets = append(nets, net1)
 	blacklist := NewNetworkBlacklist(nets)
 	added := blacklist.AddNetwork(net2)
@@ -676,7 +677,7 @@ func TestNetworkBlacklist_IsIPBlacklistedLongNetwork(t *testing.T) {
 	_, net1, _ := net.ParseCIDR("2001:0:4137:9e76:101c:b89:ce63:392a/96")
 	blacklist := NewNetworkBlacklist([]*net.IPNet{net1})
 	ip := net.ParseIP("2001:0:4137:9e76:101c:b89:ffff:392a")
-	isBlacklisted := blacklist.IsIPBlacklisted(&ip)
+	isBlacklisted := blacklist.IsIPBlacklisted(addressing.NewIPv6(ip))
 	assert.True(t, isBlacklisted)
 }
 
@@ -684,6 +685,6 @@ func TestNetworkBlacklist_IsIPBlacklistedShortNetwork(t *testing.T) {
 	_, net1, _ := net.ParseCIDR("2001:0:4137:9e76:101c:b89::/96")
 	blacklist := NewNetworkBlacklist([]*net.IPNet{net1})
 	ip := net.ParseIP("2001:0:4137:9e76:101c:b89:ffff:392a")
-	isBlacklisted := blacklist.IsIPBlacklisted(&ip)
+	isBlacklisted := blacklist.IsIPBlacklisted(addressing.NewIPv6(ip))
 	assert.True(t, isBlacklisted)
 }
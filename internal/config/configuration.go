@@ -8,6 +8,7 @@ import (
 	"net"
 	"path"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -27,8 +28,9 @@ func InitConfig() {
 	viper.BindEnv("CleanPingResultDirectory")    // Subdirectory where cleaned ping results are kept
 	viper.BindEnv("AliasedNetworkDirectory")     // Subdirectory where aliased network results are kept
 	viper.BindEnv("BloomFilterDirectory")        // Subdirectory where the Bloom filter is kept
-	viper.BindEnv("StateFileName")               // The file name for the file that contains the current state
-	viper.BindEnv("TargetNetworkFileName")       // The file name for the file that contains the last network that was targeted
+	viper.BindEnv("ICMPErrorDirectory")          // Subdirectory where ICMPv6 errors received during scans are kept
+	viper.BindEnv("UnroutedNetworkDirectory")    // Subdirectory where the running tally of unrouted networks is kept
+	viper.BindEnv("CheckpointFileName")          // The file name for the checkpoint document that records the progress of the current run
 	viper.BindEnv("CloudSyncOptInPath")          // Cloud sync opt-in status file path
 	viper.BindEnv("CloudSyncOptIn")              // Cloud sync opt-in status
 
@@ -48,28 +50,49 @@ func InitConfig() {
 	viper.SetDefault("CleanPingResultDirectory", "cleanpings")
 	viper.SetDefault("AliasedNetworkDirectory", "aliasednets")
 	viper.SetDefault("BloomFilterDirectory", "bloom")
-	viper.SetDefault("StateFileName", "state.bin")
-	viper.SetDefault("TargetNetworkFileName", "network.bin")
+	viper.SetDefault("ICMPErrorDirectory", "icmperrors")
+	viper.SetDefault("UnroutedNetworkDirectory", "unroutednets")
+	viper.SetDefault("CheckpointFileName", "checkpoint.json")
 	viper.SetDefault("CloudSyncOptInPath", ".cloudsyncoptin")
 	viper.SetDefault("CloudSyncOptIn", false)
 
 	// Candidate address generation
 
 	viper.BindEnv("GenerateAddressCount") // How many addressing to generate in a given iteration
+	viper.BindEnv("RandomSeed")           // The seed for all randomness in generation and alias checking so that runs can be reproduced (0 seeds from the clock)
 
 	viper.SetDefault("GenerateAddressCount", 1000000)
+	viper.SetDefault("RandomSeed", 0)
 
 	// Modeling
 
-	viper.BindEnv("ModelGenerationJitter") // The default jitter (ie: % likelihood of a random wildcard) to use when generating new addresses
-	viper.BindEnv("ModelCheckCount")       // The number of upgrades to wait between checking for cluster model improvement
-	viper.BindEnv("ModelMinNybblePercent") // The minimum percent probability of a nybble occurring in a cluster model
-	viper.BindEnv("ModelDistributionSize") // The size of startdust distributions used for random nybble generation
+	viper.BindEnv("ModelGenerationJitter")  // The default jitter (ie: % likelihood of a random wildcard) to use when generating new addresses
+	viper.BindEnv("ModelCheckCount")        // The number of upgrades to wait between checking for cluster model improvement
+	viper.BindEnv("ModelMinNybblePercent")  // The minimum percent probability of a nybble occurring in a cluster model
+	viper.BindEnv("ModelDistributionSize")  // The size of startdust distributions used for random nybble generation
+	viper.BindEnv("ModelGenerationWorkers") // The number of workers to use when building cluster models (0 uses one per CPU)
+	viper.BindEnv("ModelCorpusSize")        // The most distinct addresses to sample from an input when building cluster models (0 uses them all)
 
 	viper.SetDefault("ModelGenerationJitter", 0.1) //TODO figure out why configuration stuff isn't working with cobra's bindpflags
 	viper.SetDefault("ModelCheckCount", 10000)
 	viper.SetDefault("ModelMinNybblePercent", 0.01)
 	viper.SetDefault("ModelDistributionSize", 1000)
+	viper.SetDefault("ModelGenerationWorkers", 0)
+	viper.SetDefault("ModelCorpusSize", 0)
+
+	// Candidate generators
+
+	viper.BindEnv("CandidateGenerator")        // The generator to create candidate addresses with during discovery (cluster, spacetree or entropyip)
+	viper.BindEnv("GeneratorSeedFile")         // The path to a file of seed addresses to build seeded generators from in addition to the discovered addresses
+	viper.BindEnv("SpaceTreeLeafSize")         // The most seed addresses a space tree region can hold before it is split
+	viper.BindEnv("EntropyIPSegmentThreshold") // The change in normalized nybble entropy that starts a new segment in entropy models
+	viper.BindEnv("EntropyIPMinValueShare")    // The share of seeds a segment value must appear in to be kept as a value of its own in entropy models
+
+	viper.SetDefault("CandidateGenerator", "cluster")
+	viper.SetDefault("GeneratorSeedFile", "")
+	viper.SetDefault("SpaceTreeLeafSize", 16)
+	viper.SetDefault("EntropyIPSegmentThreshold", 0.1)
+	viper.SetDefault("EntropyIPMinValueShare", 0.05)
 
 	// Existing address bloom filter
 
@@ -91,21 +114,29 @@ func InitConfig() {
 	viper.SetDefault("NetworkPingCount", 6)
 	viper.SetDefault("NetworkBlacklistPercent", 0.5)
 
-	// Blacklist candidate generation
+	// Unrouted network tracking
 
-	viper.BindEnv("BlacklistFlushInterval") // The frequency with which to write newly-generate blacklist candidate addresses to disk
+	viper.BindEnv("UnroutedNetworkLength")    // The bit-length of networks to tally "no route" errors against
+	viper.BindEnv("UnroutedNetworkThreshold") // The number of scans that must report "no route" for a network before candidates are no longer generated in it
+	viper.BindEnv("UnroutedRejectMultiple")   // The multiple of a target's address generation size that may be rejected as unrouted before generation in the target is given up on
 
-	viper.SetDefault("BlacklistFlushInterval", 500000)
+	viper.SetDefault("UnroutedNetworkLength", 48)
+	viper.SetDefault("UnroutedNetworkThreshold", 3)
+	viper.SetDefault("UnroutedRejectMultiple", 2.0)
 
 	// Fan-out ping-scanning
 	viper.BindEnv("FanOutNetworkBlockSize") // Number of contiguous neighboring /64 networks to attempt
 	viper.BindEnv("FanOutHostBlockSize")    // Number of contiguous hosts to attempt, monotonically increasing from each /64
 	viper.BindEnv("FanOutMaxNetworks")      // Maximum networks to attempt during fan-out scanning
 	viper.BindEnv("FanOutMaxHosts")         // Maximum hosts to attempt during fan-out scanning
+	viper.BindEnv("FanOutPatternRulesFile") // The path to a file of interface identifier pattern rules (the built-in rules are used if empty)
+	viper.BindEnv("FanOutPatternMaxHosts")  // Maximum hosts to attempt during pattern fan-out scanning
 	viper.SetDefault("FanOutNetworkBlockSize", 1000)
 	viper.SetDefault("FanOutHostBlockSize", 500)
 	viper.SetDefault("FanOutMaxNetworks", 2000000)
 	viper.SetDefault("FanOutMaxHosts", 100000)
+	viper.SetDefault("FanOutPatternRulesFile", "")
+	viper.SetDefault("FanOutPatternMaxHosts", 500000)
 
 	// Logging
 
@@ -131,9 +162,40 @@ func InitConfig() {
 
 	viper.BindEnv("PingScanBandwidth") // The maximum bandwidth to use for ping scanning
 	viper.BindEnv("ScanTargetNetwork") // The default network to scan
+	viper.BindEnv("PingScanReplyWait") // The time in milliseconds to wait for a reply to a probe before retransmitting it or giving up
+	viper.BindEnv("PingScanRetries")   // The number of times to retransmit a probe that has not been answered
+	viper.BindEnv("ProbeType")         // The type of probe to scan with (icmp, tcp-syn:<comma-separated ports> or udp[:<comma-separated ports>])
+
+	viper.BindEnv("ScanTargetNetworks")     // A comma-separated list of networks to discover addresses in, each optionally followed by @<weight> (overrides ScanTargetNetwork)
+	viper.BindEnv("ScanTargetNetworksFile") // The path to a file listing networks to discover addresses in, one per line in the same format as ScanTargetNetworks
+	viper.BindEnv("TargetStatsFileName")    // The file name for the file that records the candidates scanned and hits found in each target network
 
 	viper.SetDefault("PingScanBandwidth", "20M")
 	viper.SetDefault("ScanTargetNetwork", "2000::/4")
+	viper.SetDefault("PingScanReplyWait", 5000)
+	viper.SetDefault("PingScanRetries", 0)
+	viper.SetDefault("ProbeType", "icmp")
+	viper.SetDefault("ScanTargetNetworks", "")
+	viper.SetDefault("ScanTargetNetworksFile", "")
+	viper.SetDefault("TargetStatsFileName", "target_stats.json")
+
+	// Region budgets
+
+	viper.BindEnv("RegionPrefixLength")     // The prefix length of the regions that hit rates are tracked for (must be divisible by 4)
+	viper.BindEnv("RegionExplorationShare") // The share of each target network's candidates that are generated across the whole network rather than in productive regions
+	viper.BindEnv("RegionMaxExploited")     // The maximum number of productive regions that candidates are directed to in a single round
+	viper.BindEnv("RegionStatsFileName")    // The file name for the file that records the candidates scanned and hits found in each region
+
+	viper.SetDefault("RegionPrefixLength", 48)
+	viper.SetDefault("RegionExplorationShare", 0.2)
+	viper.SetDefault("RegionMaxExploited", 256)
+	viper.SetDefault("RegionStatsFileName", "region_stats.json")
+
+	// Model updates
+
+	viper.BindEnv("ModelUpdateEnabled") // Whether or not to fold discovered addresses into the cluster model after each loop
+
+	viper.SetDefault("ModelUpdateEnabled", true)
 
 	// Clean Up
 
@@ -182,7 +244,7 @@ func InitConfig() {
 	// Alias Detection
 
 	viper.BindEnv("AliasLeftIndexStart")     // The left-most index for CIDR mask lengths where aliased network detection should start
-	viper.BindEnv("AliasDuplicateScanCount") // The number of times a single address should be scanned when checking for aliased networks
+	viper.BindEnv("AliasDuplicateScanCount") // The maximum number of times a single address should be probed when checking for aliased networks
 
 	viper.SetDefault("AliasLeftIndexStart", 0)
 	viper.SetDefault("AliasDuplicateScanCount", 3)
@@ -216,12 +278,16 @@ func GetOutputFilePath() string {
 	return fmt.Sprintf("%s.%s", viper.GetString("OutputFileName"), viper.GetString("OutputFileType"))
 }
 
-func GetStateFilePath() string {
-	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("StateFileName"))
+func GetCheckpointFilePath() string {
+	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("CheckpointFileName"))
+}
+
+func GetTargetStatsFilePath() string {
+	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("TargetStatsFileName"))
 }
 
-func GetTargetNetworkFilePath() string {
-	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("TargetNetworkFileName"))
+func GetRegionStatsFilePath() string {
+	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("RegionStatsFileName"))
 }
 
 func GetGeneratedModelDirPath() string {
@@ -264,6 +330,29 @@ func GetBloomDirPath() string {
 	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("BloomFilterDirectory"))
 }
 
+// Get the directory that the Bloom filter for a single target network is kept in
+func GetBloomDirPathForTarget(network *net.IPNet) string {
+	return filepath.Join(GetBloomDirPath(), getTargetDirName(network))
+}
+
+// Get the directory that the blacklist for a single target network is kept in
+func GetNetworkBlacklistDirPathForTarget(network *net.IPNet) string {
+	return filepath.Join(GetNetworkBlacklistDirPath(), getTargetDirName(network))
+}
+
+// Get the name of the directory that the state kept for a single target network goes in
+func getTargetDirName(network *net.IPNet) string {
+	return strings.NewReplacer(":", "-", "/", "_").Replace(network.String())
+}
+
+func GetICMPErrorDirPath() string {
+	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("ICMPErrorDirectory"))
+}
+
+func GetUnroutedNetworkDirPath() string {
+	return filepath.Join(viper.GetString("BaseOutputDirectory"), viper.GetString("UnroutedNetworkDirectory"))
+}
+
 func GetAllDirectories() []string {
 	return []string{
 		viper.GetString("BaseOutputDirectory"),
@@ -277,6 +366,8 @@ func GetAllDirectories() []string {
 		GetCleanPingDirPath(),
 		GetAliasedNetworkDirPath(),
 		GetBloomDirPath(),
+		GetICMPErrorDirPath(),
+		GetUnroutedNetworkDirPath(),
 	}
 }
 
@@ -292,6 +383,8 @@ func GetAllExportDirectories() []string {
 		GetCleanPingDirPath(),
 		GetAliasedNetworkDirPath(),
 		GetBloomDirPath(),
+		GetICMPErrorDirPath(),
+		GetUnroutedNetworkDirPath(),
 	}
 }
 
@@ -1,10 +1,69 @@
 package config
 
+import (
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
 func init() {
 	InitConfig()
 }
 
-//TODO add tests for getting target network
+func TestParseTargetNetwork_Weight(t *testing.T) {
+	target, err := ParseTargetNetwork(" 2600:1234::/32@2.5 ")
+	assert.Nil(t, err)
+	assert.Equal(t, "2600:1234::/32", target.String())
+	assert.Equal(t, 2.5, target.Weight)
+	target, err = ParseTargetNetwork("2600:1234::/32")
+	assert.Nil(t, err)
+	assert.Equal(t, 1.0, target.Weight)
+}
+
+func TestParseTargetNetwork_Invalid(t *testing.T) {
+	for _, toParse := range []string{"2600:1234::/32@0", "2600:1234::/32@x", "10.0.0.0/8", "2600:1234::"} {
+		_, err := ParseTargetNetwork(toParse)
+		assert.NotNil(t, err, toParse)
+	}
+}
+
+func TestGetTargetNetworks_FallsBackToSingleNetwork(t *testing.T) {
+	viper.Set("ScanTargetNetworks", "")
+	viper.Set("ScanTargetNetworksFile", "")
+	viper.Set("ScanTargetNetwork", "2600::/16")
+	defer viper.Set("ScanTargetNetwork", "2000::/4")
+	targets, err := GetTargetNetworks()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(targets))
+	assert.Equal(t, "2600::/16", targets[0].String())
+}
+
+func TestGetTargetNetworks_FileAndList(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "targets")
+	assert.Nil(t, ioutil.WriteFile(filePath, []byte("# customers\n2600:1::/32@3\n\n2600:2::/32\n"), 0644))
+	viper.Set("ScanTargetNetworksFile", filePath)
+	viper.Set("ScanTargetNetworks", "2600:3::/32@0.5")
+	defer viper.Set("ScanTargetNetworksFile", "")
+	defer viper.Set("ScanTargetNetworks", "")
+	targets, err := GetTargetNetworks()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(targets))
+	assert.Equal(t, "2600:1::/32", targets[0].String())
+	assert.Equal(t, 3.0, targets[0].Weight)
+	assert.Equal(t, "2600:3::/32", targets[2].String())
+	assert.Equal(t, targets[1], GetTargetNetworkForIP(targets, targets[1].Network.IP))
+	assert.Nil(t, GetTargetNetworkForIP(targets, net.ParseIP("2700::1")))
+}
+
+func TestGetTargetNetworks_Overlapping(t *testing.T) {
+	viper.Set("ScanTargetNetworks", "2600::/16,2600:1234::/32")
+	defer viper.Set("ScanTargetNetworks", "")
+	_, err := GetTargetNetworks()
+	assert.NotNil(t, err)
+}
 
 //
 //func TestConfiguration_SetTargetNetworkSets(t *testing.T) {
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A network to discover addresses in, along with how much of the candidate budget it should get
+// relative to the other target networks
+type TargetNetwork struct {
+	Network *net.IPNet
+	Weight  float64
+}
+
+func (target *TargetNetwork) String() string {
+	return target.Network.String()
+}
+
+// Parse a target network of the form <CIDR>[@<weight>]. The weight defaults to 1.
+func ParseTargetNetwork(toParse string) (*TargetNetwork, error) {
+	toParse = strings.TrimSpace(toParse)
+	weight := 1.0
+	if i := strings.LastIndex(toParse, "@"); i != -1 {
+		var err error
+		weight, err = strconv.ParseFloat(toParse[i+1:], 64)
+		if err != nil || weight <= 0 {
+			return nil, errors.New(fmt.Sprintf("Weight of target network '%s' must be a number greater than zero.", toParse))
+		}
+		toParse = toParse[:i]
+	}
+	ip, network, err := net.ParseCIDR(toParse)
+	if err != nil {
+		return nil, err
+	} else if ip.To4() != nil {
+		return nil, errors.New(fmt.Sprintf("Target network '%s' is not an IPv6 network.", toParse))
+	}
+	return &TargetNetwork{Network: network, Weight: weight}, nil
+}
+
+// Get the networks to discover addresses in. These are read from the configured target networks file and
+// list, falling back to the single configured target network if neither lists any.
+func GetTargetNetworks() ([]*TargetNetwork, error) {
+	var specs []string
+	if filePath := viper.GetString("ScanTargetNetworksFile"); filePath != "" {
+		fileSpecs, err := readTargetNetworksFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, fileSpecs...)
+	}
+	for _, spec := range strings.Split(viper.GetString("ScanTargetNetworks"), ",") {
+		if strings.TrimSpace(spec) != "" {
+			specs = append(specs, spec)
+		}
+	}
+	if len(specs) == 0 {
+		specs = []string{viper.GetString("ScanTargetNetwork")}
+	}
+	var toReturn []*TargetNetwork
+	for _, spec := range specs {
+		target, err := ParseTargetNetwork(spec)
+		if err != nil {
+			return nil, err
+		}
+		for _, existing := range toReturn {
+			if existing.Network.Contains(target.Network.IP) || target.Network.Contains(existing.Network.IP) {
+				return nil, errors.New(fmt.Sprintf("Target networks %s and %s overlap.", existing, target))
+			}
+		}
+		toReturn = append(toReturn, target)
+	}
+	return toReturn, nil
+}
+
+// Get the target network that contains the IP address, or nil if none of them do
+func GetTargetNetworkForIP(targets []*TargetNetwork, ip net.IP) *TargetNetwork {
+	for _, target := range targets {
+		if target.Network.Contains(ip) {
+			return target
+		}
+	}
+	return nil
+}
+
+// Read target networks from a file, one per line. Blank lines and lines starting with # are skipped.
+func readTargetNetworksFile(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var toReturn []string
+	lineScanner := bufio.NewScanner(file)
+	for lineScanner.Scan() {
+		line := strings.TrimSpace(lineScanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		toReturn = append(toReturn, line)
+	}
+	return toReturn, lineScanner.Err()
+}
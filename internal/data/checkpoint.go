@@ -0,0 +1,236 @@
+package data
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/blacklist"
+	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/fs"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+// The version of the checkpoint document format written by this build
+const CheckpointVersion = 2
+
+// The configuration values that the files and progress recorded in a checkpoint depend on. If any of
+// these change then the checkpoint can no longer be resumed from.
+var checkpointConfigKeys = []string{
+	"BaseOutputDirectory",
+	"OutputFileName",
+	"OutputFileType",
+	"ProbeType",
+	"GenerateAddressCount",
+	"NetworkGroupingSize",
+	"NetworkPingCount",
+	"NetworkBlacklistPercent",
+	"AliasLeftIndexStart",
+	"AliasDuplicateScanCount",
+	"AddressFilterSize",
+	"AddressFilterHashCount",
+}
+
+// A record of where a discovery run is at: the state it is in, how far into that state it got, and the
+// files that the states have produced so far
+type Checkpoint struct {
+	Version        int               `json:"version"`
+	RunID          string            `json:"run_id"`
+	TargetNetworks []string          `json:"target_networks"`
+	ConfigHash     string            `json:"config_hash"`
+	State          int               `json:"state"`
+	Progress       *StateProgress    `json:"progress,omitempty"`
+	Files          map[string]string `json:"files"` // The current file in each output directory, keyed by getFileKey
+}
+
+// Progress made partway through the current state
+type StateProgress struct {
+	CandidateOffset int                           `json:"candidate_offset,omitempty"` // How many addresses into the candidate file the ping scan got
+	CleanupSteps    int                           `json:"cleanup_steps,omitempty"`    // How many of the post-scan clean up steps have completed
+	AliasChecks     []*blacklist.AliasCheckRecord `json:"alias_checks,omitempty"`     // The alias checks in progress, including the resolved ones
+}
+
+var curCheckpoint *Checkpoint
+
+// Create a checkpoint for a new run against the target networks, starting at the first state
+func NewCheckpoint(targetNetworks []*config.TargetNetwork) *Checkpoint {
+	return &Checkpoint{
+		Version:        CheckpointVersion,
+		RunID:          uuid.New().String(),
+		TargetNetworks: GetTargetNetworkStrings(targetNetworks),
+		ConfigHash:     GetConfigHash(),
+		Files:          make(map[string]string),
+	}
+}
+
+// Get the networks of the target networks as strings, in the same order
+func GetTargetNetworkStrings(targetNetworks []*config.TargetNetwork) []string {
+	var toReturn []string
+	for _, target := range targetNetworks {
+		toReturn = append(toReturn, target.String())
+	}
+	return toReturn
+}
+
+// Get a hash of the configuration values that a checkpoint depends on
+func GetConfigHash() string {
+	hash := sha256.New()
+	for _, key := range checkpointConfigKeys {
+		fmt.Fprintf(hash, "%s=%v\n", key, viper.Get(key))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Load the checkpoint from the configured checkpoint file, returning nil if there isn't one
+func LoadCheckpoint() (*Checkpoint, error) {
+	filePath := config.GetCheckpointFilePath()
+	if !fs.CheckIfFileExists(filePath) {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var toReturn Checkpoint
+	err = json.Unmarshal(content, &toReturn)
+	if err != nil {
+		return nil, err
+	}
+	if toReturn.Version != CheckpointVersion {
+		return nil, errors.New(fmt.Sprintf("Checkpoint at '%s' is of version %d (expected version %d).", filePath, toReturn.Version, CheckpointVersion))
+	}
+	if toReturn.Files == nil {
+		toReturn.Files = make(map[string]string)
+	}
+	return &toReturn, nil
+}
+
+// Write the current checkpoint to the configured checkpoint file
+func SaveCheckpoint() error {
+	if curCheckpoint == nil {
+		return errors.New("no checkpoint has been set to save")
+	}
+	filePath := config.GetCheckpointFilePath()
+	logging.Debugf("Now saving checkpoint for run %s (state %d) to path '%s'.", curCheckpoint.RunID, curCheckpoint.State, filePath)
+	return writeJSONFile(filePath, curCheckpoint)
+}
+
+func SetCheckpoint(checkpoint *Checkpoint) {
+	curCheckpoint = checkpoint
+}
+
+// Get the current checkpoint, starting an unsaved one for the configured target networks if none has
+// been set
+func GetCheckpoint() *Checkpoint {
+	if curCheckpoint == nil {
+		targetNetworks, err := config.GetTargetNetworks()
+		if err != nil {
+			targetNetworks = nil
+		}
+		curCheckpoint = NewCheckpoint(targetNetworks)
+	}
+	return curCheckpoint
+}
+
+// Record the file as the current one in its directory
+func RecordFile(filePath string) {
+	if filePath == "" {
+		return
+	}
+	GetCheckpoint().Files[getFileKey(filepath.Dir(filePath))] = filePath
+}
+
+// Get the key that the current file in a directory is recorded under. This is the directory's path within
+// the base output directory (ie: "candidates" or "bloom/2600-1234--_32"), so that the directories kept for
+// each target network under different parents don't clash. Directories outside the base output directory
+// are recorded under their name alone.
+func getFileKey(dirPath string) string {
+	key, err := filepath.Rel(viper.GetString("BaseOutputDirectory"), filepath.Clean(dirPath))
+	if err != nil || key == ".." || strings.HasPrefix(key, ".."+string(filepath.Separator)) {
+		return filepath.Base(dirPath)
+	}
+	return filepath.ToSlash(key)
+}
+
+// Get the name of the file in the directory that the checkpoint records as current, falling back to the
+// most recent file in the directory if the checkpoint doesn't record one (ie: for files carried over
+// from a previous run). Returns an empty string if the directory is empty.
+func GetCurrentFileFromDirectory(dirPath string) (string, error) {
+	if curCheckpoint != nil {
+		if filePath, ok := curCheckpoint.Files[getFileKey(dirPath)]; ok {
+			if filepath.Dir(filePath) == filepath.Clean(dirPath) && fs.CheckIfFileExists(filePath) {
+				return filepath.Base(filePath), nil
+			}
+			logging.Warnf("File at path '%s' recorded in checkpoint no longer exists. Falling back to the most recent file in directory '%s'.", filePath, dirPath)
+		}
+	}
+	return fs.GetMostRecentFileFromDirectory(dirPath)
+}
+
+// Get the names of the files in the directory other than the current one
+func GetNonCurrentFilesFromDirectory(dirPath string) ([]string, error) {
+	var toReturn []string
+	currentFile, err := GetCurrentFileFromDirectory(dirPath)
+	if err != nil || currentFile == "" {
+		return toReturn, err
+	}
+	files, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		logging.Warnf("Error thrown when trying to read files from directory '%s': '%s", dirPath, err)
+		return toReturn, err
+	}
+	for _, fi := range files {
+		if fi.Mode().IsRegular() && fi.Name() != currentFile {
+			toReturn = append(toReturn, fi.Name())
+		}
+	}
+	logging.Debugf("Found %d files other than the current '%s' in directory '%s'.", len(toReturn), currentFile, dirPath)
+	return toReturn, nil
+}
+
+// Build a checkpoint from the state and target network files written by earlier versions, removing
+// them once the checkpoint has been saved. Does nothing if a checkpoint already exists or there are no
+// legacy files to migrate.
+func MigrateLegacyStateFiles(stateFilePath string, networkFilePath string) error {
+	if fs.CheckIfFileExists(config.GetCheckpointFilePath()) || !fs.CheckIfFileExists(stateFilePath) || !fs.CheckIfFileExists(networkFilePath) {
+		return nil
+	}
+	logging.Infof("Migrating legacy state file '%s' and network file '%s' to checkpoint at '%s'.", stateFilePath, networkFilePath, config.GetCheckpointFilePath())
+	stateContent, err := ioutil.ReadFile(stateFilePath)
+	if err != nil {
+		return err
+	}
+	if len(stateContent) != 1 {
+		return errors.New(fmt.Sprintf("Content of file at '%s' was of unexpected length (%d).", stateFilePath, len(stateContent)))
+	}
+	networkContent, err := ioutil.ReadFile(networkFilePath)
+	if err != nil {
+		return err
+	}
+	network, err := addressing.GetIPv6NetworkFromBytesIncLength(networkContent)
+	if err != nil {
+		return err
+	}
+	checkpoint := NewCheckpoint([]*config.TargetNetwork{{Network: network, Weight: 1}})
+	checkpoint.State = int(stateContent[0])
+	SetCheckpoint(checkpoint)
+	err = SaveCheckpoint()
+	if err != nil {
+		return err
+	}
+	for _, filePath := range []string{stateFilePath, networkFilePath} {
+		if err := os.Remove(filePath); err != nil {
+			logging.Warnf("Error thrown when removing legacy file at path '%s': %s", filePath, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/blacklist"
+	"github.com/ekaley/ipv666/internal/config"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setUpCheckpointTest(t *testing.T) *net.IPNet {
+	config.InitConfig()
+	viper.Set("BaseOutputDirectory", t.TempDir())
+	_, network, _ := net.ParseCIDR("2600:1234::/32")
+	SetCheckpoint(nil)
+	t.Cleanup(func() { SetCheckpoint(nil) })
+	return network
+}
+
+func TestCheckpoint_SaveLoadRoundTrip(t *testing.T) {
+	network := setUpCheckpointTest(t)
+	checkpoint := NewCheckpoint([]*config.TargetNetwork{{Network: network, Weight: 1}})
+	checkpoint.State = 3
+	checkpoint.Progress = &StateProgress{
+		CandidateOffset: 42,
+		AliasChecks: []*blacklist.AliasCheckRecord{
+			{BaseAddress: addressing.NewIPv6(network.IP), Left: 10, Right: 97},
+		},
+	}
+	SetCheckpoint(checkpoint)
+	RecordFile("/tmp/candidates/1234")
+	assert.Nil(t, SaveCheckpoint())
+
+	loaded, err := LoadCheckpoint()
+	assert.Nil(t, err)
+	assert.Equal(t, checkpoint, loaded)
+	assert.Equal(t, "/tmp/candidates/1234", loaded.Files["candidates"])
+}
+
+func TestCheckpoint_LoadMissing(t *testing.T) {
+	setUpCheckpointTest(t)
+	checkpoint, err := LoadCheckpoint()
+	assert.Nil(t, err)
+	assert.Nil(t, checkpoint)
+}
+
+func TestCheckpoint_LoadVersionMismatch(t *testing.T) {
+	setUpCheckpointTest(t)
+	assert.Nil(t, ioutil.WriteFile(config.GetCheckpointFilePath(), []byte(`{"version": 99}`), 0644))
+	_, err := LoadCheckpoint()
+	assert.NotNil(t, err)
+}
+
+func TestGetConfigHash_ChangesWithConfig(t *testing.T) {
+	setUpCheckpointTest(t)
+	hash := GetConfigHash()
+	assert.Equal(t, hash, GetConfigHash())
+	viper.Set("GenerateAddressCount", viper.GetInt("GenerateAddressCount")+1)
+	assert.NotEqual(t, hash, GetConfigHash())
+}
+
+func TestGetCurrentFileFromDirectory_PrefersRecordedFile(t *testing.T) {
+	network := setUpCheckpointTest(t)
+	SetCheckpoint(NewCheckpoint([]*config.TargetNetwork{{Network: network, Weight: 1}}))
+	dirPath := t.TempDir()
+	recorded := filepath.Join(dirPath, "recorded")
+	newer := filepath.Join(dirPath, "newer")
+	assert.Nil(t, ioutil.WriteFile(recorded, []byte{}, 0644))
+	assert.Nil(t, ioutil.WriteFile(newer, []byte{}, 0644))
+	assert.Nil(t, os.Chtimes(recorded, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)))
+	RecordFile(recorded)
+
+	fileName, err := GetCurrentFileFromDirectory(dirPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "recorded", fileName)
+
+	// Fall back to the most recent file once the recorded one is gone
+	assert.Nil(t, os.Remove(recorded))
+	fileName, err = GetCurrentFileFromDirectory(dirPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "newer", fileName)
+}
+
+func TestMigrateLegacyStateFiles(t *testing.T) {
+	network := setUpCheckpointTest(t)
+	baseDir := viper.GetString("BaseOutputDirectory")
+	statePath, networkPath := filepath.Join(baseDir, "state.bin"), filepath.Join(baseDir, "network.bin")
+	assert.Nil(t, ioutil.WriteFile(statePath, []byte{2}, 0644))
+	assert.Nil(t, addressing.WriteIPv6NetworksToFile(networkPath, []*net.IPNet{network}))
+
+	assert.Nil(t, MigrateLegacyStateFiles(statePath, networkPath))
+	checkpoint, err := LoadCheckpoint()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, checkpoint.State)
+	assert.Equal(t, []string{network.String()}, checkpoint.TargetNetworks)
+	_, err = os.Stat(statePath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRecordFile_TargetDirectoriesDoNotClash(t *testing.T) {
+	network := setUpCheckpointTest(t)
+	SetCheckpoint(NewCheckpoint([]*config.TargetNetwork{{Network: network, Weight: 1}}))
+	for _, dirPath := range []string{config.GetBloomDirPathForTarget(network), config.GetNetworkBlacklistDirPathForTarget(network)} {
+		assert.Nil(t, os.MkdirAll(dirPath, 0755))
+		recorded := filepath.Join(dirPath, "recorded")
+		assert.Nil(t, ioutil.WriteFile(recorded, []byte{}, 0644))
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dirPath, "newer"), []byte{}, 0644))
+		assert.Nil(t, os.Chtimes(recorded, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)))
+		RecordFile(recorded)
+	}
+	assert.Len(t, GetCheckpoint().Files, 2)
+	for _, dirPath := range []string{config.GetBloomDirPathForTarget(network), config.GetNetworkBlacklistDirPathForTarget(network)} {
+		fileName, err := GetCurrentFileFromDirectory(dirPath)
+		assert.Nil(t, err)
+		assert.Equal(t, "recorded", fileName)
+	}
+}
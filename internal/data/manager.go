@@ -22,51 +22,34 @@ import (
 	"github.com/willf/bloom"
 )
 
-var curCandidatePingResults []*net.IP
-var curCandidatePingResultsPath string
 var curScanResultsNetworkRanges []*net.IPNet
 var curScanResultsNetworkRangesPath string
 var curBlacklist *blacklist.NetworkBlacklist
 var curBlacklistPath string
-var curCleanPingResults []*net.IP
-var curCleanPingResultsPath string
-var curBloomFilter *bloom.BloomFilter
-var curBloomFilterPath string
+var curTargetBlacklists = make(map[string]*blacklist.NetworkBlacklist) // Keyed by target network
+var curTargetBlacklistPaths = make(map[string]string)
+var curBloomFilters = make(map[string]*bloom.BloomFilter) // Keyed by target network
+var curBloomFilterPaths = make(map[string]string)
 var curAliasedNetworks []*net.IPNet
 var curAliasedNetworksPath string
 var curClusterModel *modeling.ClusterModel
+var curClusterModelPath string
+var curUnroutedNetworkCounts map[string]int
+var curUnroutedNetworkCountsPath string
 var packedBox = packr.New("box", "../../assets")
 
 //TODO add unit tests for making sure that the boxed assets are returned
 
-func GetMostRecentTargetNetworkString() (string, error) {
-	if !fs.CheckIfFileExists(config.GetTargetNetworkFilePath()) {
-		return "", nil
-	}
-	content, err := ioutil.ReadFile(config.GetTargetNetworkFilePath())
-	if err != nil {
-		return "", nil
-	}
-	network, err := addressing.GetIPv6NetworkFromBytesIncLength(content)
-	if err != nil {
-		return "", err
-	}
-	return network.String(), nil
-}
-
-func WriteMostRecentTargetNetwork(toWrite *net.IPNet) error {
-	return addressing.WriteIPv6NetworksToFile(config.GetTargetNetworkFilePath(), []*net.IPNet{toWrite})
-}
-
 func UpdateAliasedNetworks(nets []*net.IPNet, filePath string) {
 	curAliasedNetworks = nets
 	curAliasedNetworksPath = filePath
+	RecordFile(filePath)
 }
 
 func GetAliasedNetworks() ([]*net.IPNet, error) {
 	aliasedDir := config.GetAliasedNetworkDirPath()
-	logging.Debugf("Attempting to retrieve most recent aliased networks from directory '%s'.", aliasedDir)
-	fileName, err := fs.GetMostRecentFileFromDirectory(aliasedDir)
+	logging.Debugf("Attempting to retrieve current aliased networks from directory '%s'.", aliasedDir)
+	fileName, err := GetCurrentFileFromDirectory(aliasedDir)
 	if err != nil {
 		logging.Warnf("Error thrown when retrieving aliased networks from directory '%s': %s", aliasedDir, err)
 		return nil, err
@@ -75,7 +58,7 @@ func GetAliasedNetworks() ([]*net.IPNet, error) {
 		return nil, errors.New(fmt.Sprintf("No aliased networks were found in directory %s.", aliasedDir))
 	}
 	filePath := filepath.Join(aliasedDir, fileName)
-	logging.Debugf("Most recent aliased networks file is at path '%s'.", filePath)
+	logging.Debugf("Current aliased networks file is at path '%s'.", filePath)
 	if filePath == curAliasedNetworksPath {
 		logging.Debugf("Already have aliased networks from path '%s' loaded in memory. Returning.", filePath)
 		return curAliasedNetworks, nil
@@ -89,32 +72,78 @@ func GetAliasedNetworks() ([]*net.IPNet, error) {
 	}
 }
 
-func UpdateBloomFilter(filter *bloom.BloomFilter, filePath string) {
-	curBloomFilter = filter
-	curBloomFilterPath = filePath
+func UpdateUnroutedNetworkCounts(counts map[string]int, filePath string) {
+	curUnroutedNetworkCounts = counts
+	curUnroutedNetworkCountsPath = filePath
+	RecordFile(filePath)
 }
 
-func LoadBloomFilterFromOutput() (*bloom.BloomFilter, error) {
-	logging.Debugf("Creating Bloom filter from output file '%s'.", config.GetOutputFilePath())
-	ips, err := fs.ReadIPsFromHexFile(config.GetOutputFilePath())
-	ips = addressing.GetUniqueIPs(ips, viper.GetInt("LogLoopEmitFreq"))
+// Get the number of scans in which each network came back "no route", keyed by network string. Returns
+// an empty map if no tally has been written yet.
+func GetUnroutedNetworkCounts() (map[string]int, error) {
+	unroutedDir := config.GetUnroutedNetworkDirPath()
+	logging.Debugf("Attempting to retrieve current unrouted network counts from directory '%s'.", unroutedDir)
+	fileName, err := GetCurrentFileFromDirectory(unroutedDir)
 	if err != nil {
+		logging.Warnf("Error thrown when retrieving unrouted network counts from directory '%s': %s", unroutedDir, err)
 		return nil, err
+	} else if fileName == "" {
+		logging.Debugf("The directory at '%s' was empty. No networks are known to be unrouted.", unroutedDir)
+		return make(map[string]int), nil
 	}
-	logging.Debugf("%d IP addresses loaded from file '%s'.", len(ips), config.GetOutputFilePath())
+	filePath := filepath.Join(unroutedDir, fileName)
+	logging.Debugf("Current unrouted network counts file is at path '%s'.", filePath)
+	if filePath == curUnroutedNetworkCountsPath {
+		logging.Debugf("Already have unrouted network counts from path '%s' loaded in memory. Returning.", filePath)
+		return curUnroutedNetworkCounts, nil
+	} else {
+		logging.Debugf("Loading unrouted network counts from path '%s'.", filePath)
+		toReturn, err := addressing.ReadIPv6NetworkCountsFromFile(filePath)
+		if err == nil {
+			UpdateUnroutedNetworkCounts(toReturn, filePath)
+		}
+		return toReturn, err
+	}
+}
+
+func UpdateBloomFilter(target *net.IPNet, filter *bloom.BloomFilter, filePath string) {
+	curBloomFilters[target.String()] = filter
+	curBloomFilterPaths[target.String()] = filePath
+	RecordFile(filePath)
+}
+
+// Create a Bloom filter from the addresses in the output file (of either output type) that fall within
+// the target network
+func LoadBloomFilterFromOutput(target *net.IPNet) (*bloom.BloomFilter, error) {
+	logging.Debugf("Creating Bloom filter for %s from output file '%s'.", target, config.GetOutputFilePath())
 	newBloom := bloom.New(uint(viper.GetInt("AddressFilterSize")), uint(viper.GetInt("AddressFilterHashCount")))
-	for _, ip := range ips {
-		ipBytes := ([]byte)(*ip)
-		newBloom.Add(ipBytes)
+	count := 0
+	err := fs.ForEachIPInInput(config.GetOutputFilePath(), fs.AutoFormat, func(ip addressing.IPv6) error {
+		if !ip.In(target) {
+			return nil
+		}
+		ipBytes := ip.Bytes()
+		newBloom.Add(ipBytes[:])
+		count++
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	logging.Debugf("Created Bloom filter with %d addresses from '%s'.", len(ips), config.GetOutputFilePath())
+	logging.Debugf("Created Bloom filter with %d addresses from '%s'.", count, config.GetOutputFilePath())
 	return newBloom, nil
 }
 
-func GetBloomFilter() (*bloom.BloomFilter, error) {
-	filterDir := config.GetBloomDirPath()
-	logging.Debugf("Attempting to retrieve most recent Bloom filter from directory '%s'.", filterDir)
-	fileName, err := fs.GetMostRecentFileFromDirectory(filterDir)
+// Get the Bloom filter of addresses that have already been generated in the target network. Each target
+// network has its own Bloom filter so that changing the set of targets leaves the others intact.
+func GetBloomFilter(target *net.IPNet) (*bloom.BloomFilter, error) {
+	filterDir := config.GetBloomDirPathForTarget(target)
+	logging.Debugf("Attempting to retrieve current Bloom filter for %s from directory '%s'.", target, filterDir)
+	err := fs.CreateDirectoryIfNotExist(filterDir)
+	if err != nil {
+		return nil, err
+	}
+	fileName, err := GetCurrentFileFromDirectory(filterDir)
 	if err != nil {
 		logging.Warnf("Error thrown when retrieving Bloom filter from directory '%s': %s", filterDir, err)
 		return nil, err
@@ -122,67 +151,51 @@ func GetBloomFilter() (*bloom.BloomFilter, error) {
 		logging.Debugf("The directory at '%s' was empty. Checking for pre-existing output file at '%s'.", filterDir, config.GetOutputFilePath())
 		if _, err := os.Stat(config.GetOutputFilePath()); !os.IsNotExist(err) {
 			logging.Debugf("File at path '%s' exists. Using for new Bloom filter.", config.GetOutputFilePath())
-			return LoadBloomFilterFromOutput()
+			return LoadBloomFilterFromOutput(target)
 		} else {
 			logging.Debugf("No existing output file at '%s'. Returning a new, empty Bloom filter.", config.GetOutputFilePath())
 			return bloom.New(uint(viper.GetInt("AddressFilterSize")), uint(viper.GetInt("AddressFilterHashCount"))), nil
 		}
 	}
 	filePath := filepath.Join(filterDir, fileName)
-	logging.Debugf("Most recent Bloom filter is at path '%s'.", filePath)
-	if filePath == curBloomFilterPath {
+	logging.Debugf("Current Bloom filter is at path '%s'.", filePath)
+	if filePath == curBloomFilterPaths[target.String()] {
 		logging.Debugf("Already have Bloom filter at path '%s' loaded in memory. Returning.", filePath)
-		return curBloomFilter, nil
+		return curBloomFilters[target.String()], nil
 	} else {
 		logging.Debugf("Loading Bloom filter from path '%s'.", filePath)
 		toReturn, err := filtering.GetBloomFilterFromFile(filePath, uint(viper.GetInt("AddressFilterSize")), uint(viper.GetInt("AddressFilterHashCount")))
 		if err == nil {
-			UpdateBloomFilter(toReturn, filePath)
+			UpdateBloomFilter(target, toReturn, filePath)
 		}
 		return toReturn, err
 	}
 }
 
-func UpdateCleanPingResults(addrs []*net.IP, filePath string) {
-	curCleanPingResults = addrs
-	curCleanPingResultsPath = filePath
-}
-
-func GetCleanPingResults() ([]*net.IP, error) {
-	resultsDir := config.GetCleanPingDirPath()
-	logging.Debugf("Attempting to retrieve most recent cleaned ping results from directory '%s'.", resultsDir)
-	fileName, err := fs.GetMostRecentFileFromDirectory(resultsDir)
+// Call fn with each of the current cleaned ping results, streaming them from disk rather than
+// loading them all into memory
+func ForEachCleanPingResult(fn fs.IPFunc) error {
+	filePath, err := GetCurrentFilePathFromDir(config.GetCleanPingDirPath())
 	if err != nil {
-		logging.Warnf("Error thrown when retrieving cleaned ping results from directory '%s': %e", resultsDir, err)
-		return nil, err
-	} else if fileName == "" {
-		logging.Debugf("The directory at '%s' was empty.", resultsDir)
-		return nil, errors.New(fmt.Sprintf("No cleaned ping results files were found in directory %s.", resultsDir))
-	}
-	filePath := filepath.Join(resultsDir, fileName)
-	logging.Debugf("Most recent cleaned ping results file is at path '%s'.", filePath)
-	if filePath == curCleanPingResultsPath {
-		logging.Debugf("Already have cleaned ping results at path '%s' loaded in memory. Returning.", filePath)
-		return curCleanPingResults, nil
-	} else {
-		logging.Debugf("Loading cleaned ping results from path '%s'.", filePath)
-		toReturn, err := addressing.ReadIPsFromBinaryFile(filePath)
-		if err == nil {
-			UpdateCleanPingResults(toReturn, filePath)
-		}
-		return toReturn, err
+		return err
 	}
+	logging.Debugf("Streaming cleaned ping results from path '%s'.", filePath)
+	return fs.ForEachIPInBinaryFile(filePath, fn)
 }
 
 func UpdateBlacklist(blacklist *blacklist.NetworkBlacklist, filePath string) {
 	curBlacklist = blacklist
 	curBlacklistPath = filePath
+	RecordFile(filePath)
 }
 
+// Get the blacklist shared by all of the target networks. This is the current one in the blacklist
+// directory (ie: written by 'generate blacklist', or by discovery before each target network had its own
+// blacklist), or the one packaged with ipv666 if there isn't one.
 func GetBlacklist() (*blacklist.NetworkBlacklist, error) {
 	blacklistDir := config.GetNetworkBlacklistDirPath()
-	logging.Debugf("Attempting to retrieve most recent blacklist from directory '%s'.", blacklistDir)
-	fileName, err := fs.GetMostRecentFileFromDirectory(blacklistDir)
+	logging.Debugf("Attempting to retrieve current blacklist from directory '%s'.", blacklistDir)
+	fileName, err := GetCurrentFileFromDirectory(blacklistDir)
 	if err != nil {
 		logging.Warnf("Error thrown when retrieving blacklist from directory '%s': %s", blacklistDir, err)
 		return nil, err
@@ -201,7 +214,7 @@ func GetBlacklist() (*blacklist.NetworkBlacklist, error) {
 		return toReturn, nil
 	}
 	filePath := filepath.Join(blacklistDir, fileName)
-	logging.Debugf("Most recent blacklist file is at path '%s'.", filePath)
+	logging.Debugf("Current blacklist file is at path '%s'.", filePath)
 	if filePath == curBlacklistPath {
 		logging.Debugf("Already have blacklist at path '%s' loaded in memory. Returning.", filePath)
 		return curBlacklist, nil
@@ -214,6 +227,69 @@ func GetBlacklist() (*blacklist.NetworkBlacklist, error) {
 	}
 }
 
+func UpdateTargetBlacklist(target *net.IPNet, blacklist *blacklist.NetworkBlacklist, filePath string) {
+	curTargetBlacklists[target.String()] = blacklist
+	curTargetBlacklistPaths[target.String()] = filePath
+	RecordFile(filePath)
+}
+
+// Get the blacklist of the aliased networks that discovery has found in the target network. Each target
+// network has its own blacklist, as it has its own Bloom filter, so that changing the set of targets leaves
+// the others intact. Addresses in a target network are checked against both its blacklist and the shared
+// one (see GetBlacklist).
+func GetTargetBlacklist(target *net.IPNet) (*blacklist.NetworkBlacklist, error) {
+	blacklistDir := config.GetNetworkBlacklistDirPathForTarget(target)
+	logging.Debugf("Attempting to retrieve current blacklist for %s from directory '%s'.", target, blacklistDir)
+	err := fs.CreateDirectoryIfNotExist(blacklistDir)
+	if err != nil {
+		return nil, err
+	}
+	fileName, err := GetCurrentFileFromDirectory(blacklistDir)
+	if err != nil {
+		logging.Warnf("Error thrown when retrieving blacklist from directory '%s': %s", blacklistDir, err)
+		return nil, err
+	} else if fileName == "" {
+		logging.Debugf("The directory at '%s' was empty.", blacklistDir)
+		if toReturn, ok := curTargetBlacklists[target.String()]; ok && curTargetBlacklistPaths[target.String()] == "" {
+			return toReturn, nil
+		}
+		logging.Debugf("Starting a new, empty blacklist for %s.", target)
+		toReturn := blacklist.NewNetworkBlacklist(nil)
+		UpdateTargetBlacklist(target, toReturn, "")
+		return toReturn, nil
+	}
+	filePath := filepath.Join(blacklistDir, fileName)
+	logging.Debugf("Current blacklist for %s is at path '%s'.", target, filePath)
+	if filePath == curTargetBlacklistPaths[target.String()] {
+		logging.Debugf("Already have blacklist at path '%s' loaded in memory. Returning.", filePath)
+		return curTargetBlacklists[target.String()], nil
+	} else {
+		toReturn, err := blacklist.ReadNetworkBlacklistFromFile(filePath)
+		if err == nil {
+			UpdateTargetBlacklist(target, toReturn, filePath)
+		}
+		return toReturn, err
+	}
+}
+
+// Get the blacklists that apply to each of the target networks, which are the shared blacklist and the
+// target network's own
+func GetTargetBlacklists(targets []*config.TargetNetwork) (map[*config.TargetNetwork]blacklist.Blacklists, error) {
+	shared, err := GetBlacklist()
+	if err != nil {
+		return nil, err
+	}
+	toReturn := make(map[*config.TargetNetwork]blacklist.Blacklists)
+	for _, target := range targets {
+		targetBlacklist, err := GetTargetBlacklist(target.Network)
+		if err != nil {
+			return nil, err
+		}
+		toReturn[target] = blacklist.Blacklists{shared, targetBlacklist}
+	}
+	return toReturn, nil
+}
+
 func getBlacklistFromBox() (*blacklist.NetworkBlacklist, error) {
 	content, err := packedBox.Find("blacklist.zlib")
 	if err != nil {
@@ -239,12 +315,13 @@ func getBlacklistFromBox() (*blacklist.NetworkBlacklist, error) {
 func UpdateScanResultsNetworkRanges(networks []*net.IPNet, filePath string) {
 	curScanResultsNetworkRanges = networks
 	curScanResultsNetworkRangesPath = filePath
+	RecordFile(filePath)
 }
 
 func GetScanResultsNetworkRanges() ([]*net.IPNet, error) {
 	scanResultsDir := config.GetNetworkGroupDirPath()
-	logging.Debugf("Attempting to retrieve most recent candidate ping networks from directory '%s'.", scanResultsDir)
-	fileName, err := fs.GetMostRecentFileFromDirectory(scanResultsDir)
+	logging.Debugf("Attempting to retrieve current candidate ping networks from directory '%s'.", scanResultsDir)
+	fileName, err := GetCurrentFileFromDirectory(scanResultsDir)
 	if err != nil {
 		logging.Warnf("Error thrown when retrieving candidate ping networks from directory '%s': %s", scanResultsDir, err)
 		return nil, err
@@ -253,7 +330,7 @@ func GetScanResultsNetworkRanges() ([]*net.IPNet, error) {
 		return nil, errors.New(fmt.Sprintf("No candidate ping networks files were found in directory %s.", scanResultsDir))
 	}
 	filePath := filepath.Join(scanResultsDir, fileName)
-	logging.Debugf("Most recent candidate ping networks file is at path '%s'.", filePath)
+	logging.Debugf("Current candidate ping networks file is at path '%s'.", filePath)
 	if filePath == curScanResultsNetworkRangesPath {
 		logging.Debugf("Already have candidate ping networks at path '%s' loaded in memory. Returning.", filePath)
 		return curScanResultsNetworkRanges, nil
@@ -267,51 +344,60 @@ func GetScanResultsNetworkRanges() ([]*net.IPNet, error) {
 	}
 }
 
-func UpdateCandidatePingResults(ips []*net.IP, filePath string) {
-	curCandidatePingResultsPath = filePath
-	curCandidatePingResults = ips
+// Call fn with each of the current candidate ping results, streaming them from disk rather than
+// loading them all into memory
+func ForEachCandidatePingResult(fn fs.IPFunc) error {
+	filePath, err := GetCurrentFilePathFromDir(config.GetPingResultDirPath())
+	if err != nil {
+		return err
+	}
+	logging.Debugf("Streaming candidate ping results from path '%s'.", filePath)
+	return fs.ForEachIPInHexFile(filePath, fn)
+}
+
+func UpdateClusterModel(model *modeling.ClusterModel, filePath string) {
+	curClusterModel = model
+	curClusterModelPath = filePath
+	RecordFile(filePath)
 }
 
-func GetCandidatePingResults() ([]*net.IP, error) {
-	pingResultsDir := config.GetPingResultDirPath()
-	logging.Debugf("Attempting to retrieve most recent candidate ping results from directory '%s'.", pingResultsDir)
-	fileName, err := fs.GetMostRecentFileFromDirectory(pingResultsDir)
+// Get the current cluster model that was trained on our own discoveries, falling back to the model
+// packaged with the binary if none has been saved yet
+func GetProbabilisticClusterModel() (*modeling.ClusterModel, error) {
+	modelDir := config.GetGeneratedModelDirPath()
+	logging.Debugf("Attempting to retrieve current cluster model from directory '%s'.", modelDir)
+	fileName, err := GetCurrentFileFromDirectory(modelDir)
 	if err != nil {
-		logging.Warnf("Error thrown when retrieving candidate ping results from directory '%s': %s", pingResultsDir, err)
+		logging.Warnf("Error thrown when retrieving cluster model from directory '%s': %s", modelDir, err)
 		return nil, err
 	} else if fileName == "" {
-		logging.Debugf("The directory at '%s' was empty.", pingResultsDir)
-		return nil, errors.New(fmt.Sprintf("No candidate ping files were found in directory %s.", pingResultsDir))
+		logging.Debugf("The directory at '%s' was empty.", modelDir)
+		if curClusterModel != nil {
+			logging.Debugf("Already have a cluster model loaded from box. Returning.")
+			return curClusterModel, nil
+		}
+		logging.Debugf("Loading cluster model from box...")
+		toReturn, err := getClusterModelFromBox()
+		if err != nil {
+			return &modeling.ClusterModel{}, err
+		}
+		UpdateClusterModel(toReturn, "")
+		return toReturn, nil
 	}
-	filePath := filepath.Join(pingResultsDir, fileName)
-	logging.Debugf("Most recent ping results file is at path '%s'.", filePath)
-	if filePath == curCandidatePingResultsPath {
-		logging.Debugf("Already have candidate ping results at path '%s' loaded in memory. Returning.", filePath)
-		return curCandidatePingResults, nil
+	filePath := filepath.Join(modelDir, fileName)
+	logging.Debugf("Current cluster model file is at path '%s'.", filePath)
+	if filePath == curClusterModelPath {
+		logging.Debugf("Already have cluster model at path '%s' loaded in memory. Returning.", filePath)
+		return curClusterModel, nil
 	} else {
-		logging.Debugf("Loading candidate ping results from path '%s'.", filePath)
-		toReturn, err := fs.ReadIPsFromHexFile(filePath)
+		toReturn, err := modeling.LoadModelFromFile(filePath)
 		if err == nil {
-			UpdateCandidatePingResults(toReturn, filePath)
+			UpdateClusterModel(toReturn, filePath)
 		}
 		return toReturn, err
 	}
 }
 
-func GetProbabilisticClusterModel() (*modeling.ClusterModel, error) {
-	if curClusterModel != nil {
-		logging.Debugf("Already have a cluster model loaded from box. Returning.")
-		return curClusterModel, nil
-	}
-	logging.Debugf("Loading cluster model from box...")
-	toReturn, err := getClusterModelFromBox()
-	if err != nil {
-		return &modeling.ClusterModel{}, err
-	}
-	curClusterModel = toReturn
-	return toReturn, nil
-}
-
 func getClusterModelFromBox() (*modeling.ClusterModel, error) { //TODO generalize fetching from box and decompressing zlib
 	content, err := packedBox.Find("clustermodel.zlib")
 	if err != nil {
@@ -330,16 +416,41 @@ func getClusterModelFromBox() (*modeling.ClusterModel, error) { //TODO generaliz
 	return modeling.LoadModelFromBytes(modelBytes)
 }
 
-func GetMostRecentFilePathFromDir(candidateDir string) (string, error) {
-	logging.Debugf("Attempting to find most recent file path in directory '%s'.", candidateDir)
-	fileName, err := fs.GetMostRecentFileFromDirectory(candidateDir)
+// Get the seed addresses to build seeded generators from, which are the addresses discovered so far and
+// any addresses in GeneratorSeedFile
+func GetGeneratorSeeds() ([]addressing.IPv6, error) {
+	var seeds []addressing.IPv6
+	if seedPath := viper.GetString("GeneratorSeedFile"); seedPath != "" {
+		logging.Debugf("Reading generator seed addresses from path '%s'.", seedPath)
+		seedAddrs, err := fs.ReadIPsFromFile(seedPath)
+		if err != nil {
+			return nil, err
+		}
+		seeds = append(seeds, seedAddrs...)
+	}
+	if _, err := os.Stat(config.GetOutputFilePath()); !os.IsNotExist(err) {
+		logging.Debugf("Reading discovered addresses from output file '%s' to seed generator.", config.GetOutputFilePath())
+		err := fs.ForEachIPInInput(config.GetOutputFilePath(), fs.AutoFormat, func(ip addressing.IPv6) error {
+			seeds = append(seeds, ip)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return seeds, nil
+}
+
+func GetCurrentFilePathFromDir(candidateDir string) (string, error) {
+	logging.Debugf("Attempting to find current file path in directory '%s'.", candidateDir)
+	fileName, err := GetCurrentFileFromDirectory(candidateDir)
 	if err != nil {
-		logging.Warnf("Error thrown when finding most recent candidate file path in directory '%s': %s", candidateDir, err)
+		logging.Warnf("Error thrown when finding current candidate file path in directory '%s': %s", candidateDir, err)
 		return "", err
 	} else if fileName == "" {
 		return "", errors.New(fmt.Sprintf("No file was found in directory '%s'.", candidateDir))
 	} else {
-		logging.Debugf("Most recent file path in directory '%s' is '%s'.", candidateDir, fileName)
+		logging.Debugf("Current file path in directory '%s' is '%s'.", candidateDir, fileName)
 		filePath := filepath.Join(candidateDir, fileName)
 		return filePath, nil
 	}
@@ -0,0 +1,97 @@
+package data
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/fs"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/spf13/viper"
+)
+
+// The candidates scanned and live addresses found in part of the address space across all runs
+type HitStats struct {
+	Candidates int `json:"candidates"`
+	Hits       int `json:"hits"`
+}
+
+// The per-region statistics, along with the prefix length of the regions they were gathered for
+type regionStatsFile struct {
+	PrefixLength int                  `json:"prefix_length"`
+	Regions      map[string]*HitStats `json:"regions"`
+}
+
+// Get the scan statistics for every target network that has been scanned, keyed by network. Statistics
+// are kept across runs so that adding or removing a target network does not lose the others' history.
+func GetTargetStats() (map[string]*HitStats, error) {
+	toReturn := make(map[string]*HitStats)
+	err := readJSONFile(config.GetTargetStatsFilePath(), &toReturn)
+	if err != nil {
+		return nil, err
+	}
+	return toReturn, nil
+}
+
+// Write the scan statistics for the target networks to the configured target stats file
+func SaveTargetStats(stats map[string]*HitStats) error {
+	filePath := config.GetTargetStatsFilePath()
+	logging.Debugf("Now saving statistics for %d target networks to path '%s'.", len(stats), filePath)
+	return writeJSONFile(filePath, stats)
+}
+
+// Get the scan statistics for every region (network of the configured region prefix length) that has had
+// a hit, keyed by network. If the statistics were gathered for regions of a different prefix length then
+// they are discarded.
+func GetRegionStats() (map[string]*HitStats, error) {
+	filePath := config.GetRegionStatsFilePath()
+	prefixLength := viper.GetInt("RegionPrefixLength")
+	content := regionStatsFile{PrefixLength: prefixLength, Regions: make(map[string]*HitStats)}
+	err := readJSONFile(filePath, &content)
+	if err != nil {
+		return nil, err
+	}
+	if content.PrefixLength != prefixLength {
+		logging.Warnf("Region statistics at '%s' are for /%d regions (expected /%d). Starting region statistics over.", filePath, content.PrefixLength, prefixLength)
+		return make(map[string]*HitStats), nil
+	}
+	if content.Regions == nil {
+		content.Regions = make(map[string]*HitStats)
+	}
+	return content.Regions, nil
+}
+
+// Write the scan statistics for the regions to the configured region stats file
+func SaveRegionStats(stats map[string]*HitStats) error {
+	filePath := config.GetRegionStatsFilePath()
+	logging.Debugf("Now saving statistics for %d regions to path '%s'.", len(stats), filePath)
+	return writeJSONFile(filePath, &regionStatsFile{PrefixLength: viper.GetInt("RegionPrefixLength"), Regions: stats})
+}
+
+// Read JSON content from a file into toReturn, leaving it as-is if the file does not exist
+func readJSONFile(filePath string, toReturn interface{}) error {
+	if !fs.CheckIfFileExists(filePath) {
+		return nil
+	}
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, toReturn)
+}
+
+// Write content to a file as indented JSON. The file is replaced in a single rename so that an
+// interrupted write never leaves a partial file behind.
+func writeJSONFile(filePath string, content interface{}) error {
+	toWrite, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempPath := filePath + ".tmp"
+	err = ioutil.WriteFile(tempPath, toWrite, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempPath, filePath)
+}
@@ -0,0 +1,33 @@
+package data
+
+import (
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTargetStats_RoundTrip(t *testing.T) {
+	setUpCheckpointTest(t)
+	stats, err := GetTargetStats()
+	assert.Nil(t, err)
+	assert.Empty(t, stats)
+	stats["2600:1234::/32"] = &HitStats{Candidates: 500, Hits: 3}
+	assert.Nil(t, SaveTargetStats(stats))
+	loaded, err := GetTargetStats()
+	assert.Nil(t, err)
+	assert.Equal(t, stats, loaded)
+}
+
+func TestGetRegionStats_DiscardsOtherPrefixLength(t *testing.T) {
+	setUpCheckpointTest(t)
+	stats := map[string]*HitStats{"2600:1234:1::/48": {Candidates: 10, Hits: 1}}
+	assert.Nil(t, SaveRegionStats(stats))
+	loaded, err := GetRegionStats()
+	assert.Nil(t, err)
+	assert.Equal(t, stats, loaded)
+	viper.Set("RegionPrefixLength", 56)
+	defer viper.Set("RegionPrefixLength", 48)
+	loaded, err = GetRegionStats()
+	assert.Nil(t, err)
+	assert.Empty(t, loaded)
+}
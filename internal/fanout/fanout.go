@@ -3,228 +3,204 @@ package fanout
 import (
 	"context"
 	"fmt"
-	"github.com/alecthomas/units"
 	"github.com/ekaley/ipv666/internal/addressing"
 	"github.com/ekaley/ipv666/internal/config"
 	"github.com/ekaley/ipv666/internal/data"
 	"github.com/ekaley/ipv666/internal/fs"
 	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/pingscan"
+	"github.com/ekaley/ipv666/internal/prober"
 	"github.com/spf13/viper"
-	"golang.org/x/net/icmp"
-	"golang.org/x/net/ipv6"
-	"golang.org/x/time/rate"
+	"github.com/willf/bloom"
 	"net"
 	"os"
-	"sync/atomic"
-	"time"
+	"sync"
 )
 
-func Slash64s(bandwidth string) error {
-	_, err := fanOut(bandwidth, true, false)
-	return err
+// The bits of a /64 network that are kept fixed when stepping to neighboring /64 networks
+const neighborFixedMask = uint64(0xff00000000000000)
+
+// Fan out to neighboring /64 networks and hosts. Returns the path to the file that ICMPv6 errors were
+// written to (empty if none were received).
+func Slash64s(ctx context.Context, bandwidth string) (string, error) {
+	return fanOut(ctx, bandwidth, true, false, false)
+}
+
+// Fan out to nybble-adjacent addresses. Returns the path to the file that ICMPv6 errors were written to
+// (empty if none were received).
+func NybbleAdjacent(ctx context.Context, bandwidth string) (string, error) {
+	return fanOut(ctx, bandwidth, false, true, false)
 }
 
-func NybbleAdjacent(bandwidth string) error {
-	_, err := fanOut(bandwidth, false, true)
-	return err
+// Fan out to hosts in the discovered /64 networks whose interface identifiers follow the configured
+// patterns. Returns the path to the file that ICMPv6 errors were written to (empty if none were received).
+func Patterns(ctx context.Context, bandwidth string) (string, error) {
+	return fanOut(ctx, bandwidth, false, false, true)
 }
 
-func fanOut(bandwidth string, slash64FanOut bool, nybbleFanOut bool) (string, error) {
+func fanOut(ctx context.Context, bandwidth string, slash64FanOut bool, nybbleFanOut bool, patternFanOut bool) (string, error) {
 
-	// Instantiate ICMPv6 packet listener
-	listener, err := net.ListenPacket("ip6:58", "::")
+	targets, err := config.GetTargetNetworks()
 	if err != nil {
-		logging.Warnf("Error thrown when listening for IPv6 packets: %s", err.Error())
 		return "", err
 	}
-
-	// Instantiate IPv6 packet connection
-	conn := ipv6.NewPacketConn(listener)
-	if err := conn.SetControlMessage(ipv6.FlagHopLimit|ipv6.FlagSrc|ipv6.FlagDst|ipv6.FlagInterface, true); err != nil {
-		logging.Warnf("Error thrown when setting control message: %s", err.Error())
-		return "", err
+	blooms := make(map[*config.TargetNetwork]*bloom.BloomFilter)
+	for _, target := range targets {
+		blooms[target], err = data.GetBloomFilter(target.Network)
+		if err != nil {
+			return "", err
+		}
 	}
-
-	// Apply ICMP echo reply filter
-	var filter ipv6.ICMPFilter
-	filter.SetAll(true)
-	filter.Accept(ipv6.ICMPTypeEchoReply)
-	if err := conn.SetICMPFilter(&filter); err != nil {
-		logging.Warnf("Error thrown when setting ICMP filter: %s", err.Error())
+	blacklists, err := data.GetTargetBlacklists(targets)
+	if err != nil {
 		return "", err
 	}
 
-	// Ping configuration
-	// - 10-byte payload
-	// - 255-hop limit
-	echoData := []byte("0123456789")
-	wcm := &ipv6.ControlMessage{HopLimit: 255}
-
-	// Use the zmap kp/s rates to estimate our bandwidth-constrained ping rate
-	maxBandwidthInt, err := units.ParseBase2Bytes(bandwidth)
-	targetRate := float64(maxBandwidthInt) / 1e6 * 1300
-	rateLimit := rate.Limit(targetRate)
-	rateLimiter := rate.NewLimiter(rateLimit, 10)
-	ctx := context.Background()
-
-	// Kick off the receive processor
+	// Output file
 	outputPath := fs.GetTimedFilePath(config.GetPingResultDirPath())
-	hitCount := uint64(0)
-	ips := make(chan net.IPAddr)
-	newIps := make(map[string]struct{})
-	go processReplies(conn, outputPath, newIps, &hitCount)
-
-	// Generate neighboring networks
-	done := make(chan bool, 1)
-	go func(newIps map[string]struct{}) {
-
-		if slash64FanOut == true {
-
-			// Generate neighboring /64s
-			netIps := make(map[*net.IP]struct{})
-			err := generateNeighboring64Networks(ips, netIps)
-			if err != nil {
-				return
-			}
-
-			// Wait until the networks are all processed
-			for len(ips) > 0 {
-				logging.Debugf("Fan-out has %d networks remaining", len(ips))
-				time.Sleep(1 * time.Second)
-			}
-			time.Sleep(2 * time.Second)
-
-			// Generate neighboring /64s
-			err = generate64NetworkHosts(ips, netIps, newIps)
-			if err != nil {
-				return
-			}
-
-			// Wait until they are all processed
-			for len(ips) > 0 {
-				logging.Debugf("Fan-out has %d networks remaining", len(ips))
-				time.Sleep(1 * time.Second)
-			}
-			time.Sleep(1 * time.Second)
-
-		}
-
-		if nybbleFanOut == true {
-
-			// Generate addresses
-			err := generateNybbleAdjacentAddrs(ips)
-			if err != nil {
-				return
-			}
-
-			// Wait until the networks are all processed
-			for len(ips) > 0 {
-				logging.Debugf("Fan-out has %d networks remaining", len(ips))
-				time.Sleep(1 * time.Second)
-			}
-			time.Sleep(2 * time.Second)
-		}
+	file, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data.RecordFile(outputPath)
 
-		done <- true
-	}(newIps)
+	// ICMPv6 errors sent back by routers are recorded separately
+	errorRecorder := pingscan.NewErrorRecorder()
+	defer errorRecorder.Close()
 
-	bloom, err := data.GetBloomFilter()
+	// Kick off the scanner, recording (and de-duplicating) every address that responds
+	var newIpsLock sync.Mutex
+	newIps := make(map[addressing.IPv6]struct{})
+	p, err := prober.New()
 	if err != nil {
+		logging.Warnf("Error thrown when creating prober: %s", err.Error())
 		return "", err
 	}
-	blacklist, err := data.GetBlacklist()
+	scanner, err := pingscan.NewScanner(p, bandwidth, func(reply *prober.Reply) {
+		newIpsLock.Lock()
+		defer newIpsLock.Unlock()
+		addr := addressing.NewIPv6(reply.Addr)
+		if _, ok := newIps[addr]; !ok {
+			newIps[addr] = struct{}{}
+			fmt.Fprintf(file, "%s\n", pingscan.FormatReply(reply))
+			file.Sync()
+			logging.Debugf("receiver got response from %s", addr)
+		}
+	}, errorRecorder.Record)
 	if err != nil {
+		p.Close()
 		return "", err
 	}
+	defer scanner.Close()
+
+	// Skip anything blacklisted, outside of the target networks, or that has already been scanned
+	filter := func(ip addressing.IPv6) bool {
+		ipBytes := ip.Bytes()
+		target := config.GetTargetNetworkForIP(targets, ip.ToIP())
+		if target == nil {
+			return false
+		} else if blacklists[target].IsIPBlacklisted(ip) {
+			return false
+		} else if blooms[target].Test(ipBytes[:]) {
+			return false
+		}
+		blooms[target].Add(ipBytes[:])
+		return true
+	}
 
-	// Ping each address
-	seq := uint16(0)
-	lastSecondCount := uint64(0)
-	count := uint64(0)
-	lastStatus := time.Now().Unix()
-	for len(ips) > 0 || len(done) == 0 {
-
-		// Attempt to read from ips with a 1 second timeout
-		select {
+	if slash64FanOut == true {
 
-		// Read
-		case ip := <-ips:
+		// Generate neighboring /64s
+		netIps := make(map[addressing.IPv6]struct{})
+		err := scanGenerated(ctx, scanner, filter, func(ips chan<- addressing.IPv6) error {
+			return generateNeighboring64Networks(ips, netIps)
+		})
+		if err != nil {
+			return "", err
+		}
 
-			if blacklist.IsIPBlacklisted(&ip.IP) {
-				continue
-			} else if bloom.Test(ip.IP) {
-				continue
-			} else {
-				bloom.Add(ip.IP)
-			}
+		// Generate hosts within the discovered /64s
+		newIpsLock.Lock()
+		foundIps := make(map[addressing.IPv6]struct{})
+		for k := range newIps {
+			foundIps[k] = struct{}{}
+		}
+		newIpsLock.Unlock()
+		err = scanGenerated(ctx, scanner, filter, func(ips chan<- addressing.IPv6) error {
+			return generate64NetworkHosts(ips, netIps, foundIps)
+		})
+		if err != nil {
+			return "", err
+		}
 
-			// Rate limit outgoing connections
-			rateLimiter.Wait(ctx)
+	}
 
-			// Build the packet
-			ping := icmp.Message{
-				Type: ipv6.ICMPTypeEchoRequest,
-				Code: 0,
-				Body: &icmp.Echo{ID: int(seq), Seq: int(seq), Data: echoData},
-			}
-			req, err := ping.Marshal(nil)
-			if err != nil {
-				logging.Warnf("error encoding ICMP echo packet with destination %s (%s)", ip, err)
-				return "", err
-			}
-			seq += 1
+	if nybbleFanOut == true {
 
-			// Send the packet
-			_, werr := conn.WriteTo(req, wcm, &ip)
-			if werr != nil {
+		// Generate addresses
+		err := scanGenerated(ctx, scanner, filter, generateNybbleAdjacentAddrs)
+		if err != nil {
+			return "", err
+		}
 
-				// Requeue the packet if it failed (i.e. due to network buffer backpressure)
-				go func() { ips <- ip }()
-				continue
-			}
+	}
 
-			// Increment the counter
-			lastSecondCount += 1
-			count += 1
-			t := time.Now().Unix()
-			if t != lastStatus {
-				lastStatus = t
-				logging.Infof("Ping-scanned %d addresses (%d hits, %d packets/second)", count, atomic.LoadUint64(&hitCount), lastSecondCount)
-				lastSecondCount = 0
-			}
+	if patternFanOut == true {
 
-		// Timeout
-		case <-time.After(1 * time.Second):
-			continue
+		// Generate pattern hosts within the discovered /64s (filtered by the generator itself)
+		err := scanGenerated(ctx, scanner, acceptAll, func(ips chan<- addressing.IPv6) error {
+			return generatePatternHosts(ips, filter)
+		})
+		if err != nil {
+			return "", err
 		}
-	}
 
-	// Close handle to stop the packet processor
-	conn.Close()
+	}
 
-	// Close the listener
-	listener.Close()
+	scanner.LogSummary()
 
-	// Exit
-	return "", err
+	return errorRecorder.GetPath(), nil
 }
 
-func generateNybbleAdjacentAddrs(ips chan net.IPAddr) error {
+// A filter that lets every address through, for generators that filter their own addresses
+func acceptAll(addressing.IPv6) bool {
+	return true
+}
 
-	// Load the discovered addresses
-	cleanPings, err := data.GetCleanPingResults()
-	if err != nil {
-		return err
+// Scan all of the addresses emitted by a generator that make it through the filter. Once the context is
+// cancelled the rest of the generated addresses are discarded without being filtered.
+func scanGenerated(ctx context.Context, scanner *pingscan.Scanner, filter func(addressing.IPv6) bool, generate func(chan<- addressing.IPv6) error) error {
+	generated := make(chan addressing.IPv6, 1024)
+	targets := make(chan addressing.IPv6, 1024)
+	genErr := make(chan error, 1)
+	go func() {
+		genErr <- generate(generated)
+		close(generated)
+	}()
+	go func() {
+		for ip := range generated {
+			if ctx.Err() != nil || !filter(ip) {
+				continue
+			}
+			select {
+			case targets <- ip:
+			case <-ctx.Done():
+			}
+		}
+		close(targets)
+	}()
+	scanErr := scanner.Scan(ctx, targets)
+	for range targets {
 	}
-
-	logging.Infof("Performing nybble-adjacent ping scan from %d discovered addresses", len(cleanPings))
-
-	// Get the target network
-	network, err := config.GetTargetNetwork()
-	if err != nil {
+	if err := <-genErr; err != nil {
 		return err
 	}
+	return scanErr
+}
 
+// Get the number of nybbles in an address that fall outside of the network's mask
+func getHostNybbleCount(network *net.IPNet) int {
 	nybbleCount := 32
 	for x := 0; x < 16; x++ {
 		if network.Mask[x]&0xF0 == 0xF0 {
@@ -238,52 +214,62 @@ func generateNybbleAdjacentAddrs(ips chan net.IPAddr) error {
 			break
 		}
 	}
+	return nybbleCount
+}
+
+func generateNybbleAdjacentAddrs(ips chan<- addressing.IPv6) error {
+
+	logging.Infof("Performing nybble-adjacent ping scan from discovered addresses")
 
-	// Generate nybble-adjacent addresses
-	addrs, err := addressing.GetAdjacentNetworkAddressesFromIPs(cleanPings, 32-nybbleCount, nybbleCount)
+	// Get the target networks
+	targets, err := config.GetTargetNetworks()
 	if err != nil {
 		return err
 	}
-	for _, v := range addrs {
-		ips <- net.IPAddr{IP: *v}
-	}
 
-	return nil
+	// Generate nybble-adjacent addresses, streaming the discovered addresses from disk
+	return data.ForEachCleanPingResult(func(cleanPing addressing.IPv6) error {
+		target := config.GetTargetNetworkForIP(targets, cleanPing.ToIP())
+		if target == nil {
+			return nil
+		}
+		nybbleCount := getHostNybbleCount(target.Network)
+		addrs, err := addressing.GetAdjacentNetworkAddressesFromIP(cleanPing, 32-nybbleCount, nybbleCount)
+		if err != nil {
+			return err
+		}
+		for _, v := range addrs {
+			ips <- v
+		}
+		return nil
+	})
 }
 
-func generate64NetworkHosts(ips chan net.IPAddr, netIps map[*net.IP]struct{}, newIps map[string]struct{}) error {
+func generate64NetworkHosts(ips chan<- addressing.IPv6, netIps map[addressing.IPv6]struct{}, newIps map[addressing.IPv6]struct{}) error {
 
 	logging.Infof("Fanning out from %d discovered /64 networks (host disovery)", (len(netIps) + len(newIps)))
 
 	// Host discovery
-	toScan := make(map[string]struct{})
+	toScan := make(map[addressing.IPv6]struct{})
 	for k, _ := range newIps {
 		toScan[k] = struct{}{}
 	}
 	for k, _ := range netIps {
-		toScan[k.String()] = struct{}{}
+		toScan[k] = struct{}{}
 	}
 
 	blockSize := viper.GetInt("FanOutHostBlockSize")
 	maxHosts := viper.GetInt("FanOutMaxHosts")
-	genIps := make(map[string]struct{})
+	genIps := make(map[addressing.IPv6]struct{})
 	count := 0
-	for k, _ := range toScan {
-
-		seed := net.ParseIP(k)
+	for seed, _ := range toScan {
 
 		// Generate $blockSize addresses
 		for x := 0; x < blockSize; x++ {
-			for d := 15; d >= 8; d-- {
-				seed[d] += 1
-				if seed[d] != 0 {
-					break
-				}
-			}
-			ip := net.IP(seed)
-			if _, ok := genIps[ip.String()]; !ok {
-				ips <- net.IPAddr{IP: ip}
-				genIps[ip.String()] = struct{}{}
+			seed.Low++
+			if _, ok := genIps[seed]; !ok {
+				ips <- seed
+				genIps[seed] = struct{}{}
 				count += 1
 			}
 		}
@@ -296,64 +282,47 @@ func generate64NetworkHosts(ips chan net.IPAddr, netIps map[*net.IP]struct{}, ne
 	return nil
 }
 
-func generateNeighboring64Networks(ips chan net.IPAddr, netIps map[*net.IP]struct{}) error {
+func generateNeighboring64Networks(ips chan<- addressing.IPv6, netIps map[addressing.IPv6]struct{}) error {
 
-	// Load the discovered addresses
-	cleanPings, err := data.GetCleanPingResults()
+	// Find the /64 networks, streaming the discovered addresses from disk
+	err := data.ForEachCleanPingResult(func(cleanPing addressing.IPv6) error {
+		if cleanPing.Low == 1 {
+			netIps[cleanPing] = struct{}{}
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	// Find the /64 networks
-	for _, v := range cleanPings {
-		_, v2 := addressing.AddressToUints(*v)
-		if v2 == 1 {
-			netIps[v] = struct{}{}
-		}
-	}
-
 	logging.Infof("Fanning out from %d discovered /64 networks (network disovery)", len(netIps))
 
 	// Generate neighboring /64 networks
-	genIps := make(map[string]struct{})
+	genIps := make(map[addressing.IPv6]struct{})
 	blockSize := viper.GetInt("FanOutNetworkBlockSize")
 	maxNetworks := viper.GetInt("FanOutMaxNetworks")
 	count := 0
 	for k, _ := range netIps {
 
-		seedUp := net.IP(*k)
-		seedDown := net.IP(*k)
+		seedUp := k
+		seedDown := k
 
-		// Generate $blockSize addresses
+		// Generate $blockSize addresses (the first byte of the network is left as-is)
 		for x := 0; x < blockSize; x++ {
-			for d := 7; d >= 1; d-- {
-				seedUp[d] += 1
-				if seedUp[d] != 0 {
-					break
-				}
-			}
-
-			ip := net.IP(seedUp)
-			if _, ok := genIps[ip.String()]; !ok {
-				ips <- net.IPAddr{IP: ip}
-				genIps[ip.String()] = struct{}{}
+			seedUp.High = seedUp.High&neighborFixedMask | (seedUp.High+1)&^neighborFixedMask
+			if _, ok := genIps[seedUp]; !ok {
+				ips <- seedUp
+				genIps[seedUp] = struct{}{}
 				count += 1
 			}
 		}
 
 		// Generate $blockSize addresses
 		for x := 0; x < blockSize; x++ {
-			for d := 7; d >= 1; d-- {
-				seedDown[d] -= 1
-				if seedDown[d] != 0 {
-					break
-				}
-			}
-
-			ip := net.IP(seedDown)
-			if _, ok := genIps[ip.String()]; !ok {
-				ips <- net.IPAddr{IP: ip}
-				genIps[ip.String()] = struct{}{}
+			seedDown.High = seedDown.High&neighborFixedMask | (seedDown.High-1)&^neighborFixedMask
+			if _, ok := genIps[seedDown]; !ok {
+				ips <- seedDown
+				genIps[seedDown] = struct{}{}
 				count += 1
 			}
 		}
@@ -365,57 +334,3 @@ func generateNeighboring64Networks(ips chan net.IPAddr, netIps map[*net.IP]struc
 
 	return nil
 }
-
-func processReplies(conn *ipv6.PacketConn, outputPath string, newIps map[string]struct{}, hitCount *uint64) {
-
-	// Output file
-	file, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		logging.ErrorF(err)
-		return
-	}
-	defer file.Close()
-
-	// Receive loop
-	rxIps := make(map[string]struct{})
-	buff := make([]byte, 1500)
-	for {
-
-		// Read the next ping response
-		rlen, _, raddr, rerr := conn.ReadFrom(buff)
-		if rerr != nil {
-
-			// Read timeout
-			if nerr, ok := rerr.(net.Error); ok && nerr.Timeout() {
-				continue
-			}
-
-			// Temporary error
-			nerr, ok := rerr.(*net.OpError)
-			if ok && nerr.Temporary() {
-				continue
-			}
-
-			// Permanent error
-			break
-		}
-
-		newIps[raddr.String()] = struct{}{}
-
-		// Deduplicate received packets
-		if _, ok := rxIps[raddr.String()]; !ok {
-
-			// Parse the response
-			rm, err := icmp.ParseMessage(58, buff[:rlen])
-			if err != nil {
-				logging.ErrorF(err)
-			}
-			atomic.AddUint64(hitCount, 1)
-			fmt.Fprintf(file, "%s\n", raddr.String())
-			file.Sync()
-			logging.Debugf("receiver got response from %s %v (%v)", raddr, buff[:rlen], rm)
-		}
-
-		continue
-	}
-}
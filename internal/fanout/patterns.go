@@ -0,0 +1,366 @@
+package fanout
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/data"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/oui"
+	"github.com/spf13/viper"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The rules used when no pattern rules file is configured
+const defaultPatternRules = `
+# Low-byte interface identifiers (::1 through ::ff)
+lowbyte 1-ff
+
+# Service ports written out as interface identifiers (::80, ::443)
+port 21,22,25,53,80,110,143,443,465,587,993,995,3389,8080,8443
+
+# Hex words
+word dead:beef,cafe,babe,face,beef,c0de,f00d,b00c,feed,dead,cafe:babe,face:b00c,c0ff:ee
+
+# Neighbors of IPv4 addresses embedded in discovered interface identifiers
+ipv4 4
+
+# Neighbors of discovered EUI-64 (ff:fe) interface identifiers
+eui64 4
+`
+
+// A rule for coming up with likely interface identifiers in a /64 network, given the interface
+// identifiers that have already been discovered in it
+type PatternRule interface {
+	GetIIDs(observed []uint64) []uint64
+}
+
+// Interface identifiers that hold a range of values in the lowest bytes
+type lowBytePatternRule struct {
+	From uint64
+	To   uint64
+}
+
+// A fixed list of interface identifiers, such as service ports or hex words
+type fixedPatternRule struct {
+	IIDs []uint64
+}
+
+// Interface identifiers near discovered ones that hold an IPv4 address in their last 32 bits, either as
+// hex (::c0a8:10a) or with each octet written in decimal digits (::192:168:1:10)
+type embeddedIPv4PatternRule struct {
+	Spread int
+}
+
+// Interface identifiers near discovered EUI-64 ones (those with ff:fe in the middle), optionally only for
+// the given vendor OUIs
+type eui64PatternRule struct {
+	Spread int
+	OUIs   map[uint32]struct{}
+}
+
+func (rule *lowBytePatternRule) GetIIDs(observed []uint64) []uint64 {
+	var toReturn []uint64
+	for iid := rule.From; iid <= rule.To; iid++ {
+		toReturn = append(toReturn, iid)
+	}
+	return toReturn
+}
+
+func (rule *fixedPatternRule) GetIIDs(observed []uint64) []uint64 {
+	return rule.IIDs
+}
+
+func (rule *embeddedIPv4PatternRule) GetIIDs(observed []uint64) []uint64 {
+	var toReturn []uint64
+	for _, iid := range observed {
+		if octets, ok := getDecimalIPv4Octets(iid); ok {
+			for _, lastOctet := range getSpread(uint64(octets[3]), rule.Spread, 255) {
+				toReturn = append(toReturn, getDecimalIPv4IID([4]uint8{octets[0], octets[1], octets[2], uint8(lastOctet)}))
+			}
+		} else if isHexIPv4IID(iid) {
+			for _, lastOctet := range getSpread(iid&0xff, rule.Spread, 255) {
+				toReturn = append(toReturn, iid&^0xff|lastOctet)
+			}
+		}
+	}
+	return toReturn
+}
+
+func (rule *eui64PatternRule) GetIIDs(observed []uint64) []uint64 {
+	var toReturn []uint64
+	for _, iid := range observed {
+		if !oui.IsEUI64(addressing.IPv6{Low: iid}) {
+			continue
+		}
+		if len(rule.OUIs) > 0 {
+			if _, ok := rule.OUIs[oui.GetEUI64OUI(addressing.IPv6{Low: iid})]; !ok {
+				continue
+			}
+		}
+		for _, nic := range getSpread(iid&0xffffff, rule.Spread, 0xffffff) {
+			toReturn = append(toReturn, iid&^0xffffff|nic)
+		}
+	}
+	return toReturn
+}
+
+// Get the values within spread of the given value, leaving out the value itself and anything outside of
+// zero to max
+func getSpread(value uint64, spread int, max uint64) []uint64 {
+	var toReturn []uint64
+	for i := -spread; i <= spread; i++ {
+		if i == 0 || (i < 0 && uint64(-i) > value) || (i > 0 && value+uint64(i) > max) {
+			continue
+		}
+		toReturn = append(toReturn, uint64(int64(value)+int64(i)))
+	}
+	return toReturn
+}
+
+// Whether the interface identifier is an IPv4 address written as hex in the last 32 bits
+func isHexIPv4IID(iid uint64) bool {
+	return iid>>32 == 0 && iid > 0xffff
+}
+
+// Get the octets of an IPv4 address written with each octet in a group of decimal digits
+// (ie: ::192:168:1:10)
+func getDecimalIPv4Octets(iid uint64) ([4]uint8, bool) {
+	var toReturn [4]uint8
+	if iid>>48 == 0 {
+		return toReturn, false
+	}
+	for i := 0; i < 4; i++ {
+		group := (iid >> uint(48-16*i)) & 0xffff
+		value, err := strconv.ParseUint(strconv.FormatUint(group, 16), 10, 8)
+		if err != nil {
+			return toReturn, false
+		}
+		toReturn[i] = uint8(value)
+	}
+	return toReturn, true
+}
+
+func getDecimalIPv4IID(octets [4]uint8) uint64 {
+	var toReturn uint64
+	for _, octet := range octets {
+		group, _ := strconv.ParseUint(strconv.Itoa(int(octet)), 16, 16)
+		toReturn = toReturn<<16 | group
+	}
+	return toReturn
+}
+
+// Parse an interface identifier written as up to four colon-separated groups of hex digits, with the
+// groups aligned to the end of the address (ie: "dead:beef" is ::dead:beef)
+func parseIIDGroups(toParse string) (uint64, error) {
+	groups := strings.Split(strings.TrimPrefix(toParse, "::"), ":")
+	if len(groups) > 4 {
+		return 0, fmt.Errorf("'%s' has more than four groups", toParse)
+	}
+	var toReturn uint64
+	for _, group := range groups {
+		value, err := strconv.ParseUint(group, 16, 16)
+		if err != nil {
+			return 0, fmt.Errorf("'%s' is not a valid interface identifier: %s", toParse, err)
+		}
+		toReturn = toReturn<<16 | value
+	}
+	return toReturn, nil
+}
+
+func parseSpread(toParse string) (int, error) {
+	spread, err := strconv.Atoi(toParse)
+	if err != nil || spread < 0 {
+		return 0, fmt.Errorf("'%s' is not a valid spread (expected a non-negative number)", toParse)
+	}
+	return spread, nil
+}
+
+func parsePatternRule(fields []string) (PatternRule, error) {
+	switch fields[0] {
+	case "lowbyte":
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("expected 'lowbyte <from>-<to>'")
+		}
+		bounds := strings.Split(fields[1], "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("'%s' is not a range (expected <from>-<to>, such as 1-ff)", fields[1])
+		}
+		from, err := strconv.ParseUint(bounds[0], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a valid hex value: %s", bounds[0], err)
+		}
+		to, err := strconv.ParseUint(bounds[1], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a valid hex value: %s", bounds[1], err)
+		} else if to < from {
+			return nil, fmt.Errorf("the range %s ends before it starts", fields[1])
+		}
+		return &lowBytePatternRule{From: from, To: to}, nil
+	case "port", "word":
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("expected '%s <value>,<value>,...'", fields[0])
+		}
+		rule := &fixedPatternRule{}
+		for _, value := range strings.Split(fields[1], ",") {
+			if fields[0] == "port" {
+				if port, err := strconv.ParseUint(value, 10, 16); err != nil {
+					return nil, fmt.Errorf("'%s' is not a valid port", value)
+				} else if port > 9999 {
+					return nil, fmt.Errorf("port %d has more than four digits and cannot be written as a single group", port)
+				}
+			}
+			iid, err := parseIIDGroups(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.IIDs = append(rule.IIDs, iid)
+		}
+		return rule, nil
+	case "ipv4":
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("expected 'ipv4 <spread>'")
+		}
+		spread, err := parseSpread(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		return &embeddedIPv4PatternRule{Spread: spread}, nil
+	case "eui64":
+		if len(fields) != 2 && len(fields) != 3 {
+			return nil, fmt.Errorf("expected 'eui64 <spread> [<oui>,<oui>,...]'")
+		}
+		spread, err := parseSpread(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		rule := &eui64PatternRule{Spread: spread, OUIs: make(map[uint32]struct{})}
+		if len(fields) == 3 {
+			ouis, err := oui.ParseOUIs(fields[2])
+			if err != nil {
+				return nil, err
+			}
+			for _, value := range ouis {
+				rule.OUIs[value] = struct{}{}
+			}
+		}
+		return rule, nil
+	default:
+		return nil, fmt.Errorf("'%s' is not a known rule (expected one of lowbyte, port, word, ipv4, or eui64)", fields[0])
+	}
+}
+
+// Parse pattern rules, one per line. Blank lines and anything after a '#' are ignored.
+func ParsePatternRules(reader io.Reader) ([]PatternRule, error) {
+	var toReturn []PatternRule
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(strings.ToLower(line))
+		if len(fields) == 0 {
+			continue
+		}
+		rule, err := parsePatternRule(fields)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern rule on line %d: %s", lineNumber, err)
+		}
+		toReturn = append(toReturn, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return toReturn, nil
+}
+
+// Load the pattern rules from the file at the given path, or the default rules if the path is empty
+func LoadPatternRules(filePath string) ([]PatternRule, error) {
+	if filePath == "" {
+		return ParsePatternRules(strings.NewReader(defaultPatternRules))
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	rules, err := ParsePatternRules(file)
+	if err != nil {
+		return nil, fmt.Errorf("error thrown when reading pattern rules from '%s': %s", filePath, err)
+	}
+	return rules, nil
+}
+
+// Get the interface identifiers that have been discovered in each /64 network
+func getDiscovered64Networks() (map[uint64][]uint64, error) {
+	toReturn := make(map[uint64][]uint64)
+	err := data.ForEachCleanPingResult(func(cleanPing addressing.IPv6) error {
+		toReturn[cleanPing.High] = append(toReturn[cleanPing.High], cleanPing.Low)
+		return nil
+	})
+	return toReturn, err
+}
+
+// Generate hosts in the discovered /64 networks that follow the pattern rules. The hosts are filtered as
+// they are generated, so that the maximum only counts hosts that have not been scanned before and each
+// loop gets past the hosts that the loops before it scanned.
+func generatePatternHosts(ips chan<- addressing.IPv6, filter func(addressing.IPv6) bool) error {
+
+	rules, err := LoadPatternRules(viper.GetString("FanOutPatternRulesFile"))
+	if err != nil {
+		return err
+	}
+	networks, err := getDiscovered64Networks()
+	if err != nil {
+		return err
+	}
+
+	logging.Infof("Fanning out from %d discovered /64 networks with %d pattern rules", len(networks), len(rules))
+
+	generatePatternHostsInNetworks(ips, filter, networks, rules, viper.GetInt("FanOutPatternMaxHosts"))
+	return nil
+}
+
+func generatePatternHostsInNetworks(ips chan<- addressing.IPv6, filter func(addressing.IPv6) bool, networks map[uint64][]uint64, rules []PatternRule, maxHosts int) {
+
+	// Go through the networks in order so that runs over the same networks attempt the same hosts
+	var highs []uint64
+	for high := range networks {
+		highs = append(highs, high)
+	}
+	sort.Slice(highs, func(i, j int) bool { return highs[i] < highs[j] })
+
+	count := 0
+	for _, high := range highs {
+		observed := networks[high]
+		genIIDs := make(map[uint64]struct{})
+		for _, iid := range observed {
+			genIIDs[iid] = struct{}{}
+		}
+		for _, rule := range rules {
+			for _, iid := range rule.GetIIDs(observed) {
+				if _, ok := genIIDs[iid]; ok {
+					continue
+				}
+				genIIDs[iid] = struct{}{}
+				ip := addressing.IPv6{High: high, Low: iid}
+				if !filter(ip) {
+					continue
+				}
+				ips <- ip
+				count += 1
+				if count >= maxHosts {
+					logging.Infof("Hit the maximum of %d pattern hosts.", maxHosts)
+					return
+				}
+			}
+		}
+	}
+}
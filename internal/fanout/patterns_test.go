@@ -0,0 +1,95 @@
+package fanout
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestParsePatternRules_Default(t *testing.T) {
+	rules, err := LoadPatternRules("")
+	assert.Nil(t, err)
+	assert.Len(t, rules, 5)
+}
+
+func TestParsePatternRules_Rules(t *testing.T) {
+	rules, err := ParsePatternRules(strings.NewReader(`
+# A comment
+lowbyte 1-3
+port 80,443   # Trailing comment
+word dead:beef,::cafe
+ipv4 1
+EUI64 2 00:1b:21
+`))
+	assert.Nil(t, err)
+	assert.Len(t, rules, 5)
+	assert.Equal(t, &lowBytePatternRule{From: 1, To: 3}, rules[0])
+	assert.Equal(t, []uint64{1, 2, 3}, rules[0].GetIIDs(nil))
+	assert.Equal(t, []uint64{0x80, 0x443}, rules[1].GetIIDs(nil))
+	assert.Equal(t, []uint64{0xdeadbeef, 0xcafe}, rules[2].GetIIDs(nil))
+	assert.Equal(t, &embeddedIPv4PatternRule{Spread: 1}, rules[3])
+	assert.Equal(t, &eui64PatternRule{Spread: 2, OUIs: map[uint32]struct{}{0x001b21: {}}}, rules[4])
+}
+
+func TestParsePatternRules_Errors(t *testing.T) {
+	for _, toParse := range []string{
+		"lowbyte ff-1",
+		"lowbyte 1",
+		"port 80000",
+		"port http",
+		"word 1:2:3:4:5",
+		"ipv4 -1",
+		"eui64 2 00:1b",
+		"ping 1",
+	} {
+		_, err := ParsePatternRules(strings.NewReader("lowbyte 1-ff\n" + toParse))
+		if assert.NotNil(t, err, toParse) {
+			assert.Contains(t, err.Error(), "line 2")
+		}
+	}
+}
+
+func TestEmbeddedIPv4PatternRule_GetIIDs(t *testing.T) {
+	rule := &embeddedIPv4PatternRule{Spread: 2}
+
+	// ::192:168:1:10, ::c0a8:1ff (192.168.1.255), and a low-byte address that holds no IPv4 address
+	iids := rule.GetIIDs([]uint64{0x0192016800010010, 0xc0a801ff, 0x1})
+	assert.Equal(t, []uint64{
+		0x0192016800010008, 0x0192016800010009, 0x0192016800010011, 0x0192016800010012,
+		0xc0a801fd, 0xc0a801fe,
+	}, iids)
+}
+
+func TestEUI64PatternRule_GetIIDs(t *testing.T) {
+
+	// Built from MAC addresses 00:1b:21:00:00:10 and 3c:fd:fe:00:00:01
+	intel := uint64(0x021b21fffe000010)
+	other := uint64(0x3efdfefffe000001)
+	rule := &eui64PatternRule{Spread: 1, OUIs: map[uint32]struct{}{}}
+	assert.Equal(t, []uint64{intel - 1, intel + 1, other - 1, other + 1}, rule.GetIIDs([]uint64{intel, other, 0x1}))
+
+	rule.OUIs[0x001b21] = struct{}{}
+	assert.Equal(t, []uint64{intel - 1, intel + 1}, rule.GetIIDs([]uint64{intel, other}))
+}
+
+func TestGetSpread_StaysInBounds(t *testing.T) {
+	assert.Equal(t, []uint64{1, 2}, getSpread(0, 2, 255))
+	assert.Equal(t, []uint64{253, 254}, getSpread(255, 2, 255))
+}
+
+func TestGeneratePatternHostsInNetworks_CountsOnlyFilteredHosts(t *testing.T) {
+	networks := map[uint64][]uint64{0x2600123400000001: {0x1}, 0x2600123400000002: {0x1}}
+	rules := []PatternRule{&lowBytePatternRule{From: 1, To: 4}}
+
+	// The hosts in the first network were scanned by an earlier loop, so the maximum is spent on the second
+	scanned := func(ip addressing.IPv6) bool { return ip.High != 0x2600123400000001 }
+	ips := make(chan addressing.IPv6, 10)
+	generatePatternHostsInNetworks(ips, scanned, networks, rules, 2)
+	close(ips)
+	var generated []addressing.IPv6
+	for ip := range ips {
+		generated = append(generated, ip)
+	}
+	assert.Equal(t, []addressing.IPv6{{High: 0x2600123400000002, Low: 2}, {High: 0x2600123400000002, Low: 3}}, generated)
+}
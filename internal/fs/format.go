@@ -0,0 +1,400 @@
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/modeling"
+	"github.com/ekaley/ipv666/internal/persist"
+	"github.com/spf13/viper"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+)
+
+// The names of the formats that addresses and networks can be read in
+const (
+	AutoFormat    = "auto" // Tell the format from the content of each input file
+	TextFormat    = "txt"
+	FatHexFormat  = "hex"
+	BinaryFormat  = "bin"
+	TreeFormat    = "tree"
+	NetworkFormat = "cidr"
+)
+
+type NetworkFunc func(*net.IPNet) error
+
+var (
+	binaryMagic = []byte("IPV666BN")
+	treeMagic   = []byte("IPV666TR")
+)
+
+// A way of storing IPv6 addresses (or network ranges) in a file. Binary formats are written with a magic
+// header so that they are never mistaken for another format, but are read with or without one so that
+// files written before the headers were added can still be read.
+type InputFormat struct {
+	Name           string
+	Description    string
+	Magic          []byte
+	forEachIP      func(reader *bufio.Reader, fn IPFunc) error
+	forEachNetwork func(reader *bufio.Reader, fn NetworkFunc) error
+	write          func(writer io.Writer, addrs []addressing.IPv6) error
+}
+
+var inputFormats = []*InputFormat{
+	{
+		Name:        TextFormat,
+		Description: "standard IPv6 addresses, one per line (anything after the address on a line is ignored)",
+		forEachIP:   forEachIPInTextLines(TextFormat, parseTextLine),
+		write:       writeTextIPs,
+	},
+	{
+		Name:        FatHexFormat,
+		Description: "32 hex characters per address without colons, one per line",
+		forEachIP:   forEachIPInTextLines(FatHexFormat, parseFatHexLine),
+		write:       writeFatHexIPs,
+	},
+	{
+		Name:        BinaryFormat,
+		Description: "packed 16-byte addresses",
+		Magic:       binaryMagic,
+		forEachIP:   forEachIPInBinary,
+		write:       writeBinaryIPs,
+	},
+	{
+		Name:        TreeFormat,
+		Description: "an address tree",
+		Magic:       treeMagic,
+		forEachIP:   forEachIPInTree,
+		write:       writeTreeIPs,
+	},
+	{
+		Name:           NetworkFormat,
+		Description:    "IPv6 network ranges in CIDR notation, one per line",
+		forEachNetwork: forEachNetworkInTextLines,
+	},
+}
+
+// An input that does not hold what its format says it should
+type FormatError struct {
+	Path   string
+	Format string
+	Line   int // The line number in text formats (starting from 1), or 0
+	Reason string
+}
+
+func (err *FormatError) Error() string {
+	if err.Line > 0 {
+		return fmt.Sprintf("line %d of input '%s' is not valid %s: %s", err.Line, err.Path, err.Format, err.Reason)
+	}
+	return fmt.Sprintf("input '%s' is not valid %s: %s", err.Path, err.Format, err.Reason)
+}
+
+func GetInputFormat(name string) (*InputFormat, error) {
+	for _, format := range inputFormats {
+		if format.Name == name {
+			return format, nil
+		}
+	}
+	return nil, fmt.Errorf("'%s' is not a known input format (expected one of %s)", name, strings.Join(GetInputFormatNames(false), ", "))
+}
+
+// Get the names of the formats that addresses (or, if networks is true, network ranges) can be read from,
+// including AutoFormat. Addresses read as network ranges are each taken as a /128.
+func GetInputFormatNames(networks bool) []string {
+	toReturn := []string{AutoFormat}
+	for _, format := range inputFormats {
+		if format.forEachIP != nil || networks {
+			toReturn = append(toReturn, format.Name)
+		}
+	}
+	return toReturn
+}
+
+// Check that addresses (or, if networks is true, network ranges) can be read in the named format
+func ValidateInputFormat(name string, networks bool) error {
+	for _, formatName := range GetInputFormatNames(networks) {
+		if formatName == name {
+			return nil
+		}
+	}
+	if _, err := GetInputFormat(name); err != nil {
+		return err
+	}
+	return fmt.Errorf("addresses cannot be read from the %s format (expected one of %s)", name, strings.Join(GetInputFormatNames(networks), ", "))
+}
+
+// Write addresses to a file in the named format, starting with its magic header if it has one
+func WriteIPsToFile(filePath string, formatName string, addrs []addressing.IPv6) error {
+	format, err := GetInputFormat(formatName)
+	if err != nil {
+		return err
+	} else if format.write == nil {
+		return fmt.Errorf("addresses cannot be written in the %s format", formatName)
+	}
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	writer.Write(format.Magic)
+	if err := format.write(writer, addrs); err != nil {
+		file.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Tell the format of an input from its first bytes. Binary formats are told apart by their magic headers,
+// and text formats by the first line that is not blank or a comment. Binary content without a header is
+// from before the headers were added, and is read as either an address tree or packed addresses.
+func DetectInputFormat(head []byte) (*InputFormat, error) {
+	for _, format := range inputFormats {
+		if format.Magic != nil && bytes.HasPrefix(head, format.Magic) {
+			return format, nil
+		}
+	}
+	if !isText(head) {
+		return headerlessBinaryFormat, nil
+	}
+	lines := strings.Split(string(head), "\n")
+	for i, line := range lines {
+		if i == len(lines)-1 && len(lines) > 1 && len(head) == inputPeekSize {
+			break // The last line may have been cut short
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if strings.Contains(fields[0], "/") {
+			return GetInputFormat(NetworkFormat)
+		} else if strings.Contains(fields[0], ":") {
+			return GetInputFormat(TextFormat)
+		} else if _, err := fatHexStringToIP(fields[0]); err == nil {
+			return GetInputFormat(FatHexFormat)
+		}
+		return nil, fmt.Errorf("could not tell the input format from line %d ('%s'), please give the format explicitly", i+1, line)
+	}
+	return GetInputFormat(TextFormat)
+}
+
+// Address trees are encoded as msgpack maps
+func isMsgpackMap(firstByte byte) bool {
+	return (firstByte >= 0x80 && firstByte <= 0x8f) || firstByte == 0xde || firstByte == 0xdf
+}
+
+func isText(content []byte) bool {
+	for _, curByte := range content {
+		if (curByte < 0x20 || curByte > 0x7e) && curByte != '\n' && curByte != '\r' && curByte != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// Binary content that does not start with a magic header. Only content that starts like an address tree
+// is read into memory (to try decoding it as one), and everything else is streamed as packed addresses.
+var headerlessBinaryFormat = &InputFormat{
+	Name: "headerless binary",
+	forEachIP: func(reader *bufio.Reader, fn IPFunc) error {
+		if head, err := reader.Peek(1); err != nil || !isMsgpackMap(head[0]) {
+			return forEachIPInBinary(reader, fn)
+		}
+		content, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		var tree modeling.AddressTree
+		if err := persist.Unmarshal(content, &tree); err == nil {
+			return forEachIPInSlice(tree.GetAllIPs(), fn)
+		}
+		return forEachIPInBinary(bufio.NewReader(bytes.NewReader(content)), fn)
+	},
+}
+
+// Call fn with each of the addresses in the reader, checking for each format's own errors and giving up at
+// the first error returned by fn
+func (format *InputFormat) ForEachIP(reader *bufio.Reader, fn IPFunc) error {
+	if format.forEachIP == nil {
+		return &FormatError{
+			Format: format.Name,
+			Reason: "it holds network ranges rather than addresses",
+		}
+	}
+	return format.forEachIP(reader, fn)
+}
+
+// Call fn with each of the network ranges in the reader. Addresses are each taken as a /128.
+func (format *InputFormat) ForEachNetwork(reader *bufio.Reader, fn NetworkFunc) error {
+	if format.forEachNetwork != nil {
+		return format.forEachNetwork(reader, fn)
+	}
+	return format.forEachIP(reader, func(addr addressing.IPv6) error {
+		return fn(&net.IPNet{
+			IP:   addr.ToIP(),
+			Mask: net.CIDRMask(128, 128),
+		})
+	})
+}
+
+func forEachIPInSlice(addrs []addressing.IPv6, fn IPFunc) error {
+	for _, addr := range addrs {
+		if err := fn(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Call fn with the line number and content of each of the lines that are not blank or comments
+func forEachTextLine(reader io.Reader, fn func(int, string) error) error {
+	lineScanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for lineScanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(lineScanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(lineNumber, line); err != nil {
+			return err
+		}
+	}
+	return lineScanner.Err()
+}
+
+func forEachIPInTextLines(formatName string, parseLine func(string) (addressing.IPv6, error)) func(*bufio.Reader, IPFunc) error {
+	return func(reader *bufio.Reader, fn IPFunc) error {
+		return forEachTextLine(reader, func(lineNumber int, line string) error {
+			newIP, err := parseLine(line)
+			if err != nil {
+				return &FormatError{
+					Format: formatName,
+					Line:   lineNumber,
+					Reason: err.Error(),
+				}
+			}
+			return fn(newIP)
+		})
+	}
+}
+
+func forEachNetworkInTextLines(reader *bufio.Reader, fn NetworkFunc) error {
+	return forEachTextLine(reader, func(lineNumber int, line string) error {
+		field := strings.Fields(line)[0]
+		_, network, err := net.ParseCIDR(field)
+		if err != nil {
+			return &FormatError{
+				Format: NetworkFormat,
+				Line:   lineNumber,
+				Reason: fmt.Sprintf("'%s' is not a network range in CIDR notation", field),
+			}
+		}
+		return fn(network)
+	})
+}
+
+func parseTextLine(line string) (addressing.IPv6, error) {
+	field := strings.Fields(line)[0] // Ping results may list the answering port after the address
+	newIP, ok := addressing.ParseIPv6(field)
+	if !ok {
+		return addressing.IPv6{}, fmt.Errorf("'%s' is not an IPv6 address", field)
+	}
+	return newIP, nil
+}
+
+func parseFatHexLine(line string) (addressing.IPv6, error) {
+	field := strings.Fields(line)[0]
+	newIP, err := fatHexStringToIP(field)
+	if err != nil {
+		return addressing.IPv6{}, fmt.Errorf("'%s' is not an IPv6 address of 32 hex characters", field)
+	}
+	return newIP, nil
+}
+
+func forEachIPInBinary(reader *bufio.Reader, fn IPFunc) error {
+	if head, _ := reader.Peek(len(binaryMagic)); bytes.Equal(head, binaryMagic) {
+		reader.Discard(len(head))
+	}
+	var ipBytes [net.IPv6len]byte
+	for {
+		count, err := io.ReadFull(reader, ipBytes[:])
+		if err == io.EOF {
+			return nil
+		} else if err == io.ErrUnexpectedEOF {
+			return &FormatError{
+				Format: BinaryFormat,
+				Reason: fmt.Sprintf("it ends partway through an address (%d bytes of %d)", count, net.IPv6len),
+			}
+		} else if err != nil {
+			return err
+		}
+		if err := fn(addressing.NewIPv6FromBytes(ipBytes)); err != nil {
+			return err
+		}
+	}
+}
+
+func forEachIPInTree(reader *bufio.Reader, fn IPFunc) error {
+	if head, _ := reader.Peek(len(treeMagic)); bytes.Equal(head, treeMagic) {
+		reader.Discard(len(head))
+	}
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	var tree modeling.AddressTree
+	if err := persist.Unmarshal(content, &tree); err != nil {
+		return &FormatError{
+			Format: TreeFormat,
+			Reason: err.Error(),
+		}
+	}
+	return forEachIPInSlice(tree.GetAllIPs(), fn)
+}
+
+func writeTextIPs(writer io.Writer, addrs []addressing.IPv6) error {
+	for _, addr := range addrs {
+		if _, err := io.WriteString(writer, addr.String()+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFatHexIPs(writer io.Writer, addrs []addressing.IPv6) error {
+	for _, addr := range addrs {
+		addrBytes := addr.Bytes()
+		if _, err := fmt.Fprintf(writer, "%x\n", addrBytes[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeBinaryIPs(writer io.Writer, addrs []addressing.IPv6) error {
+	for _, addr := range addrs {
+		addrBytes := addr.Bytes()
+		if _, err := writer.Write(addrBytes[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTreeIPs(writer io.Writer, addrs []addressing.IPv6) error {
+	tree := modeling.CreateFromAddresses(addrs, viper.GetInt("LogLoopEmitFreq"))
+	content, err := persist.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(content)
+	return err
+}
@@ -0,0 +1,156 @@
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/modeling"
+	"github.com/ekaley/ipv666/internal/persist"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectInputFormat(t *testing.T) {
+	cases := map[string]string{
+		"IPV666BN\x26\x00":                         BinaryFormat,
+		"IPV666TR\x82":                             TreeFormat,
+		"# Hitlist\n\n2600::1\n":                   TextFormat,
+		"2600::/32\n2601::/32\n":                   NetworkFormat,
+		"26000000000000000000000000000001\n":       FatHexFormat,
+		"2600::1 443 retried\n":                    TextFormat,
+		"2600:1234::abcd\n":                        TextFormat, // 16 bytes long, which is not enough to make it binary
+		"\x26\x00\x00\x00\x00\x00\x00\x00\x00\x00": headerlessBinaryFormat.Name,
+		"": TextFormat,
+	}
+	for head, expected := range cases {
+		format, err := DetectInputFormat([]byte(head))
+		assert.Nil(t, err, head)
+		assert.EqualValues(t, expected, format.Name, head)
+	}
+	_, err := DetectInputFormat([]byte("# Hitlist\nnot-an-address\n"))
+	assert.NotNil(t, err)
+}
+
+func TestWriteIPsToFile_RoundTrip(t *testing.T) {
+	viper.Set("LogLoopEmitFreq", 1000)
+	defer viper.Set("LogLoopEmitFreq", nil)
+	dir := t.TempDir()
+	for _, formatName := range []string{TextFormat, FatHexFormat, BinaryFormat, TreeFormat} {
+		filePath := filepath.Join(dir, formatName)
+		assert.Nil(t, WriteIPsToFile(filePath, formatName, streamTestIPs))
+		format, _ := GetInputFormat(formatName)
+		if format.Magic != nil {
+			content, _ := ioutil.ReadFile(filePath)
+			assert.EqualValues(t, format.Magic, content[:len(format.Magic)])
+		}
+		for _, readFormat := range []string{AutoFormat, formatName} {
+			read, err := ReadIPsFromInput(filePath, readFormat)
+			assert.Nil(t, err)
+			assert.ElementsMatch(t, streamTestIPs, read, formatName)
+		}
+	}
+	assert.NotNil(t, WriteIPsToFile(filepath.Join(dir, "cidr"), NetworkFormat, streamTestIPs))
+}
+
+func TestReadIPsFromInput_HeaderlessTree(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "tree")
+	content, err := persist.Marshal(modeling.CreateFromAddresses(streamTestIPs, 1000))
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(filePath, content, 0644))
+	read, err := ReadIPsFromFile(filePath)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, streamTestIPs, read)
+}
+
+// A reader that fails once it gets past the content it was given
+type failingReader struct {
+	content io.Reader
+}
+
+func (reader *failingReader) Read(p []byte) (int, error) {
+	count, err := reader.content.Read(p)
+	if err == io.EOF {
+		return count, errors.New("read past the end of the content")
+	}
+	return count, err
+}
+
+func TestHeaderlessBinaryFormat_StreamsPackedAddresses(t *testing.T) {
+	// The first address is handed over before the rest of the input is read
+	ipBytes := streamTestIPs[0].Bytes()
+	reader := bufio.NewReader(&failingReader{content: bytes.NewReader(ipBytes[:])})
+	stopErr := errors.New("stop")
+	var read []addressing.IPv6
+	err := headerlessBinaryFormat.ForEachIP(reader, func(addr addressing.IPv6) error {
+		read = append(read, addr)
+		return stopErr
+	})
+	assert.Equal(t, stopErr, err)
+	assert.EqualValues(t, streamTestIPs[:1], read)
+}
+
+func TestReadIPsFromInput_FormatErrors(t *testing.T) {
+	dir := t.TempDir()
+	textPath := filepath.Join(dir, "txt")
+	assert.Nil(t, ioutil.WriteFile(textPath, []byte("2600::1\n\nnot-an-address\n2600::2\n"), 0644))
+	_, err := ReadIPsFromInput(textPath, AutoFormat)
+	assert.EqualValues(t, &FormatError{Path: textPath, Format: TextFormat, Line: 3, Reason: "'not-an-address' is not an IPv6 address"}, err)
+
+	_, err = ReadIPsFromInput(textPath, FatHexFormat)
+	formatErr, ok := err.(*FormatError)
+	assert.True(t, ok)
+	assert.EqualValues(t, 1, formatErr.Line)
+
+	binaryPath := filepath.Join(dir, "bin")
+	assert.Nil(t, ioutil.WriteFile(binaryPath, append([]byte("IPV666BN"), make([]byte, 20)...), 0644))
+	_, err = ReadIPsFromInput(binaryPath, AutoFormat)
+	formatErr, ok = err.(*FormatError)
+	assert.True(t, ok)
+	assert.EqualValues(t, BinaryFormat, formatErr.Format)
+
+	networkPath := filepath.Join(dir, "cidr")
+	assert.Nil(t, ioutil.WriteFile(networkPath, []byte("2600::/32\n"), 0644))
+	_, err = ReadIPsFromInput(networkPath, AutoFormat)
+	assert.NotNil(t, err)
+}
+
+func TestReadNetworksFromInput(t *testing.T) {
+	dir := t.TempDir()
+	networkPath := filepath.Join(dir, "cidr")
+	assert.Nil(t, ioutil.WriteFile(networkPath, []byte("# Aliased\n2600::/32\n2601:1234::/64 seen twice\n"), 0644))
+	networks, err := ReadNetworksFromInput(networkPath, AutoFormat)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"2600::/32", "2601:1234::/64"}, getNetworkStrings(networks))
+
+	textPath := filepath.Join(dir, "txt")
+	assert.Nil(t, WriteIPsToFile(textPath, TextFormat, streamTestIPs[:1]))
+	networks, err = ReadNetworksFromInput(textPath, AutoFormat)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"2600::1/128"}, getNetworkStrings(networks))
+
+	assert.Nil(t, ioutil.WriteFile(networkPath, []byte("2600::/32\n2600::1\n"), 0644))
+	_, err = ReadNetworksFromInput(networkPath, NetworkFormat)
+	assert.EqualValues(t, 2, err.(*FormatError).Line)
+}
+
+func TestValidateInputFormat(t *testing.T) {
+	assert.Nil(t, ValidateInputFormat(AutoFormat, false))
+	assert.Nil(t, ValidateInputFormat(TreeFormat, false))
+	assert.NotNil(t, ValidateInputFormat(NetworkFormat, false))
+	assert.Nil(t, ValidateInputFormat(NetworkFormat, true))
+	assert.NotNil(t, ValidateInputFormat("csv", true))
+}
+
+func getNetworkStrings(networks []*net.IPNet) []string {
+	var toReturn []string
+	for _, network := range networks {
+		toReturn = append(toReturn, network.String())
+	}
+	return toReturn
+}
@@ -86,6 +86,22 @@ func GetNonMostRecentFilesFromDirectory(dirPath string) ([]string, error) {
 	return toReturn, nil
 }
 
+// Get the names of the regular files in the directory in lexical order
+func GetFilesFromDirectory(dirPath string) ([]string, error) {
+	files, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		logging.Warnf("Error thrown when reading files from directory '%s': %s", dirPath, err)
+		return nil, err
+	}
+	var toReturn []string
+	for _, fi := range files {
+		if fi.Mode().IsRegular() {
+			toReturn = append(toReturn, fi.Name())
+		}
+	}
+	return toReturn, nil
+}
+
 func ZipFiles(inputPaths []string, outputPath string) error {
 	logging.Debugf("Zipping up %d files (at %s) into output path of '%s'.", len(inputPaths), inputPaths, outputPath)
 	outFile, err := os.Create(outputPath)
@@ -0,0 +1,199 @@
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The input path that reads addresses from standard input
+const StdinPath = "-"
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// How far into an input to look when telling its format
+const inputPeekSize = 4096
+
+// Whether there is an input to read at the given path (standard input always counts as one)
+func InputExists(inputPath string) bool {
+	if inputPath == StdinPath {
+		return true
+	}
+	_, err := os.Stat(inputPath)
+	return err == nil
+}
+
+// Get the files that make up an input. A directory is made up of all of the files beneath it (skipping
+// hidden ones) in lexical order, so that a corpus can be split into shards.
+func GetInputFiles(inputPath string) ([]string, error) {
+	if inputPath == StdinPath {
+		return []string{StdinPath}, nil
+	}
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return []string{inputPath}, nil
+	}
+	var toReturn []string
+	err = filepath.Walk(inputPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath != inputPath && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			toReturn = append(toReturn, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(toReturn)
+	return toReturn, nil
+}
+
+type inputReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (reader *inputReader) Close() error {
+	var toReturn error
+	for i := len(reader.closers) - 1; i >= 0; i-- {
+		if err := reader.closers[i].Close(); err != nil && toReturn == nil {
+			toReturn = err
+		}
+	}
+	return toReturn
+}
+
+type closerFunc func()
+
+func (fn closerFunc) Close() error {
+	fn()
+	return nil
+}
+
+// Open a file (or standard input) for reading, decompressing it if it is gzip, xz or zstd compressed. The
+// compression is found from the content rather than the file name so that compressed standard input works.
+func OpenInput(filePath string) (io.ReadCloser, error) {
+	toReturn := &inputReader{}
+	var source io.Reader
+	if filePath == StdinPath {
+		source = os.Stdin
+	} else {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return nil, err
+		}
+		source = file
+		toReturn.closers = append(toReturn.closers, file)
+	}
+	buffered := bufio.NewReader(source)
+	head, _ := buffered.Peek(len(xzMagic))
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			toReturn.Close()
+			return nil, err
+		}
+		toReturn.Reader = gzipReader
+		toReturn.closers = append(toReturn.closers, gzipReader)
+	case bytes.HasPrefix(head, xzMagic):
+		xzReader, err := xz.NewReader(buffered)
+		if err != nil {
+			toReturn.Close()
+			return nil, err
+		}
+		toReturn.Reader = xzReader
+	case bytes.HasPrefix(head, zstdMagic):
+		zstdReader, err := zstd.NewReader(buffered)
+		if err != nil {
+			toReturn.Close()
+			return nil, err
+		}
+		toReturn.Reader = zstdReader
+		toReturn.closers = append(toReturn.closers, closerFunc(zstdReader.Close))
+	default:
+		toReturn.Reader = buffered
+	}
+	return toReturn, nil
+}
+
+// Call fn with each of the addresses in an input, which may be a file, a directory of shards or standard
+// input (StdinPath), any of them compressed. The files are read in the named format, or with AutoFormat in
+// the format told from the content of each. Text and packed binary inputs are read a piece at a time so
+// that they never have to be held in memory. Stops at the first line or piece that is not valid in the
+// format (returning a FormatError), or at the first error returned by fn.
+func ForEachIPInInput(inputPath string, formatName string, fn IPFunc) error {
+	return forEachInputFile(inputPath, formatName, func(format *InputFormat, reader *bufio.Reader) error {
+		return format.ForEachIP(reader, fn)
+	})
+}
+
+// Call fn with each of the network ranges in an input, read as ForEachIPInInput reads addresses
+func ForEachNetworkInInput(inputPath string, formatName string, fn NetworkFunc) error {
+	return forEachInputFile(inputPath, formatName, func(format *InputFormat, reader *bufio.Reader) error {
+		return format.ForEachNetwork(reader, fn)
+	})
+}
+
+func forEachInputFile(inputPath string, formatName string, fn func(*InputFormat, *bufio.Reader) error) error {
+	var format *InputFormat
+	if formatName != AutoFormat {
+		var err error
+		if format, err = GetInputFormat(formatName); err != nil {
+			return err
+		}
+	}
+	filePaths, err := GetInputFiles(inputPath)
+	if err != nil {
+		return err
+	}
+	for _, filePath := range filePaths {
+		if err := forEachInputFileInFormat(filePath, format, fn); err != nil {
+			if formatErr, ok := err.(*FormatError); ok {
+				formatErr.Path = filePath
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func forEachInputFileInFormat(filePath string, format *InputFormat, fn func(*InputFormat, *bufio.Reader) error) error {
+	input, err := OpenInput(filePath)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	reader := bufio.NewReaderSize(input, inputPeekSize)
+	if format == nil {
+		head, _ := reader.Peek(inputPeekSize)
+		if format, err = DetectInputFormat(head); err != nil {
+			return fmt.Errorf("input '%s': %s", filePath, err)
+		}
+		logging.Debugf("Reading input '%s' in the %s format.", filePath, format.Name)
+	}
+	return fn(format, reader)
+}
@@ -0,0 +1,98 @@
+package fs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/ulikunitz/xz"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var inputTestContent = "# Addresses\n2600::1\n2600:1234::abcd 443\n\nfe80::1\n"
+
+func collectInput(t *testing.T, inputPath string) []addressing.IPv6 {
+	var toReturn []addressing.IPv6
+	err := ForEachIPInInput(inputPath, AutoFormat, func(ip addressing.IPv6) error {
+		toReturn = append(toReturn, ip)
+		return nil
+	})
+	assert.Nil(t, err)
+	return toReturn
+}
+
+func compressInput(t *testing.T, content []byte, newWriter func(io.Writer) (io.WriteCloser, error)) []byte {
+	var buffer bytes.Buffer
+	writer, err := newWriter(&buffer)
+	assert.Nil(t, err)
+	_, err = writer.Write(content)
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+	return buffer.Bytes()
+}
+
+func TestForEachIPInInput_Compressed(t *testing.T) {
+	writers := map[string]func(io.Writer) (io.WriteCloser, error){
+		"ips.gz": func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		"ips.xz": func(w io.Writer) (io.WriteCloser, error) {
+			return xz.NewWriter(w)
+		},
+		"ips.zst": func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		},
+	}
+	dir := t.TempDir()
+	for fileName, newWriter := range writers {
+		filePath := filepath.Join(dir, fileName)
+		assert.Nil(t, ioutil.WriteFile(filePath, compressInput(t, []byte(inputTestContent), newWriter), 0644))
+		assert.EqualValues(t, streamTestIPs, collectInput(t, filePath), fileName)
+		read, err := ReadIPsFromFile(filePath)
+		assert.Nil(t, err)
+		assert.EqualValues(t, streamTestIPs, read, fileName)
+	}
+}
+
+func TestForEachIPInInput_Directory(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "shards"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "shards", "b"), []byte("fe80::1\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a"), []byte("2600::1\n2600:1234::abcd\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, ".hidden"), []byte("2600::ffff\n"), 0644))
+	assert.EqualValues(t, streamTestIPs, collectInput(t, dir))
+}
+
+func TestForEachIPInInput_FatHexAndBinary(t *testing.T) {
+	dir := t.TempDir()
+	fatHexPath := filepath.Join(dir, "fathex")
+	assert.Nil(t, WriteIPsToFile(fatHexPath, FatHexFormat, streamTestIPs))
+	assert.EqualValues(t, streamTestIPs, collectInput(t, fatHexPath))
+
+	binaryPath := filepath.Join(dir, "binary")
+	var binaryContent []byte
+	for _, ip := range streamTestIPs {
+		ipBytes := ip.Bytes()
+		binaryContent = append(binaryContent, ipBytes[:]...)
+	}
+	assert.Nil(t, ioutil.WriteFile(binaryPath, binaryContent, 0644))
+	assert.EqualValues(t, streamTestIPs, collectInput(t, binaryPath))
+}
+
+func TestForEachIPInInput_Stdin(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "ips")
+	assert.Nil(t, ioutil.WriteFile(filePath, []byte(inputTestContent), 0644))
+	file, err := os.Open(filePath)
+	assert.Nil(t, err)
+	defer file.Close()
+	stdin := os.Stdin
+	os.Stdin = file
+	defer func() { os.Stdin = stdin }()
+	assert.True(t, InputExists(StdinPath))
+	assert.EqualValues(t, streamTestIPs, collectInput(t, StdinPath))
+}
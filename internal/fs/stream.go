@@ -0,0 +1,88 @@
+package fs
+
+import (
+	"bufio"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"os"
+)
+
+type IPFunc func(addressing.IPv6) error
+
+// Call fn with each of the addresses in a text file of IPv6 addresses, one line at a time, so that the
+// file never has to be held in memory. The file is read in the text format, so only the first field of
+// each line is parsed (ping results may list the answering port and flags after the address). Stops at
+// the first line without an address (returning a FormatError), or at the first error returned by fn.
+func ForEachIPInHexFile(filePath string, fn IPFunc) error {
+	return ForEachIPInInput(filePath, TextFormat, fn)
+}
+
+// Call fn with each of the addresses in a file of packed 16-byte IPv6 addresses, one at a time
+func ForEachIPInBinaryFile(filePath string, fn IPFunc) error {
+	return ForEachIPInInput(filePath, BinaryFormat, fn)
+}
+
+// Writes IPv6 addresses to a file one at a time, either as text (one address per line) or as packed
+// 16-byte addresses
+type IPWriter struct {
+	file   *os.File
+	writer *bufio.Writer
+	binary bool
+	count  int
+}
+
+func NewHexIPWriter(filePath string) (*IPWriter, error) {
+	return newIPWriter(filePath, false)
+}
+
+func NewBinaryIPWriter(filePath string) (*IPWriter, error) {
+	return newIPWriter(filePath, true)
+}
+
+func newIPWriter(filePath string, binary bool) (*IPWriter, error) {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &IPWriter{
+		file:   file,
+		writer: bufio.NewWriter(file),
+		binary: binary,
+	}, nil
+}
+
+func (writer *IPWriter) Write(ip addressing.IPv6) error {
+	var err error
+	if writer.binary {
+		ipBytes := ip.Bytes()
+		_, err = writer.writer.Write(ipBytes[:])
+	} else {
+		_, err = writer.writer.WriteString(ip.String() + "\n")
+	}
+	if err == nil {
+		writer.count++
+	}
+	return err
+}
+
+// Get the number of addresses written so far
+func (writer *IPWriter) GetCount() int {
+	return writer.count
+}
+
+func (writer *IPWriter) GetPath() string {
+	return writer.file.Name()
+}
+
+// Flush buffered addresses to disk so that the file can be read while it is still being written
+func (writer *IPWriter) Flush() error {
+	return writer.writer.Flush()
+}
+
+func (writer *IPWriter) Close() error {
+	flushErr := writer.writer.Flush()
+	closeErr := writer.file.Close()
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
@@ -0,0 +1,66 @@
+package fs
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var streamTestIPs = addressing.GetIPsFromStrings([]string{
+	"2600::1",
+	"2600:1234::abcd",
+	"fe80::1",
+})
+
+func writeAndCollect(t *testing.T, writer *IPWriter, forEach func(string, IPFunc) error) []addressing.IPv6 {
+	for _, ip := range streamTestIPs {
+		assert.Nil(t, writer.Write(ip))
+	}
+	assert.EqualValues(t, len(streamTestIPs), writer.GetCount())
+	assert.Nil(t, writer.Close())
+	var toReturn []addressing.IPv6
+	err := forEach(writer.GetPath(), func(ip addressing.IPv6) error {
+		toReturn = append(toReturn, ip)
+		return nil
+	})
+	assert.Nil(t, err)
+	return toReturn
+}
+
+func TestIPWriter_HexRoundTrip(t *testing.T) {
+	writer, err := NewHexIPWriter(filepath.Join(t.TempDir(), "ips"))
+	assert.Nil(t, err)
+	read := writeAndCollect(t, writer, ForEachIPInHexFile)
+	assert.EqualValues(t, streamTestIPs, read)
+}
+
+func TestIPWriter_BinaryRoundTrip(t *testing.T) {
+	writer, err := NewBinaryIPWriter(filepath.Join(t.TempDir(), "ips"))
+	assert.Nil(t, err)
+	read := writeAndCollect(t, writer, ForEachIPInBinaryFile)
+	assert.EqualValues(t, streamTestIPs, read)
+}
+
+func TestForEachIPInHexFile_SkipsExtraFieldsAndStopsAtBadLines(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "results")
+	content := "2600::1 443 retried\n\nnot-an-address\n2600::2\n"
+	assert.Nil(t, ioutil.WriteFile(filePath, []byte(content), 0644))
+	var read []string
+	err := ForEachIPInHexFile(filePath, func(ip addressing.IPv6) error {
+		read = append(read, ip.String())
+		return nil
+	})
+	assert.EqualValues(t, &FormatError{Path: filePath, Format: TextFormat, Line: 3, Reason: "'not-an-address' is not an IPv6 address"}, err)
+	assert.EqualValues(t, []string{"2600::1"}, read)
+}
+
+func TestForEachIPInBinaryFile_Truncated(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "ips")
+	assert.Nil(t, ioutil.WriteFile(filePath, make([]byte, 20), 0644))
+	err := ForEachIPInBinaryFile(filePath, func(ip addressing.IPv6) error {
+		return nil
+	})
+	assert.NotNil(t, err)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/ekaley/ipv666/internal/logging"
 	"github.com/ekaley/ipv666/internal/persist"
 	"github.com/spf13/viper"
+	"io/ioutil"
 	"math"
 	"math/rand"
 	"net"
@@ -17,6 +18,8 @@ import (
 type ClusterModel struct {
 	ClusterSet       *ClusterSet     `msgpack:"c"`
 	NybbleCounts     []map[uint8]int `msgpack:"n"`
+	Version          int             `msgpack:"v"`
+	Metadata         *ModelMetadata  `msgpack:"-"` // Kept in the model file header rather than with the model
 	normalizedCounts [][]uint8
 }
 
@@ -52,19 +55,19 @@ type GenRangeMask struct {
 
 type clusterList []*GenCluster
 
-type addrProcessFunc func(*net.IP) (bool, error)
+type addrProcessFunc func(addressing.IPv6) (bool, error)
 
 // Model
 
-func (clusterModel *ClusterModel) GenerateAddresses(generateCount int, jitter float64) []*net.IP {
+func (clusterModel *ClusterModel) GenerateAddresses(random *rand.Rand, generateCount int, jitter float64) []addressing.IPv6 {
 	addrTree := newAddressTree()
-	var toReturn []*net.IP
+	var toReturn []addressing.IPv6
 	iteration := 0
 	for {
 		if iteration%viper.GetInt("LogLoopEmitFreq") == 0 {
 			logging.Infof("Generating new candidate address %d using clustering model. Unique count size is %d.", iteration, addrTree.Size())
 		}
-		newAddr := clusterModel.GenerateAddress(jitter)
+		newAddr := clusterModel.GenerateAddress(random, jitter)
 		if addrTree.AddIP(newAddr) {
 			toReturn = append(toReturn, newAddr)
 			if len(toReturn) >= generateCount {
@@ -77,20 +80,20 @@ func (clusterModel *ClusterModel) GenerateAddresses(generateCount int, jitter fl
 	return toReturn
 }
 
-func (clusterModel *ClusterModel) GenerateAddressesFromNetwork(generateCount int, jitter float64, network *net.IPNet) ([]*net.IP, error) {
+func (clusterModel *ClusterModel) GenerateAddressesFromNetwork(random *rand.Rand, generateCount int, jitter float64, network *net.IPNet) ([]addressing.IPv6, error) {
 	ones, _ := network.Mask.Size()
 	if ones%4 != 0 {
 		return nil, fmt.Errorf("generating addresses in a network requires a network length that is divisible by 4 (got length of %d)", ones)
 	}
 	networkNybbles := addressing.GetNybblesFromNetwork(network)
-	var toReturn []*net.IP
+	var toReturn []addressing.IPv6
 	iteration := 0
 	addrTree := newAddressTree()
 	for {
 		if iteration%viper.GetInt("LogLoopEmitFreq") == 0 {
 			logging.Infof("Generating new candidate address %d using clustering model. Unique count size is %d.", iteration, addrTree.Size())
 		}
-		newAddr := clusterModel.generateAddressFromNybbles(jitter, networkNybbles)
+		newAddr := clusterModel.generateAddressFromNybbles(random, jitter, networkNybbles)
 		if addrTree.AddIP(newAddr) {
 			toReturn = append(toReturn, newAddr)
 			if len(toReturn) >= generateCount {
@@ -103,39 +106,40 @@ func (clusterModel *ClusterModel) GenerateAddressesFromNetwork(generateCount int
 	return toReturn, nil
 }
 
-func (clusterModel *ClusterModel) GenerateAddressesFromNetworkWithCallback(generateCount int, jitter float64, network *net.IPNet, fn addrProcessFunc) ([]*net.IP, error) {
+// Generate addresses within the network until the callback has accepted generateCount of them. Nothing
+// is retained here, so it is up to the callback to do something with the addresses it does not filter
+// out.
+func (clusterModel *ClusterModel) GenerateAddressesFromNetworkWithCallback(random *rand.Rand, generateCount int, jitter float64, network *net.IPNet, fn addrProcessFunc) error {
 	ones, _ := network.Mask.Size()
 	if ones%4 != 0 {
-		return nil, fmt.Errorf("generating addresses in a network requires a network length that is divisible by 4 (got length of %d)", ones)
+		return fmt.Errorf("generating addresses in a network requires a network length that is divisible by 4 (got length of %d)", ones)
 	}
 	networkNybbles := addressing.GetNybblesFromNetwork(network)
-	var toReturn []*net.IP
-	iteration := 0
-	for len(toReturn) < generateCount {
-		newIP := clusterModel.generateAddressFromNybbles(jitter, networkNybbles)
+	accepted := 0
+	for accepted < generateCount {
+		newIP := clusterModel.generateAddressFromNybbles(random, jitter, networkNybbles)
 		isFiltered, err := fn(newIP)
 		if err != nil {
-			return nil, err
+			return err
 		} else if !isFiltered {
-			toReturn = append(toReturn, newIP)
+			accepted++
 		}
-		iteration++
 	}
-	return toReturn, nil
+	return nil
 }
 
-func (clusterModel *ClusterModel) GenerateAddress(jitter float64) *net.IP {
+func (clusterModel *ClusterModel) GenerateAddress(random *rand.Rand, jitter float64) addressing.IPv6 {
 	if len(clusterModel.normalizedCounts) == 0 {
 		clusterModel.generateNormalizedCounts()
 	}
-	index := rand.Int63n(int64(len(clusterModel.ClusterSet.Clusters)))
+	index := random.Int63n(int64(len(clusterModel.ClusterSet.Clusters)))
 	cluster := clusterModel.ClusterSet.Clusters[index]
 	var nybbles []uint8
 	for i := range cluster.Range.AddrNybbles {
 		if _, ok := cluster.Range.WildIndices[i]; ok {
-			nybbles = append(nybbles, uint8(rand.Int31n(16)))
-		} else if float64(rand.Int31n(10000))/100.0 <= jitter*100 {
-			index := rand.Int63n(int64(len(clusterModel.normalizedCounts[i])))
+			nybbles = append(nybbles, uint8(random.Int31n(16)))
+		} else if float64(random.Int31n(10000))/100.0 <= jitter*100 {
+			index := random.Int63n(int64(len(clusterModel.normalizedCounts[i])))
 			nybbles = append(nybbles, clusterModel.normalizedCounts[i][index])
 		} else {
 			nybbles = append(nybbles, cluster.Range.AddrNybbles[i])
@@ -144,18 +148,18 @@ func (clusterModel *ClusterModel) GenerateAddress(jitter float64) *net.IP {
 	return addressing.NybblesToIP(nybbles)
 }
 
-func (clusterModel *ClusterModel) generateAddressFromNybbles(jitter float64, fromNybbles []uint8) *net.IP {
+func (clusterModel *ClusterModel) generateAddressFromNybbles(random *rand.Rand, jitter float64, fromNybbles []uint8) addressing.IPv6 {
 	if len(clusterModel.normalizedCounts) == 0 {
 		clusterModel.generateNormalizedCounts()
 	}
-	index := rand.Int63n(int64(len(clusterModel.ClusterSet.Clusters)))
+	index := random.Int63n(int64(len(clusterModel.ClusterSet.Clusters)))
 	cluster := clusterModel.ClusterSet.Clusters[index]
 	var nybbles []uint8
 	for i := len(fromNybbles); i < 32; i++ {
 		if _, ok := cluster.Range.WildIndices[i]; ok {
-			nybbles = append(nybbles, uint8(rand.Int31n(16)))
-		} else if float64(rand.Int31n(10000))/100.0 <= jitter*100 {
-			index := rand.Int63n(int64(len(clusterModel.normalizedCounts[i])))
+			nybbles = append(nybbles, uint8(random.Int31n(16)))
+		} else if float64(random.Int31n(10000))/100.0 <= jitter*100 {
+			index := random.Int63n(int64(len(clusterModel.normalizedCounts[i])))
 			nybbles = append(nybbles, clusterModel.normalizedCounts[i][index])
 		} else {
 			nybbles = append(nybbles, cluster.Range.AddrNybbles[i])
@@ -248,7 +252,14 @@ func normalizeCountsToMinPercent(counts map[uint8]int, minPercent float64) []uin
 
 func percentsToNybbleCounts(fromPercents map[uint8]float64, distSize int) []uint8 {
 	var toReturn []uint8
-	for k, v := range fromPercents {
+
+	// Go through the nybbles in order so that the distribution is laid out the same from run to run
+	var k uint8
+	for k = 0; k < 16; k++ {
+		v, ok := fromPercents[k]
+		if !ok {
+			continue
+		}
 		for i := 0; i < int(math.Ceil(v*float64(distSize))); i++ {
 			toReturn = append(toReturn, k)
 		}
@@ -256,7 +267,14 @@ func percentsToNybbleCounts(fromPercents map[uint8]float64, distSize int) []uint
 	return toReturn
 }
 
-func CreateClusteringModel(fromAddrs []*net.IP) *ClusterModel {
+// Create a cluster model from the given addresses using the configured number of workers
+func CreateClusteringModel(fromAddrs []addressing.IPv6) *ClusterModel {
+	return CreateClusteringModelWithWorkers(fromAddrs, GetModelWorkerCount())
+}
+
+// Create a cluster model from the given addresses, spreading the review of cluster upgrade options across
+// the given number of workers. The resulting model is the same regardless of the number of workers.
+func CreateClusteringModelWithWorkers(fromAddrs []addressing.IPv6, workers int) *ClusterModel {
 
 	// Convert all IPs to clusters and create corpus
 
@@ -269,17 +287,15 @@ func CreateClusteringModel(fromAddrs []*net.IP) *ClusterModel {
 
 	// Calculate upgrade potential and create stardust from poor performers
 
-	logging.Infof("Now reviewing %d initial cluster candidates for poor performers.", len(fromAddrs))
-	var dustAddrs []*net.IP
+	logging.Infof("Now reviewing %d initial cluster candidates for poor performers using %d workers.", len(fromAddrs), workers)
+	var dustAddrs []addressing.IPv6
 	var clusterMap = make(map[string]*internal.Empty)
 	var modelCandidates clusterList
 	empty := &internal.Empty{}
 
+	clusterOptions := getAllBestUpgradeOptions(clusters, corpus, workers, "poor performers")
 	for i, cluster := range clusters {
-		if i%viper.GetInt("LogLoopEmitFreq") == 0 {
-			logging.Infof("Processing cluster %d out of %d for poor performers.", i, len(clusters))
-		}
-		upgradeDensity, upgradeCount, upgradeIndices := cluster.getBestUpgradeOptions(corpus)
+		upgradeDensity, upgradeCount, upgradeIndices := clusterOptions[i].density, clusterOptions[i].count, clusterOptions[i].indices
 		if len(upgradeIndices) == 32 { // If all upgrades are equivalent then all upgrades are bad
 			dustAddrs = append(dustAddrs, cluster.Range.GetIP())
 		} else {
@@ -312,11 +328,9 @@ func CreateClusteringModel(fromAddrs []*net.IP) *ClusterModel {
 	var upgradeMap = make(map[string]*internal.Empty)
 	var upgradeCandidates clusterList
 
+	candidateOptions := getAllBestUpgradeOptions(modelCandidates, corpus, workers, "upgrade candidates")
 	for i, cluster := range modelCandidates {
-		if i%viper.GetInt("LogLoopEmitFreq") == 0 {
-			logging.Infof("Processing model candidate %d out of %d for upgrade candidates.", i, len(modelCandidates))
-		}
-		upgradeDensity, upgradeCount, upgradeIndices := cluster.getBestUpgradeOptions(corpus)
+		upgradeDensity, upgradeCount, upgradeIndices := candidateOptions[i].density, candidateOptions[i].count, candidateOptions[i].indices
 		if len(upgradeIndices) == 31 { // Thee case where all upgrades are the same is not an upgrade
 			skipped++
 		} else {
@@ -355,6 +369,10 @@ func CreateClusteringModel(fromAddrs []*net.IP) *ClusterModel {
 
 		// Take the next upgrade candidate in line
 
+		if len(upgradeCandidates) == 0 {
+			logging.Infof("Ran out of upgrade candidates. No more improvements to be made.")
+			break
+		}
 		candidate := upgradeCandidates[0]
 		upgradeCandidates = upgradeCandidates[1:]
 		sig := candidate.signature()
@@ -432,7 +450,7 @@ func CreateClusteringModel(fromAddrs []*net.IP) *ClusterModel {
 	}
 }
 
-func addrsToNybbleCounts(toProcess []*net.IP) []map[uint8]int {
+func addrsToNybbleCounts(toProcess []addressing.IPv6) []map[uint8]int {
 	var toReturn []map[uint8]int
 	for i := 0; i < 32; i++ {
 		toReturn = append(toReturn, make(map[uint8]int))
@@ -449,32 +467,42 @@ func addrsToNybbleCounts(toProcess []*net.IP) []map[uint8]int {
 }
 
 func (clusterModel *ClusterModel) Save(filePath string) error {
-	return persist.Save(filePath, clusterModel)
+	toWrite, err := EncodeModelFile(clusterModel)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filePath, toWrite, 0644)
 }
 
 func LoadModelFromFile(filePath string) (*ClusterModel, error) {
-	var toReturn ClusterModel
-	err := persist.Load(filePath, &toReturn)
-	return &toReturn, err
+	fileContent, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	toReturn, err := DecodeModelFile(fileContent)
+	if err != nil {
+		return nil, fmt.Errorf("could not load model from file '%s': %s", filePath, err)
+	} else if toReturn.Metadata == nil {
+		logging.Warnf("The model file at '%s' is from before model file headers were added. Use 'generate model migrate' to rewrite it in the current format.", filePath)
+	}
+	return toReturn, nil
 }
 
 func LoadModelFromBytes(fromBytes []byte) (*ClusterModel, error) {
-	var toReturn ClusterModel
-	err := persist.Unmarshal(fromBytes, &toReturn)
-	return &toReturn, err
+	return DecodeModelFile(fromBytes)
 }
 
 // ClusterSet
 
-func (clusterSet *ClusterSet) GenerateAddresses(generateCount int, jitter float64) []*net.IP {
+func (clusterSet *ClusterSet) GenerateAddresses(random *rand.Rand, generateCount int, jitter float64) []addressing.IPv6 {
 	toReturn := newAddressTree()
 	iteration := 0
 	for {
 		if iteration%viper.GetInt("LogLoopEmitFreq") == 0 {
 			logging.Infof("Generating new candidate address %d using clustering model. Unique count size is %d.", iteration, toReturn.Size())
 		}
-		cluster := clusterSet.Clusters[rand.Int63n(int64(len(clusterSet.Clusters)))]
-		newAddr := cluster.generateAddr(jitter)
+		cluster := clusterSet.Clusters[random.Int63n(int64(len(clusterSet.Clusters)))]
+		newAddr := cluster.generateAddr(random, jitter)
 		toReturn.AddIP(newAddr)
 		iteration++
 		if toReturn.Size() >= generateCount {
@@ -559,7 +587,7 @@ func (clusterSet *ClusterSet) AddClusters(toAdd []*GenCluster) {
 
 // Cluster
 
-func newGenClusters(addrs []*net.IP) []*GenCluster {
+func newGenClusters(addrs []addressing.IPv6) []*GenCluster {
 	var toReturn []*GenCluster
 	for _, addr := range addrs {
 		toReturn = append(toReturn, newGenCluster(addr))
@@ -567,7 +595,7 @@ func newGenClusters(addrs []*net.IP) []*GenCluster {
 	return toReturn
 }
 
-func newGenCluster(firstIP *net.IP) *GenCluster {
+func newGenCluster(firstIP addressing.IPv6) *GenCluster {
 	return &GenCluster{
 		Range:    newGenRange(firstIP),
 		Captured: 1,
@@ -646,13 +674,13 @@ func (list clusterList) findFirstOfDensity(searchStart int, density float64) int
 	return 0
 }
 
-func (cluster *GenCluster) generateAddr(jitter float64) *net.IP {
+func (cluster *GenCluster) generateAddr(random *rand.Rand, jitter float64) addressing.IPv6 {
 	var addrNybbles []uint8
 	for i := range cluster.Range.AddrNybbles {
 		if _, ok := cluster.Range.WildIndices[i]; ok {
-			addrNybbles = append(addrNybbles, uint8(rand.Int31n(16)))
-		} else if float64(rand.Int31n(10000))/100.0 <= jitter*100 {
-			addrNybbles = append(addrNybbles, uint8(rand.Int31n(16)))
+			addrNybbles = append(addrNybbles, uint8(random.Int31n(16)))
+		} else if float64(random.Int31n(10000))/100.0 <= jitter*100 {
+			addrNybbles = append(addrNybbles, uint8(random.Int31n(16)))
 		} else {
 			addrNybbles = append(addrNybbles, cluster.Range.AddrNybbles[i])
 		}
@@ -660,7 +688,7 @@ func (cluster *GenCluster) generateAddr(jitter float64) *net.IP {
 	return addressing.NybblesToIP(addrNybbles)
 }
 
-func (cluster *GenCluster) distanceFromIP(toProcess *net.IP) int {
+func (cluster *GenCluster) distanceFromIP(toProcess addressing.IPv6) int {
 	ipNybbles := addressing.GetNybblesFromIP(toProcess, 32)
 	toReturn := 0
 	for i := range ipNybbles {
@@ -732,18 +760,18 @@ func (genRange *GenRange) Contains(toCheck *GenRange) bool {
 	return true
 }
 
-func (genRange *GenRange) GetIP() *net.IP {
+func (genRange *GenRange) GetIP() addressing.IPv6 {
 	return addressing.NybblesToIP(genRange.AddrNybbles)
 }
 
-func newGenRange(fromIP *net.IP) *GenRange {
+func newGenRange(fromIP addressing.IPv6) *GenRange {
 	return &GenRange{
 		AddrNybbles: addressing.GetNybblesFromIP(fromIP, 32),
 		WildIndices: make(map[int]internal.Empty),
 	}
 }
 
-func (genRange *GenRange) AddIP(toAdd *net.IP) {
+func (genRange *GenRange) AddIP(toAdd addressing.IPv6) {
 	ipNybbles := addressing.GetNybblesFromIP(toAdd, 32)
 	for i, curNybble := range ipNybbles {
 		if genRange.AddrNybbles[i] != curNybble {
@@ -763,7 +791,7 @@ func (genRange *GenRange) Equals(otherRange *GenRange) bool {
 	return true
 }
 
-func (genRange *GenRange) AddIPs(toAdd []*net.IP) {
+func (genRange *GenRange) AddIPs(toAdd []addressing.IPv6) {
 	for _, curAdd := range toAdd {
 		genRange.AddIP(curAdd)
 	}
@@ -837,7 +865,7 @@ func (genRange *GenRange) GetMask() *GenRangeMask {
 	}
 }
 
-func (genRange *GenRange) CopyWithIPs(newIPs []*net.IP) *GenRange {
+func (genRange *GenRange) CopyWithIPs(newIPs []addressing.IPv6) *GenRange {
 	toReturn := genRange.Copy()
 	toReturn.AddIPs(newIPs)
 	return toReturn
@@ -851,7 +879,7 @@ func (genRange *GenRange) CopyWithIndices(newIndices []int) *GenRange {
 	return toReturn
 }
 
-func GetGenRangeFromIPs(fromIPs []*net.IP) *GenRange {
+func GetGenRangeFromIPs(fromIPs []addressing.IPv6) *GenRange {
 	newRange := newGenRange(fromIPs[0])
 	newRange.AddIPs(fromIPs[1:])
 	return newRange
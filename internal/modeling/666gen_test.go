@@ -1,20 +1,21 @@
 package modeling
 
 import (
+	"github.com/ekaley/ipv666/internal/addressing"
 	"github.com/magiconair/properties/assert"
 	"net"
 	"testing"
 )
 
 func getTestRange() *GenRange {
-	ip1 := net.ParseIP("8000:0000:0001:0001:8000:0001:0000:0001")
-	ip2 := net.ParseIP("8000:0001:0000:0001:8000:0000:0000:0001")
-	ip3 := net.ParseIP("8000:0000:0000:0001:8000:0001:0000:0001")
-	ip4 := net.ParseIP("8000:0001:0000:0001:8000:0000:0001:0001")
-	toReturn := newGenRange(&ip1)
-	toReturn.AddIP(&ip2)
-	toReturn.AddIP(&ip3)
-	toReturn.AddIP(&ip4)
+	ip1 := addressing.NewIPv6(net.ParseIP("8000:0000:0001:0001:8000:0001:0000:0001"))
+	ip2 := addressing.NewIPv6(net.ParseIP("8000:0001:0000:0001:8000:0000:0000:0001"))
+	ip3 := addressing.NewIPv6(net.ParseIP("8000:0000:0000:0001:8000:0001:0000:0001"))
+	ip4 := addressing.NewIPv6(net.ParseIP("8000:0001:0000:0001:8000:0000:0001:0001"))
+	toReturn := newGenRange(ip1)
+	toReturn.AddIP(ip2)
+	toReturn.AddIP(ip3)
+	toReturn.AddIP(ip4)
 	return toReturn
 }
 
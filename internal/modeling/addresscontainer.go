@@ -1,15 +1,18 @@
 package modeling
 
-import "net"
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"net"
+)
 
 type AddressContainer interface {
-	AddIP(toAdd *net.IP) bool
-	AddIPs(toAdd []*net.IP, emitFreq int) (int, int)
-	GetAllIPs() []*net.IP
-	GetIPsInRange(fromRange *net.IPNet) ([]*net.IP, error)
+	AddIP(toAdd addressing.IPv6) bool
+	AddIPs(toAdd []addressing.IPv6, emitFreq int) (int, int)
+	GetAllIPs() []addressing.IPv6
+	GetIPsInRange(fromRange *net.IPNet) ([]addressing.IPv6, error)
 	CountIPsInRange(fromRange *net.IPNet) (uint32, error)
-	ContainsIP(toCheck *net.IP) bool
+	ContainsIP(toCheck addressing.IPv6) bool
 	CountIPsInGenRange(fromRange *GenRange) int
-	GetIPsInGenRange(fromRange *GenRange) []*net.IP
+	GetIPsInGenRange(fromRange *GenRange) []addressing.IPv6
 	Size() int
 }
@@ -35,7 +35,7 @@ func newAddressTreeNode(depth int) *AddressTreeNode {
 	}
 }
 
-func CreateFromAddresses(toAdd []*net.IP, emitFreq int) *AddressTree {
+func CreateFromAddresses(toAdd []addressing.IPv6, emitFreq int) *AddressTree {
 	toReturn := newAddressTree()
 	toReturn.AddIPs(toAdd, emitFreq)
 	return toReturn
@@ -45,7 +45,7 @@ func (addrTree *AddressTree) Size() int {
 	return int(addrTree.ChildrenCount)
 }
 
-func (addrTree *AddressTree) AddIP(toAdd *net.IP) bool {
+func (addrTree *AddressTree) AddIP(toAdd addressing.IPv6) bool {
 	ipNybbles := addressing.GetNybblesFromIP(toAdd, 32)
 	if addrTree.containsIPByNybbles(ipNybbles) {
 		return false
@@ -58,7 +58,7 @@ func (addrTree *AddressTree) AddIP(toAdd *net.IP) bool {
 	return true
 }
 
-func (addrTree *AddressTree) AddIPs(toAdd []*net.IP, emitFreq int) (int, int) {
+func (addrTree *AddressTree) AddIPs(toAdd []addressing.IPv6, emitFreq int) (int, int) {
 	added, skipped := 0, 0
 	for i, curAdd := range toAdd {
 		if i%emitFreq == 0 && i != 0 {
@@ -73,11 +73,11 @@ func (addrTree *AddressTree) AddIPs(toAdd []*net.IP, emitFreq int) (int, int) {
 	return added, skipped
 }
 
-func (addrTree *AddressTree) GetAllIPs() []*net.IP {
+func (addrTree *AddressTree) GetAllIPs() []addressing.IPv6 {
 	if addrTree.ChildrenCount == 0 {
-		return []*net.IP{}
+		return []addressing.IPv6{}
 	} else {
-		var toReturn []*net.IP
+		var toReturn []addressing.IPv6
 		for k, v := range addrTree.Children {
 			toReturn = append(toReturn, v.getAllIPs([]uint8{k})...)
 		}
@@ -98,11 +98,11 @@ func (addrTree *AddressTree) getSeekNybbles(fromRange *net.IPNet) ([]uint8, erro
 	if ones%4 != 0 {
 		return nil, fmt.Errorf("cannot get IPs from a network range that isn't on a nybble boundary (ie: modulo 4, mask size was %d)", ones)
 	} else {
-		return addressing.GetNybblesFromIP(&fromRange.IP, ones/4), nil
+		return addressing.GetNybblesFromIP(addressing.NewIPv6(fromRange.IP), ones/4), nil
 	}
 }
 
-func (addrTree *AddressTree) GetIPsInRange(fromRange *net.IPNet) ([]*net.IP, error) {
+func (addrTree *AddressTree) GetIPsInRange(fromRange *net.IPNet) ([]addressing.IPv6, error) {
 	networkNybbles, err := addrTree.getSeekNybbles(fromRange)
 	if err != nil {
 		return nil, err
@@ -118,15 +118,15 @@ func (addrTree *AddressTree) GetIPsInRange(fromRange *net.IPNet) ([]*net.IP, err
 	}
 }
 
-func (addrTree *AddressTree) GetIPsInGenRange(fromRange *GenRange) []*net.IP {
+func (addrTree *AddressTree) GetIPsInGenRange(fromRange *GenRange) []addressing.IPv6 {
 	if _, ok := fromRange.WildIndices[0]; ok {
-		var toReturn []*net.IP
+		var toReturn []addressing.IPv6
 		for k, v := range addrTree.Children {
 			toReturn = append(toReturn, v.getIPsInGenRange([]uint8{k}, fromRange.AddrNybbles[1:], fromRange.WildIndices)...)
 		}
 		return toReturn
 	} else if val, ok := addrTree.Children[fromRange.AddrNybbles[0]]; !ok {
-		return []*net.IP{}
+		return []addressing.IPv6{}
 	} else {
 		return val.getIPsInGenRange([]uint8{fromRange.AddrNybbles[0]}, fromRange.AddrNybbles[1:], fromRange.WildIndices)
 	}
@@ -178,7 +178,7 @@ func LoadAddressTreeFromFile(filePath string) (*AddressTree, error) { // TODO ab
 	return &toReturn, err
 }
 
-func (addrTree *AddressTree) ContainsIP(toCheck *net.IP) bool {
+func (addrTree *AddressTree) ContainsIP(toCheck addressing.IPv6) bool {
 	nybs := addressing.GetNybblesFromIP(toCheck, 32)
 	return addrTree.containsIPByNybbles(nybs)
 }
@@ -211,15 +211,15 @@ func (addrTreeNode *AddressTreeNode) containsNybbles(nybbles []uint8) bool {
 	}
 }
 
-func (addrTreeNode *AddressTreeNode) getAllIPs(parentNybbles []uint8) []*net.IP {
+func (addrTreeNode *AddressTreeNode) getAllIPs(parentNybbles []uint8) []addressing.IPv6 {
 	if len(addrTreeNode.Children) == 0 && addrTreeNode.Depth != 32 {
 		logging.Warnf("Ran out of children at depth %d when getting all IPs. This shouldn't happen.", addrTreeNode.Depth)
-		return []*net.IP{}
+		return []addressing.IPv6{}
 	} else if len(addrTreeNode.Children) == 0 {
 		toAdd := addressing.NybblesToIP(parentNybbles)
-		return []*net.IP{toAdd}
+		return []addressing.IPv6{toAdd}
 	} else {
-		var toReturn []*net.IP
+		var toReturn []addressing.IPv6
 		for k, v := range addrTreeNode.Children {
 			toReturn = append(toReturn, v.getAllIPs(append(parentNybbles, k))...)
 		}
@@ -227,11 +227,11 @@ func (addrTreeNode *AddressTreeNode) getAllIPs(parentNybbles []uint8) []*net.IP
 	}
 }
 
-func (addrTreeNode *AddressTreeNode) getIPsInRange(parentNybbles []uint8, searchNybbles []uint8) []*net.IP {
+func (addrTreeNode *AddressTreeNode) getIPsInRange(parentNybbles []uint8, searchNybbles []uint8) []addressing.IPv6 {
 	if len(searchNybbles) == 0 {
 		return addrTreeNode.getAllIPs(parentNybbles)
 	} else if val, ok := addrTreeNode.Children[searchNybbles[0]]; !ok {
-		return []*net.IP{}
+		return []addressing.IPv6{}
 	} else {
 		return val.getIPsInRange(append(parentNybbles, searchNybbles[0]), searchNybbles[1:])
 	}
@@ -247,21 +247,21 @@ func (addrTreeNode *AddressTreeNode) seekNode(seekNybbles []uint8) *AddressTreeN
 	}
 }
 
-func (addrTreeNode *AddressTreeNode) getIPsInGenRange(parentNybbles []uint8, rangeNybbles []uint8, wildIndices map[int]internal.Empty) []*net.IP {
+func (addrTreeNode *AddressTreeNode) getIPsInGenRange(parentNybbles []uint8, rangeNybbles []uint8, wildIndices map[int]internal.Empty) []addressing.IPv6 {
 	if len(addrTreeNode.Children) == 0 && addrTreeNode.Depth != 32 {
 		logging.Warnf("Ran out of children at depth %d when getting all IPs. This shouldn't happen.", addrTreeNode.Depth)
-		return []*net.IP{}
+		return []addressing.IPv6{}
 	} else if len(addrTreeNode.Children) == 0 {
 		toAdd := addressing.NybblesToIP(parentNybbles)
-		return []*net.IP{toAdd}
+		return []addressing.IPv6{toAdd}
 	} else if _, ok := wildIndices[addrTreeNode.Depth]; ok {
-		var toReturn []*net.IP
+		var toReturn []addressing.IPv6
 		for k, v := range addrTreeNode.Children {
 			toReturn = append(toReturn, v.getIPsInGenRange(append(parentNybbles, k), rangeNybbles[1:], wildIndices)...)
 		}
 		return toReturn
 	} else if val, ok := addrTreeNode.Children[rangeNybbles[0]]; !ok {
-		return []*net.IP{}
+		return []addressing.IPv6{}
 	} else {
 		return val.getIPsInGenRange(append(parentNybbles, rangeNybbles[0]), rangeNybbles[1:], wildIndices)
 	}
@@ -8,7 +8,7 @@ import (
 	"testing"
 )
 
-func getDefaultIPs() []*net.IP {
+func getDefaultIPs() []addressing.IPv6 {
 	var ipStrings = []string{
 		"2600:0:1:0000:0000:0000:0000:0000",
 		"2600:0:1:0000:0000:0000:0000:0001",
@@ -78,7 +78,7 @@ func getDefaultIPs() []*net.IP {
 	return addressing.GetIPsFromStrings(ipStrings)
 }
 
-func getExtendedDefaultIPs() []*net.IP {
+func getExtendedDefaultIPs() []addressing.IPv6 {
 	var ipStrings = []string{
 		"2600:0:1:0000:0000:0000:0000:0000",
 		"2600:0:1:0000:0000:0000:0000:0001",
@@ -217,7 +217,7 @@ func getAddressTree() *AddressTree {
 }
 
 func getEmptyAddressTree() *AddressTree {
-	return CreateFromAddresses([]*net.IP{}, 100)
+	return CreateFromAddresses([]addressing.IPv6{}, 100)
 }
 
 func TestCreateFromAddressesReturns(t *testing.T) {
@@ -237,17 +237,17 @@ func TestCreateFromAddressesCount(t *testing.T) {
 
 func TestAddressTree_AddIPCount(t *testing.T) {
 	addrTree := getAddressTree()
-	newIP := net.ParseIP("2600:0:1:0001:0000:0000:0000:0001")
+	newIP := addressing.NewIPv6(net.ParseIP("2600:0:1:0001:0000:0000:0000:0001"))
 	firstCount := addrTree.ChildrenCount
-	addrTree.AddIP(&newIP)
+	addrTree.AddIP(newIP)
 	assert.Equal(t, addrTree.ChildrenCount, firstCount+1)
 }
 
 func TestAddressTree_AddIPAdds(t *testing.T) {
 	addrTree := getAddressTree()
-	newIP := net.ParseIP("2600:0:1:0001:0000:0000:0000:0001")
-	addrTree.AddIP(&newIP)
-	assert.True(t, addrTree.ContainsIP(&newIP))
+	newIP := addressing.NewIPv6(net.ParseIP("2600:0:1:0001:0000:0000:0000:0001"))
+	addrTree.AddIP(newIP)
+	assert.True(t, addrTree.ContainsIP(newIP))
 }
 
 func TestAddressTree_AddIPsCount(t *testing.T) {
@@ -453,20 +453,20 @@ func TestLoadAddressTreeFromFileContent(t *testing.T) {
 
 func TestAddressTree_ContainsIPEmpty(t *testing.T) {
 	addrTree := getEmptyAddressTree()
-	ip := net.ParseIP("2600:0:1:0000:0000:0000:0000:0000")
-	assert.False(t, addrTree.ContainsIP(&ip))
+	ip := addressing.NewIPv6(net.ParseIP("2600:0:1:0000:0000:0000:0000:0000"))
+	assert.False(t, addrTree.ContainsIP(ip))
 }
 
 func TestAddressTree_ContainsIPFalse(t *testing.T) {
 	addrTree := getAddressTree()
-	ip := net.ParseIP("2700:0:1:0000:0000:0000:0000:0000")
-	assert.False(t, addrTree.ContainsIP(&ip))
+	ip := addressing.NewIPv6(net.ParseIP("2700:0:1:0000:0000:0000:0000:0000"))
+	assert.False(t, addrTree.ContainsIP(ip))
 }
 
 func TestAddressTree_ContainsIPTrue(t *testing.T) {
 	addrTree := getAddressTree()
-	ip := net.ParseIP("2600:0:1:0000:0000:0000:0000:0000")
-	assert.True(t, addrTree.ContainsIP(&ip))
+	ip := addressing.NewIPv6(net.ParseIP("2600:0:1:0000:0000:0000:0000:0000"))
+	assert.True(t, addrTree.ContainsIP(ip))
 }
 
 func TestAddressTree_GetIPsInGenRangeEmpty(t *testing.T) {
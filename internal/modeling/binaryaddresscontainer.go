@@ -12,7 +12,7 @@ type BinaryAddressContainer struct {
 	sortedHighKeys []uint64
 }
 
-func ContainerFromAddrs(toProcess []*net.IP) *BinaryAddressContainer {
+func ContainerFromAddrs(toProcess []addressing.IPv6) *BinaryAddressContainer {
 	toReturn := &BinaryAddressContainer{
 		addresses:      make(map[uint64][]uint64),
 		sortedHighKeys: []uint64{},
@@ -32,8 +32,8 @@ func (container *BinaryAddressContainer) Size() int { //TODO too computationally
 	return len(container.GetAllIPs())
 }
 
-func (container *BinaryAddressContainer) AddIP(toAdd *net.IP) bool {
-	first, second := addressing.AddressToUints(*toAdd)
+func (container *BinaryAddressContainer) AddIP(toAdd addressing.IPv6) bool {
+	first, second := toAdd.High, toAdd.Low
 	var added = false
 	var secondAdded = false
 	if _, ok := container.addresses[first]; !ok {
@@ -45,7 +45,7 @@ func (container *BinaryAddressContainer) AddIP(toAdd *net.IP) bool {
 	return added || secondAdded
 }
 
-func (container *BinaryAddressContainer) AddIPs(toAdd []*net.IP, emitFreq int) (int, int) { //TODO get rid of emit freq
+func (container *BinaryAddressContainer) AddIPs(toAdd []addressing.IPv6, emitFreq int) (int, int) { //TODO get rid of emit freq
 	added, skipped := 0, 0
 	for i, curAdd := range toAdd {
 		if i%emitFreq == 0 {
@@ -61,8 +61,8 @@ func (container *BinaryAddressContainer) AddIPs(toAdd []*net.IP, emitFreq int) (
 	return added, skipped
 }
 
-func (container *BinaryAddressContainer) GetAllIPs() []*net.IP {
-	var toReturn []*net.IP
+func (container *BinaryAddressContainer) GetAllIPs() []addressing.IPv6 {
+	var toReturn []addressing.IPv6
 	processed := 0
 	for k, v := range container.addresses {
 		for _, curLower := range v {
@@ -76,8 +76,8 @@ func (container *BinaryAddressContainer) GetAllIPs() []*net.IP {
 	return toReturn
 }
 
-func (container *BinaryAddressContainer) ContainsIP(toCheck *net.IP) bool {
-	first, second := addressing.AddressToUints(*toCheck)
+func (container *BinaryAddressContainer) ContainsIP(toCheck addressing.IPv6) bool {
+	first, second := toCheck.High, toCheck.Low
 	if val, ok := container.addresses[first]; !ok {
 		return false
 	} else {
@@ -86,21 +86,22 @@ func (container *BinaryAddressContainer) ContainsIP(toCheck *net.IP) bool {
 	}
 }
 
-func (container *BinaryAddressContainer) GetIPsInRange(fromRange *net.IPNet) ([]*net.IP, error) {
+func (container *BinaryAddressContainer) GetIPsInRange(fromRange *net.IPNet) ([]addressing.IPv6, error) {
 	ones, _ := fromRange.Mask.Size()
 	lowerFirst, lowerSecond, upperFirst, upperSecond := addressing.NetworkToUints(fromRange)
-	var toReturn []*net.IP
+	var toReturn []addressing.IPv6
 	if ones == 0 {
 		return container.GetAllIPs(), nil
 	} else if ones == 128 {
-		if container.ContainsIP(&fromRange.IP) {
-			return []*net.IP{&fromRange.IP}, nil
+		rangeIP := addressing.NewIPv6(fromRange.IP)
+		if container.ContainsIP(rangeIP) {
+			return []addressing.IPv6{rangeIP}, nil
 		} else {
-			return []*net.IP{}, nil
+			return []addressing.IPv6{}, nil
 		}
 	} else if ones == 64 {
 		if val, ok := container.addresses[lowerFirst]; !ok {
-			return []*net.IP{}, nil
+			return []addressing.IPv6{}, nil
 		} else {
 			for _, curSecond := range val {
 				toReturn = append(toReturn, addressing.UintsToAddress(lowerFirst, curSecond))
@@ -109,7 +110,7 @@ func (container *BinaryAddressContainer) GetIPsInRange(fromRange *net.IPNet) ([]
 		}
 	} else if ones < 64 {
 		parentRanges := seekRange(container.sortedHighKeys, lowerFirst, upperFirst)
-		toReturn = []*net.IP{}
+		toReturn = []addressing.IPv6{}
 		for _, curRange := range parentRanges {
 			for _, curLower := range container.addresses[curRange] {
 				toReturn = append(toReturn, addressing.UintsToAddress(curRange, curLower))
@@ -118,9 +119,9 @@ func (container *BinaryAddressContainer) GetIPsInRange(fromRange *net.IPNet) ([]
 		return toReturn, nil
 	} else {
 		if val, ok := container.addresses[lowerFirst]; !ok {
-			return []*net.IP{}, nil
+			return []addressing.IPv6{}, nil
 		} else {
-			toReturn = []*net.IP{}
+			toReturn = []addressing.IPv6{}
 			seconds := seekRange(val, lowerSecond, upperSecond)
 			for _, curSecond := range seconds {
 				toReturn = append(toReturn, addressing.UintsToAddress(lowerFirst, curSecond))
@@ -139,22 +140,22 @@ func (container *BinaryAddressContainer) CountIPsInRange(fromRange *net.IPNet) (
 	}
 }
 
-func (container *BinaryAddressContainer) GetIPsInGenRange(fromRange *GenRange) []*net.IP {
+func (container *BinaryAddressContainer) GetIPsInGenRange(fromRange *GenRange) []addressing.IPv6 {
 	if len(fromRange.WildIndices) == 0 {
 		checkIP := fromRange.GetIP()
 		if container.ContainsIP(checkIP) {
-			return []*net.IP{checkIP}
+			return []addressing.IPv6{checkIP}
 		}
 	}
-	var toReturn []*net.IP
+	var toReturn []addressing.IPv6
 	rangeMask := fromRange.GetMask()
 	firstCandidates := seekRange(container.sortedHighKeys, rangeMask.FirstMin, rangeMask.FirstMax)
 	if len(firstCandidates) == 0 {
-		return []*net.IP{}
+		return []addressing.IPv6{}
 	}
 	firstCandidates = filterByMask(firstCandidates, rangeMask.FirstMask, rangeMask.FirstExpected)
 	if len(firstCandidates) == 0 {
-		return []*net.IP{}
+		return []addressing.IPv6{}
 	}
 	for _, curFirst := range firstCandidates {
 		secondCandidates := seekRange(container.addresses[curFirst], rangeMask.SecondMin, rangeMask.SecondMax)
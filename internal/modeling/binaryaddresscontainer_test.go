@@ -77,7 +77,7 @@ func getBinaryContainer() *BinaryAddressContainer {
 }
 
 func getEmptyBinaryContainer() *BinaryAddressContainer {
-	return ContainerFromAddrs([]*net.IP{})
+	return ContainerFromAddrs([]addressing.IPv6{})
 }
 
 func getExtendedBinaryContainer() *BinaryAddressContainer {
@@ -101,17 +101,17 @@ func TestContainerFromAddrsCount(t *testing.T) {
 
 func TestBinaryAddressContainer_AddIPCount(t *testing.T) {
 	container := getBinaryContainer()
-	newIP := net.ParseIP("2600:0:1:0001:0000:0000:0000:0001")
+	newIP := addressing.NewIPv6(net.ParseIP("2600:0:1:0001:0000:0000:0000:0001"))
 	firstCount := container.Size()
-	container.AddIP(&newIP)
+	container.AddIP(newIP)
 	assert.Equal(t, firstCount+1, container.Size())
 }
 
 func TestBinaryAddressContainer_AddIPAdds(t *testing.T) {
 	container := getBinaryContainer()
-	newIP := net.ParseIP("2600:0:1:0001:0000:0000:0000:0001")
-	container.AddIP(&newIP)
-	assert.True(t, container.ContainsIP(&newIP))
+	newIP := addressing.NewIPv6(net.ParseIP("2600:0:1:0001:0000:0000:0000:0001"))
+	container.AddIP(newIP)
+	assert.True(t, container.ContainsIP(newIP))
 }
 
 func TestBinaryAddressContainer_AddIPsCount(t *testing.T) {
@@ -354,20 +354,20 @@ func TestBinaryAddressContainer_ExtendedGetIPsInRange128(t *testing.T) {
 
 func TestBinaryAddressContainer_ContainsIPEmpty(t *testing.T) {
 	container := getEmptyBinaryContainer()
-	ip := net.ParseIP("2600:0:1:0000:0000:0000:0000:0000")
-	assert.False(t, container.ContainsIP(&ip))
+	ip := addressing.NewIPv6(net.ParseIP("2600:0:1:0000:0000:0000:0000:0000"))
+	assert.False(t, container.ContainsIP(ip))
 }
 
 func TestBinaryAddressContainer_ContainsIPFalse(t *testing.T) {
 	container := getBinaryContainer()
-	ip := net.ParseIP("2700:0:1:0000:0000:0000:0000:0000")
-	assert.False(t, container.ContainsIP(&ip))
+	ip := addressing.NewIPv6(net.ParseIP("2700:0:1:0000:0000:0000:0000:0000"))
+	assert.False(t, container.ContainsIP(ip))
 }
 
 func TestBinaryAddressContainer_ContainsIPTrue(t *testing.T) {
 	container := getBinaryContainer()
-	ip := net.ParseIP("2600:0:1:0000:0000:0000:0000:0000")
-	assert.True(t, container.ContainsIP(&ip))
+	ip := addressing.NewIPv6(net.ParseIP("2600:0:1:0000:0000:0000:0000:0000"))
+	assert.True(t, container.ContainsIP(ip))
 }
 
 func TestBinaryAddressContainer_GetIPsInGenRangeEmpty(t *testing.T) {
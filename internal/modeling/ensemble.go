@@ -0,0 +1,84 @@
+package modeling
+
+import (
+	"fmt"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"math/rand"
+	"net"
+	"sort"
+)
+
+// Generates addresses from several cluster models, picking the model for each address at random in
+// proportion to its weight
+type ModelEnsemble struct {
+	Models     []*ClusterModel
+	Weights    []float64
+	cumWeights []float64
+}
+
+// Create an ensemble of the given models. If no weights are given, every model is as likely to be picked.
+func CreateModelEnsemble(models []*ClusterModel, weights []float64) (*ModelEnsemble, error) {
+	if len(models) == 0 {
+		return nil, fmt.Errorf("a model ensemble requires at least one model")
+	}
+	if len(weights) == 0 {
+		for range models {
+			weights = append(weights, 1)
+		}
+	} else if len(weights) != len(models) {
+		return nil, fmt.Errorf("a model ensemble requires a weight for each of its %d models (got %d)", len(models), len(weights))
+	}
+	toReturn := &ModelEnsemble{
+		Models:  models,
+		Weights: weights,
+	}
+	total := 0.0
+	for i, weight := range weights {
+		if weight < 0 {
+			return nil, fmt.Errorf("the weight of model %d must not be negative (got %f)", i, weight)
+		} else if len(models[i].ClusterSet.Clusters) == 0 && weight > 0 {
+			return nil, fmt.Errorf("model %d has no clusters to generate addresses from", i)
+		}
+		total += weight
+		toReturn.cumWeights = append(toReturn.cumWeights, total)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("at least one model in a model ensemble must have a weight above zero")
+	}
+	return toReturn, nil
+}
+
+func (ensemble *ModelEnsemble) pickModel(random *rand.Rand) *ClusterModel {
+	target := random.Float64() * ensemble.cumWeights[len(ensemble.cumWeights)-1]
+	index := sort.SearchFloat64s(ensemble.cumWeights, target)
+	if index >= len(ensemble.Models) {
+		index = len(ensemble.Models) - 1
+	}
+	return ensemble.Models[index]
+}
+
+func (ensemble *ModelEnsemble) GenerateAddresses(random *rand.Rand, generateCount int, jitter float64) []addressing.IPv6 {
+	return generateUniqueAddresses(generateCount, "model ensemble", func() addressing.IPv6 {
+		return ensemble.pickModel(random).GenerateAddress(random, jitter)
+	})
+}
+
+func (ensemble *ModelEnsemble) GenerateAddressesFromNetwork(random *rand.Rand, generateCount int, jitter float64, network *net.IPNet) ([]addressing.IPv6, error) {
+	networkNybbles, err := getGenerationNetworkNybbles(network)
+	if err != nil {
+		return nil, err
+	}
+	return generateUniqueAddresses(generateCount, "model ensemble", func() addressing.IPv6 {
+		return ensemble.pickModel(random).generateAddressFromNybbles(random, jitter, networkNybbles)
+	}), nil
+}
+
+func (ensemble *ModelEnsemble) GenerateAddressesFromNetworkWithCallback(random *rand.Rand, generateCount int, jitter float64, network *net.IPNet, fn addrProcessFunc) error {
+	networkNybbles, err := getGenerationNetworkNybbles(network)
+	if err != nil {
+		return err
+	}
+	return generateAcceptedAddresses(generateCount, func() addressing.IPv6 {
+		return ensemble.pickModel(random).generateAddressFromNybbles(random, jitter, networkNybbles)
+	}, fn)
+}
@@ -0,0 +1,53 @@
+package modeling
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func TestModelEnsemble_SamplesAtRatios(t *testing.T) {
+	first := getMergeTestModel(t, []string{"2600:1234:0000:0000:0000:0000:0000:????"}, []int{100}, 1)
+	second := getMergeTestModel(t, []string{"2a02:abcd:0000:0000:0000:0000:0000:????"}, []int{100}, 2)
+	ensemble, err := CreateModelEnsemble([]*ClusterModel{first, second}, []float64{3, 1})
+	assert.Nil(t, err)
+	random := rand.New(rand.NewSource(666))
+	addrs := ensemble.GenerateAddresses(random, 4000, 0)
+	assert.Len(t, addrs, 4000)
+	fromFirst := 0
+	for _, addr := range addrs {
+		if addr.High>>32 == 0x26001234 {
+			fromFirst++
+		}
+	}
+	assert.InDelta(t, 3000, fromFirst, 150)
+
+	_, network, _ := net.ParseCIDR("2600:1234::/32")
+	addrs, err = ensemble.GenerateAddressesFromNetwork(random, 100, 0, network)
+	assert.Nil(t, err)
+	for _, addr := range addrs {
+		assert.True(t, addr.In(network))
+	}
+
+	onlySecond, err := CreateModelEnsemble([]*ClusterModel{first, second}, []float64{0, 1})
+	assert.Nil(t, err)
+	for _, addr := range onlySecond.GenerateAddresses(random, 100, 0) {
+		assert.Equal(t, uint64(0x2a02abcd), addr.High>>32)
+	}
+}
+
+func TestCreateModelEnsemble_Invalid(t *testing.T) {
+	model := getMergeTestModel(t, []string{"2600:1234:0000:0000:0000:0000:0000:????"}, []int{100}, 1)
+	_, err := CreateModelEnsemble(nil, nil)
+	assert.NotNil(t, err)
+	_, err = CreateModelEnsemble([]*ClusterModel{model, model}, []float64{1})
+	assert.NotNil(t, err)
+	_, err = CreateModelEnsemble([]*ClusterModel{model}, []float64{-1})
+	assert.NotNil(t, err)
+	_, err = CreateModelEnsemble([]*ClusterModel{model, model}, []float64{0, 0})
+	assert.NotNil(t, err)
+	ensemble, err := CreateModelEnsemble([]*ClusterModel{model, model}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{1, 1}, ensemble.Weights)
+}
@@ -0,0 +1,359 @@
+package modeling
+
+import (
+	"fmt"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/zrandom"
+	"github.com/spf13/viper"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+)
+
+// The number of ranges that the values of a segment which are not common enough to stand on their own
+// are split into
+const entropySegmentRangeCount = 4
+
+// The most common values that a segment keeps as values of their own
+const entropySegmentMaxValues = 16
+
+// A generator in the style of Entropy/IP. Adjacent nybbles with similar entropy across the seed addresses
+// are grouped into segments, the common values and ranges of values in each segment are mined, and a
+// Bayesian network of the dependencies between segments is learned. Candidates are sampled from the
+// network one segment at a time.
+type EntropyIPModel struct {
+	NybbleEntropies []float64 // The entropy of each nybble across the seeds, normalized to between 0 and 1
+	Segments        []*EntropySegment
+}
+
+type EntropySegment struct {
+	Start    int     // The index of the first nybble in the segment
+	End      int     // The index one past the last nybble in the segment
+	Entropy  float64 // The mean normalized entropy of the segment's nybbles
+	Elements []*SegmentElement
+	Parent   int         // The index of the segment that this segment's values depend on, or -1 if none
+	Probs    [][]float64 // The probability of each element, for each element of the parent (or a single row without a parent)
+}
+
+// A value or range of values that a segment takes
+type SegmentElement struct {
+	Min   uint64
+	Max   uint64
+	Count int // The number of seeds with a value in the element
+}
+
+// Build an Entropy/IP model from the given seed addresses
+func CreateEntropyIPModel(fromAddrs []addressing.IPv6) (*EntropyIPModel, error) {
+	seeds := getSortedUniqueSeeds(fromAddrs)
+	if len(seeds) == 0 {
+		return nil, fmt.Errorf("an entropy model requires at least one seed address")
+	}
+	logging.Infof("Building entropy model from %d unique seed addresses.", len(seeds))
+
+	toReturn := &EntropyIPModel{NybbleEntropies: getNybbleEntropies(seeds)}
+	toReturn.Segments = getEntropySegments(toReturn.NybbleEntropies, viper.GetFloat64("EntropyIPSegmentThreshold"))
+
+	// Mine the elements of each segment and note which element each seed falls in
+
+	seedElements := make([][]int, len(toReturn.Segments))
+	for i, segment := range toReturn.Segments {
+		values := make([]uint64, len(seeds))
+		for j, seed := range seeds {
+			values[j] = segment.getValue(seed)
+		}
+		segment.Elements = mineSegmentElements(values, viper.GetFloat64("EntropyIPMinValueShare"))
+		seedElements[i] = make([]int, len(seeds))
+		for j, value := range values {
+			seedElements[i][j] = segment.getElementIndex(value)
+		}
+	}
+
+	// Each segment depends on the earlier segment that tells the most about it, which keeps the network
+	// acyclic and lets it be sampled from left to right
+
+	for i, segment := range toReturn.Segments {
+		segment.Parent = -1
+		bestInformation := 1e-9
+		for j := 0; j < i; j++ {
+			information := getMutualInformation(seedElements[i], seedElements[j], len(segment.Elements), len(toReturn.Segments[j].Elements))
+			if information > bestInformation {
+				bestInformation = information
+				segment.Parent = j
+			}
+		}
+		if segment.Parent == -1 {
+			segment.Probs = getConditionalProbabilities(seedElements[i], nil, len(segment.Elements), 1)
+		} else {
+			segment.Probs = getConditionalProbabilities(seedElements[i], seedElements[segment.Parent], len(segment.Elements), len(toReturn.Segments[segment.Parent].Elements))
+		}
+	}
+
+	logging.Infof("Built entropy model with %d segments.", len(toReturn.Segments))
+	return toReturn, nil
+}
+
+// Get the entropy of each nybble across the seeds, normalized to between 0 and 1
+func getNybbleEntropies(seeds []addressing.IPv6) []float64 {
+	toReturn := make([]float64, 32)
+	for i := 0; i < 32; i++ {
+		counts := make([]int, 16)
+		for _, seed := range seeds {
+			counts[seed.Nybble(i)]++
+		}
+		toReturn[i] = zrandom.GetEntropyOfCounts(counts) / 4.0
+	}
+	return toReturn
+}
+
+// Group adjacent nybbles into segments, starting a new segment wherever the entropy changes by more than
+// the threshold. Segments never cross the /32 or /64 boundaries.
+func getEntropySegments(entropies []float64, threshold float64) []*EntropySegment {
+	var toReturn []*EntropySegment
+	start := 0
+	for i := 1; i <= len(entropies); i++ {
+		if i == len(entropies) || i == 8 || i == 16 || math.Abs(entropies[i]-entropies[i-1]) > threshold {
+			total := 0.0
+			for _, entropy := range entropies[start:i] {
+				total += entropy
+			}
+			toReturn = append(toReturn, &EntropySegment{
+				Start:   start,
+				End:     i,
+				Entropy: total / float64(i-start),
+			})
+			start = i
+		}
+	}
+	return toReturn
+}
+
+// Get the values that are common enough (at least minShare of them) as elements of their own, and split
+// the rest of the values into ranges that hold roughly the same number of values each
+func mineSegmentElements(values []uint64, minShare float64) []*SegmentElement {
+	counts := make(map[uint64]int)
+	for _, value := range values {
+		counts[value]++
+	}
+	distinct := make([]uint64, 0, len(counts))
+	for value := range counts {
+		distinct = append(distinct, value)
+	}
+	sort.Slice(distinct, func(i, j int) bool {
+		if counts[distinct[i]] != counts[distinct[j]] {
+			return counts[distinct[i]] > counts[distinct[j]]
+		}
+		return distinct[i] < distinct[j]
+	})
+	var toReturn []*SegmentElement
+	var rest []uint64
+	for _, value := range distinct {
+		if len(toReturn) < entropySegmentMaxValues && float64(counts[value])/float64(len(values)) >= minShare {
+			toReturn = append(toReturn, &SegmentElement{Min: value, Max: value, Count: counts[value]})
+		} else {
+			rest = append(rest, value)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool {
+		return rest[i] < rest[j]
+	})
+	restCount := 0
+	for _, value := range rest {
+		restCount += counts[value]
+	}
+	rangeTarget := (restCount + entropySegmentRangeCount - 1) / entropySegmentRangeCount
+	var curRange *SegmentElement
+	for _, value := range rest {
+		if curRange == nil {
+			curRange = &SegmentElement{Min: value}
+		}
+		curRange.Max = value
+		curRange.Count += counts[value]
+		if curRange.Count >= rangeTarget {
+			toReturn = append(toReturn, curRange)
+			curRange = nil
+		}
+	}
+	if curRange != nil {
+		toReturn = append(toReturn, curRange)
+	}
+	return toReturn
+}
+
+// Get the mutual information (in bits) between the elements that the seeds fall in for two segments
+func getMutualInformation(first []int, second []int, firstCount int, secondCount int) float64 {
+	joint := make([][]int, firstCount)
+	for i := range joint {
+		joint[i] = make([]int, secondCount)
+	}
+	firstCounts := make([]int, firstCount)
+	secondCounts := make([]int, secondCount)
+	for i := range first {
+		joint[first[i]][second[i]]++
+		firstCounts[first[i]]++
+		secondCounts[second[i]]++
+	}
+	total := float64(len(first))
+	toReturn := 0.0
+	for i := range joint {
+		for j, count := range joint[i] {
+			if count == 0 {
+				continue
+			}
+			pJoint := float64(count) / total
+			toReturn += pJoint * math.Log2(pJoint/((float64(firstCounts[i])/total)*(float64(secondCounts[j])/total)))
+		}
+	}
+	return toReturn
+}
+
+// Get the probability of each of a segment's elements given each of its parent's elements. Every
+// combination is given a pseudo-count of one so that combinations that were not seen in the seeds can
+// still be generated.
+func getConditionalProbabilities(elements []int, parentElements []int, count int, parentCount int) [][]float64 {
+	toReturn := make([][]float64, parentCount)
+	for i := range toReturn {
+		toReturn[i] = make([]float64, count)
+		for j := range toReturn[i] {
+			toReturn[i][j] = 1.0
+		}
+	}
+	for i, element := range elements {
+		row := 0
+		if parentElements != nil {
+			row = parentElements[i]
+		}
+		toReturn[row][element]++
+	}
+	for _, row := range toReturn {
+		total := 0.0
+		for _, value := range row {
+			total += value
+		}
+		for j := range row {
+			row[j] /= total
+		}
+	}
+	return toReturn
+}
+
+// Get the value of the segment's nybbles in the address
+func (segment *EntropySegment) getValue(addr addressing.IPv6) uint64 {
+	var toReturn uint64
+	for i := segment.Start; i < segment.End; i++ {
+		toReturn = toReturn<<4 | uint64(addr.Nybble(i))
+	}
+	return toReturn
+}
+
+// Get the index of the element that holds the value, or -1 if none of them do
+func (segment *EntropySegment) getElementIndex(value uint64) int {
+	for i, element := range segment.Elements {
+		if value >= element.Min && value <= element.Max {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get the index of the element that the network's nybbles put each segment in, or -1 for the segments
+// that the network does not entirely cover (or that have no element for the network's value)
+func (model *EntropyIPModel) getEvidence(networkNybbles []uint8) []int {
+	toReturn := make([]int, len(model.Segments))
+	for i, segment := range model.Segments {
+		toReturn[i] = -1
+		if segment.End <= len(networkNybbles) {
+			var value uint64
+			for _, nybble := range networkNybbles[segment.Start:segment.End] {
+				value = value<<4 | uint64(nybble)
+			}
+			toReturn[i] = segment.getElementIndex(value)
+		}
+	}
+	return toReturn
+}
+
+// Sample an address from the network, keeping the given leading nybbles. The elements picked for the
+// segments covered by those nybbles are fixed by the evidence so that the segments depending on them are
+// sampled accordingly. Nybbles past the leading ones are then made random with a likelihood of jitter.
+func (model *EntropyIPModel) generateAddrFromNybbles(random *rand.Rand, jitter float64, fromNybbles []uint8, evidence []int) addressing.IPv6 {
+	nybbles := make([]uint8, 32)
+	chosen := make([]int, len(model.Segments))
+	for i, segment := range model.Segments {
+		if evidence[i] != -1 {
+			chosen[i] = evidence[i]
+		} else if segment.Parent == -1 {
+			chosen[i] = pickIndex(random, segment.Probs[0])
+		} else {
+			chosen[i] = pickIndex(random, segment.Probs[chosen[segment.Parent]])
+		}
+		value := segment.Elements[chosen[i]].sample(random)
+		for j := segment.End - 1; j >= segment.Start; j-- {
+			nybbles[j] = uint8(value & 0xf)
+			value >>= 4
+		}
+	}
+	copy(nybbles, fromNybbles)
+	for i := len(fromNybbles); i < 32; i++ {
+		if float64(random.Int31n(10000))/100.0 <= jitter*100 {
+			nybbles[i] = uint8(random.Int31n(16))
+		}
+	}
+	return addressing.NybblesToIP(nybbles)
+}
+
+func (element *SegmentElement) sample(random *rand.Rand) uint64 {
+	if element.Min == element.Max {
+		return element.Min
+	}
+	span := element.Max - element.Min + 1
+	if span == 0 { // The element covers every 64-bit value
+		return random.Uint64()
+	}
+	return element.Min + random.Uint64()%span
+}
+
+// Pick an index at random, weighted by the given probabilities
+func pickIndex(random *rand.Rand, probs []float64) int {
+	target := random.Float64()
+	for i, prob := range probs {
+		target -= prob
+		if target < 0 {
+			return i
+		}
+	}
+	return len(probs) - 1
+}
+
+func (model *EntropyIPModel) GenerateAddresses(random *rand.Rand, generateCount int, jitter float64) []addressing.IPv6 {
+	evidence := model.getEvidence(nil)
+	return generateUniqueAddresses(generateCount, "entropy model", func() addressing.IPv6 {
+		return model.generateAddrFromNybbles(random, jitter, nil, evidence)
+	})
+}
+
+func (model *EntropyIPModel) GenerateAddressesFromNetwork(random *rand.Rand, generateCount int, jitter float64, network *net.IPNet) ([]addressing.IPv6, error) {
+	networkNybbles, err := getGenerationNetworkNybbles(network)
+	if err != nil {
+		return nil, err
+	}
+	evidence := model.getEvidence(networkNybbles)
+	return generateUniqueAddresses(generateCount, "entropy model", func() addressing.IPv6 {
+		return model.generateAddrFromNybbles(random, jitter, networkNybbles, evidence)
+	}), nil
+}
+
+// Sample addresses within the network, handing each to the callback, until it has accepted generateCount
+// of them. The segments that the network covers are fixed as evidence once up front, so every sample only
+// draws the remaining segments, conditioned on the network's own.
+func (model *EntropyIPModel) GenerateAddressesFromNetworkWithCallback(random *rand.Rand, generateCount int, jitter float64, network *net.IPNet, fn addrProcessFunc) error {
+	networkNybbles, err := getGenerationNetworkNybbles(network)
+	if err != nil {
+		return err
+	}
+	evidence := model.getEvidence(networkNybbles)
+	return generateAcceptedAddresses(generateCount, func() addressing.IPv6 {
+		return model.generateAddrFromNybbles(random, jitter, networkNybbles, evidence)
+	}, fn)
+}
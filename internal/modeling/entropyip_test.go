@@ -0,0 +1,108 @@
+package modeling
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+// Hosts under two /64s, where the first uses low-byte interface identifiers and the second uses random
+// ones, so that the interface identifier depends on the network
+func getEntropyTestIPs() []addressing.IPv6 {
+	random := rand.New(rand.NewSource(666))
+	var toReturn []addressing.IPv6
+	for i := 0; i < 100; i++ {
+		toReturn = append(toReturn, addressing.IPv6{High: 0x2600123400000001, Low: uint64(random.Intn(256))})
+		toReturn = append(toReturn, addressing.IPv6{High: 0x2600123400000002, Low: random.Uint64()})
+	}
+	return toReturn
+}
+
+func TestGetEntropySegments_SplitsOnEntropyChangesAndBoundaries(t *testing.T) {
+	entropies := make([]float64, 32)
+	for i := 28; i < 32; i++ {
+		entropies[i] = 1.0
+	}
+	segments := getEntropySegments(entropies, 0.1)
+	var bounds [][2]int
+	for _, segment := range segments {
+		bounds = append(bounds, [2]int{segment.Start, segment.End})
+	}
+	assert.Equal(t, [][2]int{{0, 8}, {8, 16}, {16, 28}, {28, 32}}, bounds)
+	assert.Equal(t, 1.0, segments[3].Entropy)
+}
+
+func TestMineSegmentElements_CommonValuesAndRanges(t *testing.T) {
+	var values []uint64
+	for i := 0; i < 50; i++ {
+		values = append(values, 0x80)
+	}
+	for i := uint64(0); i < 50; i++ {
+		values = append(values, 0x1000+i)
+	}
+	elements := mineSegmentElements(values, 0.05)
+	assert.Equal(t, &SegmentElement{Min: 0x80, Max: 0x80, Count: 50}, elements[0])
+	assert.Len(t, elements, 1+entropySegmentRangeCount)
+	count := 0
+	for _, element := range elements[1:] {
+		assert.True(t, element.Min >= 0x1000 && element.Max < 0x1000+50)
+		count += element.Count
+	}
+	assert.Equal(t, 50, count)
+}
+
+func TestCreateEntropyIPModel_LearnsDependencies(t *testing.T) {
+	model, err := CreateEntropyIPModel(getEntropyTestIPs())
+	assert.Nil(t, err)
+	for i, segment := range model.Segments {
+		assert.True(t, segment.Parent < i)
+		for _, row := range segment.Probs {
+			assert.Len(t, row, len(segment.Elements))
+		}
+	}
+
+	// The last segment depends on an earlier one, since the interface identifier tells which /64 it is in
+	last := model.Segments[len(model.Segments)-1]
+	assert.NotEqual(t, -1, last.Parent)
+
+	_, err = CreateEntropyIPModel(nil)
+	assert.NotNil(t, err)
+}
+
+func TestEntropyIPModel_GenerateAddressesFromNetwork(t *testing.T) {
+	model, err := CreateEntropyIPModel(getEntropyTestIPs())
+	assert.Nil(t, err)
+	_, network, _ := net.ParseCIDR("2600:1234:0:1::/64")
+	addrs, err := model.GenerateAddressesFromNetwork(rand.New(rand.NewSource(666)), 100, 0.0, network)
+	assert.Nil(t, err)
+	assert.Len(t, addrs, 100)
+	lowByte := 0
+	for _, addr := range addrs {
+		assert.True(t, addr.In(network), addr.String())
+		if addr.Low < 256 {
+			lowByte++
+		}
+	}
+
+	// Given the network, most of the interface identifiers follow the low-byte pattern seen in it
+	assert.True(t, lowByte > 50)
+}
+
+func TestEntropyIPModel_GenerateAddressesFromNetworkWithCallback(t *testing.T) {
+	model, err := CreateEntropyIPModel(getEntropyTestIPs())
+	assert.Nil(t, err)
+	_, network, _ := net.ParseCIDR("2600:1234::/32")
+	seen := make(map[addressing.IPv6]bool)
+	err = model.GenerateAddressesFromNetworkWithCallback(rand.New(rand.NewSource(666)), 50, 0.1, network, func(addr addressing.IPv6) (bool, error) {
+		assert.True(t, addr.In(network))
+		if seen[addr] {
+			return true, nil
+		}
+		seen[addr] = true
+		return false, nil
+	})
+	assert.Nil(t, err)
+	assert.Len(t, seen, 50)
+}
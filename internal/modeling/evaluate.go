@@ -0,0 +1,139 @@
+package modeling
+
+import (
+	"fmt"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"math/rand"
+	"sort"
+)
+
+const (
+	RandomSplit = "random"
+	PrefixSplit = "prefix"
+)
+
+// How well the candidates from a generator did at finding addresses that it was not trained on
+type EvaluationResult struct {
+	Name           string  `json:"name"`
+	Generator      string  `json:"generator"`
+	Jitter         float64 `json:"jitter"`
+	TrainCount     int     `json:"train_count"`
+	TestCount      int     `json:"test_count"`
+	CandidateCount int     `json:"candidate_count"`
+	TrainOverlap   int     `json:"train_overlap"` // Candidates that were already in the training set
+	Hits           int     `json:"hits"`          // Candidates that are in the test set
+	HitRate        float64 `json:"hit_rate"`      // The share of the candidates that are in the test set
+	Recall         float64 `json:"recall"`        // The share of the test set that was generated
+	Test64Count    int     `json:"test_64_count"`
+	Covered64Count int     `json:"covered_64_count"` // Test /64 networks with at least one candidate in them
+	Test48Count    int     `json:"test_48_count"`
+	Covered48Count int     `json:"covered_48_count"` // Test /48 networks with at least one candidate in them
+}
+
+func ValidateSplitMethod(toCheck string) error {
+	if toCheck == RandomSplit || toCheck == PrefixSplit {
+		return nil
+	}
+	return fmt.Errorf("'%s' is not a valid split method (expected '%s' or '%s')", toCheck, RandomSplit, PrefixSplit)
+}
+
+// Split the addresses into a training set and a test set holding roughly testShare of them. A random split
+// picks the test addresses individually, while a prefix split holds out whole networks of the given
+// prefix length (up to 64) so that the test set is made up of networks the generator has never seen.
+func SplitAddresses(random *rand.Rand, addrs []addressing.IPv6, method string, testShare float64, prefixLength int) ([]addressing.IPv6, []addressing.IPv6, error) {
+	if testShare <= 0 || testShare >= 1 {
+		return nil, nil, fmt.Errorf("the test share must be between 0 and 1 (got %f)", testShare)
+	}
+	addrs = getSortedUniqueSeeds(addrs)
+	switch method {
+	case RandomSplit:
+		shuffled := append([]addressing.IPv6{}, addrs...)
+		random.Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+		testCount := int(float64(len(shuffled)) * testShare)
+		return shuffled[testCount:], shuffled[:testCount], nil
+	case PrefixSplit:
+		if prefixLength < 1 || prefixLength > 64 {
+			return nil, nil, fmt.Errorf("the split prefix length must be between 1 and 64 (got %d)", prefixLength)
+		}
+		getPrefix := func(addr addressing.IPv6) uint64 {
+			return addr.High >> uint(64-prefixLength)
+		}
+		var prefixes []uint64
+		seen := make(map[uint64]struct{})
+		for _, addr := range addrs {
+			if _, ok := seen[getPrefix(addr)]; !ok {
+				seen[getPrefix(addr)] = struct{}{}
+				prefixes = append(prefixes, getPrefix(addr))
+			}
+		}
+		random.Shuffle(len(prefixes), func(i, j int) {
+			prefixes[i], prefixes[j] = prefixes[j], prefixes[i]
+		})
+		testPrefixes := make(map[uint64]struct{})
+		for _, prefix := range prefixes[:int(float64(len(prefixes))*testShare)] {
+			testPrefixes[prefix] = struct{}{}
+		}
+		var train, test []addressing.IPv6
+		for _, addr := range addrs {
+			if _, ok := testPrefixes[getPrefix(addr)]; ok {
+				test = append(test, addr)
+			} else {
+				train = append(train, addr)
+			}
+		}
+		return train, test, nil
+	default:
+		return nil, nil, ValidateSplitMethod(method)
+	}
+}
+
+// Score the candidates against the addresses that were held out of training
+func EvaluateCandidates(candidates []addressing.IPv6, train []addressing.IPv6, test []addressing.IPv6) *EvaluationResult {
+	trainSet := addressing.GetIPSet(train)
+	testSet := addressing.GetIPSet(test)
+	test64s := make(map[uint64]bool)
+	test48s := make(map[uint64]bool)
+	for _, addr := range test {
+		test64s[addr.High] = false
+		test48s[addr.High>>16] = false
+	}
+	toReturn := &EvaluationResult{
+		TrainCount:     len(train),
+		TestCount:      len(test),
+		CandidateCount: len(candidates),
+		Test64Count:    len(test64s),
+		Test48Count:    len(test48s),
+	}
+	for _, candidate := range candidates {
+		if _, ok := trainSet[candidate]; ok {
+			toReturn.TrainOverlap++
+		}
+		if _, ok := testSet[candidate]; ok {
+			toReturn.Hits++
+		}
+		if covered, ok := test64s[candidate.High]; ok && !covered {
+			test64s[candidate.High] = true
+			toReturn.Covered64Count++
+		}
+		if covered, ok := test48s[candidate.High>>16]; ok && !covered {
+			test48s[candidate.High>>16] = true
+			toReturn.Covered48Count++
+		}
+	}
+	if len(candidates) > 0 {
+		toReturn.HitRate = float64(toReturn.Hits) / float64(len(candidates))
+	}
+	if len(test) > 0 {
+		toReturn.Recall = float64(toReturn.Hits) / float64(len(test))
+	}
+	return toReturn
+}
+
+// Order results from the best hit rate to the worst, keeping the original order for ties
+func SortEvaluationResults(results []*EvaluationResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].HitRate > results[j].HitRate
+	})
+}
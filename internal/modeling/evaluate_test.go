@@ -0,0 +1,104 @@
+package modeling
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func getEvaluateTestIPs(toParse ...string) []addressing.IPv6 {
+	var toReturn []addressing.IPv6
+	for _, s := range toParse {
+		addr, _ := addressing.ParseIPv6(s)
+		toReturn = append(toReturn, addr)
+	}
+	return toReturn
+}
+
+func TestSplitAddresses_Random(t *testing.T) {
+	addrs := getModelingTestIPs()
+	train, test, err := SplitAddresses(rand.New(rand.NewSource(666)), addrs, RandomSplit, 0.25, 0)
+	assert.Nil(t, err)
+	unique := len(addressing.GetIPSet(addrs))
+	assert.Equal(t, unique/4, len(test))
+	assert.Equal(t, unique, len(train)+len(test))
+	trainSet := addressing.GetIPSet(train)
+	for _, addr := range test {
+		_, ok := trainSet[addr]
+		assert.False(t, ok)
+	}
+	sameTrain, sameTest, _ := SplitAddresses(rand.New(rand.NewSource(666)), addrs, RandomSplit, 0.25, 0)
+	assert.Equal(t, train, sameTrain)
+	assert.Equal(t, test, sameTest)
+}
+
+func TestSplitAddresses_Prefix(t *testing.T) {
+	addrs := getEvaluateTestIPs(
+		"2600:1::1", "2600:1::2", "2600:1:0:1::1",
+		"2600:2::1", "2600:2::2",
+		"2600:3::1",
+		"2600:4::1", "2600:4:0:5::1",
+	)
+	train, test, err := SplitAddresses(rand.New(rand.NewSource(666)), addrs, PrefixSplit, 0.5, 32)
+	assert.Nil(t, err)
+	assert.Equal(t, len(addrs), len(train)+len(test))
+	trainPrefixes := make(map[uint64]struct{})
+	for _, addr := range train {
+		trainPrefixes[addr.High>>32] = struct{}{}
+	}
+	testPrefixes := make(map[uint64]struct{})
+	for _, addr := range test {
+		testPrefixes[addr.High>>32] = struct{}{}
+		_, ok := trainPrefixes[addr.High>>32]
+		assert.False(t, ok)
+	}
+	assert.Len(t, trainPrefixes, 2)
+	assert.Len(t, testPrefixes, 2)
+
+	_, _, err = SplitAddresses(rand.New(rand.NewSource(666)), addrs, PrefixSplit, 0.5, 80)
+	assert.NotNil(t, err)
+	_, _, err = SplitAddresses(rand.New(rand.NewSource(666)), addrs, PrefixSplit, 1, 32)
+	assert.NotNil(t, err)
+	_, _, err = SplitAddresses(rand.New(rand.NewSource(666)), addrs, "bogus", 0.5, 32)
+	assert.NotNil(t, err)
+}
+
+func TestEvaluateCandidates(t *testing.T) {
+	train := getEvaluateTestIPs("2600:1::1", "2600:1::2")
+	test := getEvaluateTestIPs("2600:2::1", "2600:2:0:1::1", "2600:3::1", "2600:3:1::1")
+	candidates := getEvaluateTestIPs(
+		"2600:1::1",     // In the training set
+		"2600:2::1",     // A hit
+		"2600:2::5",     // Covers a /64 that is already covered
+		"2600:3:0:0::7", // Covers a /64 without a hit
+		"2600:3:1:2::1", // Covers a /48 but no /64
+		"2600:9::1",     // A miss
+	)
+	result := EvaluateCandidates(candidates, train, test)
+	assert.Equal(t, &EvaluationResult{
+		TrainCount:     2,
+		TestCount:      4,
+		CandidateCount: 6,
+		TrainOverlap:   1,
+		Hits:           1,
+		HitRate:        1.0 / 6,
+		Recall:         0.25,
+		Test64Count:    4,
+		Covered64Count: 2,
+		Test48Count:    3,
+		Covered48Count: 3,
+	}, result)
+}
+
+func TestSortEvaluationResults(t *testing.T) {
+	results := []*EvaluationResult{
+		{Name: "a", HitRate: 0.1},
+		{Name: "b", HitRate: 0.3},
+		{Name: "c", HitRate: 0.1},
+	}
+	SortEvaluationResults(results)
+	assert.Equal(t, "b", results[0].Name)
+	assert.Equal(t, "a", results[1].Name)
+	assert.Equal(t, "c", results[2].Name)
+}
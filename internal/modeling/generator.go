@@ -0,0 +1,109 @@
+package modeling
+
+import (
+	"fmt"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/spf13/viper"
+	"math/rand"
+	"net"
+	"sort"
+)
+
+const (
+	ClusterGeneratorType   = "cluster"
+	SpaceTreeGeneratorType = "spacetree"
+	EntropyIPGeneratorType = "entropyip"
+)
+
+// A source of candidate addresses. The cluster model is the default, and the other generators implement
+// the same methods so that address generation and the discovery loop can use any of them.
+type Generator interface {
+	GenerateAddresses(random *rand.Rand, generateCount int, jitter float64) []addressing.IPv6
+	GenerateAddressesFromNetwork(random *rand.Rand, generateCount int, jitter float64, network *net.IPNet) ([]addressing.IPv6, error)
+	GenerateAddressesFromNetworkWithCallback(random *rand.Rand, generateCount int, jitter float64, network *net.IPNet, fn addrProcessFunc) error
+}
+
+// Get the generator types that can be selected
+func GetGeneratorTypes() []string {
+	return []string{ClusterGeneratorType, SpaceTreeGeneratorType, EntropyIPGeneratorType}
+}
+
+// Whether the generator type is built from seed addresses rather than loaded from a model file
+func IsSeededGeneratorType(generatorType string) bool {
+	return generatorType == SpaceTreeGeneratorType || generatorType == EntropyIPGeneratorType
+}
+
+// Build a generator of one of the seeded generator types from the given seed addresses
+func CreateGeneratorFromSeeds(generatorType string, seeds []addressing.IPv6) (Generator, error) {
+	switch generatorType {
+	case SpaceTreeGeneratorType:
+		return CreateSpaceTree(seeds)
+	case EntropyIPGeneratorType:
+		return CreateEntropyIPModel(seeds)
+	default:
+		return nil, fmt.Errorf("the %s generator is not built from seed addresses", generatorType)
+	}
+}
+
+func ValidateGeneratorType(toCheck string) error {
+	for _, generatorType := range GetGeneratorTypes() {
+		if toCheck == generatorType {
+			return nil
+		}
+	}
+	return fmt.Errorf("'%s' is not a valid generator (expected one of %v)", toCheck, GetGeneratorTypes())
+}
+
+// Get the nybbles of the network that addresses are to be generated within
+func getGenerationNetworkNybbles(network *net.IPNet) ([]uint8, error) {
+	ones, _ := network.Mask.Size()
+	if ones%4 != 0 {
+		return nil, fmt.Errorf("generating addresses in a network requires a network length that is divisible by 4 (got length of %d)", ones)
+	}
+	return addressing.GetNybblesFromNetwork(network), nil
+}
+
+// Call newAddr until it has produced generateCount unique addresses
+func generateUniqueAddresses(generateCount int, description string, newAddr func() addressing.IPv6) []addressing.IPv6 {
+	addrTree := newAddressTree()
+	var toReturn []addressing.IPv6
+	iteration := 0
+	for len(toReturn) < generateCount {
+		if iteration%viper.GetInt("LogLoopEmitFreq") == 0 {
+			logging.Infof("Generating new candidate address %d using %s. Unique count size is %d.", iteration, description, addrTree.Size())
+		}
+		addr := newAddr()
+		if addrTree.AddIP(addr) {
+			toReturn = append(toReturn, addr)
+		}
+		iteration++
+	}
+	logging.Infof("Successfully generated %d addresses in %d iterations.", len(toReturn), iteration)
+	return toReturn
+}
+
+// Call newAddr until the callback has accepted generateCount of its addresses
+func generateAcceptedAddresses(generateCount int, newAddr func() addressing.IPv6, fn addrProcessFunc) error {
+	accepted := 0
+	for accepted < generateCount {
+		isFiltered, err := fn(newAddr())
+		if err != nil {
+			return err
+		} else if !isFiltered {
+			accepted++
+		}
+	}
+	return nil
+}
+
+// Get the unique seed addresses in order. The address tree drops the duplicates, and sorting what is left
+// keeps the generators built from them the same from run to run.
+func getSortedUniqueSeeds(fromAddrs []addressing.IPv6) []addressing.IPv6 {
+	corpus := CreateFromAddresses(fromAddrs, viper.GetInt("LogLoopEmitFreq"))
+	toReturn := corpus.GetAllIPs()
+	sort.Slice(toReturn, func(i, j int) bool {
+		return toReturn[i].High < toReturn[j].High || (toReturn[i].High == toReturn[j].High && toReturn[i].Low < toReturn[j].Low)
+	})
+	return toReturn
+}
@@ -0,0 +1,35 @@
+package modeling
+
+import (
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func TestGenerators_SameSeedSameAddresses(t *testing.T) {
+	viper.Set("ModelCheckCount", 50)
+	defer viper.Set("ModelCheckCount", 10000)
+	addrs := getModelingTestIPs()
+	spaceTree, err := CreateSpaceTreeWithLeafSize(addrs, 8)
+	assert.Nil(t, err)
+	entropyModel, err := CreateEntropyIPModel(addrs)
+	assert.Nil(t, err)
+	generators := map[string]Generator{
+		ClusterGeneratorType:   CreateClusteringModelWithWorkers(addrs, 2),
+		SpaceTreeGeneratorType: spaceTree,
+		EntropyIPGeneratorType: entropyModel,
+	}
+	_, network, _ := net.ParseCIDR("2600:1234::/32")
+	for generatorType, generator := range generators {
+		first, err := generator.GenerateAddressesFromNetwork(rand.New(rand.NewSource(666)), 200, 0.1, network)
+		assert.Nil(t, err)
+		second, err := generator.GenerateAddressesFromNetwork(rand.New(rand.NewSource(666)), 200, 0.1, network)
+		assert.Nil(t, err)
+		assert.Equal(t, first, second, generatorType)
+		third, err := generator.GenerateAddressesFromNetwork(rand.New(rand.NewSource(667)), 200, 0.1, network)
+		assert.Nil(t, err)
+		assert.NotEqual(t, first, third, generatorType)
+	}
+}
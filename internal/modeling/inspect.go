@@ -0,0 +1,201 @@
+package modeling
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ekaley/ipv666/internal"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The JSON form of a cluster model. Every field of the msgpack form is kept so that a model exported to
+// JSON and imported again is the same model.
+type clusterModelJSON struct {
+	Version      int               `json:"version"`
+	Captured     int               `json:"captured"`
+	RangeSize    int               `json:"range_size"`
+	Density      float64           `json:"density"`
+	Clusters     []*genClusterJSON `json:"clusters"`
+	NybbleCounts []map[uint8]int   `json:"nybble_counts"` // Counts of each nybble at each position in the stardust addresses
+	Metadata     *ModelMetadata    `json:"metadata,omitempty"`
+}
+
+// A cluster in JSON. The pattern is what gets read back, while the address keeps the nybbles that sit
+// under the wildcards. It can be left out when editing by hand, in which case those nybbles are zero.
+type genClusterJSON struct {
+	Pattern  string           `json:"pattern"`
+	Address  *addressing.IPv6 `json:"address,omitempty"`
+	Captured int              `json:"captured"`
+	Density  float64          `json:"density"`
+	Size     int              `json:"size"`
+}
+
+// Get the range as an address pattern in which wildcard nybbles are marked with '?'
+// (ie: 2600:1234:0000:00??:0000:0000:0000:000?)
+func (genRange *GenRange) GetPattern() string {
+	var toReturn strings.Builder
+	for i, nybble := range genRange.AddrNybbles {
+		if i > 0 && i%4 == 0 {
+			toReturn.WriteString(":")
+		}
+		if _, ok := genRange.WildIndices[i]; ok {
+			toReturn.WriteString("?")
+		} else {
+			toReturn.WriteString(strconv.FormatUint(uint64(nybble), 16))
+		}
+	}
+	return toReturn.String()
+}
+
+// Parse an address pattern of 32 nybbles (with or without colons) in which wildcard nybbles are marked
+// with '?'. The nybbles under the wildcards are zero.
+func ParseGenRangePattern(toParse string) (*GenRange, error) {
+	nybbleString := strings.Replace(toParse, ":", "", -1)
+	if len(nybbleString) != 32 {
+		return nil, fmt.Errorf("the pattern '%s' does not have 32 nybbles", toParse)
+	}
+	toReturn := &GenRange{
+		AddrNybbles: make([]uint8, 32),
+		WildIndices: make(map[int]internal.Empty),
+	}
+	for i, char := range nybbleString {
+		if char == '?' {
+			toReturn.WildIndices[i] = internal.Empty{}
+			continue
+		}
+		nybble, err := strconv.ParseUint(string(char), 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("the pattern '%s' has an invalid nybble '%c'", toParse, char)
+		}
+		toReturn.AddrNybbles[i] = uint8(nybble)
+	}
+	return toReturn, nil
+}
+
+// Get the clusters of the model from the densest to the sparsest, with ties going to the cluster that
+// captured the most addresses
+func (clusterModel *ClusterModel) GetClustersByDensity() []*GenCluster {
+	toReturn := append([]*GenCluster{}, clusterModel.ClusterSet.Clusters...)
+	sort.SliceStable(toReturn, func(i, j int) bool {
+		if toReturn[i].Density != toReturn[j].Density {
+			return toReturn[i].Density > toReturn[j].Density
+		}
+		return toReturn[i].Captured > toReturn[j].Captured
+	})
+	return toReturn
+}
+
+// Get how often each nybble occurs at each of the 32 positions in the stardust addresses
+func (clusterModel *ClusterModel) GetNybbleHistogram() [][16]int {
+	toReturn := make([][16]int, len(clusterModel.NybbleCounts))
+	for i, counts := range clusterModel.NybbleCounts {
+		for nybble, count := range counts {
+			if nybble < 16 {
+				toReturn[i][nybble] = count
+			}
+		}
+	}
+	return toReturn
+}
+
+func (clusterModel *ClusterModel) MarshalJSON() ([]byte, error) {
+	toEncode := clusterModelJSON{
+		Version:      clusterModel.Version,
+		Clusters:     []*genClusterJSON{},
+		NybbleCounts: clusterModel.NybbleCounts,
+		Metadata:     clusterModel.Metadata,
+	}
+	if clusterModel.ClusterSet != nil {
+		toEncode.Captured = clusterModel.ClusterSet.Captured
+		toEncode.RangeSize = clusterModel.ClusterSet.RangeSize
+		toEncode.Density = clusterModel.ClusterSet.Density
+		for _, cluster := range clusterModel.ClusterSet.Clusters {
+			address := cluster.Range.GetIP()
+			toEncode.Clusters = append(toEncode.Clusters, &genClusterJSON{
+				Pattern:  cluster.Range.GetPattern(),
+				Address:  &address,
+				Captured: cluster.Captured,
+				Density:  cluster.Density,
+				Size:     cluster.Size,
+			})
+		}
+	}
+	return json.Marshal(toEncode)
+}
+
+func (clusterModel *ClusterModel) UnmarshalJSON(fromBytes []byte) error {
+	var decoded clusterModelJSON
+	if err := json.Unmarshal(fromBytes, &decoded); err != nil {
+		return err
+	}
+	clusterSet := &ClusterSet{
+		Clusters:  []*GenCluster{},
+		Captured:  decoded.Captured,
+		RangeSize: decoded.RangeSize,
+		Density:   decoded.Density,
+	}
+	for i, cluster := range decoded.Clusters {
+		genRange, err := ParseGenRangePattern(cluster.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid cluster %d: %s", i, err)
+		}
+		if cluster.Address != nil {
+			addrNybbles := addressing.GetNybblesFromIP(*cluster.Address, 32)
+			for j := range addrNybbles {
+				_, wild := genRange.WildIndices[j]
+				if !wild && addrNybbles[j] != genRange.AddrNybbles[j] {
+					return fmt.Errorf("invalid cluster %d: the address %s does not match the pattern '%s'", i, cluster.Address, cluster.Pattern)
+				}
+			}
+			genRange.AddrNybbles = addrNybbles
+		}
+		clusterSet.Clusters = append(clusterSet.Clusters, &GenCluster{
+			Range:    genRange,
+			Captured: cluster.Captured,
+			Density:  cluster.Density,
+			Size:     cluster.Size,
+		})
+	}
+	if len(decoded.NybbleCounts) != 32 {
+		return fmt.Errorf("expected nybble counts for 32 positions (got %d)", len(decoded.NybbleCounts))
+	}
+	for i, counts := range decoded.NybbleCounts {
+		if counts == nil {
+			decoded.NybbleCounts[i] = make(map[uint8]int)
+		}
+		for nybble := range counts {
+			if nybble > 15 {
+				return fmt.Errorf("the nybble counts for position %d include %d, which is not a nybble", i, nybble)
+			}
+		}
+	}
+	*clusterModel = ClusterModel{
+		ClusterSet:   clusterSet,
+		NybbleCounts: decoded.NybbleCounts,
+		Version:      decoded.Version,
+		Metadata:     decoded.Metadata,
+	}
+	return nil
+}
+
+// Write the model to the given path as JSON
+func (clusterModel *ClusterModel) SaveJSON(filePath string) error {
+	toWrite, err := json.MarshalIndent(clusterModel, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filePath, toWrite, 0644)
+}
+
+func LoadModelFromJSONFile(filePath string) (*ClusterModel, error) {
+	fileContent, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var toReturn ClusterModel
+	err = json.Unmarshal(fileContent, &toReturn)
+	return &toReturn, err
+}
@@ -0,0 +1,89 @@
+package modeling
+
+import (
+	"encoding/json"
+	"github.com/ekaley/ipv666/internal/persist"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestGenRange_PatternRoundTrip(t *testing.T) {
+	genRange := getTestRange()
+	pattern := genRange.GetPattern()
+	assert.Len(t, pattern, 39)
+	parsed, err := ParseGenRangePattern(pattern)
+	assert.Nil(t, err)
+	assert.Equal(t, genRange.WildIndices, parsed.WildIndices)
+	assert.True(t, genRange.Equals(parsed))
+	assert.Equal(t, pattern, parsed.GetPattern())
+
+	parsed, err = ParseGenRangePattern("2600123400000000000000000000000?")
+	assert.Nil(t, err)
+	assert.Equal(t, "2600:1234:0000:0000:0000:0000:0000:000?", parsed.GetPattern())
+
+	_, err = ParseGenRangePattern("2600:1234::1")
+	assert.NotNil(t, err)
+	_, err = ParseGenRangePattern("2600:1234:0000:0000:0000:0000:0000:000g")
+	assert.NotNil(t, err)
+}
+
+func TestClusterModel_JSONRoundTrip(t *testing.T) {
+	viper.Set("ModelCheckCount", 50)
+	defer viper.Set("ModelCheckCount", 10000)
+	model := CreateClusteringModelWithWorkers(getModelingTestIPs(), 2)
+
+	// Go through msgpack first so that the model looks like one loaded from a file
+	packed, err := persist.Marshal(model)
+	assert.Nil(t, err)
+	loaded, err := LoadModelFromBytes(packed)
+	assert.Nil(t, err)
+
+	exported, err := json.Marshal(loaded)
+	assert.Nil(t, err)
+	var imported ClusterModel
+	assert.Nil(t, json.Unmarshal(exported, &imported))
+	assert.Equal(t, loaded, &imported)
+}
+
+func TestClusterModel_JSONImportByHand(t *testing.T) {
+	var nybbleCounts []map[uint8]int
+	for i := 0; i < 32; i++ {
+		nybbleCounts = append(nybbleCounts, map[uint8]int{0: 1})
+	}
+	counts, _ := json.Marshal(nybbleCounts)
+	var model ClusterModel
+	err := json.Unmarshal([]byte(`{"clusters": [{"pattern": "2600:1234:0000:0000:0000:0000:0000:00??", "captured": 10, "size": 256, "density": 0.04}], "nybble_counts": `+string(counts)+`}`), &model)
+	assert.Nil(t, err)
+	assert.Len(t, model.ClusterSet.Clusters, 1)
+	assert.Len(t, model.ClusterSet.Clusters[0].Range.WildIndices, 2)
+	assert.Equal(t, float64(256), model.ClusterSet.Clusters[0].Range.Size())
+	assert.Len(t, model.GenerateAddresses(rand.New(rand.NewSource(666)), 10, 0), 10)
+
+	err = json.Unmarshal([]byte(`{"clusters": [{"pattern": "2600:1234:0000:0000:0000:0000:0000:00??", "address": "2600:1235::1"}], "nybble_counts": `+string(counts)+`}`), &model)
+	assert.NotNil(t, err)
+	err = json.Unmarshal([]byte(`{"clusters": [], "nybble_counts": []}`), &model)
+	assert.NotNil(t, err)
+}
+
+func TestClusterModel_GetClustersByDensity(t *testing.T) {
+	model := &ClusterModel{ClusterSet: &ClusterSet{Clusters: []*GenCluster{
+		{Range: getTestRange(), Density: 0.1, Captured: 1},
+		{Range: getTestRange(), Density: 0.5, Captured: 1},
+		{Range: getTestRange(), Density: 0.1, Captured: 3},
+	}}}
+	clusters := model.GetClustersByDensity()
+	assert.Equal(t, 0.5, clusters[0].Density)
+	assert.Equal(t, 3, clusters[1].Captured)
+	assert.Equal(t, 1, clusters[2].Captured)
+	assert.Equal(t, 0.1, model.ClusterSet.Clusters[0].Density)
+}
+
+func TestClusterModel_GetNybbleHistogram(t *testing.T) {
+	model := &ClusterModel{NybbleCounts: addrsToNybbleCounts(getModelingTestIPs()[:3])}
+	histogram := model.GetNybbleHistogram()
+	assert.Len(t, histogram, 32)
+	assert.Equal(t, 3, histogram[0][2])
+	assert.Equal(t, 3, histogram[1][6])
+}
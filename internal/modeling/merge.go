@@ -0,0 +1,102 @@
+package modeling
+
+import (
+	"fmt"
+	"github.com/ekaley/ipv666/internal/logging"
+	"sort"
+)
+
+// Merge several cluster models into one. Clusters that fall within a larger cluster of any of the models
+// are dropped (using a range tree, as when building a model) and what they captured is credited to the
+// cluster that covers them. The stardust nybble counts of all of the models are added together.
+func MergeModels(models []*ClusterModel) (*ClusterModel, error) {
+	if len(models) == 0 {
+		return nil, fmt.Errorf("merging models requires at least one model")
+	}
+
+	var clusters clusterList
+	nybbleCounts := addrsToNybbleCounts(nil)
+	for i, model := range models {
+		if model.ClusterSet == nil || len(model.ClusterSet.Clusters) == 0 {
+			return nil, fmt.Errorf("model %d has no clusters", i)
+		}
+		for _, cluster := range model.ClusterSet.Clusters {
+			clusters = append(clusters, &GenCluster{
+				Range:    cluster.Range.Copy(),
+				Captured: cluster.Captured,
+				Density:  cluster.Density,
+				Size:     cluster.Size,
+			})
+		}
+		for position, counts := range model.NybbleCounts {
+			if position >= len(nybbleCounts) {
+				return nil, fmt.Errorf("model %d has nybble counts for %d positions", i, len(model.NybbleCounts))
+			}
+			for nybble, count := range counts {
+				nybbleCounts[position][nybble] += count
+			}
+		}
+	}
+
+	// Largest clusters first so that the ones they cover are found in the range tree
+
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return clusters[i].Size > clusters[j].Size
+	})
+
+	rangeTree := NewRangeTree()
+	kept := make(map[string]*GenCluster)
+	var merged clusterList
+	for _, cluster := range clusters {
+		if rangeTree.AddRange(cluster.Range) {
+			kept[cluster.Range.GetPattern()] = cluster
+			merged = append(merged, cluster)
+			continue
+		}
+		covering, ok := kept[cluster.Range.GetPattern()]
+		if !ok {
+			covering = merged.findCovering(cluster.Range)
+		}
+		if covering == nil {
+			return nil, fmt.Errorf("no cluster covers the range '%s' even though the range tree does", cluster.Range.GetPattern())
+		}
+		covering.Captured += cluster.Captured
+		if covering.Captured > covering.Size {
+			covering.Captured = covering.Size
+		}
+		covering.Density = float64(covering.Captured) / float64(covering.Size)
+	}
+
+	logging.Infof("Merged %d clusters from %d models into %d clusters.", len(clusters), len(models), len(merged))
+
+	return &ClusterModel{
+		ClusterSet:   newClusterSetFromClusters(merged),
+		NybbleCounts: nybbleCounts,
+		Version:      models[0].Version,
+	}, nil
+}
+
+// Find the first cluster whose range contains every address in the given one
+func (list clusterList) findCovering(toCover *GenRange) *GenCluster {
+	for _, cluster := range list {
+		if cluster.Range.covers(toCover) {
+			return cluster
+		}
+	}
+	return nil
+}
+
+// Whether every address in the other range is in this one. Unlike Contains, a wildcard in the other
+// range only fits a wildcard in this one.
+func (genRange *GenRange) covers(otherRange *GenRange) bool {
+	for i := range genRange.AddrNybbles {
+		if _, ok := genRange.WildIndices[i]; ok {
+			continue
+		} else if _, ok := otherRange.WildIndices[i]; ok {
+			return false
+		} else if genRange.AddrNybbles[i] != otherRange.AddrNybbles[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package modeling
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func getMergeTestModel(t *testing.T, patterns []string, captured []int, nybble uint8) *ClusterModel {
+	var clusters []*GenCluster
+	for i, pattern := range patterns {
+		genRange, err := ParseGenRangePattern(pattern)
+		assert.Nil(t, err)
+		size := int(genRange.Size())
+		clusters = append(clusters, &GenCluster{
+			Range:    genRange,
+			Captured: captured[i],
+			Density:  float64(captured[i]) / float64(size),
+			Size:     size,
+		})
+	}
+	nybbleCounts := addrsToNybbleCounts(nil)
+	for _, counts := range nybbleCounts {
+		counts[nybble] = 1
+	}
+	return &ClusterModel{
+		ClusterSet:   newClusterSetFromClusters(clusters),
+		NybbleCounts: nybbleCounts,
+	}
+}
+
+func TestMergeModels(t *testing.T) {
+	first := getMergeTestModel(t, []string{
+		"2600:1234:0000:0000:0000:0000:0000:00??",
+		"2600:5678:0000:0000:0000:0000:0000:000?",
+	}, []int{10, 4}, 1)
+	second := getMergeTestModel(t, []string{
+		"2600:1234:0000:0000:0000:0000:0000:001?", // Within a larger cluster of the first model
+		"2600:5678:0000:0000:0000:0000:0000:000?", // The same as a cluster of the first model
+		"2a02:abcd:0000:0000:0000:0000:0000:000?",
+	}, []int{6, 14, 2}, 2)
+	merged, err := MergeModels([]*ClusterModel{first, second})
+	assert.Nil(t, err)
+
+	var patterns []string
+	var captured []int
+	for _, cluster := range merged.ClusterSet.Clusters {
+		patterns = append(patterns, cluster.Range.GetPattern())
+		captured = append(captured, cluster.Captured)
+	}
+	assert.Equal(t, []string{
+		"2600:1234:0000:0000:0000:0000:0000:00??",
+		"2600:5678:0000:0000:0000:0000:0000:000?",
+		"2a02:abcd:0000:0000:0000:0000:0000:000?",
+	}, patterns)
+	assert.Equal(t, []int{16, 16, 2}, captured) // Credited to the covering clusters, up to their size
+	assert.Equal(t, 1.0, merged.ClusterSet.Clusters[1].Density)
+	assert.Equal(t, 34, merged.ClusterSet.Captured)
+	assert.Equal(t, 288, merged.ClusterSet.RangeSize)
+	assert.Equal(t, map[uint8]int{1: 1, 2: 1}, merged.NybbleCounts[0])
+
+	// The models being merged are left as they were
+	assert.Equal(t, 10, first.ClusterSet.Clusters[0].Captured)
+
+	_, err = MergeModels(nil)
+	assert.NotNil(t, err)
+}
+
+func TestGenRange_Covers(t *testing.T) {
+	wide, _ := ParseGenRangePattern("2600:1234:0000:0000:0000:0000:0000:00??")
+	narrow, _ := ParseGenRangePattern("2600:1234:0000:0000:0000:0000:0000:001?")
+	other, _ := ParseGenRangePattern("2600:1234:0000:0000:0000:0000:000?:0010")
+	assert.True(t, wide.covers(narrow))
+	assert.False(t, narrow.covers(wide))
+	assert.False(t, wide.covers(other))
+}
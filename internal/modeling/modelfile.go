@@ -0,0 +1,185 @@
+package modeling
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/persist"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"time"
+)
+
+// Model files start with a header that identifies them and describes how the model was trained, followed
+// by the msgpack-encoded model and a checksum over everything before it:
+//
+//	magic (8 bytes) | format version (uint16) | metadata length (uint32) | metadata (JSON)
+//	| model length (uint64) | model (msgpack) | SHA-256 of all of the above (32 bytes)
+//
+// Files without the magic number are from before the header was added, and are still read.
+const ModelFileFormatVersion = 1
+
+var modelFileMagic = []byte("IPV666MF")
+
+const modelFileChecksumLength = sha256.Size
+
+// What a model file says about the model in it
+type ModelMetadata struct {
+	GeneratorType string            `json:"generator_type"`
+	CreatedAt     time.Time         `json:"created_at"`
+	InputSize     int               `json:"input_size"`              // The number of addresses the model was trained on
+	TrainingHash  string            `json:"training_hash,omitempty"` // SHA-256 of the unique training addresses in order
+	Parameters    map[string]string `json:"parameters,omitempty"`
+	UpdateBatches []string          `json:"update_batches,omitempty"` // The files of discovered addresses folded into the model since it was trained
+}
+
+// Describe a model that is about to be trained on the given addresses with the current configuration
+func NewModelMetadata(generatorType string, trainingAddrs []addressing.IPv6) *ModelMetadata {
+	return &ModelMetadata{
+		GeneratorType: generatorType,
+		CreatedAt:     time.Now().UTC(),
+		InputSize:     len(trainingAddrs),
+		TrainingHash:  getTrainingHash(trainingAddrs),
+		Parameters:    getTrainingParameters(generatorType),
+	}
+}
+
+func getTrainingHash(trainingAddrs []addressing.IPv6) string {
+	hash := sha256.New()
+	addrBytes := make([]byte, 16)
+	for _, addr := range getSortedUniqueSeeds(trainingAddrs) {
+		binary.BigEndian.PutUint64(addrBytes[:8], addr.High)
+		binary.BigEndian.PutUint64(addrBytes[8:], addr.Low)
+		hash.Write(addrBytes)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func getTrainingParameters(generatorType string) map[string]string {
+	var keys []string
+	switch generatorType {
+	case ClusterGeneratorType:
+		keys = []string{"ModelCheckCount", "ModelMinNybblePercent", "ModelDistributionSize"}
+	case SpaceTreeGeneratorType:
+		keys = []string{"SpaceTreeLeafSize"}
+	case EntropyIPGeneratorType:
+		keys = []string{"EntropyIPSegmentThreshold", "EntropyIPMinValueShare"}
+	}
+	toReturn := make(map[string]string)
+	for _, key := range keys {
+		toReturn[key] = viper.GetString(key)
+	}
+	return toReturn
+}
+
+// Encode the model along with its metadata. A model without metadata is described only by its type and
+// the time it was written.
+func EncodeModelFile(model *ClusterModel) ([]byte, error) {
+	metadata := model.Metadata
+	if metadata == nil {
+		metadata = &ModelMetadata{
+			GeneratorType: ClusterGeneratorType,
+			CreatedAt:     time.Now().UTC(),
+		}
+	}
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	modelBytes, err := persist.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	buffer.Write(modelFileMagic)
+	binary.Write(&buffer, binary.BigEndian, uint16(ModelFileFormatVersion))
+	binary.Write(&buffer, binary.BigEndian, uint32(len(metadataBytes)))
+	buffer.Write(metadataBytes)
+	binary.Write(&buffer, binary.BigEndian, uint64(len(modelBytes)))
+	buffer.Write(modelBytes)
+	checksum := sha256.Sum256(buffer.Bytes())
+	buffer.Write(checksum[:])
+	return buffer.Bytes(), nil
+}
+
+// Decode a model file, checking that it is whole and holds a cluster model. Files from before the header
+// was added are decoded as they always were, and have no metadata.
+func DecodeModelFile(fromBytes []byte) (*ClusterModel, error) {
+	if IsLegacyModelFile(fromBytes) {
+		var toReturn ClusterModel
+		if err := persist.Unmarshal(fromBytes, &toReturn); err != nil {
+			return nil, fmt.Errorf("the model file does not start with a model file header, and could not be read as an older model file: %s", err)
+		} else if err := toReturn.validate(); err != nil {
+			return nil, err
+		}
+		return &toReturn, nil
+	}
+	minLength := len(modelFileMagic) + 2 + 4 + 8 + modelFileChecksumLength
+	if len(fromBytes) < minLength {
+		return nil, fmt.Errorf("the model file is truncated (it is %d bytes long, and even an empty model file is %d bytes)", len(fromBytes), minLength)
+	}
+	body := fromBytes[:len(fromBytes)-modelFileChecksumLength]
+	checksum := sha256.Sum256(body)
+	if !bytes.Equal(checksum[:], fromBytes[len(body):]) {
+		return nil, fmt.Errorf("the model file checksum does not match its contents (the file is truncated or corrupt)")
+	}
+	reader := bytes.NewReader(body[len(modelFileMagic):])
+	var formatVersion uint16
+	var metadataLength uint32
+	binary.Read(reader, binary.BigEndian, &formatVersion)
+	if formatVersion > ModelFileFormatVersion {
+		return nil, fmt.Errorf("the model file is in format version %d, but this version of IPv666 only reads up to format version %d", formatVersion, ModelFileFormatVersion)
+	}
+	binary.Read(reader, binary.BigEndian, &metadataLength)
+	if int64(metadataLength) > int64(reader.Len()) {
+		return nil, fmt.Errorf("the model file metadata runs past the end of the file")
+	}
+	metadataBytes := make([]byte, metadataLength)
+	reader.Read(metadataBytes)
+	var metadata ModelMetadata
+	if err := json.Unmarshal(metadataBytes, &metadata); err != nil {
+		return nil, fmt.Errorf("the model file metadata could not be read: %s", err)
+	}
+	if metadata.GeneratorType != ClusterGeneratorType {
+		return nil, fmt.Errorf("the model file holds a '%s' model rather than a cluster model", metadata.GeneratorType)
+	}
+	var modelLength uint64
+	if err := binary.Read(reader, binary.BigEndian, &modelLength); err != nil || modelLength != uint64(reader.Len()) {
+		return nil, fmt.Errorf("the model file says the model is %d bytes long, but %d bytes follow the metadata", modelLength, reader.Len())
+	}
+	modelBytes, _ := ioutil.ReadAll(reader)
+	var toReturn ClusterModel
+	if err := persist.Unmarshal(modelBytes, &toReturn); err != nil {
+		return nil, fmt.Errorf("the model in the model file could not be read: %s", err)
+	}
+	if err := toReturn.validate(); err != nil {
+		return nil, err
+	}
+	toReturn.Metadata = &metadata
+	return &toReturn, nil
+}
+
+// Whether the bytes are from a model file written before the header was added
+func IsLegacyModelFile(fromBytes []byte) bool {
+	return !bytes.HasPrefix(fromBytes, modelFileMagic)
+}
+
+// Check that the model has everything that generating addresses from it needs, so that a model file that
+// decoded without error but is missing parts fails when it is loaded rather than when it is used
+func (clusterModel *ClusterModel) validate() error {
+	if clusterModel.ClusterSet == nil || len(clusterModel.ClusterSet.Clusters) == 0 {
+		return fmt.Errorf("the model has no clusters")
+	} else if len(clusterModel.NybbleCounts) != 32 {
+		return fmt.Errorf("the model has nybble counts for %d positions rather than 32", len(clusterModel.NybbleCounts))
+	}
+	for i, cluster := range clusterModel.ClusterSet.Clusters {
+		if cluster == nil || cluster.Range == nil || len(cluster.Range.AddrNybbles) != 32 {
+			return fmt.Errorf("cluster %d of the model does not have a range of 32 nybbles", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package modeling
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/persist"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func getModelFileTestModel(t *testing.T) *ClusterModel {
+	model := getMergeTestModel(t, []string{
+		"2600:1234:0000:0000:0000:0000:0000:00??",
+		"2a02:abcd:0000:0000:0000:0000:0000:000?",
+	}, []int{10, 2}, 1)
+	model.Metadata = &ModelMetadata{
+		GeneratorType: ClusterGeneratorType,
+		CreatedAt:     time.Date(2019, 4, 1, 12, 0, 0, 0, time.UTC),
+		InputSize:     12,
+		TrainingHash:  "abc",
+		Parameters:    map[string]string{"ModelCheckCount": "10000"},
+	}
+	return model
+}
+
+// Replace the checksum at the end of a model file with one that matches its (changed) contents
+func resealModelFile(fileBytes []byte) []byte {
+	body := fileBytes[:len(fileBytes)-modelFileChecksumLength]
+	checksum := sha256.Sum256(body)
+	return append(append([]byte{}, body...), checksum[:]...)
+}
+
+func TestModelFile_RoundTrip(t *testing.T) {
+	model := getModelFileTestModel(t)
+	filePath := filepath.Join(t.TempDir(), "model")
+	assert.Nil(t, model.Save(filePath))
+	fileBytes, _ := ioutil.ReadFile(filePath)
+	assert.False(t, IsLegacyModelFile(fileBytes))
+	loaded, err := LoadModelFromFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, model, loaded)
+}
+
+func TestModelFile_Legacy(t *testing.T) {
+	model := getModelFileTestModel(t)
+	legacyBytes, err := persist.Marshal(model)
+	assert.Nil(t, err)
+	assert.True(t, IsLegacyModelFile(legacyBytes))
+	loaded, err := DecodeModelFile(legacyBytes)
+	assert.Nil(t, err)
+	assert.Nil(t, loaded.Metadata)
+	assert.Equal(t, model.ClusterSet, loaded.ClusterSet)
+
+	// Migrating a legacy model gives it a header
+	encoded, err := EncodeModelFile(loaded)
+	assert.Nil(t, err)
+	migrated, err := DecodeModelFile(encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, ClusterGeneratorType, migrated.Metadata.GeneratorType)
+
+	// A legacy file that decodes to a half-empty model is refused
+	emptyBytes, _ := persist.Marshal(&ClusterModel{Version: 3})
+	_, err = DecodeModelFile(emptyBytes)
+	assert.NotNil(t, err)
+}
+
+func TestModelFile_Invalid(t *testing.T) {
+	model := getModelFileTestModel(t)
+	fileBytes, err := EncodeModelFile(model)
+	assert.Nil(t, err)
+
+	_, err = DecodeModelFile(fileBytes[:len(fileBytes)-100])
+	assert.Contains(t, err.Error(), "checksum")
+	_, err = DecodeModelFile(fileBytes[:20])
+	assert.Contains(t, err.Error(), "truncated")
+
+	corrupt := append([]byte{}, fileBytes...)
+	corrupt[len(corrupt)-50] ^= 0xff
+	_, err = DecodeModelFile(corrupt)
+	assert.Contains(t, err.Error(), "checksum")
+
+	newer := append([]byte{}, fileBytes...)
+	binary.BigEndian.PutUint16(newer[len(modelFileMagic):], ModelFileFormatVersion+1)
+	_, err = DecodeModelFile(resealModelFile(newer))
+	assert.Contains(t, err.Error(), "format version")
+
+	model.Metadata.GeneratorType = SpaceTreeGeneratorType
+	otherType, _ := EncodeModelFile(model)
+	_, err = DecodeModelFile(otherType)
+	assert.Contains(t, err.Error(), "spacetree")
+}
+
+func TestNewModelMetadata(t *testing.T) {
+	first, _ := addressing.ParseIPv6("2600:1234::1")
+	second, _ := addressing.ParseIPv6("2600:1234::2")
+	metadata := NewModelMetadata(ClusterGeneratorType, []addressing.IPv6{first, second, first})
+	assert.Equal(t, 3, metadata.InputSize)
+	assert.Equal(t, NewModelMetadata(ClusterGeneratorType, []addressing.IPv6{second, first}).TrainingHash, metadata.TrainingHash)
+	assert.NotEqual(t, NewModelMetadata(ClusterGeneratorType, []addressing.IPv6{first}).TrainingHash, metadata.TrainingHash)
+	assert.Contains(t, metadata.Parameters, "ModelCheckCount")
+}
@@ -0,0 +1,104 @@
+package modeling
+
+import (
+	"container/heap"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"math/rand"
+	"sort"
+)
+
+// Picks a training corpus of at most a fixed number of distinct addresses from a stream of addresses that
+// may be far too large to hold in memory and may repeat addresses. The sampler keeps the addresses with the
+// lowest salted hashes, which is a uniform sample of the distinct addresses in the stream, and since every
+// copy of an address hashes the same, a repeated address is never taken twice. A size of zero keeps every
+// distinct address.
+type AddressSampler struct {
+	size      int
+	salt      uint64
+	seenCount int
+	entries   samplerHeap
+	members   map[addressing.IPv6]bool
+}
+
+type samplerEntry struct {
+	addr  addressing.IPv6
+	hash  uint64
+	index int // Where the address first appeared in the stream
+}
+
+// A max-heap on hash, so that the entry to evict is always on top
+type samplerHeap []samplerEntry
+
+func (h samplerHeap) Len() int            { return len(h) }
+func (h samplerHeap) Less(i, j int) bool  { return h[i].hash > h[j].hash }
+func (h samplerHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *samplerHeap) Push(x interface{}) { *h = append(*h, x.(samplerEntry)) }
+func (h *samplerHeap) Pop() interface{} {
+	old := *h
+	toReturn := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return toReturn
+}
+
+func NewAddressSampler(random *rand.Rand, size int) *AddressSampler {
+	return &AddressSampler{
+		size:    size,
+		salt:    random.Uint64(),
+		members: make(map[addressing.IPv6]bool),
+	}
+}
+
+func (sampler *AddressSampler) Add(addr addressing.IPv6) {
+	index := sampler.seenCount
+	sampler.seenCount++
+	if sampler.members[addr] {
+		return
+	}
+	entry := samplerEntry{
+		addr:  addr,
+		hash:  sampler.hashAddress(addr),
+		index: index,
+	}
+	if sampler.size <= 0 || len(sampler.entries) < sampler.size {
+		heap.Push(&sampler.entries, entry)
+		sampler.members[addr] = true
+	} else if entry.hash < sampler.entries[0].hash {
+		delete(sampler.members, sampler.entries[0].addr)
+		sampler.entries[0] = entry
+		heap.Fix(&sampler.entries, 0)
+		sampler.members[addr] = true
+	}
+}
+
+// Get the number of addresses added to the sampler, including repeats
+func (sampler *AddressSampler) GetSeenCount() int {
+	return sampler.seenCount
+}
+
+// Get the sampled addresses in the order that they first appeared in the stream
+func (sampler *AddressSampler) GetAddresses() []addressing.IPv6 {
+	entries := make([]samplerEntry, len(sampler.entries))
+	copy(entries, sampler.entries)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].index < entries[j].index
+	})
+	toReturn := make([]addressing.IPv6, len(entries))
+	for i, entry := range entries {
+		toReturn[i] = entry.addr
+	}
+	return toReturn
+}
+
+func (sampler *AddressSampler) hashAddress(addr addressing.IPv6) uint64 {
+	return mixSamplerHash(mixSamplerHash(addr.High^sampler.salt) ^ addr.Low)
+}
+
+// The splitmix64 finalizer, which spreads every input bit across the whole hash
+func mixSamplerHash(value uint64) uint64 {
+	value ^= value >> 30
+	value *= 0xbf58476d1ce4e5b9
+	value ^= value >> 27
+	value *= 0x94d049bb133111eb
+	value ^= value >> 31
+	return value
+}
@@ -0,0 +1,71 @@
+package modeling
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func getSamplerTestAddrs(count int) []addressing.IPv6 {
+	var toReturn []addressing.IPv6
+	for i := 0; i < count; i++ {
+		toReturn = append(toReturn, addressing.IPv6{High: 0x2600 << 48, Low: uint64(i)})
+	}
+	return toReturn
+}
+
+func TestAddressSampler_Unlimited(t *testing.T) {
+	addrs := getSamplerTestAddrs(100)
+	sampler := NewAddressSampler(rand.New(rand.NewSource(1)), 0)
+	for _, addr := range addrs {
+		sampler.Add(addr)
+		sampler.Add(addrs[0])
+	}
+	assert.EqualValues(t, 200, sampler.GetSeenCount())
+	assert.EqualValues(t, addrs, sampler.GetAddresses())
+}
+
+func TestAddressSampler_Limited(t *testing.T) {
+	addrs := getSamplerTestAddrs(1000)
+	sampler := NewAddressSampler(rand.New(rand.NewSource(1)), 50)
+	for i := 0; i < 3; i++ {
+		for _, addr := range addrs {
+			sampler.Add(addr)
+		}
+	}
+	sampled := sampler.GetAddresses()
+	assert.Len(t, sampled, 50)
+	assert.Len(t, addressing.GetUniqueIPs(sampled, 1000), 50)
+	for i := 1; i < len(sampled); i++ {
+		assert.True(t, sampled[i-1].Low < sampled[i].Low)
+	}
+}
+
+func TestAddressSampler_Uniform(t *testing.T) {
+	addrs := getSamplerTestAddrs(10000)
+	sampler := NewAddressSampler(rand.New(rand.NewSource(1)), 1000)
+	for _, addr := range addrs {
+		sampler.Add(addr)
+	}
+	firstHalf := 0
+	for _, addr := range sampler.GetAddresses() {
+		if addr.Low < 5000 {
+			firstHalf++
+		}
+	}
+	assert.InDelta(t, 500, firstHalf, 75)
+}
+
+func TestAddressSampler_Seeded(t *testing.T) {
+	addrs := getSamplerTestAddrs(1000)
+	var samples [][]addressing.IPv6
+	for i := 0; i < 2; i++ {
+		sampler := NewAddressSampler(rand.New(rand.NewSource(42)), 10)
+		for _, addr := range addrs {
+			sampler.Add(addr)
+		}
+		samples = append(samples, sampler.GetAddresses())
+	}
+	assert.EqualValues(t, samples[0], samples[1])
+}
@@ -0,0 +1,204 @@
+package modeling
+
+import (
+	"fmt"
+	"github.com/ekaley/ipv666/internal"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/zrandom"
+	"github.com/spf13/viper"
+	"math/rand"
+	"net"
+	"sort"
+)
+
+// A generator in the style of 6Tree. Seed addresses are divided into a hierarchy of regions by
+// repeatedly splitting on the nybble position with the most variation, until each region holds no more
+// than a handful of seeds. The leaves of the tree are the regions that candidates are generated in, and
+// the denser a leaf is the more likely it is to be picked.
+type SpaceTree struct {
+	Root       *SpaceTreeNode
+	Leaves     []*SpaceTreeNode
+	cumDensity []float64
+}
+
+type SpaceTreeNode struct {
+	Range      *GenRange
+	Captured   int
+	Density    float64
+	SplitIndex int // The nybble position the children were split on, or -1 for a leaf
+	Children   []*SpaceTreeNode
+}
+
+// Build a space tree from the given seed addresses, splitting regions until they hold no more than
+// SpaceTreeLeafSize seeds
+func CreateSpaceTree(fromAddrs []addressing.IPv6) (*SpaceTree, error) {
+	return CreateSpaceTreeWithLeafSize(fromAddrs, viper.GetInt("SpaceTreeLeafSize"))
+}
+
+func CreateSpaceTreeWithLeafSize(fromAddrs []addressing.IPv6, leafSize int) (*SpaceTree, error) {
+	if leafSize < 1 {
+		return nil, fmt.Errorf("space tree leaf size must be at least 1 (got %d)", leafSize)
+	}
+
+	seeds := getSortedUniqueSeeds(fromAddrs)
+	if len(seeds) == 0 {
+		return nil, fmt.Errorf("a space tree requires at least one seed address")
+	}
+
+	logging.Infof("Building space tree from %d unique seed addresses with a leaf size of %d.", len(seeds), leafSize)
+	toReturn := &SpaceTree{}
+	toReturn.Root = toReturn.buildNode(seeds, leafSize)
+	sort.SliceStable(toReturn.Leaves, func(i, j int) bool {
+		return toReturn.Leaves[i].Density > toReturn.Leaves[j].Density
+	})
+	toReturn.cumDensity = getCumulativeDensities(toReturn.Leaves)
+	logging.Infof("Built space tree with %d leaf regions.", len(toReturn.Leaves))
+	return toReturn, nil
+}
+
+func (spaceTree *SpaceTree) buildNode(seeds []addressing.IPv6, leafSize int) *SpaceTreeNode {
+	node := &SpaceTreeNode{
+		Range:      GetGenRangeFromIPs(seeds),
+		Captured:   len(seeds),
+		SplitIndex: -1,
+	}
+	if len(seeds) <= leafSize {
+		// A leaf with a single seed has nothing varying in it, so open up its last nybble to give
+		// the seed's immediate neighbors a chance
+		if len(node.Range.WildIndices) == 0 {
+			node.Range.WildIndices[31] = internal.Empty{}
+		}
+		node.Density = float64(node.Captured) / node.Range.Size()
+		spaceTree.Leaves = append(spaceTree.Leaves, node)
+		return node
+	}
+	node.Density = float64(node.Captured) / node.Range.Size()
+	node.SplitIndex = getMostVariedIndex(seeds, node.Range.WildIndices)
+	var partitions [16][]addressing.IPv6
+	for _, seed := range seeds {
+		nybble := seed.Nybble(node.SplitIndex)
+		partitions[nybble] = append(partitions[nybble], seed)
+	}
+	for _, partition := range partitions {
+		if len(partition) > 0 {
+			node.Children = append(node.Children, spaceTree.buildNode(partition, leafSize))
+		}
+	}
+	return node
+}
+
+// Get the wild nybble position whose values are spread most evenly across the seeds (ie: has the highest
+// entropy), preferring the left-most position when there is a tie
+func getMostVariedIndex(seeds []addressing.IPv6, wildIndices map[int]internal.Empty) int {
+	bestIndex := -1
+	bestEntropy := -1.0
+	for i := 0; i < 32; i++ {
+		if _, ok := wildIndices[i]; !ok {
+			continue
+		}
+		var counts [16]int
+		for _, seed := range seeds {
+			counts[seed.Nybble(i)]++
+		}
+		entropy := zrandom.GetEntropyOfCounts(counts[:])
+		if entropy > bestEntropy {
+			bestEntropy = entropy
+			bestIndex = i
+		}
+	}
+	return bestIndex
+}
+
+func getCumulativeDensities(leaves []*SpaceTreeNode) []float64 {
+	toReturn := make([]float64, len(leaves))
+	total := 0.0
+	for i, leaf := range leaves {
+		total += leaf.Density
+		toReturn[i] = total
+	}
+	return toReturn
+}
+
+// Pick one of the leaves at random, weighted by density
+func pickLeaf(random *rand.Rand, leaves []*SpaceTreeNode, cumDensity []float64) *SpaceTreeNode {
+	target := random.Float64() * cumDensity[len(cumDensity)-1]
+	index := sort.SearchFloat64s(cumDensity, target)
+	if index >= len(leaves) {
+		index = len(leaves) - 1
+	}
+	return leaves[index]
+}
+
+// Get the leaves (and their cumulative densities) that could hold addresses in a network with the given
+// nybbles, falling back to all of the leaves if none of them could
+func (spaceTree *SpaceTree) getLeavesForNybbles(networkNybbles []uint8) ([]*SpaceTreeNode, []float64) {
+	var leaves []*SpaceTreeNode
+	for _, leaf := range spaceTree.Leaves {
+		if leaf.Range.matchesNybbles(networkNybbles) {
+			leaves = append(leaves, leaf)
+		}
+	}
+	if len(leaves) == 0 {
+		logging.Debugf("No space tree regions overlap the network's %d leading nybbles. Generating from all %d regions.", len(networkNybbles), len(spaceTree.Leaves))
+		return spaceTree.Leaves, spaceTree.cumDensity
+	}
+	return leaves, getCumulativeDensities(leaves)
+}
+
+func (spaceTree *SpaceTree) GenerateAddresses(random *rand.Rand, generateCount int, jitter float64) []addressing.IPv6 {
+	return generateUniqueAddresses(generateCount, "space tree", func() addressing.IPv6 {
+		return pickLeaf(random, spaceTree.Leaves, spaceTree.cumDensity).generateAddrFromNybbles(random, jitter, nil)
+	})
+}
+
+func (spaceTree *SpaceTree) GenerateAddressesFromNetwork(random *rand.Rand, generateCount int, jitter float64, network *net.IPNet) ([]addressing.IPv6, error) {
+	networkNybbles, err := getGenerationNetworkNybbles(network)
+	if err != nil {
+		return nil, err
+	}
+	leaves, cumDensity := spaceTree.getLeavesForNybbles(networkNybbles)
+	return generateUniqueAddresses(generateCount, "space tree", func() addressing.IPv6 {
+		return pickLeaf(random, leaves, cumDensity).generateAddrFromNybbles(random, jitter, networkNybbles)
+	}), nil
+}
+
+// Generate addresses within the network, handing each to the callback, until it has accepted generateCount
+// of them. Only the leaves whose regions could overlap the network are drawn from, each weighted by its
+// density, so candidates go to the dense parts of the tree that the network actually covers.
+func (spaceTree *SpaceTree) GenerateAddressesFromNetworkWithCallback(random *rand.Rand, generateCount int, jitter float64, network *net.IPNet, fn addrProcessFunc) error {
+	networkNybbles, err := getGenerationNetworkNybbles(network)
+	if err != nil {
+		return err
+	}
+	leaves, cumDensity := spaceTree.getLeavesForNybbles(networkNybbles)
+	return generateAcceptedAddresses(generateCount, func() addressing.IPv6 {
+		return pickLeaf(random, leaves, cumDensity).generateAddrFromNybbles(random, jitter, networkNybbles)
+	}, fn)
+}
+
+// Generate an address in the leaf's region, keeping the given leading nybbles. Wild nybbles are always
+// random, and the leaf's other nybbles are random with a likelihood of jitter.
+func (node *SpaceTreeNode) generateAddrFromNybbles(random *rand.Rand, jitter float64, fromNybbles []uint8) addressing.IPv6 {
+	nybbles := append([]uint8{}, fromNybbles...)
+	for i := len(fromNybbles); i < 32; i++ {
+		if _, ok := node.Range.WildIndices[i]; ok {
+			nybbles = append(nybbles, uint8(random.Int31n(16)))
+		} else if float64(random.Int31n(10000))/100.0 <= jitter*100 {
+			nybbles = append(nybbles, uint8(random.Int31n(16)))
+		} else {
+			nybbles = append(nybbles, node.Range.AddrNybbles[i])
+		}
+	}
+	return addressing.NybblesToIP(nybbles)
+}
+
+// Whether the range could hold addresses that start with the given nybbles
+func (genRange *GenRange) matchesNybbles(nybbles []uint8) bool {
+	for i, nybble := range nybbles {
+		if _, ok := genRange.WildIndices[i]; !ok && genRange.AddrNybbles[i] != nybble {
+			return false
+		}
+	}
+	return true
+}
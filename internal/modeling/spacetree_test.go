@@ -0,0 +1,80 @@
+package modeling
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func TestCreateSpaceTreeWithLeafSize_LeavesCoverSeeds(t *testing.T) {
+	addrs := getModelingTestIPs()
+	tree, err := CreateSpaceTreeWithLeafSize(addrs, 8)
+	assert.Nil(t, err)
+	assert.Equal(t, len(addrs), tree.Root.Captured)
+	captured := 0
+	for i, leaf := range tree.Leaves {
+		assert.True(t, leaf.Captured <= 8)
+		assert.Equal(t, -1, leaf.SplitIndex)
+		if i > 0 {
+			assert.True(t, tree.Leaves[i-1].Density >= leaf.Density)
+		}
+		captured += leaf.Captured
+	}
+	assert.Equal(t, len(addrs), captured)
+	for _, addr := range addrs {
+		covered := false
+		for _, leaf := range tree.Leaves {
+			covered = covered || leaf.Range.Contains(newGenRange(addr))
+		}
+		assert.True(t, covered, addr.String())
+	}
+}
+
+func TestCreateSpaceTreeWithLeafSize_SplitsOnMostVariedNybble(t *testing.T) {
+	var addrs []addressing.IPv6
+	for i := 0; i < 16; i++ {
+		addrs = append(addrs, addressing.IPv6{High: 0x2600123400000000, Low: uint64(i)<<4 | uint64(i%2)})
+	}
+	tree, err := CreateSpaceTreeWithLeafSize(addrs, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, 30, tree.Root.SplitIndex)
+	assert.Len(t, tree.Root.Children, 16)
+}
+
+func TestCreateSpaceTreeWithLeafSize_NoSeeds(t *testing.T) {
+	_, err := CreateSpaceTreeWithLeafSize(nil, 8)
+	assert.NotNil(t, err)
+}
+
+func TestSpaceTree_GenerateAddressesFromNetwork(t *testing.T) {
+	tree, err := CreateSpaceTreeWithLeafSize(getModelingTestIPs(), 8)
+	assert.Nil(t, err)
+	_, network, _ := net.ParseCIDR("2600:1234:0:1::/64")
+	addrs, err := tree.GenerateAddressesFromNetwork(rand.New(rand.NewSource(666)), 100, 0.0, network)
+	assert.Nil(t, err)
+	assert.Len(t, addrs, 100)
+	for _, addr := range addrs {
+		assert.True(t, addr.In(network), addr.String())
+	}
+	_, badNetwork, _ := net.ParseCIDR("2600:1234::/33")
+	_, err = tree.GenerateAddressesFromNetwork(rand.New(rand.NewSource(666)), 100, 0.0, badNetwork)
+	assert.NotNil(t, err)
+}
+
+func TestSpaceTree_GenerateAddressesFromNetworkWithCallback(t *testing.T) {
+	tree, err := CreateSpaceTreeWithLeafSize(getModelingTestIPs(), 8)
+	assert.Nil(t, err)
+	_, network, _ := net.ParseCIDR("2a02::/16")
+	seen := make(map[addressing.IPv6]bool)
+	err = tree.GenerateAddressesFromNetworkWithCallback(rand.New(rand.NewSource(666)), 50, 0.1, network, func(addr addressing.IPv6) (bool, error) {
+		if seen[addr] {
+			return true, nil
+		}
+		seen[addr] = true
+		return false, nil
+	})
+	assert.Nil(t, err)
+	assert.Len(t, seen, 50)
+}
@@ -0,0 +1,58 @@
+package modeling
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+)
+
+// Fold newly-discovered addresses into the model. Every cluster whose range covers one of the addresses
+// counts it as captured and has its density re-scored, and addresses that no cluster covers are added to
+// the nybble counts that jitter is drawn from. Addresses are expected to be new to the model (ie: the
+// same batch should not be folded in twice), though duplicates within the batch are ignored. Bumps the
+// model's version and returns the number of addresses that were captured by clusters and the number that
+// were added to the nybble counts.
+func (clusterModel *ClusterModel) Update(addrs []addressing.IPv6) (int, int) {
+	masks := make([]*GenRangeMask, len(clusterModel.ClusterSet.Clusters))
+	for i, cluster := range clusterModel.ClusterSet.Clusters {
+		masks[i] = cluster.Range.GetMask()
+	}
+	if len(clusterModel.NybbleCounts) == 0 {
+		clusterModel.NybbleCounts = addrsToNybbleCounts(nil)
+	}
+	var dustAddrs []addressing.IPv6
+	seen := make(map[addressing.IPv6]bool)
+	captured := 0
+	for _, addr := range addrs {
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		isCaptured := false
+		for i, mask := range masks {
+			if addr.High&mask.FirstMask != mask.FirstExpected || addr.Low&mask.SecondMask != mask.SecondExpected {
+				continue
+			}
+			cluster := clusterModel.ClusterSet.Clusters[i]
+			cluster.Captured++
+			cluster.Density = float64(cluster.Captured) / float64(cluster.Size)
+			isCaptured = true
+		}
+		if isCaptured {
+			captured++
+		} else {
+			dustAddrs = append(dustAddrs, addr)
+		}
+	}
+	for i, counts := range addrsToNybbleCounts(dustAddrs) {
+		for nybble, count := range counts {
+			clusterModel.NybbleCounts[i][nybble] += count
+		}
+	}
+	clusterSet := clusterModel.ClusterSet
+	clusterSet.Captured += captured
+	if clusterSet.RangeSize > 0 {
+		clusterSet.Density = float64(clusterSet.Captured) / float64(clusterSet.RangeSize)
+	}
+	clusterModel.normalizedCounts = nil
+	clusterModel.Version++
+	return captured, len(dustAddrs)
+}
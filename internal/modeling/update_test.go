@@ -0,0 +1,60 @@
+package modeling
+
+import (
+	"github.com/ekaley/ipv666/internal"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func getUpdateTestModel() *ClusterModel {
+	clusterRange := newGenRange(addressing.IPv6{High: 0x2600123400000000, Low: 0x10})
+	clusterRange.WildIndices[31] = internal.Empty{}
+	cluster := &GenCluster{
+		Range:    clusterRange,
+		Captured: 4,
+		Density:  0.25,
+		Size:     16,
+	}
+	return &ClusterModel{
+		ClusterSet:   newClusterSetFromClusters([]*GenCluster{cluster}),
+		NybbleCounts: addrsToNybbleCounts(nil),
+	}
+}
+
+func TestClusterModel_UpdateRescoresCoveringClusters(t *testing.T) {
+	model := getUpdateTestModel()
+	addrs := []addressing.IPv6{
+		{High: 0x2600123400000000, Low: 0x11},
+		{High: 0x2600123400000000, Low: 0x1f},
+		{High: 0x2600123400000000, Low: 0x11},
+	}
+	captured, dust := model.Update(addrs)
+	assert.Equal(t, 2, captured)
+	assert.Equal(t, 0, dust)
+	assert.Equal(t, 6, model.ClusterSet.Clusters[0].Captured)
+	assert.Equal(t, 6.0/16.0, model.ClusterSet.Clusters[0].Density)
+	assert.Equal(t, 6, model.ClusterSet.Captured)
+	assert.Equal(t, 6.0/16.0, model.ClusterSet.Density)
+	assert.Equal(t, 1, model.Version)
+}
+
+func TestClusterModel_UpdateAddsUncoveredToNybbleCounts(t *testing.T) {
+	model := getUpdateTestModel()
+	captured, dust := model.Update([]addressing.IPv6{{High: 0x2a02abcd00000000, Low: 0x20}})
+	assert.Equal(t, 0, captured)
+	assert.Equal(t, 1, dust)
+	assert.Equal(t, 4, model.ClusterSet.Clusters[0].Captured)
+	assert.Equal(t, 1, model.NybbleCounts[1][0xa])
+	assert.Equal(t, 1, model.NybbleCounts[30][0x2])
+	assert.Equal(t, 1, model.Version)
+}
+
+func TestClusterModel_UpdateRegeneratesNormalizedCounts(t *testing.T) {
+	model := getUpdateTestModel()
+	model.GenerateAddress(rand.New(rand.NewSource(666)), 0.0)
+	assert.NotEmpty(t, model.normalizedCounts)
+	model.Update([]addressing.IPv6{{High: 0x2a02abcd00000000, Low: 0x20}})
+	assert.Empty(t, model.normalizedCounts)
+}
@@ -0,0 +1,70 @@
+package modeling
+
+import (
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/spf13/viper"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// The result of GenCluster.getBestUpgradeOptions
+type upgradeOptions struct {
+	density float64
+	count   int
+	indices []int
+}
+
+// Get the number of workers to build cluster models with (ModelGenerationWorkers, or the number of CPUs
+// if it is not set)
+func GetModelWorkerCount() int {
+	workers := viper.GetInt("ModelGenerationWorkers")
+	if workers < 1 {
+		return runtime.NumCPU()
+	}
+	return workers
+}
+
+// Get the best upgrade options for each of the clusters, spreading the work across the given number of
+// workers. The corpus is only read from, and the results are returned in the same order as the clusters
+// so that callers process them exactly as they would have serially.
+func getAllBestUpgradeOptions(clusters clusterList, corpus AddressContainer, workers int, description string) []upgradeOptions {
+	toReturn := make([]upgradeOptions, len(clusters))
+	if workers < 1 {
+		workers = 1
+	}
+	var processed int64
+	emitFreq := int64(viper.GetInt("LogLoopEmitFreq"))
+	process := func(i int) {
+		density, count, indices := clusters[i].getBestUpgradeOptions(corpus)
+		toReturn[i] = upgradeOptions{density: density, count: count, indices: indices}
+		if done := atomic.AddInt64(&processed, 1); done%emitFreq == 0 {
+			logging.Infof("Processed cluster %d out of %d for %s.", done, len(clusters), description)
+		}
+	}
+
+	if workers == 1 {
+		for i := range clusters {
+			process(i)
+		}
+		return toReturn
+	}
+
+	indices := make(chan int, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				process(i)
+			}
+		}()
+	}
+	for i := range clusters {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return toReturn
+}
@@ -0,0 +1,48 @@
+package modeling
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+// Addresses clustered under a handful of prefixes, with a few random hosts thrown in as stardust
+func getModelingTestIPs() []addressing.IPv6 {
+	random := rand.New(rand.NewSource(666))
+	prefixes := []uint64{0x2600123400000000, 0x2600123400010000, 0x2a02abcd00000000}
+	var toReturn []addressing.IPv6
+	for _, prefix := range prefixes {
+		for i := 0; i < 60; i++ {
+			toReturn = append(toReturn, addressing.IPv6{High: prefix, Low: uint64(random.Intn(256))})
+		}
+	}
+	for i := 0; i < 20; i++ {
+		toReturn = append(toReturn, addressing.IPv6{High: random.Uint64(), Low: random.Uint64()})
+	}
+	return addressing.GetUniqueIPs(toReturn, 1000)
+}
+
+func TestGetAllBestUpgradeOptions_MatchesSerial(t *testing.T) {
+	addrs := getModelingTestIPs()
+	clusters := clusterList(newGenClusters(addrs))
+	corpus := CreateFromAddresses(addrs, 1000)
+	options := getAllBestUpgradeOptions(clusters, corpus, 4, "testing")
+	assert.Len(t, options, len(clusters))
+	for i, cluster := range clusters {
+		density, count, indices := cluster.getBestUpgradeOptions(corpus)
+		assert.Equal(t, upgradeOptions{density: density, count: count, indices: indices}, options[i])
+	}
+}
+
+func TestCreateClusteringModelWithWorkers_MatchesSerial(t *testing.T) {
+	viper.Set("ModelCheckCount", 50)
+	defer viper.Set("ModelCheckCount", 10000)
+	addrs := getModelingTestIPs()
+	serial := CreateClusteringModelWithWorkers(addrs, 1)
+	assert.NotEmpty(t, serial.ClusterSet.Clusters)
+	for _, workers := range []int{2, 8} {
+		assert.Equal(t, serial, CreateClusteringModelWithWorkers(addrs, workers))
+	}
+}
@@ -0,0 +1,130 @@
+package oui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A table of the vendors that IEEE has assigned OUIs (the first three bytes of a MAC address) to
+type Database struct {
+	vendors map[uint32]string
+}
+
+func NewDatabase() *Database {
+	return &Database{vendors: make(map[uint32]string)}
+}
+
+// Parse an OUI database in the format that IEEE publishes it in. Both the text listing (oui.txt, where
+// each assignment has a line like "00-1B-21   (hex)		Intel Corporate") and the CSV listing (oui.csv,
+// with lines like "MA-L,001B21,Intel Corporate,...") are understood. Anything else is skipped.
+func ParseDatabase(reader io.Reader) (*Database, error) {
+	toReturn := NewDatabase()
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "(hex)"); i > 0 {
+			oui, err := ParseOUI(strings.TrimSpace(line[:i]))
+			if err != nil {
+				continue
+			}
+			toReturn.vendors[oui] = strings.TrimSpace(line[i+len("(hex)"):])
+		} else if strings.HasPrefix(line, "MA-L,") {
+			fields := strings.SplitN(line, ",", 4)
+			if len(fields) < 3 {
+				continue
+			}
+			oui, err := ParseOUI(fields[1])
+			if err != nil {
+				continue
+			}
+			toReturn.vendors[oui] = strings.Trim(strings.TrimSpace(fields[2]), `"`)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return toReturn, nil
+}
+
+func LoadDatabase(filePath string) (*Database, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	toReturn, err := ParseDatabase(file)
+	if err != nil {
+		return nil, err
+	} else if toReturn.Size() == 0 {
+		return nil, fmt.Errorf("no OUI assignments found in '%s' (expected an IEEE oui.txt or oui.csv file)", filePath)
+	}
+	return toReturn, nil
+}
+
+func (db *Database) Size() int {
+	return len(db.vendors)
+}
+
+// Get the vendor the OUI is assigned to, or an empty string if it is not in the database
+func (db *Database) GetVendor(oui uint32) string {
+	if db == nil {
+		return ""
+	}
+	return db.vendors[oui]
+}
+
+// Get the OUIs assigned to vendors whose names contain the given string (ignoring case), in order
+func (db *Database) FindOUIs(vendor string) []uint32 {
+	vendor = strings.ToLower(vendor)
+	var toReturn []uint32
+	for oui, name := range db.vendors {
+		if strings.Contains(strings.ToLower(name), vendor) {
+			toReturn = append(toReturn, oui)
+		}
+	}
+	sort.Slice(toReturn, func(i, j int) bool { return toReturn[i] < toReturn[j] })
+	return toReturn
+}
+
+// Parse an OUI written as three hex bytes, either separated by colons or dashes (00:1b:21 or 00-1B-21) or
+// run together (001B21)
+func ParseOUI(toParse string) (uint32, error) {
+	bytes := strings.FieldsFunc(toParse, func(r rune) bool { return r == ':' || r == '-' })
+	if len(bytes) == 1 && len(bytes[0]) == 6 {
+		bytes = []string{bytes[0][0:2], bytes[0][2:4], bytes[0][4:6]}
+	}
+	if len(bytes) != 3 {
+		return 0, fmt.Errorf("'%s' is not a valid OUI (expected three bytes, such as 00:1b:21)", toParse)
+	}
+	var toReturn uint32
+	for _, b := range bytes {
+		value, err := strconv.ParseUint(b, 16, 8)
+		if err != nil {
+			return 0, fmt.Errorf("'%s' is not a valid OUI: %s", toParse, err)
+		}
+		toReturn = toReturn<<8 | uint32(value)
+	}
+	return toReturn, nil
+}
+
+// Parse a comma-separated list of OUIs
+func ParseOUIs(toParse string) ([]uint32, error) {
+	var toReturn []uint32
+	for _, value := range strings.Split(toParse, ",") {
+		oui, err := ParseOUI(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		toReturn = append(toReturn, oui)
+	}
+	return toReturn, nil
+}
+
+func FormatOUI(oui uint32) string {
+	return fmt.Sprintf("%02x:%02x:%02x", (oui>>16)&0xff, (oui>>8)&0xff, oui&0xff)
+}
@@ -0,0 +1,39 @@
+package oui
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+)
+
+// Whether the address has an EUI-64 interface identifier (ff:fe in the middle), as SLAAC addresses built
+// from a MAC address do
+func IsEUI64(ip addressing.IPv6) bool {
+	return (ip.Low>>24)&0xffff == 0xfffe
+}
+
+// Get the OUI of the MAC address that an EUI-64 interface identifier was built from. The universal/local
+// bit is flipped back to how it is in the MAC address.
+func GetEUI64OUI(ip addressing.IPv6) uint32 {
+	return uint32(ip.Low>>40) ^ 0x020000
+}
+
+// Get the vendor-assigned half of the MAC address that an EUI-64 interface identifier was built from
+func GetEUI64NIC(ip addressing.IPv6) uint32 {
+	return uint32(ip.Low & 0xffffff)
+}
+
+// Get the nybbles of the EUI-64 interface identifier that SLAAC builds from the MAC address with the given
+// OUI and NIC
+func GetEUI64Nybbles(oui uint32, nic uint32) []uint8 {
+	iid := uint64(oui^0x020000)<<40 | uint64(0xfffe)<<24 | uint64(nic&0xffffff)
+	toReturn := make([]uint8, 16)
+	for i := range toReturn {
+		toReturn[i] = uint8(iid>>uint((15-i)*4)) & 0xf
+	}
+	return toReturn
+}
+
+// Get the address in the /64 network with the given nybbles that has the EUI-64 interface identifier for
+// the OUI and NIC
+func GetEUI64Address(networkNybbles []uint8, oui uint32, nic uint32) addressing.IPv6 {
+	return addressing.NybblesToIP(append(append([]uint8{}, networkNybbles[:16]...), GetEUI64Nybbles(oui, nic)...))
+}
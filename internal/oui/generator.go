@@ -0,0 +1,141 @@
+package oui
+
+import (
+	"fmt"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"math/rand"
+	"net"
+	"sort"
+)
+
+// Generates SLAAC addresses with EUI-64 interface identifiers for a set of vendor OUIs. Vendors tend to
+// hand out MAC addresses in runs, so NICs close to ones that have already been seen for an OUI are tried
+// first, and after that NICs are picked at random with the OUIs that were seen more often picked more
+// often.
+type EUI64Generator struct {
+	OUIs       []uint32
+	NICs       map[uint32][]uint32 // The NICs seen for each OUI
+	Spread     int                 // How far either side of a seen NIC to try
+	seeds      map[addressing.IPv6]struct{}
+	cumWeights []float64
+}
+
+// Create a generator for the given OUIs, learning which NICs are in use (and how common each OUI is) from
+// the EUI-64 addresses in the seed addresses
+func CreateEUI64Generator(ouis []uint32, seeds []addressing.IPv6, spread int) (*EUI64Generator, error) {
+	if len(ouis) == 0 {
+		return nil, fmt.Errorf("an EUI-64 generator requires at least one OUI")
+	} else if spread < 0 {
+		return nil, fmt.Errorf("the spread around seen NICs must not be negative (got %d)", spread)
+	}
+	toReturn := &EUI64Generator{
+		OUIs:   ouis,
+		NICs:   make(map[uint32][]uint32),
+		Spread: spread,
+		seeds:  make(map[addressing.IPv6]struct{}),
+	}
+	counts := make(map[uint32]int)
+	for _, oui := range ouis {
+		counts[oui] = 0
+	}
+	nics := make(map[uint32]map[uint32]struct{})
+	for _, seed := range seeds {
+		toReturn.seeds[seed] = struct{}{}
+		if !IsEUI64(seed) {
+			continue
+		}
+		oui := GetEUI64OUI(seed)
+		if _, ok := counts[oui]; !ok {
+			continue
+		}
+		counts[oui]++
+		if nics[oui] == nil {
+			nics[oui] = make(map[uint32]struct{})
+		}
+		nics[oui][GetEUI64NIC(seed)] = struct{}{}
+	}
+	for oui, ouiNICs := range nics {
+		for nic := range ouiNICs {
+			toReturn.NICs[oui] = append(toReturn.NICs[oui], nic)
+		}
+		sort.Slice(toReturn.NICs[oui], func(i, j int) bool { return toReturn.NICs[oui][i] < toReturn.NICs[oui][j] })
+	}
+
+	// Every OUI gets a chance, even the ones that were not seen at all
+	total := 0.0
+	for _, oui := range ouis {
+		total += float64(counts[oui] + 1)
+		toReturn.cumWeights = append(toReturn.cumWeights, total)
+	}
+	return toReturn, nil
+}
+
+func (generator *EUI64Generator) pickOUI(random *rand.Rand) uint32 {
+	target := random.Float64() * generator.cumWeights[len(generator.cumWeights)-1]
+	index := sort.SearchFloat64s(generator.cumWeights, target)
+	if index >= len(generator.OUIs) {
+		index = len(generator.OUIs) - 1
+	}
+	return generator.OUIs[index]
+}
+
+// Get the NICs within the spread of the ones seen for the OUI, nearest first
+func (generator *EUI64Generator) getNearbyNICs(oui uint32) []uint32 {
+	var toReturn []uint32
+	for offset := 0; offset <= generator.Spread; offset++ {
+		for _, nic := range generator.NICs[oui] {
+			if int64(nic)-int64(offset) >= 0 {
+				toReturn = append(toReturn, nic-uint32(offset))
+			}
+			if offset > 0 && nic+uint32(offset) <= 0xffffff {
+				toReturn = append(toReturn, nic+uint32(offset))
+			}
+		}
+	}
+	return toReturn
+}
+
+// Generate generateCount EUI-64 addresses in the network, which must be a /64 or larger with a length that
+// is divisible by 4. The bits between the network and the interface identifier are picked at random. None
+// of the seed addresses are generated.
+func (generator *EUI64Generator) GenerateAddressesInNetwork(random *rand.Rand, generateCount int, network *net.IPNet) ([]addressing.IPv6, error) {
+	ones, _ := network.Mask.Size()
+	if ones > 64 || ones%4 != 0 {
+		return nil, fmt.Errorf("generating EUI-64 addresses requires a network of /64 or larger with a length that is divisible by 4 (got length of %d)", ones)
+	} else if generateCount > len(generator.OUIs)<<24 {
+		return nil, fmt.Errorf("cannot generate %d unique EUI-64 addresses from %d OUIs", generateCount, len(generator.OUIs))
+	}
+	networkNybbles := addressing.GetNybblesFromNetwork(network)
+	newNetworkNybbles := func() []uint8 {
+		nybbles := append([]uint8{}, networkNybbles...)
+		for len(nybbles) < 16 {
+			nybbles = append(nybbles, uint8(random.Int31n(16)))
+		}
+		return nybbles
+	}
+
+	genAddrs := make(map[addressing.IPv6]struct{})
+	var toReturn []addressing.IPv6
+	add := func(addr addressing.IPv6) {
+		if _, ok := generator.seeds[addr]; ok {
+			return
+		} else if _, ok := genAddrs[addr]; ok {
+			return
+		}
+		genAddrs[addr] = struct{}{}
+		toReturn = append(toReturn, addr)
+	}
+
+	for _, oui := range generator.OUIs {
+		for _, nic := range generator.getNearbyNICs(oui) {
+			if len(toReturn) >= generateCount {
+				return toReturn, nil
+			}
+			add(GetEUI64Address(newNetworkNybbles(), oui, nic))
+		}
+	}
+	for len(toReturn) < generateCount {
+		add(GetEUI64Address(newNetworkNybbles(), generator.pickOUI(random), random.Uint32()&0xffffff))
+	}
+	return toReturn, nil
+}
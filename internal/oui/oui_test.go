@@ -0,0 +1,146 @@
+package oui
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+)
+
+const testOUITxt = `OUI/MA-L                                                    Organization
+company_id                                                  Organization
+                                                            Address
+
+00-1B-21   (hex)		Intel Corporate
+001B21     (base 16)		Intel Corporate
+				Lot 8, Jalan Hi-Tech 2/3
+				Kulim  Kedah  09000
+				MY
+
+3C-FD-FE   (hex)		Intel Corporate
+3CFDFE     (base 16)		Intel Corporate
+
+00-00-0C   (hex)		Cisco Systems, Inc
+00000C     (base 16)		Cisco Systems, Inc
+`
+
+const testOUICsv = `Registry,Assignment,Organization Name,Organization Address
+MA-L,001B21,Intel Corporate,Lot 8 Jalan Hi-Tech 2/3 Kulim Kedah MY 09000
+MA-L,00000C,"Cisco Systems, Inc",170 West Tasman Drive San Jose CA US 95134
+`
+
+func TestParseDatabase_Text(t *testing.T) {
+	db, err := ParseDatabase(strings.NewReader(testOUITxt))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, db.Size())
+	assert.Equal(t, "Intel Corporate", db.GetVendor(0x001b21))
+	assert.Equal(t, "Cisco Systems, Inc", db.GetVendor(0x00000c))
+	assert.Equal(t, "", db.GetVendor(0x123456))
+	assert.Equal(t, []uint32{0x001b21, 0x3cfdfe}, db.FindOUIs("intel"))
+}
+
+func TestParseDatabase_CSV(t *testing.T) {
+	db, err := ParseDatabase(strings.NewReader(testOUICsv))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, db.Size())
+	assert.Equal(t, "Intel Corporate", db.GetVendor(0x001b21))
+	assert.Equal(t, []uint32{0x00000c}, db.FindOUIs("CISCO"))
+}
+
+func TestParseOUI(t *testing.T) {
+	for _, toParse := range []string{"00:1b:21", "00-1B-21", "001B21"} {
+		oui, err := ParseOUI(toParse)
+		assert.Nil(t, err, toParse)
+		assert.Equal(t, uint32(0x001b21), oui)
+	}
+	for _, toParse := range []string{"00:1b", "001b2", "zz:1b:21", "100:1b:21"} {
+		_, err := ParseOUI(toParse)
+		assert.NotNil(t, err, toParse)
+	}
+	assert.Equal(t, "00:1b:21", FormatOUI(0x001b21))
+}
+
+func TestEUI64_RoundTrip(t *testing.T) {
+
+	// SLAAC address for MAC address 00:1b:21:12:34:56
+	addr, _ := addressing.ParseIPv6("2600:1234::21b:21ff:fe12:3456")
+	assert.True(t, IsEUI64(addr))
+	assert.Equal(t, uint32(0x001b21), GetEUI64OUI(addr))
+	assert.Equal(t, uint32(0x123456), GetEUI64NIC(addr))
+	_, network, _ := net.ParseCIDR("2600:1234::/64")
+	assert.Equal(t, addr, GetEUI64Address(addressing.GetNybblesFromNetwork(network), 0x001b21, 0x123456))
+
+	lowByte, _ := addressing.ParseIPv6("2600:1234::1")
+	assert.False(t, IsEUI64(lowByte))
+}
+
+func getOUITestIPs() []addressing.IPv6 {
+	var toReturn []addressing.IPv6
+	for _, s := range []string{
+		"2600:1234:0:1:21b:21ff:fe00:10",
+		"2600:1234:0:2:21b:21ff:fe00:20",
+		"2600:1234:0:2:21b:21ff:fe00:30",
+		"2600:1234:0:3:3efd:feff:fe00:1",
+		"2600:1234:0:3::1",
+	} {
+		addr, _ := addressing.ParseIPv6(s)
+		toReturn = append(toReturn, addr)
+	}
+	return toReturn
+}
+
+func TestRankOUIs(t *testing.T) {
+	db, _ := ParseDatabase(strings.NewReader(testOUITxt))
+	ranks := RankOUIs(getOUITestIPs(), db)
+	assert.Equal(t, []*RankedOUI{
+		{OUI: 0x001b21, Vendor: "Intel Corporate", Count: 3, Networks: 2},
+		{OUI: 0x3cfdfe, Vendor: "Intel Corporate", Count: 1, Networks: 1},
+	}, ranks)
+	assert.Equal(t, []uint32{0x001b21}, GetTopOUIs(ranks, 1))
+	assert.Equal(t, "", RankOUIs(getOUITestIPs(), nil)[0].Vendor)
+}
+
+func TestEUI64Generator_NearbyNICsFirst(t *testing.T) {
+	seeds := getOUITestIPs()
+	generator, err := CreateEUI64Generator([]uint32{0x001b21}, seeds, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{0x10, 0x20, 0x30}, generator.NICs[0x001b21])
+
+	_, network, _ := net.ParseCIDR("2600:1234:0:1::/64")
+	addrs, err := generator.GenerateAddressesInNetwork(rand.New(rand.NewSource(666)), 8, network)
+	assert.Nil(t, err)
+	assert.Len(t, addrs, 8)
+	var nics []uint32
+	for _, addr := range addrs {
+		assert.True(t, addr.In(network))
+		assert.True(t, IsEUI64(addr))
+		assert.Equal(t, uint32(0x001b21), GetEUI64OUI(addr))
+		nics = append(nics, GetEUI64NIC(addr))
+	}
+
+	// The seed in this /64 is left out, then the neighbors of every seen NIC follow
+	assert.Equal(t, []uint32{0x20, 0x30, 0xf, 0x11, 0x1f, 0x21, 0x2f, 0x31}, nics)
+}
+
+func TestEUI64Generator_RandomNICsInNetwork(t *testing.T) {
+	generator, err := CreateEUI64Generator([]uint32{0x001b21, 0x3cfdfe}, nil, 4)
+	assert.Nil(t, err)
+	_, network, _ := net.ParseCIDR("2600:1234::/48")
+	addrs, err := generator.GenerateAddressesInNetwork(rand.New(rand.NewSource(666)), 100, network)
+	assert.Nil(t, err)
+	assert.Len(t, addrs, 100)
+	assert.Len(t, addressing.GetIPSet(addrs), 100)
+	for _, addr := range addrs {
+		assert.True(t, addr.In(network))
+		assert.True(t, IsEUI64(addr))
+	}
+
+	_, badNetwork, _ := net.ParseCIDR("2600:1234::/80")
+	_, err = generator.GenerateAddressesInNetwork(rand.New(rand.NewSource(666)), 100, badNetwork)
+	assert.NotNil(t, err)
+
+	_, err = CreateEUI64Generator(nil, nil, 4)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,58 @@
+package oui
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"sort"
+)
+
+// How often an OUI shows up in the EUI-64 interface identifiers of a set of addresses
+type RankedOUI struct {
+	OUI      uint32
+	Vendor   string
+	Count    int // The number of addresses built from a MAC address with the OUI
+	Networks int // The number of /64 networks those addresses are in
+}
+
+// Count the OUIs behind the EUI-64 addresses in the given set, most common first. The vendors are filled
+// in from the database if one is given.
+func RankOUIs(addrs []addressing.IPv6, db *Database) []*RankedOUI {
+	ranks := make(map[uint32]*RankedOUI)
+	networks := make(map[uint32]map[uint64]struct{})
+	for _, addr := range addrs {
+		if !IsEUI64(addr) {
+			continue
+		}
+		oui := GetEUI64OUI(addr)
+		rank, ok := ranks[oui]
+		if !ok {
+			rank = &RankedOUI{OUI: oui, Vendor: db.GetVendor(oui)}
+			ranks[oui] = rank
+			networks[oui] = make(map[uint64]struct{})
+		}
+		rank.Count++
+		networks[oui][addr.High] = struct{}{}
+	}
+	var toReturn []*RankedOUI
+	for oui, rank := range ranks {
+		rank.Networks = len(networks[oui])
+		toReturn = append(toReturn, rank)
+	}
+	sort.Slice(toReturn, func(i, j int) bool {
+		if toReturn[i].Count != toReturn[j].Count {
+			return toReturn[i].Count > toReturn[j].Count
+		} else if toReturn[i].Networks != toReturn[j].Networks {
+			return toReturn[i].Networks > toReturn[j].Networks
+		}
+		return toReturn[i].OUI < toReturn[j].OUI
+	})
+	return toReturn
+}
+
+// Get the OUIs of the first count ranks
+func GetTopOUIs(ranks []*RankedOUI, count int) []uint32 {
+	var toReturn []uint32
+	for i := 0; i < len(ranks) && i < count; i++ {
+		toReturn = append(toReturn, ranks[i].OUI)
+	}
+	return toReturn
+}
@@ -1,202 +1,152 @@
 package pingscan
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"github.com/alecthomas/units"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/fs"
 	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/prober"
 	"github.com/spf13/viper"
-	"golang.org/x/net/icmp"
-	"golang.org/x/net/ipv6"
-	"golang.org/x/time/rate"
-	"net"
 	"os"
-	"sync/atomic"
-	"time"
 )
 
-func processReplies(conn *ipv6.PacketConn, outputFile string, done chan bool, hitCount *uint64) {
+// How many generated addresses are queued up ahead of the scanner
+const targetQueueSize = 1024
+
+// Sends addresses to be scanned on the channel, returning once it has sent them all or the context has
+// been cancelled
+type GenerateFunc func(ctx context.Context, targets chan<- addressing.IPv6) error
+
+// Ping scan the addresses in the input file, writing each live address to the output file once. Unanswered
+// probes are retransmitted up to the given number of retries. The first skip addresses in the input file
+// are passed over and results are appended to the output file, so that a scan that was cancelled part
+// way through can be resumed. Returns the path to the file that ICMPv6 errors were written to (empty if
+// none were received) and how many addresses into the input file the scan got, including the skipped
+// ones.
+func Scan(ctx context.Context, inputFile string, outputFile string, bandwidth string, retries int, skip int) (string, int, error) {
+
+	if skip > 0 {
+		logging.Infof("Resuming ping scan on addresses defined in %s from address %d", inputFile, skip)
+	} else {
+		logging.Infof("Performing ping scan on addresses defined in %s", inputFile)
+	}
 
 	// Output file
-	file, err := os.OpenFile(outputFile, os.O_CREATE|os.O_WRONLY, 0644)
+	file, err := os.OpenFile(outputFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
-		logging.ErrorF(err)
-		return
+		return "", skip, err
 	}
 	defer file.Close()
 
-	// Receive loop
-	buff := make([]byte, 1500)
-	for {
-
-		// Read the next ping response
-		rlen, _, raddr, rerr := conn.ReadFrom(buff)
-		if rerr != nil {
-
-			// Read timeout
-			if nerr, ok := rerr.(net.Error); ok && nerr.Timeout() {
-				continue
+	// Read the addresses from disk as the scanner is ready for them
+	written := make(map[addressing.IPv6]struct{})
+	errorsPath, scanned, err := ScanGenerated(ctx, bandwidth, retries, func(ctx context.Context, targets chan<- addressing.IPv6) error {
+		skipped := 0
+		err := fs.ForEachIPInHexFile(inputFile, func(addr addressing.IPv6) error {
+			if skipped < skip {
+				skipped++
+				return nil
 			}
-
-			// Temporary error
-			nerr, ok := rerr.(*net.OpError)
-			if ok && nerr.Temporary() {
-				continue
+			select {
+			case targets <- addr:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
 			}
-
-			// Permanent error
-			break
+		})
+		if err != nil && ctx.Err() == nil {
+			logging.Warnf("Error thrown when reading IP input file: %s", err.Error())
+			return err
 		}
-
-		// Parse the response
-		_, err := icmp.ParseMessage(58, buff[:rlen])
-		if err != nil {
-			logging.ErrorF(err)
-			continue
+		return nil
+	}, func(reply *prober.Reply) {
+		// Targets can answer more than once (e.g. on several ports), but each is only written out once
+		addr := addressing.NewIPv6(reply.Addr)
+		if _, ok := written[addr]; ok {
+			return
 		}
-		atomic.AddUint64(hitCount, 1)
-		fmt.Fprintf(file, "%s\n", raddr.String())
+		written[addr] = struct{}{}
+		fmt.Fprintf(file, "%s\n", FormatReply(reply))
 		file.Sync()
-	}
-	done <- true
+	})
+	return errorsPath, skip + scanned, err
 }
 
-func Scan(inputFile string, outputFile string, bandwidth string) (string, error) {
+// Ping scan the addresses that generate sends on the channel it is given, calling onReply with every
+// live reply. The channel is bounded, so addresses are only generated as fast as they are scanned and are
+// never held in memory or written to disk. The context given to generate is cancelled as soon as the scan
+// stops, so generate must stop sending once it is done. Unanswered probes are retransmitted up to the
+// given number of retries. Returns the path to the file that ICMPv6 errors were written to (empty if none
+// were received) and how many addresses were scanned.
+func ScanGenerated(ctx context.Context, bandwidth string, retries int, generate GenerateFunc, onReply ReplyFunc) (string, int, error) {
 
-	logging.Infof("Performing ping scan on addresses defined in %s", inputFile)
+	// ICMPv6 errors sent back by routers are recorded separately
+	errorRecorder := NewErrorRecorder()
+	defer errorRecorder.Close()
 
-	// Instantiate ICMPv6 packet listener
-	listener, err := net.ListenPacket("ip6:58", "::")
+	// Instantiate the prober and the scanner that drives it
+	p, err := prober.New()
 	if err != nil {
-		logging.Warnf("Error thrown when listening for IPv6 packets: %s", err.Error())
-		return "", err
+		logging.Warnf("Error thrown when creating prober: %s", err.Error())
+		return "", 0, err
 	}
-
-	// Instantiate IPv6 packet connection
-	conn := ipv6.NewPacketConn(listener)
-	if err := conn.SetControlMessage(ipv6.FlagHopLimit|ipv6.FlagSrc|ipv6.FlagDst|ipv6.FlagInterface, true); err != nil {
-		logging.Warnf("Error thrown when setting control message: %s", err.Error())
-		return "", err
-	}
-
-	// Apply ICMP echo reply filter
-	var filter ipv6.ICMPFilter
-	filter.SetAll(true)
-	filter.Accept(ipv6.ICMPTypeEchoReply)
-	if err := conn.SetICMPFilter(&filter); err != nil {
-		logging.Warnf("Error thrown when setting ICMP filter: %s", err.Error())
-		return "", err
+	scanner, err := NewScanner(p, bandwidth, onReply, errorRecorder.Record)
+	if err != nil {
+		p.Close()
+		return "", 0, err
 	}
+	scanner.SetRetries(retries)
 
-	// Ping configuration
-	// - 10-byte payload
-	// - 255-hop limit
-	echoData := []byte("0123456789")
-	wcm := &ipv6.ControlMessage{HopLimit: 255}
-
-	// Use the zmap kp/s rates to estimate our bandwidth-constrained ping rate
-	maxBandwidthInt, err := units.ParseBase2Bytes(bandwidth)
-	targetRate := float64(maxBandwidthInt) / 1e6 * 1300
-	rateLimit := rate.Limit(targetRate)
-	rateLimiter := rate.NewLimiter(rateLimit, 10)
-	ctx := context.Background()
-
-	// Read the addresses from disk and queue them in the channel
-	ips := make(chan net.IPAddr)
-	done := make(chan bool, 2)
+	// Generate the addresses on their own goroutine
+	genCtx, cancelGen := context.WithCancel(ctx)
+	defer cancelGen()
+	targets := make(chan addressing.IPv6, targetQueueSize)
+	genErr := make(chan error, 1)
 	go func() {
-		file, err := os.Open(inputFile)
-		if err != nil {
-			logging.Warnf("Error thrown when opening IP input file: %s", err.Error())
-			return
-		}
-		defer file.Close()
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			ip := scanner.Text()
-			parsedAddr := net.ParseIP(ip)
-			dstAddr := net.IPAddr{IP: parsedAddr}
-			ips <- dstAddr
-		}
-		done <- true
+		genErr <- generate(genCtx, targets)
+		close(targets)
 	}()
 
-	// Kick off the receive processor
-	hitCount := uint64(0)
-	go processReplies(conn, outputFile, done, &hitCount)
-
-	// Ping each address
-	seq := uint16(0)
-	finished := false
-	count := uint64(0)
-	lastSecondCount := uint64(0)
-	lastStatus := time.Now().Unix()
-	for finished == false {
+	// Ping each address, stopping the generator as soon as the scan stops (ie: if it fails part way through)
+	scanErr := scanner.Scan(ctx, targets)
+	cancelGen()
 
-		// Attempt to read from ips with a 1 second timeout
-		select {
+	// Close the prober to stop the reply processor
+	scanner.Close()
 
-		// Read
-		case ip := <-ips:
-
-			// Rate limit outgoing connections
-			rateLimiter.Wait(ctx)
-
-			// Build the packet
-			ping := icmp.Message{
-				Type: ipv6.ICMPTypeEchoRequest,
-				Code: 0,
-				Body: &icmp.Echo{ID: int(seq), Seq: int(seq), Data: echoData},
-			}
-			req, err := ping.Marshal(nil)
-			if err != nil {
-				logging.Warnf("error encoding ICMP echo packet with destination %s (%s)", ip, err)
-				return "", err
-			}
-			seq += 1
-
-			// Send the packet
-			_, werr := conn.WriteTo(req, wcm, &ip)
-			if werr != nil {
-
-				// Requeue the packet if it failed (i.e. due to network buffer backpressure)
-				go func() { ips <- ip }()
-				continue
-			}
-
-			// Increment the counter
-			lastSecondCount += 1
-			count += 1
-			t := time.Now().Unix()
-			if t != lastStatus {
-				lastStatus = t
-				logging.Infof("Ping-scanned %d addresses (%d hits, %d packets/second)", count, atomic.LoadUint64(&hitCount), lastSecondCount)
-				lastSecondCount = 0
-			}
-
-		// Timeout
-		case <-time.After(5 * time.Second):
-			finished = true
-			break
-		}
+	// Wait for the generator to finish. If the scan failed, that error is the one worth returning.
+	scanned := int(scanner.GetSentCount())
+	if err := <-genErr; err != nil && scanErr == nil {
+		return "", scanned, err
 	}
 
-	// Wait for the file read goroutine to finish
-	<-done
+	scanner.LogSummary()
+	if errorRecorder.GetCount() > 0 {
+		logging.Infof("Received %d ICMPv6 errors from routers while scanning. Errors written to '%s'.", errorRecorder.GetCount(), errorRecorder.GetPath())
+	}
 
-	// Close handle to stop the packet processor
-	conn.Close()
+	return errorRecorder.GetPath(), scanned, scanErr
+}
 
-	// Close the listener
-	listener.Close()
+func ScanFromConfig(ctx context.Context, inputFile string, outputFile string, skip int) (string, int, error) {
+	return Scan(ctx, inputFile, outputFile, viper.GetString("PingScanBandwidth"), viper.GetInt("PingScanRetries"), skip)
+}
 
-	// Wait for the receiver goroutine to finish
-	<-done
+func ScanGeneratedFromConfig(ctx context.Context, generate GenerateFunc, onReply ReplyFunc) (string, int, error) {
+	return ScanGenerated(ctx, viper.GetString("PingScanBandwidth"), viper.GetInt("PingScanRetries"), generate, onReply)
+}
 
-	return "", nil
+// Ping scan the addresses in the input file when checking for aliased networks, probing each address up
+// to AliasDuplicateScanCount times
+func AliasScanFromConfig(ctx context.Context, inputFile string, outputFile string) (string, error) {
+	errorsPath, _, err := Scan(ctx, inputFile, outputFile, viper.GetString("PingScanBandwidth"), viper.GetInt("AliasDuplicateScanCount")-1, 0)
+	return errorsPath, err
 }
 
-func ScanFromConfig(inputFile string, outputFile string) (string, error) {
-	return Scan(inputFile, outputFile, viper.GetString("PingScanBandwidth"))
+// Ping scan the generated addresses when checking for aliased networks, probing each address up to
+// AliasDuplicateScanCount times
+func AliasScanGeneratedFromConfig(ctx context.Context, generate GenerateFunc, onReply ReplyFunc) (string, error) {
+	errorsPath, _, err := ScanGenerated(ctx, viper.GetString("PingScanBandwidth"), viper.GetInt("AliasDuplicateScanCount")-1, generate, onReply)
+	return errorsPath, err
 }
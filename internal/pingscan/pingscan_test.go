@@ -0,0 +1,140 @@
+package pingscan
+
+import (
+	"context"
+	"errors"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/fs"
+	"github.com/ekaley/ipv666/internal/prober"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanGenerated_ScansEveryGeneratedAddress(t *testing.T) {
+	config.InitConfig()
+	viper.Set("PingScanReplyWait", 20)
+	live := []net.IP{net.ParseIP("2600::10"), net.ParseIP("2600::fff")}
+	network := prober.NewFakeNetwork(live, nil)
+	prober.SetFactory(network.Factory())
+	defer prober.ResetFactory()
+
+	// More addresses than fit in the queue, so the generator has to wait on the scanner
+	found := make(map[addressing.IPv6]struct{})
+	errorsPath, scanned, err := ScanGenerated(context.Background(), "100MB", 0, func(ctx context.Context, targets chan<- addressing.IPv6) error {
+		for i := 0; i < targetQueueSize*4; i++ {
+			targets <- addressing.IPv6{High: 0x2600 << 48, Low: uint64(i)}
+		}
+		return nil
+	}, func(reply *prober.Reply) {
+		found[addressing.NewIPv6(reply.Addr)] = struct{}{}
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, errorsPath)
+	assert.Equal(t, targetQueueSize*4, scanned)
+	assert.Len(t, found, 2)
+	for _, ip := range live {
+		assert.Contains(t, found, addressing.NewIPv6(ip))
+	}
+}
+
+func TestScanGenerated_ReturnsGeneratorError(t *testing.T) {
+	config.InitConfig()
+	viper.Set("PingScanReplyWait", 20)
+	network := prober.NewFakeNetwork(nil, nil)
+	prober.SetFactory(network.Factory())
+	defer prober.ResetFactory()
+
+	genErr := errors.New("generation failed")
+	_, scanned, err := ScanGenerated(context.Background(), "100MB", 0, func(ctx context.Context, targets chan<- addressing.IPv6) error {
+		targets <- addressing.IPv6{High: 0x2600 << 48, Low: 1}
+		return genErr
+	}, func(reply *prober.Reply) {})
+	assert.Equal(t, genErr, err)
+	assert.Equal(t, 1, scanned)
+}
+
+// A prober that is closed out from under the scanner after sending a few probes
+type closingProber struct {
+	prober.Prober
+	sendsLeft int
+}
+
+func (p *closingProber) Send(target net.IP) error {
+	if p.sendsLeft == 0 {
+		return prober.ErrClosed
+	}
+	p.sendsLeft--
+	return p.Prober.Send(target)
+}
+
+func TestScanGenerated_StopsGeneratorWhenScanFails(t *testing.T) {
+	config.InitConfig()
+	viper.Set("PingScanReplyWait", 20)
+	network := prober.NewFakeNetwork(nil, nil)
+	prober.SetFactory(func() (prober.Prober, error) {
+		return &closingProber{Prober: prober.NewFakeProber(network), sendsLeft: 10}, nil
+	})
+	defer prober.ResetFactory()
+
+	generated, limit := 0, targetQueueSize*1024
+	_, _, err := ScanGenerated(context.Background(), "100MB", 0, func(ctx context.Context, targets chan<- addressing.IPv6) error {
+		for ; generated < limit; generated++ {
+			select {
+			case targets <- addressing.IPv6{High: 0x2600 << 48, Low: uint64(generated)}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}, func(reply *prober.Reply) {})
+	assert.Equal(t, prober.ErrClosed, err)
+	assert.True(t, generated < limit)
+}
+
+// A prober whose live targets answer on several ports, as TCP and UDP targets can
+type multiPortProber struct {
+	prober.Prober
+	pending []*prober.Reply
+}
+
+func (p *multiPortProber) Recv() (*prober.Reply, error) {
+	if len(p.pending) > 0 {
+		reply := p.pending[0]
+		p.pending = p.pending[1:]
+		return reply, nil
+	}
+	reply, err := p.Prober.Recv()
+	if err != nil {
+		return nil, err
+	}
+	for _, port := range []uint16{443, 8080} {
+		p.pending = append(p.pending, &prober.Reply{Addr: reply.Addr, Port: port})
+	}
+	reply.Port = 80
+	return reply, nil
+}
+
+func TestScan_WritesEachLiveAddressOnce(t *testing.T) {
+	config.InitConfig()
+	viper.Set("PingScanReplyWait", 20)
+	network := prober.NewFakeNetwork([]net.IP{net.ParseIP("2600::1"), net.ParseIP("2600::3")}, nil)
+	prober.SetFactory(func() (prober.Prober, error) {
+		return &multiPortProber{Prober: prober.NewFakeProber(network)}, nil
+	})
+	defer prober.ResetFactory()
+
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "candidates")
+	outputPath := filepath.Join(dir, "results")
+	assert.Nil(t, fs.WriteStringsToFile([]string{"2600::1", "2600::2", "2600::3"}, inputPath))
+	_, scanned, err := Scan(context.Background(), inputPath, outputPath, "100MB", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, scanned)
+	count, err := fs.CountLinesInFile(outputPath)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
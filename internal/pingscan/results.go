@@ -0,0 +1,139 @@
+package pingscan
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/fs"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/prober"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Flag appended to ping result lines for targets that only answered after a retransmission
+const RetriedFlag = "retried"
+
+// Format a reply as a line in a ping result file (the address, followed by the port that answered if any
+// and a flag if the target only answered after a retransmission)
+func FormatReply(reply *prober.Reply) string {
+	toReturn := reply.Addr.String()
+	if reply.Port != 0 {
+		toReturn = fmt.Sprintf("%s %d", toReturn, reply.Port)
+	}
+	if reply.Retried {
+		toReturn = fmt.Sprintf("%s %s", toReturn, RetriedFlag)
+	}
+	return toReturn
+}
+
+// Format an error reply as a line in an ICMP error result file (target, kind, code and router)
+func FormatError(reply *prober.Reply) string {
+	return fmt.Sprintf("%s %s %d %s", reply.Addr, reply.Kind, reply.Code, reply.Router)
+}
+
+func parseErrorLine(line string) (*prober.Reply, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 4 {
+		return nil, errors.New(fmt.Sprintf("Expected 4 fields in ICMP error line '%s' (got %d).", line, len(fields)))
+	}
+	toReturn := &prober.Reply{
+		Addr:   net.ParseIP(fields[0]),
+		Router: net.ParseIP(fields[3]),
+	}
+	if toReturn.Addr == nil {
+		return nil, errors.New(fmt.Sprintf("Could not parse target address from ICMP error line '%s'.", line))
+	}
+	switch fields[1] {
+	case prober.ReplyUnreachable.String():
+		toReturn.Kind = prober.ReplyUnreachable
+	case prober.ReplyTimeExceeded.String():
+		toReturn.Kind = prober.ReplyTimeExceeded
+	default:
+		return nil, errors.New(fmt.Sprintf("Unexpected error kind in ICMP error line '%s'.", line))
+	}
+	code, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	toReturn.Code = code
+	return toReturn, nil
+}
+
+func ReadErrorsFromFile(filePath string) ([]*prober.Reply, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var toReturn []*prober.Reply
+	lineScanner := bufio.NewScanner(file)
+	for lineScanner.Scan() {
+		reply, err := parseErrorLine(lineScanner.Text())
+		if err != nil {
+			logging.Warnf("Skipping ICMP error line in file '%s': %s", filePath, err)
+			continue
+		}
+		toReturn = append(toReturn, reply)
+	}
+	return toReturn, lineScanner.Err()
+}
+
+// Records the ICMPv6 errors received during a single scan to a file in the ICMP error result directory.
+// The file is only created once the first error is received.
+type ErrorRecorder struct {
+	lock  sync.Mutex
+	path  string
+	file  *os.File
+	count int
+}
+
+func NewErrorRecorder() *ErrorRecorder {
+	return &ErrorRecorder{
+		path: fs.GetTimedFilePath(config.GetICMPErrorDirPath()),
+	}
+}
+
+func (recorder *ErrorRecorder) Record(reply *prober.Reply) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if recorder.file == nil {
+		file, err := os.OpenFile(recorder.path, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			logging.Warnf("Error thrown when opening ICMP error file '%s': %s", recorder.path, err)
+			return
+		}
+		recorder.file = file
+	}
+	fmt.Fprintf(recorder.file, "%s\n", FormatError(reply))
+	recorder.count++
+}
+
+// Get the path to the file that errors were written to, or an empty string if no errors were received
+func (recorder *ErrorRecorder) GetPath() string {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if recorder.file == nil {
+		return ""
+	}
+	return recorder.path
+}
+
+func (recorder *ErrorRecorder) GetCount() int {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	return recorder.count
+}
+
+func (recorder *ErrorRecorder) Close() error {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if recorder.file == nil {
+		return nil
+	}
+	return recorder.file.Close()
+}
@@ -0,0 +1,46 @@
+package pingscan
+
+import (
+	"github.com/ekaley/ipv666/internal/prober"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestFormatReply_NoPort(t *testing.T) {
+	reply := &prober.Reply{Addr: net.ParseIP("2600::1")}
+	assert.EqualValues(t, "2600::1", FormatReply(reply))
+}
+
+func TestFormatReply_Port(t *testing.T) {
+	reply := &prober.Reply{Addr: net.ParseIP("2600::1"), Port: 443}
+	assert.EqualValues(t, "2600::1 443", FormatReply(reply))
+}
+
+func TestFormatError_RoundTrip(t *testing.T) {
+	reply := &prober.Reply{
+		Addr:   net.ParseIP("2600::1"),
+		Kind:   prober.ReplyUnreachable,
+		Code:   0,
+		Router: net.ParseIP("2600::ffff"),
+	}
+	parsed, err := parseErrorLine(FormatError(reply))
+	assert.Nil(t, err)
+	assert.True(t, reply.Addr.Equal(parsed.Addr))
+	assert.True(t, reply.Router.Equal(parsed.Router))
+	assert.EqualValues(t, reply.Kind, parsed.Kind)
+	assert.EqualValues(t, reply.Code, parsed.Code)
+	assert.True(t, parsed.IsNoRoute())
+}
+
+func TestParseErrorLine_BadLine(t *testing.T) {
+	_, err := parseErrorLine("2600::1 unreachable 0")
+	assert.NotNil(t, err)
+	_, err = parseErrorLine("2600::1 exploded 0 2600::ffff")
+	assert.NotNil(t, err)
+}
+
+func TestFormatReply_Retried(t *testing.T) {
+	reply := &prober.Reply{Addr: net.ParseIP("2600::1"), Port: 443, Retried: true}
+	assert.EqualValues(t, "2600::1 443 retried", FormatReply(reply))
+}
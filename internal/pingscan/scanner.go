@@ -0,0 +1,358 @@
+package pingscan
+
+import (
+	"context"
+	"github.com/alecthomas/units"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/prober"
+	"github.com/rcrowley/go-metrics"
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The maximum number of times to attempt sending a single probe (ie: due to network buffer backpressure)
+const maxSendAttempts = 10
+
+// The number of RTT samples kept by each scanner when summarizing the RTT distribution
+const rttSampleSize = 4096
+
+var retryCounter = metrics.NewCounter()
+var retryHitCounter = metrics.NewCounter()
+var rttHistogram = metrics.NewHistogram(metrics.NewExpDecaySample(1028, 0.015))
+
+func init() {
+	metrics.Register("pingscan.retry.count", retryCounter)
+	metrics.Register("pingscan.retry_hit.count", retryHitCounter)
+	metrics.Register("pingscan.rtt.histogram", rttHistogram)
+}
+
+type ReplyFunc func(*prober.Reply)
+
+// A probe that has been sent to a target and has not been answered yet
+type pendingProbe struct {
+	target  addressing.IPv6
+	sentAt  time.Time
+	attempt int
+}
+
+// A Scanner sends probes through a Prober at a bandwidth-constrained rate and hands every reply that
+// comes back to a callback (live replies to onReply, ICMPv6 errors to onError if it is not nil). Probes
+// are tracked per target, and a probe that is not answered within the reply timeout is retransmitted
+// up to the configured number of retries. A single Scanner can be used to scan several batches of
+// targets.
+type Scanner struct {
+	prober        prober.Prober
+	rateLimiter   *rate.Limiter
+	replyTimeout  time.Duration
+	retries       int
+	onReply       ReplyFunc
+	onError       ReplyFunc
+	sentCount     uint64
+	retryCount    uint64
+	hitCount      uint64
+	retryHitCount uint64
+	errorCount    uint64
+	pendingLock   sync.Mutex
+	pending       map[addressing.IPv6]*pendingProbe
+	pendingQueue  []*pendingProbe
+	rtts          metrics.Histogram
+	recvDone      chan bool
+}
+
+func NewScanner(p prober.Prober, bandwidth string, onReply ReplyFunc, onError ReplyFunc) (*Scanner, error) {
+
+	// Use the zmap kp/s rates to estimate our bandwidth-constrained ping rate
+	maxBandwidthInt, err := units.ParseBase2Bytes(bandwidth)
+	if err != nil {
+		return nil, err
+	}
+	targetRate := float64(maxBandwidthInt) / 1e6 * 1300
+	rateLimit := rate.Limit(targetRate)
+
+	toReturn := &Scanner{
+		prober:       p,
+		rateLimiter:  rate.NewLimiter(rateLimit, 10),
+		replyTimeout: time.Duration(viper.GetInt("PingScanReplyWait")) * time.Millisecond,
+		retries:      viper.GetInt("PingScanRetries"),
+		onReply:      onReply,
+		onError:      onError,
+		pending:      make(map[addressing.IPv6]*pendingProbe),
+		rtts:         metrics.NewHistogram(metrics.NewUniformSample(rttSampleSize)),
+		recvDone:     make(chan bool, 1),
+	}
+
+	// Kick off the receive processor
+	go toReturn.processReplies()
+
+	return toReturn, nil
+}
+
+// Create a new Scanner using the configured prober and scan bandwidth
+func NewScannerFromConfig(onReply ReplyFunc, onError ReplyFunc) (*Scanner, error) {
+	p, err := prober.New()
+	if err != nil {
+		return nil, err
+	}
+	scanner, err := NewScanner(p, viper.GetString("PingScanBandwidth"), onReply, onError)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	return scanner, nil
+}
+
+// Set the number of times that an unanswered probe is retransmitted
+func (scanner *Scanner) SetRetries(retries int) {
+	scanner.retries = retries
+}
+
+func (scanner *Scanner) processReplies() {
+	for {
+		reply, err := scanner.prober.Recv()
+		if err != nil {
+			break
+		}
+		scanner.completeProbe(reply)
+		if reply.Kind != prober.ReplyLive {
+			atomic.AddUint64(&scanner.errorCount, 1)
+			if scanner.onError != nil {
+				scanner.onError(reply)
+			}
+			continue
+		}
+		atomic.AddUint64(&scanner.hitCount, 1)
+		if reply.Retried {
+			atomic.AddUint64(&scanner.retryHitCount, 1)
+			retryHitCounter.Inc(1)
+		}
+		scanner.onReply(reply)
+	}
+	scanner.recvDone <- true
+}
+
+// Stop tracking the probe that a reply answers, filling in the reply's RTT and retry flag. Replies to
+// targets that are not being tracked (ie: additional ports answering, or replies that arrive after we
+// gave up on the target) are left as-is.
+func (scanner *Scanner) completeProbe(reply *prober.Reply) {
+	scanner.pendingLock.Lock()
+	defer scanner.pendingLock.Unlock()
+	key := addressing.NewIPv6(reply.Addr)
+	probe, ok := scanner.pending[key]
+	if !ok {
+		return
+	}
+	delete(scanner.pending, key)
+	reply.RTT = time.Since(probe.sentAt)
+	reply.Retried = probe.attempt > 0
+	scanner.rtts.Update(int64(reply.RTT))
+	rttHistogram.Update(int64(reply.RTT))
+}
+
+// Start tracking a probe to the target. This happens before the probe is sent so that replies can never
+// beat it.
+func (scanner *Scanner) trackProbe(target addressing.IPv6, attempt int) *pendingProbe {
+	scanner.pendingLock.Lock()
+	defer scanner.pendingLock.Unlock()
+	probe := &pendingProbe{target: target, sentAt: time.Now(), attempt: attempt}
+	scanner.pending[target] = probe
+	scanner.pendingQueue = append(scanner.pendingQueue, probe)
+	return probe
+}
+
+// Pop the probes whose reply timeout has passed off of the queue, returning the ones that should be
+// retransmitted. Probes are queued in the order they were sent, so only the head of the queue needs to
+// be checked.
+func (scanner *Scanner) popExpiredProbes() []*pendingProbe {
+	scanner.pendingLock.Lock()
+	defer scanner.pendingLock.Unlock()
+	var toReturn []*pendingProbe
+	now := time.Now()
+	for len(scanner.pendingQueue) > 0 {
+		probe := scanner.pendingQueue[0]
+		if now.Sub(probe.sentAt) < scanner.replyTimeout {
+			break
+		}
+		scanner.pendingQueue = scanner.pendingQueue[1:]
+		key := probe.target
+		if scanner.pending[key] != probe {
+			continue
+		}
+		if probe.attempt < scanner.retries {
+			toReturn = append(toReturn, probe)
+		} else {
+			delete(scanner.pending, key)
+		}
+	}
+	return toReturn
+}
+
+func (scanner *Scanner) getPendingCount() int {
+	scanner.pendingLock.Lock()
+	defer scanner.pendingLock.Unlock()
+	return len(scanner.pending)
+}
+
+// Send a single probe to the target, retrying on send errors. If the context is cancelled while waiting
+// on the rate limiter, the probe is not sent and the context's error is returned.
+func (scanner *Scanner) sendProbe(ctx context.Context, target addressing.IPv6, attempt int) error {
+	probe := scanner.trackProbe(target, attempt)
+	targetIP := target.ToIP()
+	for sendAttempt := 1; ; sendAttempt++ {
+
+		// Rate limit outgoing connections
+		if err := scanner.rateLimiter.Wait(ctx); err != nil {
+			scanner.dropProbe(probe)
+			return ctx.Err()
+		}
+
+		// Send the probe
+		err := scanner.prober.Send(targetIP)
+		if err == nil {
+			return nil
+		} else if err == prober.ErrClosed {
+			return err
+		} else if sendAttempt >= maxSendAttempts {
+			logging.Debugf("Giving up on sending probe to %s after %d attempts: %s", target, sendAttempt, err)
+			return nil
+		}
+	}
+}
+
+// Retransmit the probes that have not been answered within the reply timeout. Once the scan has been
+// cancelled, expired probes are dropped rather than retransmitted.
+func (scanner *Scanner) retransmitExpired(ctx context.Context) error {
+	for _, probe := range scanner.popExpiredProbes() {
+		if ctx.Err() != nil {
+			scanner.dropProbe(probe)
+			continue
+		}
+		if err := scanner.sendProbe(ctx, probe.target, probe.attempt+1); err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			return err
+		}
+		atomic.AddUint64(&scanner.retryCount, 1)
+		retryCounter.Inc(1)
+	}
+	return nil
+}
+
+// Stop tracking a probe that is not going to be retransmitted
+func (scanner *Scanner) dropProbe(probe *pendingProbe) {
+	scanner.pendingLock.Lock()
+	defer scanner.pendingLock.Unlock()
+	if scanner.pending[probe.target] == probe {
+		delete(scanner.pending, probe.target)
+	}
+}
+
+// Probe every target read from the channel until it is closed, then keep retransmitting unanswered
+// probes until every target has either answered or run out of retries. If the context is cancelled, no
+// more targets are read from the channel and the probes already in flight are given one reply timeout to
+// be answered before the context's error is returned.
+func (scanner *Scanner) Scan(ctx context.Context, targets <-chan addressing.IPv6) error {
+	lastSecondCount := uint64(0)
+	lastStatus := time.Now().Unix()
+	checkInterval := scanner.replyTimeout / 10
+	if checkInterval < time.Millisecond {
+		checkInterval = time.Millisecond
+	}
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	done := ctx.Done()
+	for targets != nil || scanner.getPendingCount() > 0 {
+
+		if done != nil && ctx.Err() != nil {
+			logging.Infof("Ping scan cancelled. Waiting on replies to %d outstanding probes.", scanner.getPendingCount())
+			targets = nil
+			done = nil
+			continue
+		}
+
+		select {
+		case <-done:
+			// Stop reading targets at the top of the loop
+		case target, ok := <-targets:
+			if !ok {
+				targets = nil
+				break
+			}
+			if err := scanner.sendProbe(ctx, target, 0); err != nil {
+				if ctx.Err() != nil {
+					// The target was never probed, so it isn't counted as scanned
+					continue
+				}
+				return err
+			}
+
+			// Increment the counter
+			lastSecondCount += 1
+			count := atomic.AddUint64(&scanner.sentCount, 1)
+			t := time.Now().Unix()
+			if t != lastStatus {
+				lastStatus = t
+				logging.Infof("Ping-scanned %d addresses (%d hits, %d packets/second)", count, atomic.LoadUint64(&scanner.hitCount), lastSecondCount)
+				lastSecondCount = 0
+			}
+		case <-ticker.C:
+		}
+
+		if err := scanner.retransmitExpired(ctx); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// Get the number of targets probed (not including retransmissions)
+func (scanner *Scanner) GetSentCount() uint64 {
+	return atomic.LoadUint64(&scanner.sentCount)
+}
+
+func (scanner *Scanner) GetRetryCount() uint64 {
+	return atomic.LoadUint64(&scanner.retryCount)
+}
+
+func (scanner *Scanner) GetHitCount() uint64 {
+	return atomic.LoadUint64(&scanner.hitCount)
+}
+
+// Get the number of live replies that only came back after the probe was retransmitted
+func (scanner *Scanner) GetRetryHitCount() uint64 {
+	return atomic.LoadUint64(&scanner.retryHitCount)
+}
+
+func (scanner *Scanner) GetErrorCount() uint64 {
+	return atomic.LoadUint64(&scanner.errorCount)
+}
+
+// Get the given percentiles (0.0 to 1.0) of the RTTs measured by the scanner
+func (scanner *Scanner) GetRTTPercentiles(percentiles ...float64) []time.Duration {
+	var toReturn []time.Duration
+	for _, rtt := range scanner.rtts.Percentiles(percentiles) {
+		toReturn = append(toReturn, time.Duration(rtt))
+	}
+	return toReturn
+}
+
+// Log the probe, retry and RTT totals for everything the scanner has sent so far
+func (scanner *Scanner) LogSummary() {
+	logging.Infof("Sent %d probes (%d retransmissions) and received %d replies (%d only after a retransmission).", scanner.GetSentCount(), scanner.GetRetryCount(), scanner.GetHitCount(), scanner.GetRetryHitCount())
+	if scanner.rtts.Count() > 0 {
+		rtts := scanner.GetRTTPercentiles(0.5, 0.9, 0.99)
+		logging.Infof("RTT min %s, median %s, 90th percentile %s, 99th percentile %s, max %s.", time.Duration(scanner.rtts.Min()), rtts[0], rtts[1], rtts[2], time.Duration(scanner.rtts.Max()))
+	}
+}
+
+// Close the underlying prober and wait for the receive processor to finish
+func (scanner *Scanner) Close() error {
+	err := scanner.prober.Close()
+	<-scanner.recvDone
+	return err
+}
@@ -0,0 +1,102 @@
+package pingscan
+
+import (
+	"context"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/prober"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"sync"
+	"testing"
+)
+
+func scanFakeNetwork(t *testing.T, network *prober.FakeNetwork, retries int, targets ...net.IP) (*Scanner, map[string]*prober.Reply) {
+	config.InitConfig()
+	viper.Set("PingScanReplyWait", 20)
+	var lock sync.Mutex
+	replies := make(map[string]*prober.Reply)
+	scanner, err := NewScanner(prober.NewFakeProber(network), "100MB", func(reply *prober.Reply) {
+		lock.Lock()
+		defer lock.Unlock()
+		replies[reply.Addr.String()] = reply
+	}, nil)
+	assert.Nil(t, err)
+	scanner.SetRetries(retries)
+	ips := make(chan addressing.IPv6, len(targets))
+	for _, target := range targets {
+		ips <- addressing.NewIPv6(target)
+	}
+	close(ips)
+	assert.Nil(t, scanner.Scan(context.Background(), ips))
+	assert.Nil(t, scanner.Close())
+	return scanner, replies
+}
+
+func TestScanner_RetransmitsUnansweredProbes(t *testing.T) {
+	live := net.ParseIP("2600::1")
+	lossy := net.ParseIP("2600::2")
+	dead := net.ParseIP("2600::3")
+	network := prober.NewFakeNetwork([]net.IP{live, lossy}, nil)
+	network.AddDrops(lossy, 1)
+
+	scanner, replies := scanFakeNetwork(t, network, 2, live, lossy, dead)
+
+	// The lossy host is found on the retry and flagged, the dead host is given up on after two retries
+	assert.Len(t, replies, 2)
+	assert.False(t, replies[live.String()].Retried)
+	assert.True(t, replies[lossy.String()].Retried)
+	assert.EqualValues(t, 3, scanner.GetSentCount())
+	assert.EqualValues(t, 3, scanner.GetRetryCount())
+	assert.EqualValues(t, 2, scanner.GetHitCount())
+	assert.EqualValues(t, 1, scanner.GetRetryHitCount())
+	assert.EqualValues(t, 6, network.GetProbeCount())
+	assert.Len(t, scanner.GetRTTPercentiles(0.5), 1)
+}
+
+func TestScanner_NoRetries(t *testing.T) {
+	lossy := net.ParseIP("2600::2")
+	network := prober.NewFakeNetwork([]net.IP{lossy}, nil)
+	network.AddDrops(lossy, 1)
+
+	scanner, replies := scanFakeNetwork(t, network, 0, lossy)
+
+	assert.Empty(t, replies)
+	assert.EqualValues(t, 0, scanner.GetRetryCount())
+	assert.EqualValues(t, 1, network.GetProbeCount())
+}
+
+func TestScanner_StopsWhenCancelled(t *testing.T) {
+	config.InitConfig()
+	viper.Set("PingScanReplyWait", 20)
+	live := net.ParseIP("2600::1")
+	network := prober.NewFakeNetwork([]net.IP{live}, nil)
+	scanner, err := NewScanner(prober.NewFakeProber(network), "100MB", func(reply *prober.Reply) {}, nil)
+	assert.Nil(t, err)
+	ips := make(chan addressing.IPv6, 3)
+	for i := 0; i < 3; i++ {
+		ips <- addressing.NewIPv6(live)
+	}
+	close(ips)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, scanner.Scan(ctx, ips))
+	assert.Nil(t, scanner.Close())
+	assert.EqualValues(t, 0, scanner.GetSentCount())
+	assert.EqualValues(t, 0, network.GetProbeCount())
+}
+
+func TestScanner_DoesNotSendProbeWhenCancelledWhileRateLimited(t *testing.T) {
+	config.InitConfig()
+	viper.Set("PingScanReplyWait", 20)
+	network := prober.NewFakeNetwork(nil, nil)
+	scanner, err := NewScanner(prober.NewFakeProber(network), "100MB", func(reply *prober.Reply) {}, nil)
+	assert.Nil(t, err)
+	defer scanner.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, scanner.sendProbe(ctx, addressing.NewIPv6(net.ParseIP("2600::1")), 0))
+	assert.Equal(t, 0, scanner.getPendingCount())
+	assert.EqualValues(t, 0, network.GetProbeCount())
+}
@@ -0,0 +1,70 @@
+package prober
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/rcrowley/go-metrics"
+	"net"
+)
+
+const cookieKeyLength = 32
+
+var invalidReplyCounter = metrics.NewCounter()
+
+func init() {
+	metrics.Register("prober.invalid_reply.count", invalidReplyCounter)
+}
+
+// Record that a reply failed cookie validation and was dropped
+func countInvalidReply() {
+	invalidReplyCounter.Inc(1)
+}
+
+// Get the total number of replies that have been dropped because they failed cookie validation
+func GetInvalidReplyCount() int64 {
+	return invalidReplyCounter.Count()
+}
+
+// Derives a keyed cookie from each target address so that replies can be checked against the probes
+// that were actually sent (ie: to drop stray replies meant for other tools and spoofed replies)
+type Cookie struct {
+	key []byte
+}
+
+func NewCookie() (*Cookie, error) {
+	key := make([]byte, cookieKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return NewCookieFromKey(key), nil
+}
+
+func NewCookieFromKey(key []byte) *Cookie {
+	return &Cookie{key: key}
+}
+
+// Get the HMAC of the target address
+func (cookie *Cookie) Sum(target net.IP) []byte {
+	mac := hmac.New(sha256.New, cookie.key)
+	mac.Write(target.To16())
+	return mac.Sum(nil)
+}
+
+func (cookie *Cookie) Uint16(target net.IP) uint16 {
+	return binary.BigEndian.Uint16(cookie.Sum(target))
+}
+
+func (cookie *Cookie) Uint32(target net.IP) uint32 {
+	return binary.BigEndian.Uint32(cookie.Sum(target))
+}
+
+// Check whether the given bytes match the start of the target's cookie
+func (cookie *Cookie) Check(target net.IP, toCheck []byte) bool {
+	sum := cookie.Sum(target)
+	if len(toCheck) == 0 || len(toCheck) > len(sum) {
+		return false
+	}
+	return hmac.Equal(sum[:len(toCheck)], toCheck)
+}
@@ -0,0 +1,34 @@
+package prober
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestCookie_SumDiffersByTarget(t *testing.T) {
+	cookie := NewCookieFromKey([]byte("0123456789abcdef"))
+	assert.NotEqual(t, cookie.Sum(net.ParseIP("2600::1")), cookie.Sum(net.ParseIP("2600::2")))
+}
+
+func TestCookie_SumDiffersByKey(t *testing.T) {
+	first := NewCookieFromKey([]byte("0123456789abcdef"))
+	second := NewCookieFromKey([]byte("fedcba9876543210"))
+	assert.NotEqual(t, first.Sum(net.ParseIP("2600::1")), second.Sum(net.ParseIP("2600::1")))
+}
+
+func TestCookie_Check(t *testing.T) {
+	cookie := NewCookieFromKey([]byte("0123456789abcdef"))
+	target := net.ParseIP("2600::1")
+	sum := cookie.Sum(target)
+	assert.True(t, cookie.Check(target, sum))
+	assert.True(t, cookie.Check(target, sum[:4]))
+	assert.False(t, cookie.Check(net.ParseIP("2600::2"), sum[:4]))
+	assert.False(t, cookie.Check(target, []byte{}))
+	assert.False(t, cookie.Check(target, append(sum, 0x00)))
+}
+
+func TestGetEchoCookieBytes_RoundTrip(t *testing.T) {
+	cookie := NewCookieFromKey([]byte("0123456789abcdef")).Sum(net.ParseIP("2600::1"))
+	assert.EqualValues(t, cookie[:echoCookieLength], getEchoCookieBytes(getCookieEcho(cookie)))
+}
@@ -0,0 +1,220 @@
+package prober
+
+import (
+	"net"
+	"sync"
+)
+
+// An in-memory stand-in for the IPv6 network. Addresses that are live or that fall within an aliased
+// prefix will answer probes sent by any FakeProber created from the network, while probes to addresses
+// within an unrouted prefix get a "no route" error back from a router. Like real probes, replies echo a
+// cookie that the FakeProber checks before handing them on.
+type FakeNetwork struct {
+	lock       sync.RWMutex
+	live       map[string]struct{}
+	aliased    []*net.IPNet
+	unrouted   []*net.IPNet
+	drops      map[string]int
+	probers    []*FakeProber
+	probeCount int
+}
+
+func NewFakeNetwork(live []net.IP, aliased []*net.IPNet) *FakeNetwork {
+	toReturn := &FakeNetwork{
+		live:    make(map[string]struct{}),
+		aliased: []*net.IPNet{},
+		drops:   make(map[string]int),
+	}
+	toReturn.AddLive(live...)
+	toReturn.AddAliased(aliased...)
+	return toReturn
+}
+
+func (network *FakeNetwork) AddLive(addrs ...net.IP) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	for _, addr := range addrs {
+		network.live[addr.String()] = struct{}{}
+	}
+}
+
+func (network *FakeNetwork) AddAliased(nets ...*net.IPNet) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.aliased = append(network.aliased, nets...)
+}
+
+func (network *FakeNetwork) IsLive(target net.IP) bool {
+	network.lock.RLock()
+	defer network.lock.RUnlock()
+	if _, ok := network.live[target.String()]; ok {
+		return true
+	}
+	for _, aliased := range network.aliased {
+		if aliased.Contains(target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (network *FakeNetwork) AddUnrouted(nets ...*net.IPNet) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.unrouted = append(network.unrouted, nets...)
+}
+
+// Drop the next count probes sent to the address, as if they had been lost in transit
+func (network *FakeNetwork) AddDrops(addr net.IP, count int) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.drops[addr.String()] += count
+}
+
+// Whether the probe to the target should be dropped
+func (network *FakeNetwork) shouldDrop(target net.IP) bool {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	key := target.String()
+	if network.drops[key] > 0 {
+		network.drops[key]--
+		return true
+	}
+	return false
+}
+
+// Get the prefix that the target falls within if it is unrouted, nil otherwise
+func (network *FakeNetwork) getUnrouted(target net.IP) *net.IPNet {
+	network.lock.RLock()
+	defer network.lock.RUnlock()
+	for _, unrouted := range network.unrouted {
+		if unrouted.Contains(target) {
+			return unrouted
+		}
+	}
+	return nil
+}
+
+// Deliver a reply that was not caused by any of our probes (ie: a reply to some other tool or a spoofed
+// reply) to every prober created from the network
+func (network *FakeNetwork) InjectStrayReply(addr net.IP) {
+	network.lock.RLock()
+	probers := network.probers
+	network.lock.RUnlock()
+	for _, p := range probers {
+		p.deliver(&fakePacket{reply: &Reply{Addr: addr}, cookie: make([]byte, fakeCookieLength)})
+	}
+}
+
+func (network *FakeNetwork) addProber(p *FakeProber) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.probers = append(network.probers, p)
+}
+
+// Get the total number of probes sent to the network by all of its probers
+func (network *FakeNetwork) GetProbeCount() int {
+	network.lock.RLock()
+	defer network.lock.RUnlock()
+	return network.probeCount
+}
+
+func (network *FakeNetwork) recordProbe() {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.probeCount++
+}
+
+// Get a prober factory that creates FakeProbers against this network
+func (network *FakeNetwork) Factory() Factory {
+	return func() (Prober, error) {
+		return NewFakeProber(network), nil
+	}
+}
+
+const fakeCookieLength = 8
+
+// A reply along with the cookie that the fake network echoed back from the probe
+type fakePacket struct {
+	reply  *Reply
+	cookie []byte
+}
+
+type FakeProber struct {
+	network   *FakeNetwork
+	cookie    *Cookie
+	packets   chan *fakePacket
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func NewFakeProber(network *FakeNetwork) *FakeProber {
+	toReturn := &FakeProber{
+		network: network,
+		cookie:  NewCookieFromKey([]byte("fake prober cookie key")),
+		packets: make(chan *fakePacket, 4096),
+		closed:  make(chan struct{}),
+	}
+	network.addProber(toReturn)
+	return toReturn
+}
+
+func (p *FakeProber) Send(target net.IP) error {
+	select {
+	case <-p.closed:
+		return ErrClosed
+	default:
+	}
+	p.network.recordProbe()
+	if p.network.shouldDrop(target) {
+		return nil
+	}
+	replyAddr := make(net.IP, len(target))
+	copy(replyAddr, target)
+	var reply *Reply
+	if unrouted := p.network.getUnrouted(target); unrouted != nil {
+		router := make(net.IP, len(unrouted.IP))
+		copy(router, unrouted.IP)
+		router[len(router)-1] |= 1
+		reply = &Reply{Addr: replyAddr, Kind: ReplyUnreachable, Code: icmpNoRouteCode, Router: router}
+	} else if p.network.IsLive(target) {
+		reply = &Reply{Addr: replyAddr}
+	} else {
+		return nil
+	}
+	if !p.deliver(&fakePacket{reply: reply, cookie: p.cookie.Sum(target)[:fakeCookieLength]}) {
+		return ErrClosed
+	}
+	return nil
+}
+
+func (p *FakeProber) deliver(packet *fakePacket) bool {
+	select {
+	case p.packets <- packet:
+		return true
+	case <-p.closed:
+		return false
+	}
+}
+
+func (p *FakeProber) Recv() (*Reply, error) {
+	for {
+		select {
+		case packet := <-p.packets:
+			if !p.cookie.Check(packet.reply.Addr, packet.cookie) {
+				countInvalidReply()
+				continue
+			}
+			return packet.reply, nil
+		case <-p.closed:
+			return nil, ErrClosed
+		}
+	}
+}
+
+func (p *FakeProber) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+	})
+	return nil
+}
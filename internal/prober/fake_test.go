@@ -0,0 +1,56 @@
+package prober
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestFakeProber_LiveReply(t *testing.T) {
+	live := net.ParseIP("2600::1")
+	network := NewFakeNetwork([]net.IP{live}, nil)
+	p := NewFakeProber(network)
+	defer p.Close()
+	assert.Nil(t, p.Send(net.ParseIP("2600::2")))
+	assert.Nil(t, p.Send(live))
+	reply, err := p.Recv()
+	assert.Nil(t, err)
+	assert.True(t, live.Equal(reply.Addr))
+	assert.EqualValues(t, ReplyLive, reply.Kind)
+	assert.EqualValues(t, 2, network.GetProbeCount())
+}
+
+func TestFakeProber_StrayReplyDropped(t *testing.T) {
+	live := net.ParseIP("2600::1")
+	network := NewFakeNetwork([]net.IP{live}, nil)
+	p := NewFakeProber(network)
+	defer p.Close()
+	before := GetInvalidReplyCount()
+	network.InjectStrayReply(net.ParseIP("2600::3"))
+	assert.Nil(t, p.Send(live))
+	reply, err := p.Recv()
+	assert.Nil(t, err)
+	assert.True(t, live.Equal(reply.Addr))
+	assert.EqualValues(t, before+1, GetInvalidReplyCount())
+}
+
+func TestFakeProber_UnroutedReply(t *testing.T) {
+	_, unrouted, _ := net.ParseCIDR("2600:1::/48")
+	network := NewFakeNetwork(nil, nil)
+	network.AddUnrouted(unrouted)
+	p := NewFakeProber(network)
+	defer p.Close()
+	assert.Nil(t, p.Send(net.ParseIP("2600:1::1")))
+	reply, err := p.Recv()
+	assert.Nil(t, err)
+	assert.True(t, reply.IsNoRoute())
+	assert.True(t, unrouted.Contains(reply.Router))
+}
+
+func TestFakeProber_ClosedRecv(t *testing.T) {
+	p := NewFakeProber(NewFakeNetwork(nil, nil))
+	p.Close()
+	_, err := p.Recv()
+	assert.Equal(t, ErrClosed, err)
+	assert.Equal(t, ErrClosed, p.Send(net.ParseIP("2600::1")))
+}
@@ -0,0 +1,166 @@
+package prober
+
+import (
+	"encoding/binary"
+	"github.com/ekaley/ipv666/internal/logging"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"net"
+)
+
+// The number of cookie bytes carried in the echo ID, sequence number and payload of each probe
+const (
+	echoCookieLength = 20
+	echoHeaderLength = 4
+)
+
+type ICMPProber struct {
+	listener net.PacketConn
+	conn     *ipv6.PacketConn
+	wcm      *ipv6.ControlMessage
+	cookie   *Cookie
+	buff     []byte
+}
+
+func NewICMPProber() (*ICMPProber, error) {
+
+	// Instantiate ICMPv6 packet listener
+	listener, err := net.ListenPacket("ip6:58", "::")
+	if err != nil {
+		logging.Warnf("Error thrown when listening for IPv6 packets: %s", err.Error())
+		return nil, err
+	}
+
+	// Instantiate IPv6 packet connection
+	conn := ipv6.NewPacketConn(listener)
+	if err := conn.SetControlMessage(ipv6.FlagHopLimit|ipv6.FlagSrc|ipv6.FlagDst|ipv6.FlagInterface, true); err != nil {
+		logging.Warnf("Error thrown when setting control message: %s", err.Error())
+		listener.Close()
+		return nil, err
+	}
+
+	// Apply ICMP echo reply and error filter
+	var filter ipv6.ICMPFilter
+	filter.SetAll(true)
+	filter.Accept(ipv6.ICMPTypeEchoReply)
+	acceptICMPErrors(&filter)
+	if err := conn.SetICMPFilter(&filter); err != nil {
+		logging.Warnf("Error thrown when setting ICMP filter: %s", err.Error())
+		listener.Close()
+		return nil, err
+	}
+
+	cookie, err := NewCookie()
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	// Ping configuration
+	// - ID, sequence number and 16-byte payload taken from the target's cookie
+	// - 255-hop limit
+	return &ICMPProber{
+		listener: listener,
+		conn:     conn,
+		wcm:      &ipv6.ControlMessage{HopLimit: 255},
+		cookie:   cookie,
+		buff:     make([]byte, 1500),
+	}, nil
+}
+
+func (p *ICMPProber) Send(target net.IP) error {
+	ping := icmp.Message{
+		Type: ipv6.ICMPTypeEchoRequest,
+		Code: 0,
+		Body: getCookieEcho(p.cookie.Sum(target)),
+	}
+	req, err := ping.Marshal(nil)
+	if err != nil {
+		logging.Warnf("error encoding ICMP echo packet with destination %s (%s)", target, err)
+		return err
+	}
+	_, err = p.conn.WriteTo(req, p.wcm, &net.IPAddr{IP: target})
+	return err
+}
+
+func (p *ICMPProber) Recv() (*Reply, error) {
+	for {
+
+		// Read the next ping response
+		rlen, _, raddr, rerr := p.conn.ReadFrom(p.buff)
+		if rerr != nil {
+			if isRetryableReadError(rerr) {
+				continue
+			}
+			return nil, rerr
+		}
+
+		// Parse the response
+		message, err := icmp.ParseMessage(icmpProtocolNumber, p.buff[:rlen])
+		if err != nil {
+			logging.Warnf("Error thrown when parsing ICMP reply from %s: %s", raddr, err)
+			continue
+		}
+
+		if message.Type == ipv6.ICMPTypeEchoReply {
+			echo, ok := message.Body.(*icmp.Echo)
+			addr := addrToIP(raddr)
+			if !ok || len(echo.Data) != echoCookieLength-echoHeaderLength || !p.cookie.Check(addr, getEchoCookieBytes(echo)) {
+				countInvalidReply()
+				continue
+			}
+			return &Reply{Addr: addr}, nil
+		} else if reply, quoted, ok := parseICMPError(message, addrToIP(raddr)); ok && isQuotedEchoRequest(quoted) {
+			quotedCookie := quoted[ipv6HeaderLength+icmpHeaderLength:]
+			if len(quotedCookie) > echoCookieLength {
+				quotedCookie = quotedCookie[:echoCookieLength]
+			}
+			if len(quotedCookie) < echoHeaderLength || !p.cookie.Check(reply.Addr, quotedCookie) {
+				countInvalidReply()
+				continue
+			}
+			return reply, nil
+		}
+	}
+}
+
+func (p *ICMPProber) Close() error {
+	p.conn.Close()
+	return p.listener.Close()
+}
+
+// Build an echo request body that carries the given cookie in its ID, sequence number and payload
+func getCookieEcho(cookie []byte) *icmp.Echo {
+	data := make([]byte, echoCookieLength-echoHeaderLength)
+	copy(data, cookie[echoHeaderLength:echoCookieLength])
+	return &icmp.Echo{
+		ID:   int(binary.BigEndian.Uint16(cookie[0:2])),
+		Seq:  int(binary.BigEndian.Uint16(cookie[2:4])),
+		Data: data,
+	}
+}
+
+// Get the cookie bytes carried in an echo body (ID, then sequence number, then payload)
+func getEchoCookieBytes(echo *icmp.Echo) []byte {
+	toReturn := make([]byte, echoHeaderLength, echoHeaderLength+len(echo.Data))
+	binary.BigEndian.PutUint16(toReturn[0:2], uint16(echo.ID))
+	binary.BigEndian.PutUint16(toReturn[2:4], uint16(echo.Seq))
+	return append(toReturn, echo.Data...)
+}
+
+func addrToIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	default:
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			host = addr.String()
+		}
+		return net.ParseIP(host)
+	}
+}
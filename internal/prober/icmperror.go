@@ -0,0 +1,56 @@
+package prober
+
+import (
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"net"
+)
+
+const (
+	icmpNoRouteCode       = 0
+	icmpHeaderLength      = 4
+	icmpProtocolNumber    = 58
+	icmpEchoRequestType   = 128
+	ipv6NextHeaderOffset  = 6
+	ipv6DestinationOffset = 24
+)
+
+// Build an error reply from an ICMPv6 destination unreachable or time exceeded message. The datagram quoted
+// in the message is returned as well so that it can be checked against the probe that was sent.
+func parseICMPError(message *icmp.Message, router net.IP) (*Reply, []byte, bool) {
+	var quoted []byte
+	var kind ReplyKind
+	switch body := message.Body.(type) {
+	case *icmp.DstUnreach:
+		quoted = body.Data
+		kind = ReplyUnreachable
+	case *icmp.TimeExceeded:
+		quoted = body.Data
+		kind = ReplyTimeExceeded
+	default:
+		return nil, nil, false
+	}
+	if len(quoted) < ipv6HeaderLength {
+		return nil, nil, false
+	}
+	target := make(net.IP, net.IPv6len)
+	copy(target, quoted[ipv6DestinationOffset:ipv6DestinationOffset+net.IPv6len])
+	return &Reply{
+		Addr:   target,
+		Kind:   kind,
+		Code:   message.Code,
+		Router: router,
+	}, quoted, true
+}
+
+// Whether a datagram quoted in an ICMPv6 error is an echo request
+func isQuotedEchoRequest(quoted []byte) bool {
+	return len(quoted) > ipv6HeaderLength &&
+		quoted[ipv6NextHeaderOffset] == icmpProtocolNumber &&
+		quoted[ipv6HeaderLength] == icmpEchoRequestType
+}
+
+func acceptICMPErrors(filter *ipv6.ICMPFilter) {
+	filter.Accept(ipv6.ICMPTypeDestinationUnreachable)
+	filter.Accept(ipv6.ICMPTypeTimeExceeded)
+}
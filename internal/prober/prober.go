@@ -0,0 +1,109 @@
+package prober
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"net"
+	"time"
+)
+
+var ErrClosed = errors.New("prober has been closed")
+
+type ReplyKind int
+
+const (
+	ReplyLive         ReplyKind = iota // The target answered the probe
+	ReplyUnreachable                   // A router reported that the target was unreachable
+	ReplyTimeExceeded                  // A router reported that the probe's hop limit was exceeded
+)
+
+func (kind ReplyKind) String() string {
+	switch kind {
+	case ReplyLive:
+		return "live"
+	case ReplyUnreachable:
+		return "unreachable"
+	case ReplyTimeExceeded:
+		return "time-exceeded"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(kind))
+	}
+}
+
+// A reply received in response to a probe sent to a target
+type Reply struct {
+	Addr    net.IP
+	Port    uint16        // The port that answered (zero for probes that are not port-based)
+	Kind    ReplyKind     // Whether the target answered or a router sent back an ICMPv6 error
+	Code    int           // The ICMPv6 code of an error reply
+	Router  net.IP        // The address that sent an error reply
+	RTT     time.Duration // The time since the most recent probe to the target was sent (set by the scanner)
+	Retried bool          // Whether the target only answered after the probe was retransmitted (set by the scanner)
+}
+
+// Whether the reply indicates that a router had no route to the target's network
+func (reply *Reply) IsNoRoute() bool {
+	return reply.Kind == ReplyUnreachable && reply.Code == icmpNoRouteCode
+}
+
+// A Prober sends probes to target addresses and receives the replies that indicate a target is live
+type Prober interface {
+
+	// Send a single probe to the given target address
+	Send(target net.IP) error
+
+	// Block until the next reply is received. Returns ErrClosed (or the underlying read error) once the
+	// prober has been closed.
+	Recv() (*Reply, error)
+
+	// Release the resources held by the prober and unblock any pending calls to Recv
+	Close() error
+}
+
+type Factory func() (Prober, error)
+
+var factory Factory = newFromConfig
+
+// Replace the function used to create new probers (ie: to scan with a FakeProber in tests)
+func SetFactory(newFactory Factory) {
+	factory = newFactory
+}
+
+// Restore the default, configuration-driven prober factory
+func ResetFactory() {
+	factory = newFromConfig
+}
+
+// Create a new prober using the currently-configured factory
+func New() (Prober, error) {
+	return factory()
+}
+
+// Whether an error returned when reading from a socket is transient and the read should be retried
+func isRetryableReadError(err error) bool {
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return true
+	}
+	nerr, ok := err.(*net.OpError)
+	return ok && nerr.Temporary()
+}
+
+func newFromConfig() (Prober, error) {
+	spec, err := ParseSpec(viper.GetString("ProbeType"))
+	if err != nil {
+		return nil, err
+	}
+	return NewFromSpec(spec)
+}
+
+func NewFromSpec(spec *Spec) (Prober, error) {
+	switch spec.Type {
+	case ProbeTypeTCPSyn:
+		return NewTCPSynProber(spec.Ports)
+	case ProbeTypeUDP:
+		return NewUDPProber(spec.Ports)
+	default:
+		return NewICMPProber()
+	}
+}
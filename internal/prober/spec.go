@@ -0,0 +1,74 @@
+package prober
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	ProbeTypeICMP   = "icmp"
+	ProbeTypeTCPSyn = "tcp-syn"
+	ProbeTypeUDP    = "udp"
+)
+
+// A parsed probe specification (ie: "icmp", "tcp-syn:22,80,443" or "udp:53,123")
+type Spec struct {
+	Type  string
+	Ports []uint16
+}
+
+func ParseSpec(toParse string) (*Spec, error) {
+	parts := strings.SplitN(strings.TrimSpace(toParse), ":", 2)
+	toReturn := &Spec{Type: strings.ToLower(parts[0])}
+	switch toReturn.Type {
+	case ProbeTypeICMP:
+		if len(parts) > 1 {
+			return nil, errors.New(fmt.Sprintf("Probe type '%s' does not accept any ports (got '%s').", ProbeTypeICMP, parts[1]))
+		}
+	case ProbeTypeTCPSyn:
+		if len(parts) == 1 || parts[1] == "" {
+			return nil, errors.New(fmt.Sprintf("Probe type '%s' requires a list of ports (ie: '%s:80,443').", ProbeTypeTCPSyn, ProbeTypeTCPSyn))
+		}
+		ports, err := parsePorts(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		toReturn.Ports = ports
+	case ProbeTypeUDP:
+		if len(parts) == 1 || parts[1] == "" {
+			toReturn.Ports = GetUDPProbePorts()
+			break
+		}
+		ports, err := parsePorts(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		for _, port := range ports {
+			if _, ok := udpProbes[port]; !ok {
+				return nil, errors.New(fmt.Sprintf("There is no UDP probe payload for port %d (supported ports are %v).", port, GetUDPProbePorts()))
+			}
+		}
+		toReturn.Ports = ports
+	default:
+		return nil, errors.New(fmt.Sprintf("'%s' is not a valid probe type (expected '%s', '%s:<ports>' or '%s[:<ports>]').", toParse, ProbeTypeICMP, ProbeTypeTCPSyn, ProbeTypeUDP))
+	}
+	return toReturn, nil
+}
+
+func parsePorts(toParse string) ([]uint16, error) {
+	var toReturn []uint16
+	seen := make(map[uint16]struct{})
+	for _, portString := range strings.Split(toParse, ",") {
+		port, err := strconv.ParseUint(strings.TrimSpace(portString), 10, 16)
+		if err != nil || port == 0 {
+			return nil, errors.New(fmt.Sprintf("'%s' is not a valid port number.", portString))
+		}
+		if _, ok := seen[uint16(port)]; !ok {
+			seen[uint16(port)] = struct{}{}
+			toReturn = append(toReturn, uint16(port))
+		}
+	}
+	return toReturn, nil
+}
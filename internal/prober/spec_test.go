@@ -0,0 +1,64 @@
+package prober
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseSpec_ICMP(t *testing.T) {
+	spec, err := ParseSpec("icmp")
+	assert.Nil(t, err)
+	assert.EqualValues(t, ProbeTypeICMP, spec.Type)
+	assert.Empty(t, spec.Ports)
+}
+
+func TestParseSpec_ICMPWithPortsFails(t *testing.T) {
+	_, err := ParseSpec("icmp:80")
+	assert.NotNil(t, err)
+}
+
+func TestParseSpec_TCPSyn(t *testing.T) {
+	spec, err := ParseSpec("tcp-syn:22, 80,443,80")
+	assert.Nil(t, err)
+	assert.EqualValues(t, ProbeTypeTCPSyn, spec.Type)
+	assert.EqualValues(t, []uint16{22, 80, 443}, spec.Ports)
+}
+
+func TestParseSpec_TCPSynNoPortsFails(t *testing.T) {
+	_, err := ParseSpec("tcp-syn")
+	assert.NotNil(t, err)
+	_, err = ParseSpec("tcp-syn:")
+	assert.NotNil(t, err)
+}
+
+func TestParseSpec_TCPSynBadPortFails(t *testing.T) {
+	_, err := ParseSpec("tcp-syn:80,65536")
+	assert.NotNil(t, err)
+	_, err = ParseSpec("tcp-syn:0")
+	assert.NotNil(t, err)
+	_, err = ParseSpec("tcp-syn:http")
+	assert.NotNil(t, err)
+}
+
+func TestParseSpec_UnknownTypeFails(t *testing.T) {
+	_, err := ParseSpec("carrier-pigeon")
+	assert.NotNil(t, err)
+}
+
+func TestParseSpec_UDPDefaultsToAllPorts(t *testing.T) {
+	spec, err := ParseSpec("udp")
+	assert.Nil(t, err)
+	assert.EqualValues(t, ProbeTypeUDP, spec.Type)
+	assert.EqualValues(t, []uint16{53, 123, 161, 500}, spec.Ports)
+}
+
+func TestParseSpec_UDPPorts(t *testing.T) {
+	spec, err := ParseSpec("udp:123,53")
+	assert.Nil(t, err)
+	assert.EqualValues(t, []uint16{123, 53}, spec.Ports)
+}
+
+func TestParseSpec_UDPUnsupportedPortFails(t *testing.T) {
+	_, err := ParseSpec("udp:53,80")
+	assert.NotNil(t, err)
+}
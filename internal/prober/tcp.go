@@ -0,0 +1,146 @@
+package prober
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/ekaley/ipv666/internal/logging"
+	"golang.org/x/net/ipv6"
+	"math/big"
+	"net"
+)
+
+const (
+	tcpHeaderLength   = 20
+	tcpChecksumOffset = 16
+	tcpFlagRST        = 0x04
+	tcpFlagSYN        = 0x02
+	tcpFlagACK        = 0x10
+	tcpSrcPortBase    = 32768
+	tcpSrcPortCount   = 28232
+)
+
+// Sends TCP SYN segments to a list of ports over a raw IPv6 socket. A target is considered live if it
+// responds to any of them with either a SYN-ACK or a RST.
+type TCPSynProber struct {
+	listener net.PacketConn
+	conn     *ipv6.PacketConn
+	ports    []uint16
+	srcPort  uint16
+	cookie   *Cookie
+	buff     []byte
+}
+
+func NewTCPSynProber(ports []uint16) (*TCPSynProber, error) {
+
+	// Instantiate raw TCP over IPv6 packet listener
+	listener, err := net.ListenPacket("ip6:6", "::")
+	if err != nil {
+		logging.Warnf("Error thrown when listening for IPv6 TCP packets: %s", err.Error())
+		return nil, err
+	}
+
+	// Have the kernel fill in the TCP checksum (it knows the source address for the pseudo-header)
+	conn := ipv6.NewPacketConn(listener)
+	if err := conn.SetChecksum(true, tcpChecksumOffset); err != nil {
+		logging.Warnf("Error thrown when enabling kernel TCP checksums: %s", err.Error())
+		listener.Close()
+		return nil, err
+	}
+
+	cookie, err := NewCookie()
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	// Like the cookie key, the source port comes from crypto/rand rather than the run's seeded source of
+	// randomness. Seeding a run makes the addresses it generates reproducible, but must never make it
+	// easier for someone else to guess the port and spoof replies.
+	srcPort, err := rand.Int(rand.Reader, big.NewInt(tcpSrcPortCount))
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	// The initial sequence number of each SYN is the target's cookie
+	return &TCPSynProber{
+		listener: listener,
+		conn:     conn,
+		ports:    ports,
+		srcPort:  uint16(tcpSrcPortBase + srcPort.Int64()),
+		cookie:   cookie,
+		buff:     make([]byte, 1500),
+	}, nil
+}
+
+func (p *TCPSynProber) Send(target net.IP) error {
+	var toReturn error
+	seq := p.cookie.Uint32(target)
+	for _, port := range p.ports {
+		syn := marshalTCPSyn(p.srcPort, port, seq)
+		_, err := p.conn.WriteTo(syn, nil, &net.IPAddr{IP: target})
+		if err != nil && toReturn == nil {
+			toReturn = err
+		}
+	}
+	return toReturn
+}
+
+func (p *TCPSynProber) Recv() (*Reply, error) {
+	for {
+
+		// Read the next TCP segment
+		rlen, _, raddr, rerr := p.conn.ReadFrom(p.buff)
+		if rerr != nil {
+			if isRetryableReadError(rerr) {
+				continue
+			}
+			return nil, rerr
+		}
+
+		// Raw sockets see all inbound TCP traffic, so only keep replies to our own probes
+		port, ack, ok := parseTCPSynReply(p.buff[:rlen], p.srcPort)
+		if !ok {
+			continue
+		}
+		addr := addrToIP(raddr)
+		if ack != p.cookie.Uint32(addr)+1 {
+			countInvalidReply()
+			continue
+		}
+
+		return &Reply{Addr: addr, Port: port}, nil
+	}
+}
+
+func (p *TCPSynProber) Close() error {
+	p.conn.Close()
+	return p.listener.Close()
+}
+
+func marshalTCPSyn(srcPort uint16, dstPort uint16, seq uint32) []byte {
+	segment := make([]byte, tcpHeaderLength)
+	binary.BigEndian.PutUint16(segment[0:2], srcPort)
+	binary.BigEndian.PutUint16(segment[2:4], dstPort)
+	binary.BigEndian.PutUint32(segment[4:8], seq)
+	segment[12] = (tcpHeaderLength / 4) << 4
+	segment[13] = tcpFlagSYN
+	binary.BigEndian.PutUint16(segment[14:16], 65535)
+	return segment
+}
+
+// Check whether a TCP segment is a SYN-ACK or RST sent to our source port, returning the port that it
+// came from and its acknowledgement number if so
+func parseTCPSynReply(segment []byte, srcPort uint16) (uint16, uint32, bool) {
+	if len(segment) < tcpHeaderLength {
+		return 0, 0, false
+	}
+	if binary.BigEndian.Uint16(segment[2:4]) != srcPort {
+		return 0, 0, false
+	}
+	flags := segment[13]
+	if flags&tcpFlagACK == 0 || flags&(tcpFlagSYN|tcpFlagRST) == 0 {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint16(segment[0:2]), binary.BigEndian.Uint32(segment[8:12]), true
+}
@@ -0,0 +1,51 @@
+package prober
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func getTCPReply(srcPort uint16, dstPort uint16, ack uint32, flags byte) []byte {
+	segment := marshalTCPSyn(srcPort, dstPort, 0)
+	segment[8] = byte(ack >> 24)
+	segment[9] = byte(ack >> 16)
+	segment[10] = byte(ack >> 8)
+	segment[11] = byte(ack)
+	segment[13] = flags
+	return segment
+}
+
+func TestMarshalTCPSyn(t *testing.T) {
+	segment := marshalTCPSyn(40000, 443, 0x01020304)
+	assert.Len(t, segment, tcpHeaderLength)
+	assert.EqualValues(t, []byte{0x9c, 0x40, 0x01, 0xbb}, segment[0:4])
+	assert.EqualValues(t, []byte{0x01, 0x02, 0x03, 0x04}, segment[4:8])
+	assert.EqualValues(t, 0x50, segment[12])
+	assert.EqualValues(t, tcpFlagSYN, segment[13])
+}
+
+func TestParseTCPSynReply_SynAck(t *testing.T) {
+	port, ack, ok := parseTCPSynReply(getTCPReply(443, 40000, 101, tcpFlagSYN|tcpFlagACK), 40000)
+	assert.True(t, ok)
+	assert.EqualValues(t, 443, port)
+	assert.EqualValues(t, 101, ack)
+}
+
+func TestParseTCPSynReply_Rst(t *testing.T) {
+	port, ack, ok := parseTCPSynReply(getTCPReply(22, 40000, 101, tcpFlagRST|tcpFlagACK), 40000)
+	assert.True(t, ok)
+	assert.EqualValues(t, 22, port)
+	assert.EqualValues(t, 101, ack)
+}
+
+func TestParseTCPSynReply_WrongPort(t *testing.T) {
+	_, _, ok := parseTCPSynReply(getTCPReply(443, 40001, 101, tcpFlagSYN|tcpFlagACK), 40000)
+	assert.False(t, ok)
+}
+
+func TestParseTCPSynReply_NotAReply(t *testing.T) {
+	_, _, ok := parseTCPSynReply(getTCPReply(443, 40000, 101, tcpFlagACK), 40000)
+	assert.False(t, ok)
+	_, _, ok = parseTCPSynReply([]byte{0x01, 0xbb}, 40000)
+	assert.False(t, ok)
+}
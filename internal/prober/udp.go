@@ -0,0 +1,411 @@
+package prober
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/ekaley/ipv666/internal/logging"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"net"
+	"sort"
+	"sync"
+)
+
+const (
+	ipv6HeaderLength     = 40
+	udpHeaderLength      = 8
+	udpProtocolNumber    = 17
+	icmpPortUnreachCode  = 4
+	udpReplyChannelDepth = 4096
+)
+
+// A probe for a specific UDP protocol. Part of the target's cookie is carried in a field of the payload
+// that the protocol echoes back, so replies can be checked against the probe that was sent.
+type udpProbe struct {
+	getPayload func(cookie []byte) []byte
+	checkReply func(reply []byte, cookie []byte) bool
+}
+
+var udpProbes = map[uint16]*udpProbe{
+	53:  {getDNSPayload, checkDNSReply},
+	123: {getNTPPayload, checkNTPReply},
+	161: {getSNMPPayload, checkSNMPReply},
+	500: {getIKEPayload, checkIKEReply},
+}
+
+func GetUDPProbePorts() []uint16 {
+	var toReturn []uint16
+	for port := range udpProbes {
+		toReturn = append(toReturn, port)
+	}
+	sort.Slice(toReturn, func(i, j int) bool { return toReturn[i] < toReturn[j] })
+	return toReturn
+}
+
+// A query for the NS records of the root zone, with the cookie as the query ID
+func getDNSPayload(cookie []byte) []byte {
+	payload := []byte{
+		0x00, 0x00, // ID
+		0x01, 0x00, // Flags (recursion desired)
+		0x00, 0x01, // Question count
+		0x00, 0x00, // Answer count
+		0x00, 0x00, // Authority count
+		0x00, 0x00, // Additional count
+		0x00,       // Root name
+		0x00, 0x02, // Type NS
+		0x00, 0x01, // Class IN
+	}
+	copy(payload[0:2], cookie[0:2])
+	return payload
+}
+
+func checkDNSReply(reply []byte, cookie []byte) bool {
+	return len(reply) >= 12 && bytes.Equal(reply[0:2], cookie[0:2]) && reply[2]&0x80 != 0
+}
+
+// An NTPv3 client request, with the cookie as the transmit timestamp
+func getNTPPayload(cookie []byte) []byte {
+	payload := make([]byte, 48)
+	payload[0] = 0x1b
+	copy(payload[40:48], cookie[0:8])
+	return payload
+}
+
+// Servers copy the transmit timestamp of the request into the originate timestamp of the reply
+func checkNTPReply(reply []byte, cookie []byte) bool {
+	return len(reply) >= 48 && bytes.Equal(reply[24:32], cookie[0:8])
+}
+
+func getSNMPRequestID(cookie []byte) uint32 {
+	return binary.BigEndian.Uint32(cookie[0:4]) & 0x7fffffff
+}
+
+// An SNMPv2c get-request for sysDescr.0 using the "public" community, with the cookie as the request ID
+func getSNMPPayload(cookie []byte) []byte {
+	payload := []byte{
+		0x30, 0x29, // Message
+		0x02, 0x01, 0x01, // Version (v2c)
+		0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c', // Community
+		0xa0, 0x1c, // Get-request PDU
+		0x02, 0x04, 0x00, 0x00, 0x00, 0x00, // Request ID
+		0x02, 0x01, 0x00, // Error status
+		0x02, 0x01, 0x00, // Error index
+		0x30, 0x0e, // Variable bindings
+		0x30, 0x0c, // Variable binding
+		0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, // 1.3.6.1.2.1.1.1.0
+		0x05, 0x00, // Null
+	}
+	binary.BigEndian.PutUint32(payload[17:21], getSNMPRequestID(cookie))
+	return payload
+}
+
+func checkSNMPReply(reply []byte, cookie []byte) bool {
+	tag, message, _, ok := readBER(reply)
+	if !ok || tag != 0x30 {
+		return false
+	}
+	for i := 0; i < 2; i++ { // Skip the version and community
+		_, _, message, ok = readBER(message)
+		if !ok {
+			return false
+		}
+	}
+	tag, pdu, _, ok := readBER(message)
+	if !ok || tag != 0xa2 {
+		return false
+	}
+	tag, requestID, _, ok := readBER(pdu)
+	if !ok || tag != 0x02 || len(requestID) == 0 || len(requestID) > 5 {
+		return false
+	}
+	var value uint32
+	for _, b := range requestID {
+		value = value<<8 | uint32(b)
+	}
+	return value == getSNMPRequestID(cookie)
+}
+
+// Read a single BER-encoded TLV, returning its tag, its value and whatever follows it
+func readBER(toParse []byte) (byte, []byte, []byte, bool) {
+	if len(toParse) < 2 {
+		return 0, nil, nil, false
+	}
+	tag := toParse[0]
+	length := int(toParse[1])
+	offset := 2
+	if length&0x80 != 0 {
+		lengthBytes := length & 0x7f
+		if lengthBytes == 0 || lengthBytes > 2 || len(toParse) < offset+lengthBytes {
+			return 0, nil, nil, false
+		}
+		length = 0
+		for _, b := range toParse[offset : offset+lengthBytes] {
+			length = length<<8 | int(b)
+		}
+		offset += lengthBytes
+	}
+	if len(toParse) < offset+length {
+		return 0, nil, nil, false
+	}
+	return tag, toParse[offset : offset+length], toParse[offset+length:], true
+}
+
+// An IKEv1 main mode request with a single proposal (3DES, SHA1, pre-shared key, MODP 1024), with the
+// cookie as the initiator cookie
+func getIKEPayload(cookie []byte) []byte {
+	payload := []byte{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Initiator cookie
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Responder cookie
+		0x01,                   // Next payload (SA)
+		0x10,                   // Version (1.0)
+		0x02,                   // Exchange type (main mode)
+		0x00,                   // Flags
+		0x00, 0x00, 0x00, 0x00, // Message ID
+		0x00, 0x00, 0x00, 0x50, // Length
+		0x00, 0x00, 0x00, 0x34, // SA payload header
+		0x00, 0x00, 0x00, 0x01, // DOI (IPsec)
+		0x00, 0x00, 0x00, 0x01, // Situation (identity only)
+		0x00, 0x00, 0x00, 0x28, // Proposal payload header
+		0x01, 0x01, 0x00, 0x01, // Proposal 1, ISAKMP, no SPI, 1 transform
+		0x00, 0x00, 0x00, 0x20, // Transform payload header
+		0x01, 0x01, 0x00, 0x00, // Transform 1, KEY_IKE
+		0x80, 0x01, 0x00, 0x05, // Encryption (3DES)
+		0x80, 0x02, 0x00, 0x02, // Hash (SHA1)
+		0x80, 0x03, 0x00, 0x01, // Authentication (pre-shared key)
+		0x80, 0x04, 0x00, 0x02, // Group (MODP 1024)
+		0x80, 0x0b, 0x00, 0x01, // Life type (seconds)
+		0x80, 0x0c, 0x70, 0x80, // Life duration (28800)
+	}
+	copy(payload[0:8], cookie[0:8])
+	return payload
+}
+
+func checkIKEReply(reply []byte, cookie []byte) bool {
+	return len(reply) >= 28 && bytes.Equal(reply[0:8], cookie[0:8])
+}
+
+// Sends protocol-specific UDP payloads to a list of ports. A target is considered live if it either
+// responds over UDP or sends back an ICMPv6 port unreachable error.
+type UDPProber struct {
+	conn         net.PacketConn
+	icmpListener net.PacketConn
+	icmpConn     *ipv6.PacketConn
+	probes       map[uint16]*udpProbe
+	cookie       *Cookie
+	localPort    uint16
+	replies      chan *Reply
+	errs         chan error
+	closed       chan struct{}
+	closeOnce    sync.Once
+	wg           sync.WaitGroup
+}
+
+func NewUDPProber(ports []uint16) (*UDPProber, error) {
+
+	probes := make(map[uint16]*udpProbe)
+	for _, port := range ports {
+		probe, ok := udpProbes[port]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("There is no UDP probe payload for port %d.", port))
+		}
+		probes[port] = probe
+	}
+	cookie, err := NewCookie()
+	if err != nil {
+		return nil, err
+	}
+
+	// Instantiate the UDP socket that probes are sent from and replies are received on
+	conn, err := net.ListenPacket("udp6", "[::]:0")
+	if err != nil {
+		logging.Warnf("Error thrown when listening for IPv6 UDP packets: %s", err.Error())
+		return nil, err
+	}
+
+	// Instantiate ICMPv6 packet listener for port unreachable and routing errors
+	icmpListener, err := net.ListenPacket("ip6:58", "::")
+	if err != nil {
+		logging.Warnf("Error thrown when listening for IPv6 packets: %s", err.Error())
+		conn.Close()
+		return nil, err
+	}
+	icmpConn := ipv6.NewPacketConn(icmpListener)
+	var filter ipv6.ICMPFilter
+	filter.SetAll(true)
+	acceptICMPErrors(&filter)
+	if err := icmpConn.SetICMPFilter(&filter); err != nil {
+		logging.Warnf("Error thrown when setting ICMP filter: %s", err.Error())
+		icmpListener.Close()
+		conn.Close()
+		return nil, err
+	}
+
+	toReturn := &UDPProber{
+		conn:         conn,
+		icmpListener: icmpListener,
+		icmpConn:     icmpConn,
+		probes:       probes,
+		cookie:       cookie,
+		localPort:    uint16(conn.LocalAddr().(*net.UDPAddr).Port),
+		replies:      make(chan *Reply, udpReplyChannelDepth),
+		errs:         make(chan error, 2),
+		closed:       make(chan struct{}),
+	}
+	// Kick off the receive processors
+	toReturn.wg.Add(2)
+	go toReturn.receiveUDP()
+	go toReturn.receiveICMP()
+
+	return toReturn, nil
+}
+
+func (p *UDPProber) Send(target net.IP) error {
+	var toReturn error
+	cookie := p.cookie.Sum(target)
+	for port, probe := range p.probes {
+		_, err := p.conn.WriteTo(probe.getPayload(cookie), &net.UDPAddr{IP: target, Port: int(port)})
+		if err != nil && toReturn == nil {
+			toReturn = err
+		}
+	}
+	return toReturn
+}
+
+func (p *UDPProber) Recv() (*Reply, error) {
+	select {
+	case reply := <-p.replies:
+		return reply, nil
+	case err := <-p.errs:
+		return nil, err
+	case <-p.closed:
+		return nil, ErrClosed
+	}
+}
+
+func (p *UDPProber) Close() error {
+	var toReturn error
+	p.closeOnce.Do(func() {
+		close(p.closed)
+		p.icmpConn.Close()
+		toReturn = p.conn.Close()
+	})
+	p.wg.Wait()
+	return toReturn
+}
+
+func (p *UDPProber) emit(reply *Reply) {
+	select {
+	case p.replies <- reply:
+	case <-p.closed:
+	}
+}
+
+func (p *UDPProber) fail(err error) {
+	select {
+	case <-p.closed:
+	default:
+		p.errs <- err
+	}
+}
+
+func (p *UDPProber) receiveUDP() {
+	defer p.wg.Done()
+	buff := make([]byte, 1500)
+	for {
+		rlen, raddr, err := p.conn.ReadFrom(buff)
+		if err != nil {
+			if isRetryableReadError(err) {
+				continue
+			}
+			p.fail(err)
+			return
+		}
+		udpAddr, ok := raddr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		probe, ok := p.probes[uint16(udpAddr.Port)]
+		if !ok {
+			continue
+		}
+		if !probe.checkReply(buff[:rlen], p.cookie.Sum(udpAddr.IP)) {
+			countInvalidReply()
+			continue
+		}
+		p.emit(&Reply{Addr: udpAddr.IP, Port: uint16(udpAddr.Port)})
+	}
+}
+
+func (p *UDPProber) receiveICMP() {
+	defer p.wg.Done()
+	buff := make([]byte, 1500)
+	for {
+		rlen, _, raddr, err := p.icmpConn.ReadFrom(buff)
+		if err != nil {
+			if isRetryableReadError(err) {
+				continue
+			}
+			p.fail(err)
+			return
+		}
+		message, err := icmp.ParseMessage(icmpProtocolNumber, buff[:rlen])
+		if err != nil {
+			logging.Warnf("Error thrown when parsing ICMP message from %s: %s", raddr, err)
+			continue
+		}
+		router := addrToIP(raddr)
+		reply, quoted, ok := parseICMPError(message, router)
+		if !ok {
+			continue
+		}
+		_, port, ok := parseQuotedUDPProbe(quoted, p.localPort)
+		if !ok {
+			continue
+		}
+		probe, ok := p.probes[port]
+		if !ok {
+			continue
+		}
+
+		// Whatever part of the payload was quoted must match the probe that was sent to the target
+		quotedPayload := quoted[ipv6HeaderLength+udpHeaderLength:]
+		sentPayload := probe.getPayload(p.cookie.Sum(reply.Addr))
+		checkLength := len(quotedPayload)
+		if checkLength > len(sentPayload) {
+			checkLength = len(sentPayload)
+		}
+		if checkLength == 0 || !bytes.Equal(quotedPayload[:checkLength], sentPayload[:checkLength]) {
+			countInvalidReply()
+			continue
+		}
+		reply.Port = port
+
+		// Only the target itself reporting that the port is closed proves that the target is live
+		if reply.Kind == ReplyUnreachable && reply.Code == icmpPortUnreachCode && reply.Addr.Equal(router) {
+			reply.Kind = ReplyLive
+			reply.Code = 0
+			reply.Router = nil
+		}
+		p.emit(reply)
+	}
+}
+
+// Pull the original destination address and port out of the datagram quoted in an ICMPv6 error message,
+// provided that the datagram was a UDP probe sent from the given local port
+func parseQuotedUDPProbe(quoted []byte, localPort uint16) (net.IP, uint16, bool) {
+	if len(quoted) < ipv6HeaderLength+udpHeaderLength {
+		return nil, 0, false
+	}
+	if quoted[ipv6NextHeaderOffset] != udpProtocolNumber {
+		return nil, 0, false
+	}
+	udpHeader := quoted[ipv6HeaderLength:]
+	if binary.BigEndian.Uint16(udpHeader[0:2]) != localPort {
+		return nil, 0, false
+	}
+	target := make(net.IP, net.IPv6len)
+	copy(target, quoted[ipv6DestinationOffset:ipv6DestinationOffset+net.IPv6len])
+	return target, binary.BigEndian.Uint16(udpHeader[2:4]), true
+}
@@ -0,0 +1,111 @@
+package prober
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func getQuotedUDPDatagram(target net.IP, srcPort uint16, dstPort uint16, nextHeader byte) []byte {
+	quoted := make([]byte, ipv6HeaderLength+udpHeaderLength)
+	quoted[0] = 0x60
+	quoted[6] = nextHeader
+	copy(quoted[24:40], target.To16())
+	binary.BigEndian.PutUint16(quoted[40:42], srcPort)
+	binary.BigEndian.PutUint16(quoted[42:44], dstPort)
+	return quoted
+}
+
+func TestParseQuotedUDPProbe(t *testing.T) {
+	target := net.ParseIP("2600::1")
+	addr, port, ok := parseQuotedUDPProbe(getQuotedUDPDatagram(target, 40000, 161, udpProtocolNumber), 40000)
+	assert.True(t, ok)
+	assert.True(t, target.Equal(addr))
+	assert.EqualValues(t, 161, port)
+}
+
+func TestParseQuotedUDPProbe_WrongLocalPort(t *testing.T) {
+	target := net.ParseIP("2600::1")
+	_, _, ok := parseQuotedUDPProbe(getQuotedUDPDatagram(target, 40001, 161, udpProtocolNumber), 40000)
+	assert.False(t, ok)
+}
+
+func TestParseQuotedUDPProbe_NotUDP(t *testing.T) {
+	target := net.ParseIP("2600::1")
+	_, _, ok := parseQuotedUDPProbe(getQuotedUDPDatagram(target, 40000, 161, 6), 40000)
+	assert.False(t, ok)
+}
+
+func TestParseQuotedUDPProbe_Truncated(t *testing.T) {
+	_, _, ok := parseQuotedUDPProbe(make([]byte, ipv6HeaderLength), 40000)
+	assert.False(t, ok)
+}
+
+var testCookie = NewCookieFromKey([]byte("0123456789abcdef")).Sum(net.ParseIP("2600::1"))
+
+func TestGetSNMPPayload_LengthsMatch(t *testing.T) {
+	payload := getSNMPPayload(testCookie)
+	assert.EqualValues(t, len(payload)-2, payload[1])
+	assert.EqualValues(t, len(payload)-15, payload[14])
+}
+
+func TestGetIKEPayload_LengthsMatch(t *testing.T) {
+	payload := getIKEPayload(testCookie)
+	assert.EqualValues(t, len(payload), binary.BigEndian.Uint32(payload[24:28]))
+	assert.EqualValues(t, len(payload)-28, binary.BigEndian.Uint16(payload[30:32]))
+}
+
+func TestCheckDNSReply(t *testing.T) {
+	reply := getDNSPayload(testCookie)
+	reply[2] |= 0x80
+	assert.True(t, checkDNSReply(reply, testCookie))
+	reply[0] ^= 0xff
+	assert.False(t, checkDNSReply(reply, testCookie))
+}
+
+func TestCheckDNSReply_NotAResponse(t *testing.T) {
+	assert.False(t, checkDNSReply(getDNSPayload(testCookie), testCookie))
+}
+
+func TestCheckNTPReply(t *testing.T) {
+	request := getNTPPayload(testCookie)
+	reply := make([]byte, 48)
+	reply[0] = 0x1c
+	copy(reply[24:32], request[40:48])
+	assert.True(t, checkNTPReply(reply, testCookie))
+	assert.False(t, checkNTPReply(reply[:40], testCookie))
+	reply[24] ^= 0xff
+	assert.False(t, checkNTPReply(reply, testCookie))
+}
+
+func TestCheckSNMPReply(t *testing.T) {
+	reply := getSNMPPayload(testCookie)
+	reply[13] = 0xa2
+	assert.True(t, checkSNMPReply(reply, testCookie))
+	reply[20] ^= 0x01
+	assert.False(t, checkSNMPReply(reply, testCookie))
+}
+
+func TestCheckSNMPReply_NotAResponse(t *testing.T) {
+	assert.False(t, checkSNMPReply(getSNMPPayload(testCookie), testCookie))
+	assert.False(t, checkSNMPReply([]byte{0x30, 0x05, 0x02}, testCookie))
+}
+
+func TestCheckIKEReply(t *testing.T) {
+	reply := getIKEPayload(testCookie)
+	assert.True(t, checkIKEReply(reply, testCookie))
+	reply[0] ^= 0xff
+	assert.False(t, checkIKEReply(reply, testCookie))
+}
+
+func TestReadBER_LongFormLength(t *testing.T) {
+	value := make([]byte, 200)
+	encoded := append([]byte{0x04, 0x81, 200}, value...)
+	encoded = append(encoded, 0x05, 0x00)
+	tag, parsed, rest, ok := readBER(encoded)
+	assert.True(t, ok)
+	assert.EqualValues(t, 0x04, tag)
+	assert.Len(t, parsed, 200)
+	assert.EqualValues(t, []byte{0x05, 0x00}, rest)
+}
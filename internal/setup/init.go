@@ -2,12 +2,17 @@ package setup
 
 import (
 	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/data"
 	"github.com/ekaley/ipv666/internal/fs"
 	"github.com/ekaley/ipv666/internal/logging"
-	"github.com/ekaley/ipv666/internal/statemachine"
-	"os"
+	"github.com/spf13/viper"
+	"path/filepath"
 )
 
+// The names of the files that earlier versions kept the current state and target network in
+const legacyStateFileName = "state.bin"
+const legacyTargetNetworkFileName = "network.bin"
+
 func InitFilesystem() error {
 	logging.Debug("Now initializing filesystem...")
 	for _, dirPath := range config.GetAllDirectories() {
@@ -16,15 +21,10 @@ func InitFilesystem() error {
 			return err
 		}
 	}
-	logging.Debugf("Initializing state file at '%s'.", config.GetStateFilePath())
-	if _, err := os.Stat(config.GetStateFilePath()); os.IsNotExist(err) {
-		logging.Debugf("State file does not exist at path '%s'. Creating now.", config.GetStateFilePath())
-		err = statemachine.InitStateFile(config.GetStateFilePath())
-		if err != nil {
-			return err
-		}
-	} else {
-		logging.Debugf("State file already exists at path '%s'.", config.GetStateFilePath())
+	baseDir := viper.GetString("BaseOutputDirectory")
+	err := data.MigrateLegacyStateFiles(filepath.Join(baseDir, legacyStateFileName), filepath.Join(baseDir, legacyTargetNetworkFileName))
+	if err != nil {
+		return err
 	}
 	logging.Debug("Local filesystem initialized.")
 	return nil
@@ -1,13 +1,16 @@
 package statemachine
 
 import (
+	"context"
 	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/blacklist"
 	"github.com/ekaley/ipv666/internal/config"
 	"github.com/ekaley/ipv666/internal/data"
 	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/modeling"
 	"github.com/rcrowley/go-metrics"
 	"github.com/spf13/viper"
-	"net"
+	"math/rand"
 	"time"
 
 	"errors"
@@ -15,83 +18,197 @@ import (
 	"github.com/ekaley/ipv666/internal/filtering"
 	"github.com/ekaley/ipv666/internal/fs"
 	bloom2 "github.com/willf/bloom"
+	"net"
 	"os"
 )
 
 var generateDurationTimer = metrics.NewTimer()
 var generateBlacklistCount = metrics.NewCounter()
 var generateBloomCount = metrics.NewCounter()
+var generateUnroutedCount = metrics.NewCounter()
 var generateWriteTimer = metrics.NewTimer()
 var bloomWriteTimer = metrics.NewTimer()
 var bloomEmptyCount = metrics.NewCounter()
 
+// Stops generation in a target network once too many of its candidates have been rejected as unrouted,
+// which happens when most of the network sits within unrouted networks
+var errTooManyUnrouted = errors.New("too many candidate addresses were rejected as unrouted")
+
 func init() {
 	metrics.Register("addrgen.generate_duration.time", generateDurationTimer)
 	metrics.Register("addrgen.generate_blacklist.count", generateBlacklistCount)
 	metrics.Register("addrgen.generate_bloom.count", generateBloomCount)
+	metrics.Register("addrgen.generate_unrouted.count", generateUnroutedCount)
 	metrics.Register("addrgen.candidate_write.time", generateWriteTimer)
 	metrics.Register("addrgen.bloom_write.time", bloomWriteTimer)
 	metrics.Register("addrgen.bloom_empty.count", bloomEmptyCount)
 }
 
-func generateCandidateAddresses() error {
+func generateCandidateAddresses(ctx context.Context, random *rand.Rand) error {
 
-	// Load the statistical model, blacklist, and bloom filter
+	// Load the candidate generator, target networks, and their blacklists
 
-	model, err := data.GetProbabilisticClusterModel()
+	generator, err := getCandidateGenerator()
+	if err != nil {
+		return err
+	}
+	unrouted, err := getUnroutedNetworks()
+	if err != nil {
+		return err
+	}
+	targetNetworks, err := config.GetTargetNetworks()
 	if err != nil {
 		return err
 	}
-	blacklist, err := data.GetBlacklist()
+	blacklists, err := data.GetTargetBlacklists(targetNetworks)
+	if err != nil {
+		return err
+	}
+
+	var scanTargets []*config.TargetNetwork
+	for _, target := range targetNetworks {
+		if blacklist := blacklists[target]; blacklist.IsNetworkBlacklisted(target.Network) {
+			blacklistNet := blacklist.GetBlacklistingNetworkFromNetwork(target.Network)
+			logging.Warnf("The target network range (%s) is blacklisted (blacklisting network of %s). Skipping it.", target, blacklistNet)
+			continue
+		} else if unrouted.IsNetworkBlacklisted(target.Network) {
+			unroutedNet := unrouted.GetBlacklistingNetworkFromNetwork(target.Network)
+			logging.Warnf("The target network range (%s) is unrouted (unrouted network of %s). Skipping it.", target, unroutedNet)
+			continue
+		}
+		scanTargets = append(scanTargets, target)
+	}
+	if len(scanTargets) == 0 {
+		return errors.New(fmt.Sprintf("All %d of the target network ranges are blacklisted or unrouted.", len(targetNetworks)))
+	}
+
+	// Split the addresses to generate between the target networks
+
+	stats, err := data.GetTargetStats()
 	if err != nil {
 		return err
 	}
-	bloom, err := data.GetBloomFilter()
+	budgets := getTargetBudgets(scanTargets, stats, viper.GetInt("GenerateAddressCount"))
+	regionStats, err := data.GetRegionStats()
 	if err != nil {
 		return err
 	}
-	targetNetwork, err := config.GetTargetNetwork()
+	regionExploitedGauge.Update(0)
+
+	// Candidates are written to disk as they are generated rather than held in memory
+
+	outputPath := fs.GetTimedFilePath(config.GetCandidateAddressDirPath())
+	logging.Debugf("Writing results of candidate address generation to file at '%s'.", outputPath)
+	writer, err := fs.NewHexIPWriter(outputPath)
 	if err != nil {
 		return err
 	}
+	defer writer.Close()
+	data.RecordFile(outputPath)
+
+	start := time.Now()
+	var writeElapsed time.Duration
+	for i, target := range scanTargets {
+		if budgets[i] == 0 {
+			logging.Infof("Target network %s was given no addresses to generate this round.", target)
+			continue
+		}
+		elapsed, err := generateCandidateAddressesForTarget(ctx, random, generator, blacklists[target], unrouted, regionStats, target.Network, budgets[i], writer)
+		if err != nil {
+			return err
+		}
+		writeElapsed += elapsed
+	}
+	logging.Infof("Took a total of %s to generate %d candidate addresses across %d target networks.", time.Since(start), writer.GetCount(), len(scanTargets))
+
+	// Finish writing the addresses
 
-	if blacklist.IsNetworkBlacklisted(targetNetwork) {
-		blacklistNet := blacklist.GetBlacklistingNetworkFromNetwork(targetNetwork)
-		return errors.New(fmt.Sprintf("The target network range (%s) is blaclisted (blacklisting network of %s).", targetNetwork, blacklistNet))
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+	generateWriteTimer.Update(writeElapsed)
+	logging.Debugf("It took a total of %s to write %d addresses to file.", writeElapsed, writer.GetCount())
+	return nil
+
+}
+
+// Get the generator configured by CandidateGenerator. Seeded generators need addresses to be built from,
+// so the cluster model is used in their place until some have been discovered.
+func getCandidateGenerator() (modeling.Generator, error) {
+	generatorType := viper.GetString("CandidateGenerator")
+	if modeling.IsSeededGeneratorType(generatorType) {
+		seeds, err := data.GetGeneratorSeeds()
+		if err != nil {
+			return nil, err
+		} else if len(seeds) > 0 {
+			return modeling.CreateGeneratorFromSeeds(generatorType, seeds)
+		}
+		logging.Warnf("No seed addresses are available to build the %s generator from yet. Generating candidates with the cluster model instead.", generatorType)
+	}
+	return data.GetProbabilisticClusterModel()
+}
+
+// Generate addresses within a single target network, favoring its productive regions, filtering out ones
+// that are blacklisted or exist in the target network's Bloom filter, and write them to the candidates
+// writer. Returns the time spent writing candidates.
+func generateCandidateAddressesForTarget(ctx context.Context, random *rand.Rand, generator modeling.Generator, blacklist blacklist.Blacklists, unrouted *blacklist.NetworkBlacklist, regionStats map[string]*data.HitStats, targetNetwork *net.IPNet, count int, writer *fs.IPWriter) (time.Duration, error) {
+
+	bloom, err := data.GetBloomFilter(targetNetwork)
+	if err != nil {
+		return 0, err
 	}
 
 	// Generate all of the addresses and filter out based on Bloom filter and blacklist
 
 	logging.Infof(
-		"Generating a total of %d addresses based on the content of cluster model. Network range is %s.",
-		viper.GetInt("GenerateAddressCount"),
+		"Generating a total of %d addresses with the %s generator. Network range is %s.",
+		count,
+		viper.GetString("CandidateGenerator"),
 		targetNetwork,
 	)
-	var addresses []*net.IP
-	var blacklistCount, totalBloomCount, curBloomCount, madeCount = 0, 0, 0, 0
-	var bloomEmptyThreshold = int(viper.GetFloat64("BloomEmptyMultiple") * float64(viper.GetInt("GenerateAddressCount")))
+	var writeElapsed time.Duration
+
+	var blacklistCount, unroutedCount, totalBloomCount, curBloomCount, madeCount = 0, 0, 0, 0, 0
+	var bloomEmptyThreshold = int(viper.GetFloat64("BloomEmptyMultiple") * float64(count))
+	var unroutedThreshold = int(viper.GetFloat64("UnroutedRejectMultiple") * float64(count))
+	firstCandidate := writer.GetCount()
 
-	addrProcessFunc := func(toCheck *net.IP) (bool, error) {
-		ipBytes := ([]byte)(*toCheck)
+	addrProcessFunc := func(toCheck addressing.IPv6) (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		ipBytes := toCheck.Bytes()
 		var toReturn bool
 		if blacklist.IsIPBlacklisted(toCheck) {
 			blacklistCount++
 			toReturn = true
-		} else if bloom.Test(ipBytes) {
+		} else if unrouted.IsIPBlacklisted(toCheck) {
+			unroutedCount++
+			if unroutedCount >= unroutedThreshold {
+				return false, errTooManyUnrouted
+			}
+			toReturn = true
+		} else if bloom.Test(ipBytes[:]) {
 			curBloomCount++
 			totalBloomCount++
 			toReturn = true
 		} else {
 			madeCount++
-			bloom.Add(ipBytes)
+			bloom.Add(ipBytes[:])
+			writeStart := time.Now()
+			if err := writer.Write(toCheck); err != nil {
+				return false, err
+			}
+			writeElapsed += time.Since(writeStart)
 			toReturn = false
 		}
-		if (madeCount+blacklistCount+totalBloomCount)%viper.GetInt("LogLoopEmitFreq") == 0 {
-			logging.Infof("Generated %d total addresses, %d have been valid, %d have been blacklisted, %d exist in Bloom filter.", madeCount+blacklistCount+totalBloomCount, madeCount, blacklistCount, totalBloomCount)
+		if (madeCount+blacklistCount+unroutedCount+totalBloomCount)%viper.GetInt("LogLoopEmitFreq") == 0 {
+			logging.Infof("Generated %d total addresses, %d have been valid, %d have been blacklisted, %d have been unrouted, %d exist in Bloom filter.", madeCount+blacklistCount+unroutedCount+totalBloomCount, madeCount, blacklistCount, unroutedCount, totalBloomCount)
 		}
 		if curBloomCount >= bloomEmptyThreshold {
 			logging.Infof("Bloom filter rejection rate currently exceeds threshold of %d (%d rejected). Emptying and recreating.", bloomEmptyThreshold, curBloomCount)
-			bloom, err = remakeBloomFilter(addresses)
+			bloom, err = remakeBloomFilter(targetNetwork, writer, firstCandidate)
 			if err != nil {
 				logging.Warnf("Error thrown when remaking Bloom filter: %e", err)
 				return false, err
@@ -102,56 +219,59 @@ func generateCandidateAddresses() error {
 		return toReturn, nil
 	}
 
-	start := time.Now()
-	targetNetwork, err = config.GetTargetNetwork()
-	if err != nil {
-		logging.Warnf("Error thrown when getting target network from config: %e", err)
-		return err
+	// Regions that every address would be filtered out of are never exploited, as generation would not end
+	skipRegion := func(region *net.IPNet) bool {
+		return blacklist.IsNetworkBlacklisted(region) || unrouted.IsNetworkBlacklisted(region)
 	}
-	addresses, err = model.GenerateAddressesFromNetworkWithCallback(viper.GetInt("GenerateAddressCount"), viper.GetFloat64("ModelGenerationJitter"), targetNetwork, addrProcessFunc)
-	if err != nil {
-		logging.Warnf("Error thrown when generating multiple IP addresses for network %s: %e", targetNetwork, err)
-		return err
+	regionBudgets := getRegionBudgets(targetNetwork, regionStats, count, skipRegion)
+	regionExploreCount.Inc(int64(regionBudgets[0].count))
+	regionExploitCount.Inc(int64(count - regionBudgets[0].count))
+	regionExploitedGauge.Update(regionExploitedGauge.Value() + int64(len(regionBudgets)-1))
+
+	start := time.Now()
+	for _, regionBudget := range regionBudgets {
+		err = generator.GenerateAddressesFromNetworkWithCallback(random, regionBudget.count, viper.GetFloat64("ModelGenerationJitter"), regionBudget.network, addrProcessFunc)
+		if err == errTooManyUnrouted {
+			logging.Warnf("Rejected %d addresses in %s as unrouted. Giving up on generating the rest of its %d addresses this round.", unroutedCount, targetNetwork, count-madeCount)
+			break
+		} else if err != nil {
+			logging.Warnf("Error thrown when generating multiple IP addresses for network %s: %e", regionBudget.network, err)
+			return 0, err
+		}
 	}
 	elapsed := time.Since(start)
 	generateDurationTimer.Update(elapsed)
 	generateBlacklistCount.Inc(int64(blacklistCount))
 	generateBloomCount.Inc(int64(totalBloomCount))
-	logging.Infof("Took a total of %s to generate %d candidate addresses (%d blacklisted filtered out, %d existed in Bloom filter).", elapsed, viper.GetInt("GenerateAddressCount"), blacklistCount, totalBloomCount)
+	generateUnroutedCount.Inc(int64(unroutedCount))
+	logging.Infof("Took a total of %s to generate %d candidate addresses in %s (%d blacklisted filtered out, %d unrouted filtered out, %d existed in Bloom filter).", elapsed, count, targetNetwork, blacklistCount, unroutedCount, totalBloomCount)
 
-	// Write addresses and Bloom filter to disk and update data manager to point to in-memory references
+	// Write the Bloom filter to disk and update data manager to point to the in-memory reference
 
-	outputPath := fs.GetTimedFilePath(config.GetCandidateAddressDirPath())
-	logging.Debugf("Writing results of candidate address generation to file at '%s'.", outputPath)
-	start = time.Now()
-	err = addressing.WriteIPsToHexFile(outputPath, addresses)
-	if err != nil {
-		return err
-	}
-	elapsed = time.Since(start)
-	generateWriteTimer.Update(elapsed)
-	logging.Debugf("It took a total of %s to write %d addresses to file.", elapsed, len(addresses))
-	outputPath = fs.GetTimedFilePath(config.GetBloomDirPath())
+	outputPath := fs.GetTimedFilePath(config.GetBloomDirPathForTarget(targetNetwork))
 	logging.Debugf("Writing current state of Bloom filter to file at '%s'.", outputPath)
 	start = time.Now()
 	err = filtering.WriteBloomFilterToFile(outputPath, bloom)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	elapsed = time.Since(start)
 	bloomWriteTimer.Update(elapsed)
-	data.UpdateBloomFilter(bloom, outputPath)
+	data.UpdateBloomFilter(targetNetwork, bloom, outputPath)
 	logging.Debugf("It took a total of %s to write Bloom filter to file '%s'.", elapsed, outputPath)
-	return nil
+	return writeElapsed, nil
 
 }
 
-func remakeBloomFilter(existingAddrs []*net.IP) (*bloom2.BloomFilter, error) {
+// Create a new Bloom filter for the target network from the output file (if any) and the candidates
+// written so far for the target network in this batch (the ones from the given index on), which are read
+// back from disk
+func remakeBloomFilter(targetNetwork *net.IPNet, candidates *fs.IPWriter, firstCandidate int) (*bloom2.BloomFilter, error) {
 	logging.Debugf("Creating new Bloom filter with %d entries and %d hashes.", viper.GetInt("AddressFilterSize"), viper.GetInt("AddressFilterHashCount"))
 	var filter *bloom2.BloomFilter
 	if _, err := os.Stat(config.GetOutputFilePath()); !os.IsNotExist(err) {
 		logging.Debugf("Output file at path '%s' exists. Creating new Bloom filter from its contents.", config.GetOutputFilePath())
-		filter, err = data.LoadBloomFilterFromOutput()
+		filter, err = data.LoadBloomFilterFromOutput(targetNetwork)
 		if err != nil {
 			return nil, err
 		}
@@ -159,11 +279,23 @@ func remakeBloomFilter(existingAddrs []*net.IP) (*bloom2.BloomFilter, error) {
 		logging.Debugf("No output file found at path '%s'. Starting a new Bloom filter from scratch.", config.GetOutputFilePath())
 		filter = filtering.NewFromConfig()
 	}
-	logging.Debugf("Updating Bloom filter with %d existing addresses.", len(existingAddrs))
-	for _, ip := range existingAddrs {
-		ipBytes := ([]byte)(*ip)
-		filter.Add(ipBytes)
+	err := candidates.Flush()
+	if err != nil {
+		return nil, err
+	}
+	logging.Debugf("Updating Bloom filter with %d existing addresses.", candidates.GetCount()-firstCandidate)
+	index := 0
+	err = fs.ForEachIPInHexFile(candidates.GetPath(), func(ip addressing.IPv6) error {
+		if index >= firstCandidate {
+			ipBytes := ip.Bytes()
+			filter.Add(ipBytes[:])
+		}
+		index++
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	logging.Debugf("Successfully created new Bloom filter and added %d existing addresses.", len(existingAddrs))
+	logging.Debugf("Successfully created new Bloom filter and added %d existing addresses.", candidates.GetCount()-firstCandidate)
 	return filter, nil
 }
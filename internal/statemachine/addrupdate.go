@@ -3,8 +3,10 @@ package statemachine
 import (
 	"bufio"
 	"fmt"
+	"github.com/ekaley/ipv666/internal/addressing"
 	"github.com/ekaley/ipv666/internal/config"
 	"github.com/ekaley/ipv666/internal/data"
+	"github.com/ekaley/ipv666/internal/fs"
 	"github.com/ekaley/ipv666/internal/logging"
 	"github.com/ekaley/ipv666/internal/sync"
 	"github.com/rcrowley/go-metrics"
@@ -13,6 +15,9 @@ import (
 	"time"
 )
 
+// The maximum number of addresses to hold in memory before syncing them
+const syncBatchSize = 10000
+
 var addressUpdateTimer = metrics.NewTimer()
 
 func init() {
@@ -20,40 +25,55 @@ func init() {
 }
 
 func updateAddressFile() error {
-	cleanPings, err := data.GetCleanPingResults()
-	if err != nil {
-		return err
-	}
 	//TODO don't write addresses in input file in output file
 	outputPath := config.GetOutputFilePath()
-	logging.Infof("Updating file at path '%s' with %d newly-found IP addresses.", outputPath, len(cleanPings))
+	logging.Infof("Updating file at path '%s' with newly-found IP addresses.", outputPath)
 	file, err := os.OpenFile(outputPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-	writer := bufio.NewWriter(file)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
+	writer := bufio.NewWriter(file)
 	start := time.Now()
-	if viper.GetString("OutputFileType") != "bin" {
-		if !(viper.GetString("OutputFileType") == "txt") { //TODO figure out why the != check fails but this works
-			logging.Warnf("Unexpected file format for output (%s). Defaulting to text.", viper.GetString("OutputFileType"))
-		}
-		for _, addr := range cleanPings {
+	binary := viper.GetString("OutputFileType") == "bin"
+	if !binary && !(viper.GetString("OutputFileType") == "txt") { //TODO figure out why the != check fails but this works
+		logging.Warnf("Unexpected file format for output (%s). Defaulting to text.", viper.GetString("OutputFileType"))
+	}
+	if info, err := file.Stat(); binary && err == nil && info.Size() == 0 {
+		binaryFormat, _ := fs.GetInputFormat(fs.BinaryFormat)
+		writer.Write(binaryFormat.Magic) // So that the file is never mistaken for another format when read back
+	}
+
+	// Stream the clean ping results into the output file, syncing them in batches along the way
+	var toSync []addressing.IPv6
+	count := 0
+	err = data.ForEachCleanPingResult(func(addr addressing.IPv6) error {
+		count++
+		if binary {
+			addrBytes := addr.Bytes()
+			writer.Write(addrBytes[:])
+		} else {
 			writer.WriteString(fmt.Sprintf("%s\n", addr))
 		}
-	} else {
-		for _, addr := range cleanPings {
-			toWrite := ([]byte)(*addr)
-			writer.Write(toWrite)
+		if viper.GetBool("CloudSyncOptIn") {
+			toSync = append(toSync, addr)
+			if len(toSync) >= syncBatchSize {
+				sync.SyncIpAddresses(toSync, true)
+				toSync = nil
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 	writer.Flush()
 	elapsed := time.Since(start)
 	addressUpdateTimer.Update(elapsed)
-	logging.Successf("%d new live IPv6 addresses were found.", len(cleanPings))
-	logging.Debugf("Finished writing %d addresses to '%s'.", len(cleanPings), outputPath)
-	if viper.GetBool("CloudSyncOptIn") {
-		sync.SyncIpAddresses(cleanPings, true)
+	logging.Successf("%d new live IPv6 addresses were found.", count)
+	logging.Debugf("Finished writing %d addresses to '%s'.", count, outputPath)
+	if len(toSync) > 0 {
+		sync.SyncIpAddresses(toSync, true)
 	}
 	return nil
 }
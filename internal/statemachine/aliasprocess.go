@@ -8,6 +8,7 @@ import (
 	"github.com/ekaley/ipv666/internal/logging"
 	"github.com/rcrowley/go-metrics"
 	"github.com/spf13/viper"
+	"net"
 	"time"
 )
 
@@ -27,11 +28,13 @@ func init() {
 	metrics.Register("aliasprocess.blacklist.clean.count", aliasBlacklistCleanCount)
 }
 
+// Add the aliased networks that were found to the blacklists of the target networks that they overlap, then
+// write out the blacklists that changed
 func processAliasedNetworks() error {
 
-	logging.Infof("Processing the aliased networks that were found into blacklist.")
+	logging.Infof("Processing the aliased networks that were found into blacklists.")
 
-	curBlacklist, err := data.GetBlacklist()
+	targets, err := config.GetTargetNetworks()
 	if err != nil {
 		return err
 	}
@@ -42,6 +45,44 @@ func processAliasedNetworks() error {
 
 	logging.Debugf("Loaded all relevant data into memory. Processing aliased results now.")
 
+	targetAliasedNets := make(map[*config.TargetNetwork][]*net.IPNet)
+	for _, aliasedNet := range aliasedNets {
+		found := false
+		for _, target := range targets {
+			if target.Network.Contains(aliasedNet.IP) || aliasedNet.Contains(target.Network.IP) {
+				targetAliasedNets[target] = append(targetAliasedNets[target], aliasedNet)
+				found = true
+			}
+		}
+		if !found {
+			logging.Warnf("Aliased network %s does not overlap any of the target networks. Skipping it.", aliasedNet)
+			aliasProcessSkippedCount.Inc(1)
+		}
+	}
+
+	for _, target := range targets {
+		if len(targetAliasedNets[target]) == 0 {
+			continue
+		}
+		err := processTargetAliasedNetworks(target.Network, targetAliasedNets[target])
+		if err != nil {
+			return err
+		}
+	}
+
+	logging.Infof("Successfully updated blacklists based on the results of the aliased network checking.")
+
+	return nil
+
+}
+
+func processTargetAliasedNetworks(target *net.IPNet, aliasedNets []*net.IPNet) error {
+
+	curBlacklist, err := data.GetTargetBlacklist(target)
+	if err != nil {
+		return err
+	}
+
 	start := time.Now()
 	added, skipped := curBlacklist.AddNetworks(aliasedNets)
 	elapsed := time.Since(start)
@@ -49,28 +90,26 @@ func processAliasedNetworks() error {
 	aliasProcessSkippedCount.Inc(int64(skipped))
 	aliasProcessAddedCount.Inc(int64(added))
 
-	logging.Debugf("Successfully processed %d aliased networks in %s. %d were added, %d were skipped.", len(aliasedNets), elapsed, added, skipped)
+	logging.Debugf("Successfully processed %d aliased networks in %s in %s. %d were added, %d were skipped.", len(aliasedNets), target, elapsed, added, skipped)
 
-	logging.Debugf("Cleaning blacklist now. Blacklist is starting at capacity %d.", curBlacklist.GetCount())
+	logging.Debugf("Cleaning blacklist for %s now. Blacklist is starting at capacity %d.", target, curBlacklist.GetCount())
 	start = time.Now()
 	numCleaned := curBlacklist.Clean(viper.GetInt("LogLoopEmitFreq"))
 	aliasBlacklistCleanTime.Update(time.Since(start))
 	aliasBlacklistCleanCount.Inc(int64(numCleaned))
-	logging.Debugf("%d networks were cleaned from the blacklist (down to %d capacity).", numCleaned, curBlacklist.GetCount())
+	logging.Debugf("%d networks were cleaned from the blacklist for %s (down to %d capacity).", numCleaned, target, curBlacklist.GetCount())
 
-	outputPath := fs.GetTimedFilePath(config.GetNetworkBlacklistDirPath())
-	logging.Debugf("Writing new blacklist to file at path '%s'.", outputPath)
+	outputPath := fs.GetTimedFilePath(config.GetNetworkBlacklistDirPathForTarget(target))
+	logging.Debugf("Writing new blacklist for %s to file at path '%s'.", target, outputPath)
 	start = time.Now()
 	err = blacklist.WriteNetworkBlacklistToFile(outputPath, curBlacklist)
 	if err != nil {
-		logging.Warnf("Error thrown when writing blacklist to file '%s': %e", outputPath, err)
+		logging.Warnf("Error thrown when writing blacklist to file '%s': %s", outputPath, err)
 		return err
 	}
 	aliasBlacklistWriteTime.Update(time.Since(start))
 
-	data.UpdateBlacklist(curBlacklist, outputPath)
-
-	logging.Infof("Successfully updated blacklist based on the results of the aliased network checking.")
+	data.UpdateTargetBlacklist(target, curBlacklist, outputPath)
 
 	return nil
 
@@ -1,8 +1,9 @@
 package statemachine
 
 import (
-	"bufio"
+	"context"
 	"errors"
+	"github.com/ekaley/ipv666/internal"
 	"github.com/ekaley/ipv666/internal/addressing"
 	"github.com/ekaley/ipv666/internal/blacklist"
 	"github.com/ekaley/ipv666/internal/config"
@@ -10,10 +11,11 @@ import (
 	"github.com/ekaley/ipv666/internal/fs"
 	"github.com/ekaley/ipv666/internal/logging"
 	"github.com/ekaley/ipv666/internal/pingscan"
+	"github.com/ekaley/ipv666/internal/prober"
 	"github.com/rcrowley/go-metrics"
 	"github.com/spf13/viper"
+	"math/rand"
 	"net"
-	"os"
 	"time"
 )
 
@@ -37,50 +39,62 @@ func init() {
 	metrics.Register("aliasseek.uniquefoundnets.count", aliasUniqueNetsCount)
 }
 
+// A network alongside the distinct live addresses found in it, the first of which seeds its alias check
 type seekPair struct {
-	network *net.IPNet
-	address *net.IP
-	count   uint8
+	network   *net.IPNet
+	address   addressing.IPv6
+	addresses map[addressing.IPv6]internal.Empty
 }
 
-func newSeekPair(network *net.IPNet, addr *net.IP, count uint8) *seekPair {
+func newSeekPair(network *net.IPNet, addr addressing.IPv6) *seekPair {
 	return &seekPair{
-		network: network,
-		address: addr,
-		count:   count,
+		network:   network,
+		address:   addr,
+		addresses: make(map[addressing.IPv6]internal.Empty),
 	}
 }
 
-func seekAliasedNetworks() error {
+func seekAliasedNetworks(ctx context.Context, random *rand.Rand) error {
 
 	logging.Infof("Starting to seek aliased networks from results of ping scan.")
 
-	scanNets, err := data.GetScanResultsNetworkRanges()
-	aliasInitialNetsCounter.Inc(int64(len(scanNets)))
+	var acs *blacklist.AliasCheckStates
+	if len(curProgress.AliasChecks) > 0 {
+		acs = blacklist.NewAliasCheckStatesFromRecords(curProgress.AliasChecks)
+		logging.Infof("Resuming alias seeking from checkpoint (%d out of %d alias checks resolved).", acs.GetFoundCount(), acs.GetChecksCount())
+	} else {
+		scanNets, err := data.GetScanResultsNetworkRanges()
+		aliasInitialNetsCounter.Inc(int64(len(scanNets)))
 
-	if err != nil {
-		logging.Warnf("Error thrown when reading scanned networks from directory '%s': %e", config.GetNetworkGroupDirPath(), err)
-		return err
-	}
+		if err != nil {
+			logging.Warnf("Error thrown when reading scanned networks from directory '%s': %e", config.GetNetworkGroupDirPath(), err)
+			return err
+		}
 
-	seekPairs, err := checkNetworksForAliased(scanNets)
-	aliasSeekPairsCounter.Inc(int64(len(seekPairs)))
+		seekPairs, err := checkNetworksForAliased(ctx, random, scanNets)
+		aliasSeekPairsCounter.Inc(int64(len(seekPairs)))
 
-	if len(seekPairs) == 0 {
-		logging.Infof("None of the tested networks appeared to be aliased!")
-		return nil
-	}
+		if err != nil {
+			logging.Warnf("Error thrown when checking networks for aliased properties: %e", err)
+			return err
+		}
 
-	if err != nil {
-		logging.Warnf("Error thrown when checking networks for aliased properties: %e", err)
-		return err
+		if len(seekPairs) == 0 {
+			logging.Infof("None of the tested networks appeared to be aliased!")
+			return nil
+		}
+
+		acs, err = newAliasCheckStatesFromSeekPairs(seekPairs)
+		if err != nil {
+			return err
+		}
 	}
 
-	nets, err := findAliasedNetworksFromSeekPairs(seekPairs)
+	nets, err := findAliasedNetworks(ctx, acs)
 	aliasAliasedNetsCount.Inc(int64(len(nets)))
 
 	if err != nil {
-		logging.Warnf("Error thrown when finding aliased networks from seek pairs: %e", err)
+		logging.Warnf("Error thrown when finding aliased networks from alias check states: %e", err)
 		return err
 	}
 
@@ -104,30 +118,31 @@ func seekAliasedNetworks() error {
 	return nil
 }
 
-func findAliasedNetworksFromSeekPairs(seekPairs []*seekPair) ([]*net.IPNet, error) {
-
-	logging.Infof("Starting search for aliased networks based on %d initial starting IPs.", len(seekPairs))
-	start := time.Now()
-
-	var seekIPs []*net.IP
+func newAliasCheckStatesFromSeekPairs(seekPairs []*seekPair) (*blacklist.AliasCheckStates, error) {
+	var seekIPs []addressing.IPv6
 	for _, pair := range seekPairs {
 		seekIPs = append(seekIPs, pair.address)
 	}
-	acs, err := blacklist.NewAliasCheckStates(seekIPs, uint8(viper.GetInt("AliasLeftIndexStart")), uint8(viper.GetInt("NetworkGroupingSize")))
+	return blacklist.NewAliasCheckStates(seekIPs, uint8(viper.GetInt("AliasLeftIndexStart")), uint8(viper.GetInt("NetworkGroupingSize")))
+}
 
-	if err != nil {
-		return nil, err
-	}
+// Narrow down the aliased networks until every alias check has been resolved, recording the progress
+// made after each loop in the current checkpoint
+func findAliasedNetworks(ctx context.Context, acs *blacklist.AliasCheckStates) ([]*net.IPNet, error) {
+
+	logging.Infof("Starting search for aliased networks based on %d initial starting IPs.", acs.GetChecksCount())
+	start := time.Now()
 
 	loopCount := 0
 	var toReturn []*net.IPNet
 	for {
 		logging.Debugf("Now starting loop %d.", loopCount)
-		err := aliasSeekLoop(acs)
+		err := aliasSeekLoop(ctx, acs)
 		if err != nil {
 			logging.Warnf("Error thrown on iteration %d of loop: %e", loopCount, err)
 			return nil, err
 		}
+		curProgress.AliasChecks = acs.GetRecords()
 		if acs.GetAllFound() {
 			toReturn, err = acs.GetAliasedNetworks()
 			if err != nil {
@@ -151,160 +166,111 @@ func findAliasedNetworksFromSeekPairs(seekPairs []*seekPair) ([]*net.IPNet, erro
 
 }
 
-func aliasSeekLoop(acs *blacklist.AliasCheckStates) error {
-	//TODO delete files after the function is finished?
-	var i int
+func aliasSeekLoop(ctx context.Context, acs *blacklist.AliasCheckStates) error {
 	start := time.Now()
 	logging.Debug("Generating test addresses...")
 	testAddrs := acs.GetTestAddresses()
 	if len(testAddrs) == 0 {
 		return errors.New("did not generate any test addresses in loop")
 	}
-	logging.Debugf("%d addresses generated.", len(testAddrs))
-	var scanAddrs []*net.IP
-	for _, testAddr := range testAddrs {
-		for i = 0; i < viper.GetInt("AliasDuplicateScanCount"); i++ {
-			scanAddrs = append(scanAddrs, testAddr)
+	logging.Debugf("%d addresses generated. Kicking off ping scan.", len(testAddrs))
+	foundAddrSet := make(map[addressing.IPv6]internal.Empty)
+	_, err := pingscan.AliasScanGeneratedFromConfig(ctx, func(ctx context.Context, targets chan<- addressing.IPv6) error {
+		for _, addr := range testAddrs {
+			select {
+			case targets <- addr:
+			case <-ctx.Done():
+				return nil
+			}
 		}
-	}
-	targetsPath := fs.GetTimedFilePath(config.GetNetworkScanTargetsDirPath())
-	logging.Debugf("Writing %d blacklist scan addresses to file '%s'.", len(scanAddrs), targetsPath)
-	err := addressing.WriteIPsToHexFile(targetsPath, scanAddrs)
-	if err != nil {
-		logging.Warnf("Error thrown when writing %d addresses to file '%s': %e", len(scanAddrs), targetsPath, err)
-		return err
-	}
-	logging.Debugf("Successfully wrote %d blacklist scan addresses to file '%s'.", len(scanAddrs), targetsPath)
-	outputPath := fs.GetTimedFilePath(config.GetNetworkScanResultsDirPath())
-	logging.Debugf("Kicking off ping scan from file path '%s' to output path '%s'.", targetsPath, outputPath)
-	_, err = pingscan.ScanFromConfig(targetsPath, outputPath)
+		return nil
+	}, func(reply *prober.Reply) {
+		foundAddrSet[addressing.NewIPv6(reply.Addr)] = internal.Empty{}
+	})
 	if err != nil {
 		logging.Warnf("An error was thrown when running ping scan: %s", err)
 		return err
 	}
-	foundAddrs, err := fs.ReadIPsFromHexFile(outputPath)
-	if err != nil {
-		logging.Warnf("Error thrown when reading IP addresses from file '%s': %e", outputPath, err)
-		return err
-	}
-	logging.Debugf("%d addresses responded to ICMP pings.", len(foundAddrs))
-	foundAddrSet := addressing.GetIPSet(foundAddrs)
+	logging.Debugf("%d addresses responded to ICMP pings.", len(foundAddrSet))
 	logging.Debugf("Updating check list with results from Zmap scan.")
 	acs.Update(foundAddrSet)
 	aliasSeekLoopTimer.Update(time.Since(start))
 	return nil
 }
 
-func checkNetworksForAliased(nets []*net.IPNet) ([]*seekPair, error) {
+// Ping scan random addresses in each of the networks, tallying the live ones against the networks they
+// were generated in as the replies come in
+func checkNetworksForAliased(ctx context.Context, random *rand.Rand, nets []*net.IPNet) ([]*seekPair, error) {
 
 	logging.Infof("Now testing %d networks for aliased properties.", len(nets))
 	start := time.Now()
 
-	candsPath, err := generateAliasCandidates(nets)
-	if err != nil {
-		return nil, err
-	}
-
-	outputPath := fs.GetTimedFilePath(config.GetNetworkScanResultsDirPath())
-	logging.Debugf("Ping scanning alias candidates in file '%s'. Results will be written to '%s'.", candsPath, outputPath)
-
-	_, err = pingscan.ScanFromConfig(candsPath, outputPath)
-	if err != nil {
-		return nil, err
-	}
-	logging.Infof("Successfully scanned alias candidates to file '%s'.", outputPath)
-
-	foundAddrs, err := fs.ReadIPsFromHexFile(outputPath)
+	netList := blacklist.NewNetworkBlacklist(nets)
+	presenceTracker := make(map[string]*seekPair)
+	liveCount := 0
+	_, _, err := pingscan.ScanGeneratedFromConfig(ctx, func(ctx context.Context, targets chan<- addressing.IPv6) error {
+		return generateAliasCandidates(ctx, random, nets, targets)
+	}, func(reply *prober.Reply) {
+		liveCount++
+		addSeekPairAddress(presenceTracker, netList, addressing.NewIPv6(reply.Addr))
+	})
 	if err != nil {
 		return nil, err
 	}
+	logging.Infof("Successfully scanned alias candidates (%d live addresses).", liveCount)
 
-	seekPairs := getSeekPairsFromScanResults(nets, foundAddrs)
+	seekPairs := getSeekPairs(presenceTracker, len(nets))
 	aliasCheckTimer.Update(time.Since(start))
 
 	return seekPairs, nil
 
 }
 
-func generateAliasCandidates(nets []*net.IPNet) (string, error) {
-
-	outputPath := fs.GetTimedFilePath(config.GetNetworkScanTargetsDirPath())
-
-	logging.Debugf("Alias checking targets will be written to file '%s'.", outputPath)
-
-	var addrs []*net.IP
-	file, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-	writer := bufio.NewWriter(file)
-
-	for i, networks := range nets {
+// Send NetworkPingCount random addresses in each of the networks to the channel, stopping early if the
+// context is cancelled
+func generateAliasCandidates(ctx context.Context, random *rand.Rand, nets []*net.IPNet, targets chan<- addressing.IPv6) error {
+	for i, network := range nets {
 		if i%viper.GetInt("LogLoopEmitFreq") == 0 {
 			logging.Debugf("Generating addresses for network %d out of %d.", i, len(nets))
 		}
-		addrs = append(addrs, addressing.GenerateRandomAddressesInNetwork(networks, viper.GetInt("NetworkPingCount"))...)
-		if len(addrs) >= viper.GetInt("BlacklistFlushInterval") {
-			err := flushAddressesToDisk(addrs, writer)
-			if err != nil {
-				return "", err
+		for _, addr := range addressing.GenerateRandomAddressesInNetwork(random, network, viper.GetInt("NetworkPingCount")) {
+			select {
+			case targets <- addr:
+			case <-ctx.Done():
+				return nil
 			}
-			addrs = addrs[:0]
 		}
 	}
-	if len(addrs) > 0 {
-		err := flushAddressesToDisk(addrs, writer)
-		if err != nil {
-			return "", err
-		}
-	}
-	writer.Flush()
-
-	logging.Debugf("Alias candidates successfully written to file '%s'.", outputPath)
-	return outputPath, nil
-
+	return nil
 }
 
-func getSeekPairsFromScanResults(nets []*net.IPNet, addrs []*net.IP) []*seekPair {
-
-	logging.Infof("Processing %d live addresses against %d networks to find networks that appear to be aliased.", len(addrs), len(nets))
-
-	netList := blacklist.NewNetworkBlacklist(nets)
-	presenceTracker := make(map[string]*seekPair)
-
-	for i, addr := range addrs {
-		if i%viper.GetInt("LogLoopEmitFreq") == 0 {
-			logging.Debugf("Checking address %d out of %d.", i, len(addrs))
-		}
-		addrNetwork := netList.GetBlacklistingNetworkFromIP(addr)
-		if addrNetwork != nil {
-			netString := addrNetwork.String()
-			if _, ok := presenceTracker[netString]; !ok {
-				presenceTracker[netString] = newSeekPair(addrNetwork, addr, 0)
-			}
-			presenceTracker[netString].count++
-		}
+// Record a live address against the network that it was generated in. An address that replies more than
+// once (e.g. to several probes or on several ports) is only counted once.
+func addSeekPairAddress(presenceTracker map[string]*seekPair, netList *blacklist.NetworkBlacklist, addr addressing.IPv6) {
+	addrNetwork := netList.GetBlacklistingNetworkFromIP(addr)
+	if addrNetwork == nil {
+		return
 	}
+	netString := addrNetwork.String()
+	if _, ok := presenceTracker[netString]; !ok {
+		presenceTracker[netString] = newSeekPair(addrNetwork, addr)
+	}
+	presenceTracker[netString].addresses[addr] = internal.Empty{}
+}
 
-	logging.Debugf("Processed all %d addresses.", len(addrs))
+// Get the networks that enough of the live addresses were found in for them to appear aliased
+func getSeekPairs(presenceTracker map[string]*seekPair, netCount int) []*seekPair {
 
 	var toReturn []*seekPair
-	threshold := (uint8)(float64(viper.GetInt("NetworkPingCount")) * viper.GetFloat64("NetworkBlacklistPercent"))
+	threshold := int(float64(viper.GetInt("NetworkPingCount")) * viper.GetFloat64("NetworkBlacklistPercent"))
 
 	for _, v := range presenceTracker {
-		if v.count >= threshold {
+		if len(v.addresses) >= threshold {
 			toReturn = append(toReturn, v)
 		}
 	}
 
-	logging.Infof("%d (out of an initial %d) networks exhibit traits of aliased networks.", len(toReturn), len(nets))
+	logging.Infof("%d (out of an initial %d) networks exhibit traits of aliased networks.", len(toReturn), netCount)
 
 	return toReturn
 }
-
-func flushAddressesToDisk(addrs []*net.IP, w *bufio.Writer) error {
-	toWrite := addressing.GetTextLinesFromIPs(addrs)
-	_, err := w.WriteString(toWrite)
-	return err
-}
@@ -1,6 +1,12 @@
 package statemachine
 
 import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/blacklist"
+	"github.com/ekaley/ipv666/internal/config"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"net"
 	"testing"
 )
 
@@ -62,3 +68,25 @@ func TestGetSeekPairsFromScanResults(t *testing.T) {
 	//conf, _ := config.LoadFromFile("../../config.json")
 	//getSeekPairsFromScanResults(nets, ips, &conf)
 }
+
+func TestGetSeekPairs_CountsDistinctAddresses(t *testing.T) {
+	config.InitConfig()
+	viper.Set("NetworkPingCount", 4)
+	viper.Set("NetworkBlacklistPercent", 0.5)
+	_, repeatNet, _ := net.ParseCIDR("2600:1::/64")
+	_, distinctNet, _ := net.ParseCIDR("2600:2::/64")
+	netList := blacklist.NewNetworkBlacklist([]*net.IPNet{repeatNet, distinctNet})
+	presenceTracker := make(map[string]*seekPair)
+
+	// A single address that replies many times doesn't make its network look aliased
+	repeatAddr := addressing.NewIPv6(net.ParseIP("2600:1::1"))
+	for i := 0; i < 300; i++ {
+		addSeekPairAddress(presenceTracker, netList, repeatAddr)
+	}
+	addSeekPairAddress(presenceTracker, netList, addressing.NewIPv6(net.ParseIP("2600:2::1")))
+	addSeekPairAddress(presenceTracker, netList, addressing.NewIPv6(net.ParseIP("2600:2::2")))
+
+	seekPairs := getSeekPairs(presenceTracker, 2)
+	assert.Len(t, seekPairs, 1)
+	assert.Equal(t, distinctNet.String(), seekPairs[0].network.String())
+}
@@ -2,6 +2,7 @@ package statemachine
 
 import (
 	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/blacklist"
 	"github.com/ekaley/ipv666/internal/config"
 	"github.com/ekaley/ipv666/internal/data"
 	"github.com/ekaley/ipv666/internal/fs"
@@ -21,31 +22,58 @@ func init() {
 	metrics.Register("blclean.legitimate.count", blLegitimateCount)
 }
 
+// Remove the addresses in the ping results that fall in a blacklisted network, checking each against the
+// blacklists of the target network that it is in (or only the shared blacklist if it is in none of them)
 func cleanBlacklistedAddresses() error {
-	blacklist, err := data.GetBlacklist()
+	targets, err := config.GetTargetNetworks()
 	if err != nil {
 		return err
 	}
-	logging.Infof("Cleaning addresses using blacklist with %d entries.", blacklist.GetCount())
-	addrs, err := data.GetCandidatePingResults()
+	blacklists, err := data.GetTargetBlacklists(targets)
 	if err != nil {
 		return err
 	}
-	logging.Debugf("Total of %d addresses to clean.", len(addrs))
-	start := time.Now()
-	cleanedAddrs := blacklist.CleanIPList(addrs, viper.GetInt("LogLoopEmitFreq"))
-	elapsed := time.Since(start)
-	blRemovalDurationTimer.Update(elapsed)
-	blRemovalCount.Inc(int64(len(addrs) - len(cleanedAddrs)))
-	blLegitimateCount.Inc(int64(len(cleanedAddrs)))
-	logging.Debugf("Resulting cleaned list contains %d addresses (down from %d). Cleaned in %s.", len(cleanedAddrs), len(addrs), elapsed)
+	shared, err := data.GetBlacklist()
+	if err != nil {
+		return err
+	}
+	logging.Infof("Cleaning addresses using the shared blacklist with %d entries and the blacklists of %d target networks.", shared.GetCount(), len(targets))
 	outputPath := fs.GetTimedFilePath(config.GetCleanPingDirPath())
 	logging.Debugf("Writing resulting cleaned ping addresses to file at path '%s'.", outputPath)
-	err = addressing.WriteIPsToBinaryFile(outputPath, cleanedAddrs)
+	writer, err := fs.NewBinaryIPWriter(outputPath)
 	if err != nil {
 		return err
 	}
+	defer writer.Close()
+	data.RecordFile(outputPath)
+	start := time.Now()
+	count := 0
+	err = data.ForEachCandidatePingResult(func(addr addressing.IPv6) error {
+		if count%viper.GetInt("LogLoopEmitFreq") == 0 && count != 0 {
+			logging.Debugf("Cleaning entry %d.", count)
+		}
+		count++
+		addrBlacklists := blacklist.Blacklists{shared}
+		if target := config.GetTargetNetworkForIP(targets, addr.ToIP()); target != nil {
+			addrBlacklists = blacklists[target]
+		}
+		if addrBlacklists.IsIPBlacklisted(addr) {
+			return nil
+		}
+		return writer.Write(addr)
+	})
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	blRemovalDurationTimer.Update(elapsed)
+	blRemovalCount.Inc(int64(count - writer.GetCount()))
+	blLegitimateCount.Inc(int64(writer.GetCount()))
+	logging.Debugf("Resulting cleaned list contains %d addresses (down from %d). Cleaned in %s.", writer.GetCount(), count, elapsed)
 	logging.Debugf("Cleaned ping results successfully written to path '%s'.", outputPath)
-	data.UpdateCleanPingResults(cleanedAddrs, outputPath)
 	return nil
 }
@@ -21,23 +21,28 @@ func init() {
 
 func generateScanResultsNetworkRanges() error {
 	logging.Infof("Now converting ping scan for candidates into network ranges.")
-	addrs, err := data.GetCandidatePingResults()
-	if err != nil {
-		return err
-	}
-	logging.Debugf("Loaded ping scan results, now converting down to networks.")
+	addrCount := 0
 	var nets []*net.IPNet
-	for _, curAddr := range addrs {
-		newNet, err := addressing.GetIPv6NetworkFromBytes(*curAddr, uint8(viper.GetInt("NetworkGroupingSize")))
+	seenNets := make(map[string]struct{})
+	err := data.ForEachCandidatePingResult(func(curAddr addressing.IPv6) error {
+		addrCount++
+		addrBytes := curAddr.Bytes()
+		newNet, err := addressing.GetIPv6NetworkFromBytes(addrBytes[:], uint8(viper.GetInt("NetworkGroupingSize")))
 		if err != nil {
 			return err
 		}
-		nets = append(nets, newNet)
+		if _, ok := seenNets[newNet.String()]; !ok {
+			seenNets[newNet.String()] = struct{}{}
+			nets = append(nets, newNet)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	nets = addressing.GetUniqueNetworks(nets, viper.GetInt("LogLoopEmitFreq"))
-	logging.Debugf("Whittled %d initial addresses down to %d network ranges with bit mask length of %d.", len(addrs), len(nets), viper.GetInt("NetworkGroupingSize"))
+	logging.Debugf("Whittled %d initial addresses down to %d network ranges with bit mask length of %d.", addrCount, len(nets), viper.GetInt("NetworkGroupingSize"))
 	netRangesCreatedGauge.Update(int64(len(nets)))
-	netRangesDownFromGauge.Update(int64(len(addrs)))
+	netRangesDownFromGauge.Update(int64(addrCount))
 	outputPath := fs.GetTimedFilePath(config.GetNetworkGroupDirPath())
 	logging.Debugf("Writing resulting network file to path '%s'.", outputPath)
 	err = addressing.WriteIPv6NetworksToFile(outputPath, nets)
@@ -1,6 +1,7 @@
 package statemachine
 
 import (
+	"context"
 	"github.com/ekaley/ipv666/internal/config"
 	"github.com/ekaley/ipv666/internal/data"
 	"github.com/ekaley/ipv666/internal/fs"
@@ -21,21 +22,41 @@ func init() {
 	metrics.Register("candscan.ping_scan.error.count", pingscanCandErrorCounter)
 }
 
-func pingScanCandidateAddresses() error {
-	inputPath, err := data.GetMostRecentFilePathFromDir(config.GetCandidateAddressDirPath())
+// Ping scan the current candidate addresses. If the scan was interrupted on a previous attempt, it picks
+// up where it left off in the same candidate file and appends to the same results file.
+func pingScanCandidateAddresses(ctx context.Context) error {
+	inputPath, err := data.GetCurrentFilePathFromDir(config.GetCandidateAddressDirPath())
 	if err != nil {
 		return err
 	}
-	outputPath := fs.GetTimedFilePath(config.GetPingResultDirPath())
+	var outputPath string
+	if curProgress.CandidateOffset > 0 {
+		outputPath, err = data.GetCurrentFilePathFromDir(config.GetPingResultDirPath())
+		if err != nil {
+			return err
+		}
+	} else {
+		outputPath = fs.GetTimedFilePath(config.GetPingResultDirPath())
+		data.RecordFile(outputPath)
+	}
 	logging.Infof(
 		"Now ping-scanning IPv6 addressing found in file at path '%s'. Results will be written to '%s'.",
 		inputPath,
 		outputPath,
 	)
 	start := time.Now()
-	_, err = pingscan.ScanFromConfig(inputPath, outputPath)
+	errorsPath, scanned, err := pingscan.ScanFromConfig(ctx, inputPath, outputPath, curProgress.CandidateOffset)
+	curProgress.CandidateOffset = scanned
 	elapsed := time.Since(start)
 	if err != nil {
+		if ctx.Err() != nil {
+			// The addresses scanned so far won't be scanned again, so keep the errors they turned up
+			logging.Infof("Ping-scan interrupted after %d addresses in file '%s'.", scanned, inputPath)
+			if err := updateUnroutedNetworks(errorsPath, outputPath); err != nil {
+				logging.Warnf("Error thrown when tallying unrouted networks from interrupted ping-scan: %s", err)
+			}
+			return err
+		}
 		pingscanCandErrorCounter.Inc(1)
 		logging.Warnf("An error was thrown when trying to run ping-scan: %s", err)
 		logging.Debugf("Ping-scan elapsed time was %s.", elapsed)
@@ -51,5 +72,13 @@ func pingScanCandidateAddresses() error {
 	}
 	liveAddrCandGauge.Update(int64(liveCount))
 	logging.Infof("Ping-scan completed successfully in %s. Results written to file at '%s'.", elapsed, outputPath)
-	return nil
+	err = updateTargetStats(inputPath, outputPath)
+	if err != nil {
+		return err
+	}
+	err = updateRegionStats(inputPath, outputPath)
+	if err != nil {
+		return err
+	}
+	return updateUnroutedNetworks(errorsPath, outputPath)
 }
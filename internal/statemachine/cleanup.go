@@ -2,6 +2,7 @@ package statemachine
 
 import (
 	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/data"
 	"github.com/ekaley/ipv666/internal/fs"
 	"github.com/ekaley/ipv666/internal/logging"
 	"github.com/rcrowley/go-metrics"
@@ -17,10 +18,21 @@ func init() {
 
 func cleanUpNonRecentFiles() error {
 	allDirs := config.GetAllExportDirectories()
-	logging.Infof("Now starting to delete all non-recent files from %d directories.", len(allDirs))
+	targetNetworks, err := config.GetTargetNetworks()
+	if err != nil {
+		return err
+	}
+	for _, target := range targetNetworks {
+		for _, targetDir := range []string{config.GetBloomDirPathForTarget(target.Network), config.GetNetworkBlacklistDirPathForTarget(target.Network)} {
+			if fs.CheckIfFileExists(targetDir) {
+				allDirs = append(allDirs, targetDir)
+			}
+		}
+	}
+	logging.Infof("Now starting to delete all non-current files from %d directories.", len(allDirs))
 	for _, curDir := range allDirs {
 		logging.Debugf("Processing content of directory '%s'.", curDir)
-		exportFiles, err := fs.GetNonMostRecentFilesFromDirectory(curDir)
+		exportFiles, err := data.GetNonCurrentFilesFromDirectory(curDir)
 		if err != nil {
 			logging.Warnf("Error thrown when attempting to gather files for deletion in directory '%s'.", curDir)
 			return err
@@ -41,6 +53,6 @@ func cleanUpNonRecentFiles() error {
 		}
 		logging.Debugf("Deleted all files in directory '%s'.", curDir)
 	}
-	logging.Infof("Successfully deleted all non-recent files from %d directories.", len(allDirs))
+	logging.Infof("Successfully deleted all non-current files from %d directories.", len(allDirs))
 	return nil
 }
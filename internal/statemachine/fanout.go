@@ -1,14 +1,42 @@
 package statemachine
 
 import (
+	"context"
+	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/data"
 	"github.com/ekaley/ipv666/internal/fanout"
 	"github.com/spf13/viper"
 )
 
-func fanOutSlash64s() error {
-	return fanout.Slash64s(viper.GetString("PingScanBandwidth"))
+func fanOutSlash64s(ctx context.Context) error {
+	errorsPath, err := fanout.Slash64s(ctx, viper.GetString("PingScanBandwidth"))
+	if err != nil {
+		return err
+	}
+	return updateUnroutedNetworksFromFanOut(errorsPath)
 }
 
-func fanOutNybbleAdjacent() error {
-	return fanout.NybbleAdjacent(viper.GetString("PingScanBandwidth"))
+func fanOutNybbleAdjacent(ctx context.Context) error {
+	errorsPath, err := fanout.NybbleAdjacent(ctx, viper.GetString("PingScanBandwidth"))
+	if err != nil {
+		return err
+	}
+	return updateUnroutedNetworksFromFanOut(errorsPath)
+}
+
+func fanOutPatterns(ctx context.Context) error {
+	errorsPath, err := fanout.Patterns(ctx, viper.GetString("PingScanBandwidth"))
+	if err != nil {
+		return err
+	}
+	return updateUnroutedNetworksFromFanOut(errorsPath)
+}
+
+// Update the unrouted networks from a fan-out scan, whose live addresses are in the current ping results
+func updateUnroutedNetworksFromFanOut(errorsPath string) error {
+	resultsPath, err := data.GetCurrentFilePathFromDir(config.GetPingResultDirPath())
+	if err != nil {
+		return err
+	}
+	return updateUnroutedNetworks(errorsPath, resultsPath)
 }
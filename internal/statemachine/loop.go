@@ -1,13 +1,15 @@
 package statemachine
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/data"
 	"github.com/ekaley/ipv666/internal/logging"
 	"github.com/rcrowley/go-metrics"
 	"github.com/spf13/viper"
-	"io/ioutil"
+	"math/rand"
 	"time"
 )
 
@@ -22,10 +24,30 @@ const (
 	FAN_OUT_64_ALIAS_REMOVAL
 	CLEAN_UP
 	EMIT_METRICS
+	FAN_OUT_PATTERNS
+	FAN_OUT_PATTERNS_ALIAS_REMOVAL
+	UPDATE_MODEL
 )
 
+// The values of the states are recorded in checkpoints, so new states are added to the end of the list
+// above and placed in the loop here rather than renumbering the states that come after them
+var stateOrder = []State{
+	GEN_ADDRESSES,
+	PING_SCAN_ADDR,
+	PING_SCAN_ALIAS_REMOVAL,
+	FAN_OUT_NYBBLE_ADJACENT,
+	FAN_OUT_NYBBLE_ADJACENT_ALIAS_REMOVAL,
+	FAN_OUT_64,
+	FAN_OUT_64_ALIAS_REMOVAL,
+	FAN_OUT_PATTERNS,
+	FAN_OUT_PATTERNS_ALIAS_REMOVAL,
+	UPDATE_MODEL,
+	CLEAN_UP,
+	EMIT_METRICS,
+}
+
 var FIRST_STATE = GEN_ADDRESSES
-var LAST_STATE = EMIT_METRICS
+var LAST_STATE = UPDATE_MODEL
 
 type State int8
 
@@ -50,161 +72,211 @@ func getStateLoopTimer(state State) (metrics.Timer, bool) {
 	return timer, found
 }
 
-func fetchStateFromFile(filePath string) (State, error) {
-	content, err := ioutil.ReadFile(filePath)
-	if err != nil {
-		return -1, err
-	}
-	if len(content) == 0 || len(content) > 1 {
-		return -1, errors.New(fmt.Sprintf("Content of file at '%s' was of unexpected length (%d).", filePath, len(content)))
-	}
-	state := int(content[0])
+// The progress made in the state that is currently running
+var curProgress *data.StateProgress
+
+// Get the state recorded in the checkpoint, making sure that it is a state we know about
+func getCheckpointState(checkpoint *data.Checkpoint) (State, error) {
+	state := checkpoint.State
 	if state < int(FIRST_STATE) || state > int(LAST_STATE) {
-		return -1, errors.New(fmt.Sprintf("State with value %d was unexpected (expected between %d and %d, inclusive).", state, FIRST_STATE, LAST_STATE))
+		return -1, errors.New(fmt.Sprintf("State with value %d in checkpoint for run %s was unexpected (expected between %d and %d, inclusive).", state, checkpoint.RunID, FIRST_STATE, LAST_STATE))
 	}
 	return State(state), nil
 }
 
-func postScanCleanup() error {
-
-	// Process results of ping scan into a set of network ranges
-	err := generateScanResultsNetworkRanges()
-	if err != nil {
-		return err
+// Get the state that the loop moves on to after the given one
+func getNextState(state State) State {
+	for i, curState := range stateOrder {
+		if curState == state {
+			return stateOrder[(i+1)%len(stateOrder)]
+		}
 	}
+	return FIRST_STATE
+}
 
-	// Seek out aliased networks
-	err = seekAliasedNetworks()
-	if err != nil {
-		return err
-	}
+// Process the results of a ping scan, picking up after whichever steps the current checkpoint records as
+// complete
+func postScanCleanup(ctx context.Context, random *rand.Rand) error {
+	steps := []func() error{
 
-	// Process the results of aliased network seeking (add to blacklist and de-dupe)
-	err = processAliasedNetworks()
-	if err != nil {
-		return err
-	}
+		// Process results of ping scan into a set of network ranges
+		generateScanResultsNetworkRanges,
 
-	// Remove all the addressing from the ping scan results that are in ranges that failed
-	// the test in the previous step
-	err = cleanBlacklistedAddresses()
-	if err != nil {
-		return err
-	}
+		// Seek out aliased networks
+		func() error { return seekAliasedNetworks(ctx, random) },
 
-	// Update the cumulative addresses file
-	err = updateAddressFile()
-	if err != nil {
-		return err
-	}
+		// Process the results of aliased network seeking (add to blacklist and de-dupe)
+		processAliasedNetworks,
+
+		// Remove all the addressing from the ping scan results that are in ranges that failed
+		// the test in the previous step
+		cleanBlacklistedAddresses,
 
+		// Update the cumulative addresses file
+		updateAddressFile,
+	}
+	if curProgress.CleanupSteps > 0 {
+		logging.Infof("Resuming post-scan clean up after %d completed steps.", curProgress.CleanupSteps)
+	}
+	for i := curProgress.CleanupSteps; i < len(steps); i++ {
+		err := steps[i]()
+		if err != nil {
+			return err
+		}
+		curProgress.CleanupSteps = i + 1
+	}
 	return nil
 }
 
-func SetStateFile(filePath string, curState State) error {
-	logging.Debugf("Now updating state file at path '%s' with current state of %d.", filePath, curState)
-	var b []byte
-	b = append(b, byte(curState))
-	return ioutil.WriteFile(filePath, b, 0644)
-}
+// Run the work for a single state of the state machine, recording how long it took. If the state was
+// interrupted on a previous attempt, it picks up from the current checkpoint.
+func RunState(ctx context.Context, random *rand.Rand, state State) error {
 
-func ResetStateFile(filePath string) error {
-	return SetStateFile(filePath, FIRST_STATE)
-}
+	logging.Debugf("Now entering state %d.", state)
+	start := time.Now()
+	checkpoint := data.GetCheckpoint()
+	if checkpoint.State != int(state) || checkpoint.Progress == nil {
+		checkpoint.State = int(state)
+		checkpoint.Progress = &data.StateProgress{}
+	}
+	curProgress = checkpoint.Progress
 
-func InitStateFile(filePath string) error {
-	return SetStateFile(filePath, FIRST_STATE)
+	switch state {
+	case GEN_ADDRESSES:
+		// Generate the candidate addressing to scan from the most recent model
+		err := generateCandidateAddresses(ctx, random)
+		if err != nil {
+			return err
+		}
+	case PING_SCAN_ADDR:
+		// Perform a ping scan of the candidate addressing that were generated
+		err := pingScanCandidateAddresses(ctx)
+		if err != nil {
+			return err
+		}
+	case PING_SCAN_ALIAS_REMOVAL:
+		// Perform alias network detection and cleanup
+		err := postScanCleanup(ctx, random)
+		if err != nil {
+			return err
+		}
+	case FAN_OUT_NYBBLE_ADJACENT:
+		// Fan out to find neighboring nybble-adjacent addresses
+		err := fanOutNybbleAdjacent(ctx)
+		if err != nil {
+			return err
+		}
+	case FAN_OUT_NYBBLE_ADJACENT_ALIAS_REMOVAL:
+		// Perform alias network detection and cleanup
+		err := postScanCleanup(ctx, random)
+		if err != nil {
+			return err
+		}
+	case FAN_OUT_64:
+		// Fan out to find neighboring /64 networks from the discovered address set, and
+		// monotonically-increasing addresses from each /64
+		err := fanOutSlash64s(ctx)
+		if err != nil {
+			return err
+		}
+	case FAN_OUT_64_ALIAS_REMOVAL:
+		// Perform alias network detection and cleanup
+		err := postScanCleanup(ctx, random)
+		if err != nil {
+			return err
+		}
+	case FAN_OUT_PATTERNS:
+		// Fan out to hosts in the discovered /64 networks whose interface identifiers follow
+		// well-known patterns (low-byte, service ports, embedded IPv4, EUI-64, hex words)
+		err := fanOutPatterns(ctx)
+		if err != nil {
+			return err
+		}
+	case FAN_OUT_PATTERNS_ALIAS_REMOVAL:
+		// Perform alias network detection and cleanup
+		err := postScanCleanup(ctx, random)
+		if err != nil {
+			return err
+		}
+	case UPDATE_MODEL:
+		// Fold the addresses discovered during this loop into the cluster model
+		if !viper.GetBool("ModelUpdateEnabled") {
+			logging.Infof("Model updates disabled. Skipping model update step.")
+		} else {
+			err := updateClusterModel()
+			if err != nil {
+				return err
+			}
+		}
+	case CLEAN_UP:
+		// Remove all but the most recent files in each of the directories
+		if !viper.GetBool("CleanUpEnabled") {
+			logging.Infof("Clean up disabled. Skipping clean up step.")
+		} else {
+			err := cleanUpNonRecentFiles()
+			if err != nil {
+				return err
+			}
+		}
+	case EMIT_METRICS:
+		// Emit metrics
+	}
+
+	checkpoint.Progress = nil
+	elapsed := time.Since(start)
+	logging.Debugf("Completed state %d (took %s).", state, elapsed)
+
+	timer, found := getStateLoopTimer(state)
+	if !found {
+		logging.Warnf("Unable to find state loop timer for state %d.", state)
+		if viper.GetBool("ExitOnFailedMetrics") {
+			return errors.New(fmt.Sprintf("Unable to find state loop timer for state %d.", state))
+		}
+	} else {
+		timer.Update(elapsed)
+	}
+
+	return nil
 }
 
-func RunStateMachine() error {
+// Run the state machine from the state recorded in the current checkpoint until it fails or the context
+// is cancelled. The checkpoint is saved after every state, and when cancelled it also records the progress
+// made partway through the current state so that the next run can resume it. Candidate and alias check
+// addresses are drawn from random, so runs given identically seeded sources generate the same addresses.
+func RunStateMachine(ctx context.Context, random *rand.Rand) error {
 
 	logging.Infof("Now starting to run the state machine.")
 
-	state, err := fetchStateFromFile(config.GetStateFilePath())
+	checkpoint := data.GetCheckpoint()
+	state, err := getCheckpointState(checkpoint)
 
 	if err != nil {
 		return err
 	}
 
+	if checkpoint.Progress != nil {
+		logging.Infof("Resuming state %d of run %s from checkpoint.", state, checkpoint.RunID)
+	}
+
 	logging.Debugf("Starting at state %d.", state)
 
 	for {
 
-		logging.Debugf("Now entering state %d.", state)
-		start := time.Now()
-
-		switch state {
-		case GEN_ADDRESSES:
-			// Generate the candidate addressing to scan from the most recent model
-			err := generateCandidateAddresses()
-			if err != nil {
-				return err
-			}
-		case PING_SCAN_ADDR:
-			// Perform a ping scan of the candidate addressing that were generated
-			err := pingScanCandidateAddresses()
-			if err != nil {
-				return err
-			}
-		case PING_SCAN_ALIAS_REMOVAL:
-			// Perform alias network detection and cleanup
-			err := postScanCleanup()
-			if err != nil {
-				return err
-			}
-		case FAN_OUT_NYBBLE_ADJACENT:
-			// Fan out to find neighboring nybble-adjacent addresses
-			err := fanOutNybbleAdjacent()
-			if err != nil {
-				return err
-			}
-		case FAN_OUT_NYBBLE_ADJACENT_ALIAS_REMOVAL:
-			// Perform alias network detection and cleanup
-			err := postScanCleanup()
-			if err != nil {
-				return err
-			}
-		case FAN_OUT_64:
-			// Fan out to find neighboring /64 networks from the discovered address set, and
-			// monotonically-increasing addresses from each /64
-			err := fanOutSlash64s()
-			if err != nil {
-				return err
-			}
-		case FAN_OUT_64_ALIAS_REMOVAL:
-			// Perform alias network detection and cleanup
-			err := postScanCleanup()
-			if err != nil {
-				return err
-			}
-		case CLEAN_UP:
-			// Remove all but the most recent files in each of the directories
-			if !viper.GetBool("CleanUpEnabled") {
-				logging.Infof("Clean up disabled. Skipping clean up step.")
-			} else {
-				err := cleanUpNonRecentFiles()
-				if err != nil {
+		err := RunState(ctx, random, state)
+		if err != nil {
+			if ctx.Err() != nil {
+				logging.Infof("Interrupted during state %d. Saving checkpoint to '%s'.", state, config.GetCheckpointFilePath())
+				if err := data.SaveCheckpoint(); err != nil {
 					return err
 				}
+				return ctx.Err()
 			}
-		case EMIT_METRICS:
-			// Emit metrics
-		}
-
-		elapsed := time.Since(start)
-		logging.Debugf("Completed state %d (took %s).", state, elapsed)
-
-		timer, found := getStateLoopTimer(state)
-		if !found {
-			logging.Warnf("Unable to find state loop timer for state %d.", state)
-			if viper.GetBool("ExitOnFailedMetrics") {
-				return errors.New(fmt.Sprintf("Unable to find state loop timer for state %d.", state))
-			}
+			return err
 		}
-		timer.Update(elapsed)
 
-		state = (state + 1) % (LAST_STATE + 1)
-		err = SetStateFile(config.GetStateFilePath(), state)
+		state = getNextState(state)
+		checkpoint.State = int(state)
+		err = data.SaveCheckpoint()
 		if err != nil {
 			return err
 		}
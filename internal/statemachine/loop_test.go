@@ -0,0 +1,417 @@
+package statemachine
+
+import (
+	"context"
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/data"
+	"github.com/ekaley/ipv666/internal/fs"
+	"github.com/ekaley/ipv666/internal/modeling"
+	"github.com/ekaley/ipv666/internal/prober"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setUpDiscoveryTest(t *testing.T, targetNetwork string) {
+	config.InitConfig()
+	baseDir := t.TempDir()
+	viper.Set("BaseOutputDirectory", baseDir)
+	viper.Set("OutputFileName", filepath.Join(baseDir, "discovered_addrs"))
+	viper.Set("OutputFileType", "txt")
+	viper.Set("ScanTargetNetwork", targetNetwork)
+	viper.Set("ScanTargetNetworks", "")
+	viper.Set("GenerateAddressCount", 500)
+	viper.Set("AddressFilterSize", 100000)
+	viper.Set("PingScanBandwidth", "100MB")
+	viper.Set("PingScanReplyWait", 10)
+	viper.Set("FanOutNetworkBlockSize", 5)
+	viper.Set("FanOutHostBlockSize", 5)
+	viper.Set("FanOutMaxNetworks", 100)
+	viper.Set("FanOutMaxHosts", 100)
+	viper.Set("FanOutPatternRulesFile", "")
+	viper.Set("FanOutPatternMaxHosts", 100)
+	viper.Set("CleanUpEnabled", false)
+	viper.Set("CloudSyncOptIn", false)
+	viper.Set("CandidateGenerator", modeling.ClusterGeneratorType)
+	for _, dir := range config.GetAllDirectories() {
+		err := fs.CreateDirectoryIfNotExist(dir)
+		assert.Nil(t, err)
+	}
+	targetNetworks, err := config.GetTargetNetworks()
+	assert.Nil(t, err)
+	data.SetCheckpoint(data.NewCheckpoint(targetNetworks))
+}
+
+func newTestRand() *rand.Rand {
+	return rand.New(rand.NewSource(666))
+}
+
+func TestStateMachine_RunStateDiscoversLiveAddresses(t *testing.T) {
+	setUpDiscoveryTest(t, "2600:1234::/32")
+
+	// Generate the candidate addresses so that the fake network can be built around them
+	assert.Nil(t, RunState(context.Background(), newTestRand(), GEN_ADDRESSES))
+	candPath, err := data.GetCurrentFilePathFromDir(config.GetCandidateAddressDirPath())
+	assert.Nil(t, err)
+	candidates, err := fs.ReadIPsFromHexFile(candPath)
+	assert.Nil(t, err)
+	assert.True(t, len(candidates) > 10)
+
+	// The /64 of the first candidate is aliased, and a handful of candidates outside of it are live
+	_, aliasedNet, _ := net.ParseCIDR(candidates[0].String() + "/64")
+	var live []net.IP
+	for _, candidate := range candidates[1:] {
+		if !candidate.In(aliasedNet) && len(live) < 10 {
+			live = append(live, candidate.ToIP())
+		}
+	}
+	network := prober.NewFakeNetwork(live, []*net.IPNet{aliasedNet})
+	prober.SetFactory(network.Factory())
+	defer prober.ResetFactory()
+
+	for state := PING_SCAN_ADDR; state != UPDATE_MODEL; state = getNextState(state) {
+		if !assert.Nil(t, RunState(context.Background(), newTestRand(), state)) {
+			return
+		}
+	}
+	assert.True(t, network.GetProbeCount() > 0)
+
+	// The aliased network was blacklisted in the target network's blacklist, leaving the shared one as-is
+	_, targetNetwork, _ := net.ParseCIDR("2600:1234::/32")
+	blacklist, err := data.GetTargetBlacklist(targetNetwork)
+	assert.Nil(t, err)
+	assert.True(t, blacklist.IsIPBlacklisted(candidates[0]))
+	blacklistPath, err := data.GetCurrentFilePathFromDir(config.GetNetworkBlacklistDirPathForTarget(targetNetwork))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, blacklistPath)
+	shared, err := data.GetBlacklist()
+	assert.Nil(t, err)
+	assert.False(t, shared.IsIPBlacklisted(candidates[0]))
+
+	// The live addresses were discovered, and nothing from within the aliased network was kept
+	discovered, err := fs.ReadIPsFromHexFile(config.GetOutputFilePath())
+	assert.Nil(t, err)
+	discoveredSet := addressing.GetIPSet(discovered)
+	for _, addr := range live {
+		_, found := discoveredSet[addressing.NewIPv6(addr)]
+		assert.True(t, found)
+	}
+	for _, addr := range discovered {
+		assert.False(t, addr.In(aliasedNet))
+	}
+}
+
+func TestStateMachine_RunStateSplitsCandidatesBetweenTargets(t *testing.T) {
+	setUpDiscoveryTest(t, "2600:1234::/32")
+	viper.Set("ScanTargetNetworks", "2600:1234::/32@3,2600:5678::/32")
+	viper.Set("PingScanRetries", 0)
+	targetNetworks, err := config.GetTargetNetworks()
+	assert.Nil(t, err)
+
+	assert.Nil(t, RunState(context.Background(), newTestRand(), GEN_ADDRESSES))
+	candPath, err := data.GetCurrentFilePathFromDir(config.GetCandidateAddressDirPath())
+	assert.Nil(t, err)
+	candidates, err := fs.ReadIPsFromHexFile(candPath)
+	assert.Nil(t, err)
+	var inSecond []addressing.IPv6
+	for _, candidate := range candidates {
+		if candidate.In(targetNetworks[1].Network) {
+			inSecond = append(inSecond, candidate)
+		} else {
+			assert.True(t, candidate.In(targetNetworks[0].Network))
+		}
+	}
+	assert.Equal(t, 375, len(candidates)-len(inSecond))
+	assert.Equal(t, 125, len(inSecond))
+
+	// Each target network has a Bloom filter of its own
+	for _, target := range targetNetworks {
+		bloomPath, err := data.GetCurrentFilePathFromDir(config.GetBloomDirPathForTarget(target.Network))
+		assert.Nil(t, err)
+		assert.NotEmpty(t, bloomPath)
+	}
+
+	// Hits are tallied against the target network they were found in
+	network := prober.NewFakeNetwork([]net.IP{inSecond[0].ToIP(), inSecond[1].ToIP()}, nil)
+	prober.SetFactory(network.Factory())
+	defer prober.ResetFactory()
+	assert.Nil(t, RunState(context.Background(), newTestRand(), PING_SCAN_ADDR))
+	stats, err := data.GetTargetStats()
+	assert.Nil(t, err)
+	assert.Equal(t, &data.HitStats{Candidates: 375, Hits: 0}, stats[targetNetworks[0].String()])
+	assert.Equal(t, &data.HitStats{Candidates: 125, Hits: 2}, stats[targetNetworks[1].String()])
+
+	// Hits are also tallied against the region they were found in
+	regionStats, err := data.GetRegionStats()
+	assert.Nil(t, err)
+	_, region, _ := net.ParseCIDR(inSecond[0].String() + "/48")
+	assert.True(t, regionStats[region.String()].Hits > 0)
+	assert.True(t, regionStats[region.String()].Candidates >= regionStats[region.String()].Hits)
+}
+
+func TestStateMachine_RunStateGeneratesFromSpaceTree(t *testing.T) {
+	setUpDiscoveryTest(t, "2600:1234::/32")
+	viper.Set("CandidateGenerator", modeling.SpaceTreeGeneratorType)
+	_, seedNet, _ := net.ParseCIDR("2600:1234:0:1::/64")
+
+	// Without any discovered addresses the cluster model is used instead
+	generator, err := getCandidateGenerator()
+	assert.Nil(t, err)
+	assert.IsType(t, &modeling.ClusterModel{}, generator)
+
+	// Once there are discovered addresses the candidates are drawn from the regions around them
+	var seeds []string
+	for i := 0; i < 256; i++ {
+		seeds = append(seeds, addressing.IPv6{High: 0x2600123400000001, Low: uint64(i)}.String())
+	}
+	assert.Nil(t, fs.WriteStringsToFile(seeds, config.GetOutputFilePath()))
+	generator, err = getCandidateGenerator()
+	assert.Nil(t, err)
+	assert.IsType(t, &modeling.SpaceTree{}, generator)
+
+	assert.Nil(t, RunState(context.Background(), newTestRand(), GEN_ADDRESSES))
+	candPath, err := data.GetCurrentFilePathFromDir(config.GetCandidateAddressDirPath())
+	assert.Nil(t, err)
+	candidates, err := fs.ReadIPsFromHexFile(candPath)
+	assert.Nil(t, err)
+	assert.Len(t, candidates, 500)
+	inSeedNet := 0
+	for _, candidate := range candidates {
+		assert.False(t, candidate.High == 0x2600123400000001 && candidate.Low < 256)
+		if candidate.In(seedNet) {
+			inSeedNet++
+		}
+	}
+	assert.True(t, inSeedNet > 100)
+}
+
+func TestStateMachine_SeededRunsGenerateIdenticalCandidates(t *testing.T) {
+	generate := func(generatorType string, seed int64) []byte {
+		setUpDiscoveryTest(t, "2600:1234::/32")
+		viper.Set("CandidateGenerator", generatorType)
+		var seeds []string
+		for i := 0; i < 256; i++ {
+			seeds = append(seeds, addressing.IPv6{High: 0x2600123400000001 + uint64(i%4)<<16, Low: uint64(i)}.String())
+		}
+		assert.Nil(t, fs.WriteStringsToFile(seeds, config.GetOutputFilePath()))
+		assert.Nil(t, RunState(context.Background(), rand.New(rand.NewSource(seed)), GEN_ADDRESSES))
+		candPath, err := data.GetCurrentFilePathFromDir(config.GetCandidateAddressDirPath())
+		assert.Nil(t, err)
+		content, err := ioutil.ReadFile(candPath)
+		assert.Nil(t, err)
+		return content
+	}
+	for _, generatorType := range modeling.GetGeneratorTypes() {
+		first := generate(generatorType, 666)
+		assert.NotEmpty(t, first)
+		assert.Equal(t, first, generate(generatorType, 666), generatorType)
+		assert.NotEqual(t, first, generate(generatorType, 667), generatorType)
+	}
+}
+
+func TestStateMachine_RunStateSkipsUnroutedNetworks(t *testing.T) {
+	setUpDiscoveryTest(t, "2600:1234::/32")
+	viper.Set("UnroutedNetworkThreshold", 1)
+	viper.Set("UnroutedNetworkLength", 36)
+
+	assert.Nil(t, RunState(context.Background(), newTestRand(), GEN_ADDRESSES))
+	candPath, err := data.GetCurrentFilePathFromDir(config.GetCandidateAddressDirPath())
+	assert.Nil(t, err)
+	candidates, err := fs.ReadIPsFromHexFile(candPath)
+	assert.Nil(t, err)
+
+	// Every candidate within the /36 of the first candidate gets a "no route" error back
+	_, unroutedNet, _ := net.ParseCIDR(candidates[0].String() + "/36")
+	network := prober.NewFakeNetwork(nil, nil)
+	network.AddUnrouted(unroutedNet)
+	prober.SetFactory(network.Factory())
+	defer prober.ResetFactory()
+
+	assert.Nil(t, RunState(context.Background(), newTestRand(), PING_SCAN_ADDR))
+
+	// The errors were recorded and the network was tallied
+	errorsPath, err := data.GetCurrentFilePathFromDir(config.GetICMPErrorDirPath())
+	assert.Nil(t, err)
+	count, err := fs.CountLinesInFile(errorsPath)
+	assert.Nil(t, err)
+	assert.True(t, count > 0)
+	counts, err := data.GetUnroutedNetworkCounts()
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]int{unroutedNet.String(): 1}, counts)
+
+	// No more candidates are generated within the unrouted network
+	assert.Nil(t, RunState(context.Background(), newTestRand(), GEN_ADDRESSES))
+	candPath, err = data.GetCurrentFilePathFromDir(config.GetCandidateAddressDirPath())
+	assert.Nil(t, err)
+	candidates, err = fs.ReadIPsFromHexFile(candPath)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, candidates)
+	for _, candidate := range candidates {
+		assert.False(t, candidate.In(unroutedNet))
+	}
+}
+
+func setUnroutedNetworkCounts(t *testing.T, counts map[string]int) {
+	outputPath := fs.GetTimedFilePath(config.GetUnroutedNetworkDirPath())
+	assert.Nil(t, addressing.WriteIPv6NetworkCountsToFile(outputPath, counts))
+	data.UpdateUnroutedNetworkCounts(counts, outputPath)
+}
+
+func TestStateMachine_RunStateSkipsUnroutedTargets(t *testing.T) {
+	setUpDiscoveryTest(t, "2600:1234:5678:9a00::/56")
+	viper.Set("UnroutedNetworkThreshold", 1)
+	setUnroutedNetworkCounts(t, map[string]int{"2600:1234:5678::/48": 1})
+
+	// Every candidate in the target would be rejected, so the target is not generated in at all
+	assert.NotNil(t, RunState(context.Background(), newTestRand(), GEN_ADDRESSES))
+}
+
+func TestStateMachine_RunStateCapsUnroutedRejects(t *testing.T) {
+	setUpDiscoveryTest(t, "2600:1234::/32")
+	viper.Set("UnroutedNetworkThreshold", 1)
+	viper.Set("UnroutedNetworkLength", 33)
+	viper.Set("UnroutedRejectMultiple", 0.1)
+	setUnroutedNetworkCounts(t, map[string]int{"2600:1234::/33": 1})
+
+	// Half of the target is unrouted, so generation gives up on it well before making all of its addresses
+	assert.Nil(t, RunState(context.Background(), newTestRand(), GEN_ADDRESSES))
+	candPath, err := data.GetCurrentFilePathFromDir(config.GetCandidateAddressDirPath())
+	assert.Nil(t, err)
+	count, err := fs.CountLinesInFile(candPath)
+	assert.Nil(t, err)
+	assert.True(t, count < 500)
+}
+
+func TestUpdateUnroutedNetworks_ClearsNetworksWithLiveReplies(t *testing.T) {
+	setUpDiscoveryTest(t, "2600:1234::/32")
+	viper.Set("UnroutedNetworkLength", 48)
+	setUnroutedNetworkCounts(t, map[string]int{"2600:1234:1::/48": 2, "2600:1234:2::/48": 5})
+	resultsPath := filepath.Join(t.TempDir(), "results")
+	assert.Nil(t, fs.WriteStringsToFile([]string{"2600:1234:2::1 retried"}, resultsPath))
+
+	assert.Nil(t, updateUnroutedNetworks("", resultsPath))
+	counts, err := data.GetUnroutedNetworkCounts()
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]int{"2600:1234:1::/48": 2}, counts)
+}
+
+func TestStateMachine_RunStateUpdatesClusterModel(t *testing.T) {
+	setUpDiscoveryTest(t, "2600:1234::/32")
+	before, err := data.GetProbabilisticClusterModel()
+	assert.Nil(t, err)
+	version := before.Version
+
+	// Write a batch of clean ping results for the model to learn from
+	writer, err := fs.NewBinaryIPWriter(fs.GetTimedFilePath(config.GetCleanPingDirPath()))
+	assert.Nil(t, err)
+	for i := uint64(1); i <= 10; i++ {
+		assert.Nil(t, writer.Write(addressing.IPv6{High: 0x2600123400000000, Low: i}))
+	}
+	assert.Nil(t, writer.Close())
+
+	assert.Nil(t, RunState(context.Background(), newTestRand(), UPDATE_MODEL))
+	modelPath, err := data.GetCurrentFilePathFromDir(config.GetGeneratedModelDirPath())
+	assert.Nil(t, err)
+	model, err := data.GetProbabilisticClusterModel()
+	assert.Nil(t, err)
+	assert.Equal(t, version+1, model.Version)
+
+	// The saved model is used from here on, and the same batch is not folded in twice
+	loaded, err := modeling.LoadModelFromFile(modelPath)
+	assert.Nil(t, err)
+	assert.Equal(t, version+1, loaded.Version)
+	assert.Nil(t, RunState(context.Background(), newTestRand(), UPDATE_MODEL))
+	latestPath, err := data.GetCurrentFilePathFromDir(config.GetGeneratedModelDirPath())
+	assert.Nil(t, err)
+	assert.Equal(t, modelPath, latestPath)
+	model, err = data.GetProbabilisticClusterModel()
+	assert.Nil(t, err)
+	assert.Equal(t, version+1, model.Version)
+
+	// A batch written after the model was touched is still folded in
+	writer, err = fs.NewBinaryIPWriter(fs.GetTimedFilePath(config.GetCleanPingDirPath()))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Write(addressing.IPv6{High: 0x2600123400000001, Low: 1}))
+	assert.Nil(t, writer.Close())
+	future := time.Now().Add(time.Hour)
+	assert.Nil(t, os.Chtimes(modelPath, future, future))
+	assert.Nil(t, RunState(context.Background(), newTestRand(), UPDATE_MODEL))
+	model, err = data.GetProbabilisticClusterModel()
+	assert.Nil(t, err)
+	assert.Equal(t, version+2, model.Version)
+	assert.Len(t, model.Metadata.UpdateBatches, 2)
+}
+
+func TestStateMachine_RunStateResumesPingScanFromCheckpoint(t *testing.T) {
+	setUpDiscoveryTest(t, "2600:1234::/32")
+	viper.Set("PingScanRetries", 0)
+	assert.Nil(t, RunState(context.Background(), newTestRand(), GEN_ADDRESSES))
+	candPath, err := data.GetCurrentFilePathFromDir(config.GetCandidateAddressDirPath())
+	assert.Nil(t, err)
+	candidates, err := fs.ReadIPsFromHexFile(candPath)
+	assert.Nil(t, err)
+
+	// One live address was found before the interruption, and one is in the part that is left to scan
+	live := []net.IP{candidates[0].ToIP(), candidates[len(candidates)-1].ToIP()}
+	network := prober.NewFakeNetwork(live, nil)
+	prober.SetFactory(network.Factory())
+	defer prober.ResetFactory()
+	resultsPath := fs.GetTimedFilePath(config.GetPingResultDirPath())
+	assert.Nil(t, fs.WriteStringsToFile([]string{candidates[0].String()}, resultsPath))
+	data.RecordFile(resultsPath)
+	checkpoint := data.GetCheckpoint()
+	checkpoint.State = int(PING_SCAN_ADDR)
+	checkpoint.Progress = &data.StateProgress{CandidateOffset: len(candidates) - 10}
+
+	assert.Nil(t, RunState(context.Background(), newTestRand(), PING_SCAN_ADDR))
+	assert.EqualValues(t, 10, network.GetProbeCount())
+	results, err := fs.ReadIPsFromHexFile(resultsPath)
+	assert.Nil(t, err)
+	assert.Equal(t, []addressing.IPv6{candidates[0], candidates[len(candidates)-1]}, results)
+	assert.Nil(t, checkpoint.Progress)
+}
+
+func TestStateMachine_InterruptedRunSavesCheckpoint(t *testing.T) {
+	setUpDiscoveryTest(t, "2600:1234::/32")
+	assert.Nil(t, RunState(context.Background(), newTestRand(), GEN_ADDRESSES))
+	candPath, err := data.GetCurrentFilePathFromDir(config.GetCandidateAddressDirPath())
+	assert.Nil(t, err)
+	data.GetCheckpoint().State = int(PING_SCAN_ADDR)
+	network := prober.NewFakeNetwork(nil, nil)
+	prober.SetFactory(network.Factory())
+	defer prober.ResetFactory()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, RunStateMachine(ctx, newTestRand()))
+	checkpoint, err := data.LoadCheckpoint()
+	assert.Nil(t, err)
+	assert.Equal(t, int(PING_SCAN_ADDR), checkpoint.State)
+	assert.NotNil(t, checkpoint.Progress)
+	assert.Equal(t, 0, checkpoint.Progress.CandidateOffset)
+	assert.Equal(t, candPath, checkpoint.Files[filepath.Base(config.GetCandidateAddressDirPath())])
+	assert.NotEmpty(t, checkpoint.Files[filepath.Base(config.GetPingResultDirPath())])
+}
+
+func TestStateMachine_GetNextStateFollowsLoopOrder(t *testing.T) {
+	assert.Equal(t, FAN_OUT_PATTERNS, getNextState(FAN_OUT_64_ALIAS_REMOVAL))
+	assert.Equal(t, UPDATE_MODEL, getNextState(FAN_OUT_PATTERNS_ALIAS_REMOVAL))
+	assert.Equal(t, GEN_ADDRESSES, getNextState(EMIT_METRICS))
+	assert.Len(t, stateOrder, int(LAST_STATE-FIRST_STATE)+1)
+}
+
+func TestStateMachine_StateValuesAreAppendOnly(t *testing.T) {
+	// The values are recorded in checkpoints and state files and name the per-state timers, so states that
+	// have been released keep theirs
+	assert.Equal(t, State(6), FAN_OUT_64_ALIAS_REMOVAL)
+	assert.Equal(t, State(7), CLEAN_UP)
+	assert.Equal(t, State(8), EMIT_METRICS)
+	assert.Equal(t, State(10), FAN_OUT_PATTERNS_ALIAS_REMOVAL)
+}
@@ -0,0 +1,105 @@
+package statemachine
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/data"
+	"github.com/ekaley/ipv666/internal/fs"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/modeling"
+	"github.com/rcrowley/go-metrics"
+	"path/filepath"
+	"time"
+)
+
+var modelUpdateDurationTimer = metrics.NewTimer()
+var modelUpdateCapturedCount = metrics.NewCounter()
+var modelUpdateDustCount = metrics.NewCounter()
+
+func init() {
+	metrics.Register("modelupdate.update.time", modelUpdateDurationTimer)
+	metrics.Register("modelupdate.captured.count", modelUpdateCapturedCount)
+	metrics.Register("modelupdate.dust.count", modelUpdateDustCount)
+}
+
+// Get the names of the batches of clean ping results in the directory that the model has not been updated
+// with yet, along with the names of the ones it has been updated with that are still there. The batches
+// are told apart by the names recorded in the model rather than by when they were written, so that a model
+// that is copied, touched or restored from a backup still picks up the batches that it is missing.
+func getCleanPingBatches(model *modeling.ClusterModel, cleanDir string) ([]string, []string, error) {
+	fileNames, err := fs.GetFilesFromDirectory(cleanDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	processed := make(map[string]bool)
+	if model.Metadata != nil {
+		for _, fileName := range model.Metadata.UpdateBatches {
+			processed[fileName] = true
+		}
+	}
+	var toProcess, stillProcessed []string
+	for _, fileName := range fileNames {
+		if processed[fileName] {
+			stillProcessed = append(stillProcessed, fileName)
+		} else {
+			toProcess = append(toProcess, fileName)
+		}
+	}
+	return toProcess, stillProcessed, nil
+}
+
+// Fold every batch of clean ping results that the model has not seen yet into the cluster model, then save
+// the result as a new version of the model for later loops to generate candidates from
+func updateClusterModel() error {
+	model, err := data.GetProbabilisticClusterModel()
+	if err != nil {
+		return err
+	}
+	cleanDir := config.GetCleanPingDirPath()
+	fileNames, processed, err := getCleanPingBatches(model, cleanDir)
+	if err != nil {
+		return err
+	}
+	var addrs []addressing.IPv6
+	for _, fileName := range fileNames {
+		filePath := filepath.Join(cleanDir, fileName)
+		logging.Debugf("Reading clean ping results from path '%s' to update cluster model.", filePath)
+		err := fs.ForEachIPInBinaryFile(filePath, func(addr addressing.IPv6) error {
+			addrs = append(addrs, addr)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(addrs) == 0 {
+		logging.Infof("No new clean ping results found in %d files. Leaving cluster model as-is.", len(fileNames))
+		return nil
+	}
+	logging.Infof("Updating cluster model with %d addresses from %d batches of clean ping results.", len(addrs), len(fileNames))
+	start := time.Now()
+	captured, dust := model.Update(addrs)
+	elapsed := time.Since(start)
+	modelUpdateDurationTimer.Update(elapsed)
+	modelUpdateCapturedCount.Inc(int64(captured))
+	modelUpdateDustCount.Inc(int64(dust))
+	logging.Infof("Updated cluster model in %s (%d addresses captured by existing clusters, %d added to nybble counts).", elapsed, captured, dust)
+
+	// Only the batches that are still on disk need to be remembered, as the rest have been cleaned up
+	if model.Metadata == nil {
+		model.Metadata = &modeling.ModelMetadata{
+			GeneratorType: modeling.ClusterGeneratorType,
+			CreatedAt:     time.Now().UTC(),
+		}
+	}
+	model.Metadata.UpdateBatches = append(processed, fileNames...)
+	outputPath := fs.GetTimedFilePath(config.GetGeneratedModelDirPath())
+	logging.Debugf("Writing version %d of cluster model to file at path '%s'.", model.Version, outputPath)
+	err = model.Save(outputPath)
+	if err != nil {
+		return err
+	}
+	data.UpdateClusterModel(model, outputPath)
+	logging.Infof("Version %d of cluster model successfully written to path '%s'.", model.Version, outputPath)
+	return nil
+}
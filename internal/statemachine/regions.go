@@ -0,0 +1,158 @@
+package statemachine
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/data"
+	"github.com/ekaley/ipv666/internal/fs"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/rcrowley/go-metrics"
+	"github.com/spf13/viper"
+	"math"
+	"net"
+	"sort"
+)
+
+var regionTrackedGauge = metrics.NewGauge()
+var regionExploitedGauge = metrics.NewGauge()
+var regionExploitCount = metrics.NewCounter()
+var regionExploreCount = metrics.NewCounter()
+var regionHitRateHistogram = metrics.NewHistogram(metrics.NewUniformSample(1028)) // Hit rates in parts per million
+
+func init() {
+	metrics.Register("regions.tracked.gauge", regionTrackedGauge)
+	metrics.Register("regions.exploited.gauge", regionExploitedGauge)
+	metrics.Register("regions.exploit.count", regionExploitCount)
+	metrics.Register("regions.explore.count", regionExploreCount)
+	metrics.Register("regions.hit_rate.histogram", regionHitRateHistogram)
+}
+
+// A number of addresses to generate within a network
+type regionBudget struct {
+	network *net.IPNet
+	count   int
+}
+
+// The number of candidates' worth of weight given to the hit rate across all of the productive regions in
+// a target network when estimating the hit rate of a single region, as is done for target networks. This
+// keeps a region that has only had a handful of candidates from taking the whole exploitation budget.
+const regionPriorCandidates = targetPriorCandidates
+
+// A region that has had hits, along with its estimated hit rate
+type productiveRegion struct {
+	network *net.IPNet
+	rate    float64
+}
+
+// Split the addresses to generate in a target network between exploring the target network as a whole
+// and exploiting the regions within it that have had the best hit rates so far. The exploration share is
+// always generated across the whole target network (and makes up the whole budget until some region has a
+// hit), and the rest is split between the productive regions in proportion to their hit rates, which are
+// smoothed towards the hit rate across all of them. Regions that skip returns true for (ie: ones that are
+// blacklisted) are not exploited.
+func getRegionBudgets(targetNetwork *net.IPNet, stats map[string]*data.HitStats, count int, skip func(*net.IPNet) bool) []*regionBudget {
+	targetLength, _ := targetNetwork.Mask.Size()
+	if targetLength >= viper.GetInt("RegionPrefixLength") {
+		return []*regionBudget{{network: targetNetwork, count: count}}
+	}
+
+	var regions []*productiveRegion
+	var regionStats []*data.HitStats
+	totalHits, totalCandidates := 0, 0
+	for region, curStats := range stats {
+		if curStats.Hits == 0 || curStats.Candidates == 0 {
+			continue
+		}
+		_, network, err := net.ParseCIDR(region)
+		if err != nil || !targetNetwork.Contains(network.IP) || skip(network) {
+			continue
+		}
+		regions = append(regions, &productiveRegion{network: network})
+		regionStats = append(regionStats, curStats)
+		totalHits += curStats.Hits
+		totalCandidates += curStats.Candidates
+	}
+	priorRate := float64(totalHits+1) / float64(totalCandidates+1)
+	for i, region := range regions {
+		region.rate = (float64(regionStats[i].Hits) + priorRate*regionPriorCandidates) / (float64(regionStats[i].Candidates) + regionPriorCandidates)
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		if regions[i].rate != regions[j].rate {
+			return regions[i].rate > regions[j].rate
+		}
+		return regions[i].network.String() < regions[j].network.String()
+	})
+	if len(regions) > viper.GetInt("RegionMaxExploited") {
+		regions = regions[:viper.GetInt("RegionMaxExploited")]
+	}
+	if len(regions) == 0 {
+		return []*regionBudget{{network: targetNetwork, count: count}}
+	}
+
+	exploreCount := int(math.Ceil(float64(count) * viper.GetFloat64("RegionExplorationShare")))
+	scores := make([]float64, len(regions))
+	for i, region := range regions {
+		scores[i] = region.rate
+	}
+	toReturn := []*regionBudget{{network: targetNetwork, count: exploreCount}}
+	for i, regionCount := range splitBudget(count-exploreCount, scores) {
+		if regionCount > 0 {
+			toReturn = append(toReturn, &regionBudget{network: regions[i].network, count: regionCount})
+		}
+	}
+	logging.Infof("Directing %d addresses to %d productive regions in %s and exploring the rest of it with %d addresses.", count-exploreCount, len(toReturn)-1, targetNetwork, exploreCount)
+	return toReturn
+}
+
+// Get the region that the address falls in
+func getRegionForIP(ip addressing.IPv6, mask net.IPMask) string {
+	return (&net.IPNet{IP: ip.ToIP().Mask(mask), Mask: mask}).String()
+}
+
+// Add the candidates from a completed ping scan and the live addresses that it found to the statistics
+// of the regions that they fall in. Only regions that have had a hit are tracked, so the hits are tallied
+// first and candidates are only tallied for tracked regions.
+func updateRegionStats(candidatePath string, resultsPath string) error {
+	targets, err := config.GetTargetNetworks()
+	if err != nil {
+		return err
+	}
+	stats, err := data.GetRegionStats()
+	if err != nil {
+		return err
+	}
+	mask := net.CIDRMask(viper.GetInt("RegionPrefixLength"), 8*net.IPv6len)
+	err = fs.ForEachIPInHexFile(resultsPath, func(ip addressing.IPv6) error {
+		if config.GetTargetNetworkForIP(targets, ip.ToIP()) == nil {
+			return nil
+		}
+		region := getRegionForIP(ip, mask)
+		regionStats, ok := stats[region]
+		if !ok {
+			regionStats = &data.HitStats{}
+			stats[region] = regionStats
+		}
+		regionStats.Hits++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = fs.ForEachIPInHexFile(candidatePath, func(ip addressing.IPv6) error {
+		if regionStats, ok := stats[getRegionForIP(ip, mask)]; ok {
+			regionStats.Candidates++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	regionTrackedGauge.Update(int64(len(stats)))
+	for _, regionStats := range stats {
+		if regionStats.Candidates > 0 {
+			regionHitRateHistogram.Update(int64(1e6 * float64(regionStats.Hits) / float64(regionStats.Candidates)))
+		}
+	}
+	logging.Infof("Tracking hit rates for %d regions.", len(stats))
+	return data.SaveRegionStats(stats)
+}
@@ -0,0 +1,85 @@
+package statemachine
+
+import (
+	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/data"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func noSkip(*net.IPNet) bool {
+	return false
+}
+
+func TestGetRegionBudgets_ExploresWithoutHits(t *testing.T) {
+	config.InitConfig()
+	_, target, _ := net.ParseCIDR("2600:1234::/32")
+	budgets := getRegionBudgets(target, map[string]*data.HitStats{"2600:1234:1::/48": {Candidates: 100}}, 1000, noSkip)
+	assert.Equal(t, 1, len(budgets))
+	assert.Equal(t, target, budgets[0].network)
+	assert.Equal(t, 1000, budgets[0].count)
+}
+
+func TestGetRegionBudgets_ExploitsProductiveRegions(t *testing.T) {
+	config.InitConfig()
+	viper.Set("RegionExplorationShare", 0.2)
+	_, target, _ := net.ParseCIDR("2600:1234::/32")
+	stats := map[string]*data.HitStats{
+		"2600:1234:1::/48": {Candidates: 100000, Hits: 30000},
+		"2600:1234:2::/48": {Candidates: 100000, Hits: 10000},
+		"2600:5678:1::/48": {Candidates: 100000, Hits: 50000},
+	}
+	budgets := getRegionBudgets(target, stats, 1000, noSkip)
+	assert.Equal(t, 3, len(budgets))
+	assert.Equal(t, target, budgets[0].network)
+	assert.Equal(t, 200, budgets[0].count)
+	assert.Equal(t, "2600:1234:1::/48", budgets[1].network.String())
+	assert.Equal(t, 598, budgets[1].count)
+	assert.Equal(t, "2600:1234:2::/48", budgets[2].network.String())
+	assert.Equal(t, 202, budgets[2].count)
+}
+
+func TestGetRegionBudgets_SmoothsRegionsWithFewCandidates(t *testing.T) {
+	config.InitConfig()
+	viper.Set("RegionExplorationShare", 0.2)
+	_, target, _ := net.ParseCIDR("2600:1234::/32")
+	stats := map[string]*data.HitStats{
+		"2600:1234:1::/48": {Candidates: 1, Hits: 1},
+		"2600:1234:2::/48": {Candidates: 10000, Hits: 1000},
+	}
+
+	// A single lucky hit is not enough to take the exploitation budget from a region with a long record
+	budgets := getRegionBudgets(target, stats, 1000, noSkip)
+	assert.Equal(t, 3, len(budgets))
+	assert.Equal(t, "2600:1234:1::/48", budgets[1].network.String())
+	assert.True(t, budgets[1].count < 500)
+	assert.True(t, budgets[2].count > 300)
+}
+
+func TestGetRegionBudgets_SkipsAndLimitsRegions(t *testing.T) {
+	config.InitConfig()
+	viper.Set("RegionMaxExploited", 1)
+	defer viper.Set("RegionMaxExploited", 256)
+	_, target, _ := net.ParseCIDR("2600:1234::/32")
+	stats := map[string]*data.HitStats{
+		"2600:1234:1::/48": {Candidates: 100, Hits: 30},
+		"2600:1234:2::/48": {Candidates: 100, Hits: 20},
+		"2600:1234:3::/48": {Candidates: 100, Hits: 10},
+	}
+	_, blacklisted, _ := net.ParseCIDR("2600:1234:1::/48")
+	budgets := getRegionBudgets(target, stats, 1000, func(region *net.IPNet) bool {
+		return region.String() == blacklisted.String()
+	})
+	assert.Equal(t, 2, len(budgets))
+	assert.Equal(t, "2600:1234:2::/48", budgets[1].network.String())
+}
+
+func TestGetRegionBudgets_SmallTarget(t *testing.T) {
+	config.InitConfig()
+	_, target, _ := net.ParseCIDR("2600:1234:1:1::/64")
+	budgets := getRegionBudgets(target, map[string]*data.HitStats{"2600:1234:1::/48": {Candidates: 100, Hits: 30}}, 1000, noSkip)
+	assert.Equal(t, 1, len(budgets))
+	assert.Equal(t, target, budgets[0].network)
+}
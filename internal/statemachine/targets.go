@@ -0,0 +1,116 @@
+package statemachine
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/data"
+	"github.com/ekaley/ipv666/internal/fs"
+	"github.com/ekaley/ipv666/internal/logging"
+)
+
+// The number of candidates' worth of weight given to the hit rate across all target networks when
+// estimating the hit rate of a single target network. This keeps target networks with little history
+// (ie: ones that were just added) from being either starved or flooded.
+const targetPriorCandidates = 1000
+
+// Split the total number of addresses to generate between the target networks in proportion to each
+// network's weight multiplied by its estimated hit rate. Target networks without any statistics are
+// estimated at the hit rate seen across all of the target networks.
+func getTargetBudgets(targets []*config.TargetNetwork, stats map[string]*data.HitStats, total int) []int {
+	totalHits, totalCandidates := 0, 0
+	for _, target := range targets {
+		if targetStats, ok := stats[target.String()]; ok {
+			totalHits += targetStats.Hits
+			totalCandidates += targetStats.Candidates
+		}
+	}
+	priorRate := float64(totalHits+1) / float64(totalCandidates+1)
+	scores := make([]float64, len(targets))
+	for i, target := range targets {
+		hits, candidates := 0, 0
+		if targetStats, ok := stats[target.String()]; ok {
+			hits, candidates = targetStats.Hits, targetStats.Candidates
+		}
+		rate := (float64(hits) + priorRate*targetPriorCandidates) / (float64(candidates) + targetPriorCandidates)
+		scores[i] = target.Weight * rate
+	}
+	budgets := splitBudget(total, scores)
+	for i, target := range targets {
+		logging.Debugf("Target network %s (weight %.2f, score %.6f) was given %d addresses to generate.", target, target.Weight, scores[i], budgets[i])
+	}
+	return budgets
+}
+
+// Split the total between scores in proportion to each score. The whole shares are handed out first,
+// then the leftovers go to the largest fractional shares.
+func splitBudget(total int, scores []float64) []int {
+	scoreSum := 0.0
+	for _, score := range scores {
+		scoreSum += score
+	}
+	budgets := make([]int, len(scores))
+	if scoreSum <= 0 {
+		return budgets
+	}
+	remainders := make([]float64, len(scores))
+	assigned := 0
+	for i := range scores {
+		share := float64(total) * scores[i] / scoreSum
+		budgets[i] = int(share)
+		remainders[i] = share - float64(budgets[i])
+		assigned += budgets[i]
+	}
+	for ; assigned < total; assigned++ {
+		largest := 0
+		for i := range remainders {
+			if remainders[i] > remainders[largest] {
+				largest = i
+			}
+		}
+		budgets[largest]++
+		remainders[largest] = -1
+	}
+	return budgets
+}
+
+// Add the candidates from a completed ping scan and the live addresses that it found to the statistics
+// of the target networks that they fall in
+func updateTargetStats(candidatePath string, resultsPath string) error {
+	targets, err := config.GetTargetNetworks()
+	if err != nil {
+		return err
+	}
+	stats, err := data.GetTargetStats()
+	if err != nil {
+		return err
+	}
+	tally := func(filePath string, count func(*data.HitStats)) error {
+		return fs.ForEachIPInHexFile(filePath, func(ip addressing.IPv6) error {
+			target := config.GetTargetNetworkForIP(targets, ip.ToIP())
+			if target == nil {
+				return nil
+			}
+			targetStats, ok := stats[target.String()]
+			if !ok {
+				targetStats = &data.HitStats{}
+				stats[target.String()] = targetStats
+			}
+			count(targetStats)
+			return nil
+		})
+	}
+	err = tally(candidatePath, func(targetStats *data.HitStats) { targetStats.Candidates++ })
+	if err != nil {
+		return err
+	}
+	err = tally(resultsPath, func(targetStats *data.HitStats) { targetStats.Hits++ })
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		if targetStats, ok := stats[target.String()]; ok {
+			logging.Infof("Target network %s has had %d hits out of %d candidates scanned.", target, targetStats.Hits, targetStats.Candidates)
+		}
+	}
+	return data.SaveTargetStats(stats)
+}
@@ -0,0 +1,42 @@
+package statemachine
+
+import (
+	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/data"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func getTestTargets(t *testing.T, specs ...string) []*config.TargetNetwork {
+	var toReturn []*config.TargetNetwork
+	for _, spec := range specs {
+		target, err := config.ParseTargetNetwork(spec)
+		assert.Nil(t, err)
+		toReturn = append(toReturn, target)
+	}
+	return toReturn
+}
+
+func TestGetTargetBudgets_SplitsByWeight(t *testing.T) {
+	targets := getTestTargets(t, "2600:1::/32@3", "2600:2::/32", "2600:3::/32")
+	budgets := getTargetBudgets(targets, map[string]*data.HitStats{}, 1000)
+	assert.Equal(t, []int{600, 200, 200}, budgets)
+}
+
+func TestGetTargetBudgets_AssignsWholeTotal(t *testing.T) {
+	targets := getTestTargets(t, "2600:1::/32", "2600:2::/32", "2600:3::/32")
+	budgets := getTargetBudgets(targets, map[string]*data.HitStats{}, 100)
+	assert.Equal(t, 100, budgets[0]+budgets[1]+budgets[2])
+}
+
+func TestGetTargetBudgets_FavorsHigherHitRates(t *testing.T) {
+	targets := getTestTargets(t, "2600:1::/32", "2600:2::/32", "2600:3::/32")
+	stats := map[string]*data.HitStats{
+		"2600:1::/32": {Candidates: 10000, Hits: 100},
+		"2600:2::/32": {Candidates: 10000, Hits: 0},
+	}
+	budgets := getTargetBudgets(targets, stats, 1000)
+	assert.True(t, budgets[0] > budgets[2])
+	assert.True(t, budgets[2] > budgets[1])
+	assert.True(t, budgets[1] > 0)
+}
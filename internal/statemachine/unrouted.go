@@ -0,0 +1,135 @@
+package statemachine
+
+import (
+	"github.com/ekaley/ipv666/internal/addressing"
+	"github.com/ekaley/ipv666/internal/blacklist"
+	"github.com/ekaley/ipv666/internal/config"
+	"github.com/ekaley/ipv666/internal/data"
+	"github.com/ekaley/ipv666/internal/fs"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/pingscan"
+	"github.com/rcrowley/go-metrics"
+	"github.com/spf13/viper"
+	"net"
+)
+
+var unroutedNetsGauge = metrics.NewGauge()
+
+func init() {
+	metrics.Register("unrouted.networks.gauge", unroutedNetsGauge)
+}
+
+// Fold the "no route" errors received during a single scan into the running tally of unrouted networks.
+// A network that a live reply came from (as recorded in the scan's results file) is routed after all, so
+// its tally is cleared rather than leaving it excluded for good after a brief outage.
+func updateUnroutedNetworks(errorsPath string, resultsPath string) error {
+
+	length := uint8(viper.GetInt("UnroutedNetworkLength"))
+	scanNets := make(map[string]struct{})
+	if errorsPath == "" {
+		logging.Debugf("No ICMPv6 errors were received during the last scan.")
+	} else {
+		scanErrors, err := pingscan.ReadErrorsFromFile(errorsPath)
+		if err != nil {
+			logging.Warnf("Error thrown when reading ICMPv6 errors from file '%s': %s", errorsPath, err)
+			return err
+		}
+
+		// Each network is only counted once per scan
+		for _, scanError := range scanErrors {
+			if !scanError.IsNoRoute() {
+				continue
+			}
+			network, err := addressing.GetIPv6NetworkFromBytes(scanError.Addr.To16(), length)
+			if err != nil {
+				return err
+			}
+			scanNets[network.String()] = struct{}{}
+		}
+		logging.Debugf("%d of the %d ICMPv6 errors in file '%s' were for unrouted networks.", len(scanNets), len(scanErrors), errorsPath)
+	}
+
+	counts, err := data.GetUnroutedNetworkCounts()
+	if err != nil {
+		return err
+	}
+	routedNets, err := getRoutedNetworks(resultsPath, counts, length)
+	if err != nil {
+		return err
+	}
+	if len(scanNets) == 0 && len(routedNets) == 0 {
+		logging.Debugf("Unrouted networks are unchanged by the last scan.")
+		return nil
+	}
+
+	newCounts := make(map[string]int)
+	for k, v := range counts {
+		if _, ok := routedNets[k]; !ok {
+			newCounts[k] = v
+		}
+	}
+	for k := range scanNets {
+		if _, ok := routedNets[k]; !ok {
+			newCounts[k]++
+		}
+	}
+
+	outputPath := fs.GetTimedFilePath(config.GetUnroutedNetworkDirPath())
+	logging.Debugf("Writing counts for %d unrouted networks to file '%s'.", len(newCounts), outputPath)
+	err = addressing.WriteIPv6NetworkCountsToFile(outputPath, newCounts)
+	if err != nil {
+		return err
+	}
+	data.UpdateUnroutedNetworkCounts(newCounts, outputPath)
+
+	logging.Infof("%d networks came back as unrouted and %d tracked networks answered during the last scan (%d networks tracked in total).", len(scanNets), len(routedNets), len(newCounts))
+
+	return nil
+}
+
+// Get the tracked unrouted networks that a live address in the results file falls within
+func getRoutedNetworks(resultsPath string, counts map[string]int, length uint8) (map[string]struct{}, error) {
+	toReturn := make(map[string]struct{})
+	if resultsPath == "" || len(counts) == 0 {
+		return toReturn, nil
+	}
+	err := fs.ForEachIPInHexFile(resultsPath, func(addr addressing.IPv6) error {
+		addrBytes := addr.Bytes()
+		network, err := addressing.GetIPv6NetworkFromBytes(addrBytes[:], length)
+		if err != nil {
+			return err
+		}
+		if _, ok := counts[network.String()]; ok {
+			toReturn[network.String()] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		logging.Warnf("Error thrown when reading live addresses from file '%s': %s", resultsPath, err)
+		return nil, err
+	}
+	return toReturn, nil
+}
+
+// Get the networks that have come back "no route" often enough that candidates should no longer be
+// generated within them
+func getUnroutedNetworks() (*blacklist.NetworkBlacklist, error) {
+	counts, err := data.GetUnroutedNetworkCounts()
+	if err != nil {
+		return nil, err
+	}
+	threshold := viper.GetInt("UnroutedNetworkThreshold")
+	var nets []*net.IPNet
+	for k, v := range counts {
+		if v < threshold {
+			continue
+		}
+		_, network, err := net.ParseCIDR(k)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, network)
+	}
+	unroutedNetsGauge.Update(int64(len(nets)))
+	return blacklist.NewNetworkBlacklist(nets), nil
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/rcrowley/go-metrics"
 	"github.com/spf13/viper"
 	"io/ioutil"
-	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -29,12 +28,12 @@ type urlResponse struct {
 	UploadUrl string `json:"upload_url"`
 }
 
-func SyncIpAddresses(toSync []*net.IP, concurrent bool) {
+func SyncIpAddresses(toSync []addressing.IPv6, concurrent bool) {
 	if !checkForSync() {
 		goodTime := syncFailures[0].Add(time.Duration(viper.GetFloat64("SyncBackoffSeconds")) * time.Second)
 		logging.Warnf("Not syncing IP addresses (%d failures seen in last %d seconds, waiting until %s).", len(syncFailures), viper.GetInt("SyncBackoffSeconds"), goodTime)
 	}
-	var toRun = func(addrs []*net.IP) {
+	var toRun = func(addrs []addressing.IPv6) {
 		err := syncIpAddressesRoutine(addrs)
 		if err != nil {
 			recordFailure()
@@ -66,7 +65,7 @@ func recordFailure() {
 	}
 }
 
-func syncIpAddressesRoutine(toSync []*net.IP) error {
+func syncIpAddressesRoutine(toSync []addressing.IPv6) error {
 
 	logging.Debugf("Attempting to sync %d addresses to remote server.", len(toSync))
 
@@ -93,7 +92,7 @@ func syncIpAddressesRoutine(toSync []*net.IP) error {
 
 // https://gist.github.com/slav123/cbb3309052de5a870667
 
-func putAddressesToUrl(toPut []*net.IP, url string, client *http.Client) error {
+func putAddressesToUrl(toPut []addressing.IPv6, url string, client *http.Client) error {
 
 	logging.Debugf("Putting %d addresses to URL '%s'.", len(toPut), url)
 
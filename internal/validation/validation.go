@@ -6,7 +6,10 @@ import (
 	"github.com/ekaley/ipv666/internal/addressing"
 	"github.com/ekaley/ipv666/internal/config"
 	"github.com/ekaley/ipv666/internal/data"
+	"github.com/ekaley/ipv666/internal/fanout"
 	"github.com/ekaley/ipv666/internal/fs"
+	"github.com/ekaley/ipv666/internal/modeling"
+	"github.com/ekaley/ipv666/internal/prober"
 	"github.com/spf13/viper"
 	"net"
 	"regexp"
@@ -57,6 +60,28 @@ func ValidateOutputFileType(toCheck string) error {
 	}
 }
 
+func ValidateInputFormat(toCheck string) error {
+	return fs.ValidateInputFormat(toCheck, false)
+}
+
+func ValidateNetworkInputFormat(toCheck string) error {
+	return fs.ValidateInputFormat(toCheck, true)
+}
+
+func ValidateProbeType(toCheck string) error {
+	_, err := prober.ParseSpec(toCheck)
+	return err
+}
+
+func ValidateGeneratorType(toCheck string) error {
+	return modeling.ValidateGeneratorType(toCheck)
+}
+
+func ValidatePatternRulesFile(filePath string) error {
+	_, err := fanout.LoadPatternRules(filePath)
+	return err
+}
+
 func ValidateLogLevel(toCheck string) error {
 	if toCheck == "debug" || toCheck == "info" || toCheck == "success" || toCheck == "warning" || toCheck == "error" {
 		return nil
@@ -81,6 +106,14 @@ func ValidateFileExists(filePath string) error {
 	}
 }
 
+func ValidateRegionPrefixLength(toCheck int) error {
+	if toCheck < 4 || toCheck > 128 || toCheck%4 != 0 {
+		return fmt.Errorf("%d is not a valid region prefix length, expecting a multiple of 4 between 4 and 128", toCheck)
+	} else {
+		return nil
+	}
+}
+
 func ValidateScanBandwidth(toValidate string) error {
 	if !bandwidthRegex.Match([]byte(toValidate)) {
 		return fmt.Errorf("%s is not a valid bandwidth, expecting a number followed by K, M, or G (ex: 10M, 100K)", toValidate)
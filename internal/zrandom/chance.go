@@ -1,15 +1,13 @@
 package zrandom
 
-import (
-	"math/rand"
-)
+import "math/rand"
 
-func GenerateHostBits(bitCount int) []byte {
+func GenerateHostBits(random *rand.Rand, bitCount int) []byte {
 	var toReturn []byte
 	var curByte byte = 0x00
 	curPos := 0
 	for i := 0; i < bitCount; i++ {
-		curByte = (curByte << 1) | (byte)(uint8(rand.Intn(2)))
+		curByte = (curByte << 1) | (byte)(uint8(random.Intn(2)))
 		curPos ++
 		if curPos == 8 {
 			toReturn = append([]byte{curByte}, toReturn...)
@@ -26,13 +24,13 @@ func GenerateHostBits(bitCount int) []byte {
 	return toReturn
 }
 
-func GenerateRandomBits(bitCount uint8) []byte {
+func GenerateRandomBits(random *rand.Rand, bitCount uint8) []byte {
 	var toReturn []byte
 	var curByte byte = 0x00
 	curPos := 0
 	var i uint8
 	for i = 0; i < bitCount; i++ {
-		curByte = (curByte << 1) | (byte)(uint8(rand.Intn(2)))
+		curByte = (curByte << 1) | (byte)(uint8(random.Intn(2)))
 		curPos ++
 		if curPos == 8 {
 			toReturn = append([]byte{curByte}, toReturn...)
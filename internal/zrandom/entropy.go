@@ -20,3 +20,19 @@ func GetEntropyOfBitsFromRight(bytes []byte, count int) (float64) {
 	}
 	return result
 }
+
+// Get the Shannon entropy (in bits) of a distribution given as the number of times each value was seen
+func GetEntropyOfCounts(counts []int) float64 {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	var result float64
+	for _, count := range counts {
+		if count > 0 {
+			frequency := float64(count) / float64(total)
+			result -= frequency * (math.Log(frequency) / math.Log(2))
+		}
+	}
+	return result
+}
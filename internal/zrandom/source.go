@@ -0,0 +1,45 @@
+package zrandom
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// A source that is safe to draw from on several goroutines at once, as the global math/rand source is
+type lockedSource struct {
+	lock sync.Mutex
+	src  rand.Source
+}
+
+func (source *lockedSource) Int63() int64 {
+	source.lock.Lock()
+	defer source.lock.Unlock()
+	return source.src.Int63()
+}
+
+func (source *lockedSource) Seed(seed int64) {
+	source.lock.Lock()
+	defer source.lock.Unlock()
+	source.src.Seed(seed)
+}
+
+// The randomness that the command line passes to address generation, modeling and alias checking. It is
+// seeded from the clock unless a seed is configured, in which case the same inputs always give the same
+// addresses. Everything below the command line takes its randomness as an argument rather than drawing
+// from here.
+var random = newRand(rand.NewSource(time.Now().UTC().UnixNano()))
+
+func newRand(source rand.Source) *rand.Rand {
+	return rand.New(&lockedSource{src: source})
+}
+
+// Get the default source of randomness
+func Rand() *rand.Rand {
+	return random
+}
+
+// Replace the default source of randomness with one seeded with the given value
+func Seed(seed int64) {
+	random = newRand(rand.NewSource(seed))
+}
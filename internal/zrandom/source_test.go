@@ -0,0 +1,20 @@
+package zrandom
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestGenerateHostBits_SameSeedSameBits(t *testing.T) {
+	first := GenerateHostBits(rand.New(rand.NewSource(666)), 128)
+	assert.Equal(t, first, GenerateHostBits(rand.New(rand.NewSource(666)), 128))
+	assert.NotEqual(t, first, GenerateHostBits(rand.New(rand.NewSource(667)), 128))
+}
+
+func TestSeed_DrawsFromSeededSource(t *testing.T) {
+	Seed(666)
+	expected := rand.New(rand.NewSource(666))
+	assert.Equal(t, expected.Int63n(1000), Rand().Int63n(1000))
+	assert.Equal(t, expected.Float64(), Rand().Float64())
+}
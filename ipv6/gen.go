@@ -7,9 +7,16 @@ import (
 
 	"github.com/ekaley/ipv666/internal/data"
 	"github.com/ekaley/ipv666/internal/modeling"
+	"github.com/ekaley/ipv666/internal/zrandom"
 )
 
 func IPv6AddrGen(fromNetwork string, genCount int) ([]*net.IP, error) {
+	return IPv6AddrGenWithRand(zrandom.Rand(), fromNetwork, genCount)
+}
+
+// Generate addresses in the network drawing from the given source of randomness, so that the same seed and
+// network always give the same addresses
+func IPv6AddrGenWithRand(random *rand.Rand, fromNetwork string, genCount int) ([]*net.IP, error) {
 
 	var clusterModel *modeling.ClusterModel
 	var err error
@@ -27,10 +34,14 @@ func IPv6AddrGen(fromNetwork string, genCount int) ([]*net.IP, error) {
 	} else {
 		_, ipnet, _ := net.ParseCIDR(fromNetwork)
 		// logging.Infof("Generating addresses in specified network range of '%s'.", ipnet)
-		generatedAddrs, err = clusterModel.GenerateAddressesFromNetwork(genCount, rand.Float64(), ipnet)
+		addrs, err := clusterModel.GenerateAddressesFromNetwork(random, genCount, random.Float64(), ipnet)
 		if err != nil {
 			return nil, fmt.Errorf("generating error %s", err)
 		}
+		for _, addr := range addrs {
+			ip := addr.ToIP()
+			generatedAddrs = append(generatedAddrs, &ip)
+		}
 	}
 
 	// logging.Infof("Successfully generated %d IP addresses. Writing results to file at path '%s'.", genCount, outputPath)
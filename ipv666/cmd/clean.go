@@ -4,7 +4,9 @@ import (
 	"github.com/ekaley/ipv666/internal/app"
 	"github.com/ekaley/ipv666/internal/blacklist"
 	"github.com/ekaley/ipv666/internal/data"
+	"github.com/ekaley/ipv666/internal/fs"
 	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/validation"
 	"github.com/spf13/cobra"
 	"os"
 	"strings"
@@ -14,7 +16,9 @@ func init() {
 	var inputPath string
 	var outputPath string
 	var blacklistPath string
+	var inputFormat string
 	cleanCmd.PersistentFlags().StringVarP(&inputPath, "input", "i", "", "An input file containing IPv6 addresses to clean via a blacklist.")
+	cleanCmd.PersistentFlags().StringVar(&inputFormat, "input-format", fs.AutoFormat, "The format of the input (one of "+strings.Join(fs.GetInputFormatNames(false), ", ")+"). If auto, the format is told from the content of each input file.")
 	cleanCmd.PersistentFlags().StringVarP(&outputPath, "out", "o", "", "The file path where the cleaned results should be written to.")
 	cleanCmd.PersistentFlags().StringVarP(&blacklistPath, "blacklist", "b", "", "The local file path to the blacklist to use. If not specified, defaults to the most recent blacklist in the configured blacklist directory.")
 	cleanCmd.MarkPersistentFlagRequired("input")
@@ -22,8 +26,8 @@ func init() {
 }
 
 var cleanLongDesc = strings.TrimSpace(`
-This utility will clean the contents of an IPv6 address file (new-line delimited, 
-standard ASCII hex representation) based on the contents of an IPv6 network blacklist
+This utility will clean the contents of an IPv6 address file (in any of the formats 
+that 'convert' reads) based on the contents of an IPv6 network blacklist
 file. If no blacklist path is supplied then the utility will use the default blacklist. 
 The cleaned results will then be written to an output file.
 `)
@@ -44,6 +48,16 @@ var cleanCmd = &cobra.Command{
 			logging.ErrorStringFf("No file found at path '%s'. Please supply a valid file path.", inputPath)
 		}
 
+		inputFormat, err := cmd.PersistentFlags().GetString("input-format")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if err := validation.ValidateInputFormat(inputFormat); err != nil {
+			logging.ErrorF(err)
+		}
+
 		outPath, err := cmd.PersistentFlags().GetString("out")
 
 		if err != nil {
@@ -84,6 +98,7 @@ var cleanCmd = &cobra.Command{
 			logging.ErrorF(err)
 		}
 
-		app.RunClean(inputPath, outputPath, processBlacklist)
+		inputFormat, _ := cmd.PersistentFlags().GetString("input-format")
+		app.RunClean(inputPath, inputFormat, outputPath, processBlacklist)
 	},
 }
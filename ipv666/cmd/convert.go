@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"github.com/ekaley/ipv666/internal/app"
+	"github.com/ekaley/ipv666/internal/fs"
 	"github.com/ekaley/ipv666/internal/logging"
 	"github.com/ekaley/ipv666/internal/validation"
 	"github.com/spf13/cobra"
@@ -13,7 +14,9 @@ func init() {
 	var inputPath string
 	var outputPath string
 	var outputType string
+	var inputFormat string
 	convertCmd.PersistentFlags().StringVarP(&inputPath, "input", "i", "", "The file to process IPv6 addresses out of.")
+	convertCmd.PersistentFlags().StringVar(&inputFormat, "input-format", fs.AutoFormat, "The format of the input (one of "+strings.Join(fs.GetInputFormatNames(false), ", ")+"). If auto, the format is told from the content of each input file.")
 	convertCmd.PersistentFlags().StringVarP(&outputPath, "out", "o", "", "The file path to write the converted file to.")
 	convertCmd.PersistentFlags().StringVarP(&outputType, "type", "t", viper.GetString("OutputFileType"), "The format to write the IPv6 addresses in (one of 'txt', 'bin', 'hex', 'tree').")
 	convertCmd.MarkPersistentFlagRequired("input")
@@ -23,8 +26,9 @@ func init() {
 var convertLongDesc = strings.TrimSpace(`
 This utility will process the contents of a file as containing IPv6 addresses, convert
 those addresses to another format, and then write a new file with the same addresses in
-the new format. This functionality is (hopefully) intelligent enough to determine how the
-addresses are stored in the file without having to specify an input type.
+the new format. Unless an input format is given, the format of the input is told from its
+content: binary files written by IPv666 start with a header naming their format, and text files
+are told apart by their first line.
 `)
 
 var convertCmd = &cobra.Command{
@@ -43,6 +47,16 @@ var convertCmd = &cobra.Command{
 			logging.ErrorF(err)
 		}
 
+		inputFormat, err := cmd.PersistentFlags().GetString("input-format")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if err := validation.ValidateInputFormat(inputFormat); err != nil {
+			logging.ErrorF(err)
+		}
+
 		outputPath, err := cmd.PersistentFlags().GetString("out")
 
 		if err != nil {
@@ -68,6 +82,7 @@ var convertCmd = &cobra.Command{
 		inputPath, _ := cmd.PersistentFlags().GetString("input")
 		outputPath, _ := cmd.PersistentFlags().GetString("out")
 		outputType, _ := cmd.PersistentFlags().GetString("type")
-		app.RunConvert(inputPath, outputPath, outputType)
+		inputFormat, _ := cmd.PersistentFlags().GetString("input-format")
+		app.RunConvert(inputPath, inputFormat, outputPath, outputType)
 	},
 }
@@ -1,29 +1,43 @@
 package generate
 
 import (
+	"fmt"
 	"github.com/ekaley/ipv666/internal/app"
 	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/modeling"
+	"github.com/ekaley/ipv666/internal/validation"
+	"github.com/ekaley/ipv666/internal/zrandom"
 	"github.com/spf13/cobra"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 )
 
 func init() {
-	var modelPath string
+	var modelPaths []string
+	var modelRatios string
 	var outputPath string
 	var genNetwork string
 	var genCount int
-	addrgenCmd.PersistentFlags().StringVarP(&modelPath, "model", "m", "", "Local file path to the model to generate addresses from (if empty, uses the default model packaged with ipv666).")
+	var generatorType string
+	var seedsPath string
+	addrgenCmd.PersistentFlags().StringSliceVarP(&modelPaths, "model", "m", nil, "Local file path to the model to generate addresses from (if empty, uses the default model packaged with ipv666). Give more than once to generate from an ensemble of models.")
+	addrgenCmd.PersistentFlags().StringVar(&modelRatios, "model-ratios", "", "A comma-separated list of how often to generate from each model in an ensemble, in the order the models were given (e.g. 3,1). If empty, each model is used equally.")
 	addrgenCmd.PersistentFlags().StringVarP(&outputPath, "out", "o", "", "File path to where the generated IP addresses should be written.")
 	addrgenCmd.PersistentFlags().StringVarP(&genNetwork, "network", "n", "", "The address range to generate addresses within (if empty, generates addresses in the global address space of ::/0).")
 	addrgenCmd.PersistentFlags().IntVarP(&genCount, "count", "c", 1000000, "The number of IP addresses to generate.")
+	addrgenCmd.PersistentFlags().StringVarP(&generatorType, "generator", "g", modeling.ClusterGeneratorType, "The generator to create addresses with (cluster, spacetree or entropyip).")
+	addrgenCmd.PersistentFlags().StringVarP(&seedsPath, "seeds", "s", "", "A file containing IPv6 addresses to build the generator from (required by the spacetree and entropyip generators).")
 	addrgenCmd.MarkPersistentFlagRequired("out")
 }
 
 var addrgenLongDesc = strings.TrimSpace(`
 This utility will generate IPv6 addresses in target network range (or in the global address space) based on
-the default included cluster model or a cluster model that you specify.
+the default included cluster model or a cluster model that you specify. When several cluster models are
+given, each address is generated from one of them picked at random in proportion to the model ratios. With
+the spacetree or entropyip generators, the addresses are instead generated from a space tree or an entropy
+model built over a file of seed addresses.
 `)
 
 var addrgenCmd = &cobra.Command{
@@ -32,18 +46,60 @@ var addrgenCmd = &cobra.Command{
 	Long:  addrgenLongDesc,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 
-		modelPath, err := cmd.PersistentFlags().GetString("model")
+		modelPaths, err := cmd.PersistentFlags().GetStringSlice("model")
 
 		if err != nil {
 			logging.ErrorF(err)
 		}
 
-		if modelPath != "" {
+		for _, modelPath := range modelPaths {
 			if _, err := os.Stat(modelPath); os.IsNotExist(err) {
 				logging.ErrorStringFf("No file found at path '%s'. Please supply a valid model path.", modelPath)
 			}
 		}
 
+		modelRatios, err := cmd.PersistentFlags().GetString("model-ratios")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if modelRatios != "" {
+			ratios, err := parseModelRatios(modelRatios)
+			if err != nil {
+				logging.ErrorF(err)
+			}
+			if len(ratios) != len(modelPaths) {
+				logging.ErrorStringFf("You must supply one model ratio for each model (got %d ratios for %d models).", len(ratios), len(modelPaths))
+			}
+		}
+
+		generatorType, err := cmd.PersistentFlags().GetString("generator")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if err := validation.ValidateGeneratorType(generatorType); err != nil {
+			logging.ErrorF(err)
+		}
+
+		seedsPath, err := cmd.PersistentFlags().GetString("seeds")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if modeling.IsSeededGeneratorType(generatorType) && seedsPath == "" {
+			logging.ErrorStringFf("The %s generator requires a file of seed addresses (--seeds or -s).", generatorType)
+		}
+
+		if seedsPath != "" {
+			if _, err := os.Stat(seedsPath); os.IsNotExist(err) {
+				logging.ErrorStringFf("No file found at path '%s'. Please supply a valid seed address path.", seedsPath)
+			}
+		}
+
 		outputPath, err := cmd.PersistentFlags().GetString("out")
 
 		if err != nil {
@@ -79,10 +135,30 @@ var addrgenCmd = &cobra.Command{
 
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		modelPath, _ := cmd.PersistentFlags().GetString("model")
+		modelPaths, _ := cmd.PersistentFlags().GetStringSlice("model")
+		modelRatios, _ := cmd.PersistentFlags().GetString("model-ratios")
+		ratios, _ := parseModelRatios(modelRatios)
 		outputPath, _ := cmd.PersistentFlags().GetString("out")
 		networkString, _ := cmd.PersistentFlags().GetString("network")
 		genCount, _ := cmd.PersistentFlags().GetInt("count")
-		app.RunAddrGen(modelPath, outputPath, networkString, genCount)
+		generatorType, _ := cmd.PersistentFlags().GetString("generator")
+		seedsPath, _ := cmd.PersistentFlags().GetString("seeds")
+		app.RunAddrGen(zrandom.Rand(), generatorType, modelPaths, ratios, seedsPath, outputPath, networkString, genCount)
 	},
 }
+
+// Parse a comma-separated list of model ratios. An empty list means every model is used equally.
+func parseModelRatios(toParse string) ([]float64, error) {
+	if toParse == "" {
+		return nil, nil
+	}
+	var toReturn []float64
+	for _, value := range strings.Split(toParse, ",") {
+		ratio, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || ratio < 0 {
+			return nil, fmt.Errorf("'%s' is not a valid model ratio (expected a number of zero or more)", value)
+		}
+		toReturn = append(toReturn, ratio)
+	}
+	return toReturn, nil
+}
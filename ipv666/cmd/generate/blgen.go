@@ -2,7 +2,9 @@ package generate
 
 import (
 	"github.com/ekaley/ipv666/internal/app"
+	"github.com/ekaley/ipv666/internal/fs"
 	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/validation"
 	"github.com/spf13/cobra"
 	"os"
 	"strings"
@@ -12,7 +14,9 @@ import (
 
 func init() {
 	var inputPath string
+	var inputFormat string
 	blgenCmd.PersistentFlags().StringVarP(&inputPath, "input", "i", "", "An input file containing IPv6 network ranges to build a blacklist from.")
+	blgenCmd.PersistentFlags().StringVar(&inputFormat, "input-format", fs.AutoFormat, "The format of the input (one of "+strings.Join(fs.GetInputFormatNames(true), ", ")+"). If auto, the format is told from the content of each input file. Addresses are each added as a /128.")
 	blgenCmd.MarkPersistentFlagRequired("input")
 }
 
@@ -38,9 +42,20 @@ var blgenCmd = &cobra.Command{
 			logging.ErrorStringFf("No file found at path '%s'. Please supply a valid file path.", inputPath)
 		}
 
+		inputFormat, err := cmd.PersistentFlags().GetString("input-format")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if err := validation.ValidateNetworkInputFormat(inputFormat); err != nil {
+			logging.ErrorF(err)
+		}
+
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		inputPath, _ := cmd.PersistentFlags().GetString("input")
-		app.RunBlgen(inputPath)
+		inputFormat, _ := cmd.PersistentFlags().GetString("input-format")
+		app.RunBlgen(inputPath, inputFormat)
 	},
 }
@@ -0,0 +1,177 @@
+package generate
+
+import (
+	"github.com/ekaley/ipv666/internal/app"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/oui"
+	"github.com/ekaley/ipv666/internal/zrandom"
+	"github.com/spf13/cobra"
+	"net"
+	"os"
+	"strings"
+)
+
+func init() {
+	var inputPath string
+	var outputPath string
+	var genNetwork string
+	var ouiList string
+	var vendor string
+	var ouiDBPath string
+	var topCount int
+	var spread int
+	var genCount int
+	var rankOnly bool
+	eui64genCmd.PersistentFlags().StringVarP(&inputPath, "input", "i", "", "A file of discovered IPv6 addresses. Addresses are generated in their /64 networks, and the OUIs and MAC addresses seen in them are learned from.")
+	eui64genCmd.PersistentFlags().StringVarP(&outputPath, "out", "o", "", "File path to where the generated IP addresses (or the OUI ranking) should be written.")
+	eui64genCmd.PersistentFlags().StringVarP(&genNetwork, "network", "n", "", "The address range to generate addresses within (a /64 or larger). Overrides the /64 networks of the input addresses.")
+	eui64genCmd.PersistentFlags().StringVar(&ouiList, "ouis", "", "A comma-separated list of OUIs to generate addresses for (e.g. 00:1b:21,3c:fd:fe).")
+	eui64genCmd.PersistentFlags().StringVar(&vendor, "vendor", "", "Generate addresses for the OUIs assigned to vendors whose names contain this string (requires --oui-db).")
+	eui64genCmd.PersistentFlags().StringVar(&ouiDBPath, "oui-db", "", "The path to an OUI database in the format published by IEEE (oui.txt or oui.csv).")
+	eui64genCmd.PersistentFlags().IntVar(&topCount, "top", 10, "The number of the most common OUIs in the input addresses to generate addresses for when neither --ouis nor --vendor are given.")
+	eui64genCmd.PersistentFlags().IntVar(&spread, "spread", 16, "How far either side of the MAC addresses seen in the input addresses to generate addresses for.")
+	eui64genCmd.PersistentFlags().IntVarP(&genCount, "count", "c", 100, "The number of IP addresses to generate in each network.")
+	eui64genCmd.PersistentFlags().BoolVar(&rankOnly, "rank", false, "Rank the OUIs found in the input addresses by how common they are instead of generating addresses.")
+	eui64genCmd.MarkPersistentFlagRequired("out")
+}
+
+var eui64genLongDesc = strings.TrimSpace(`
+This utility will generate SLAAC IPv6 addresses with EUI-64 interface identifiers (those built from a MAC
+address) for chosen vendor OUIs. The OUIs can be listed directly, looked up by vendor name in an IEEE OUI
+database, or learned from the most common OUIs in a file of discovered addresses. MAC addresses close to
+those seen in the discovered addresses are tried first. With --rank, the OUIs found in the discovered
+addresses are ranked instead.
+`)
+
+var eui64genCmd = &cobra.Command{
+	Use:   "eui64",
+	Short: "Generate EUI-64 IPv6 addresses for vendor OUIs",
+	Long:  eui64genLongDesc,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+
+		inputPath, err := cmd.PersistentFlags().GetString("input")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if inputPath != "" {
+			if _, err := os.Stat(inputPath); os.IsNotExist(err) {
+				logging.ErrorStringFf("No file found at path '%s'. Please supply a valid file path.", inputPath)
+			}
+		}
+
+		ouiDBPath, err := cmd.PersistentFlags().GetString("oui-db")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if ouiDBPath != "" {
+			if _, err := os.Stat(ouiDBPath); os.IsNotExist(err) {
+				logging.ErrorStringFf("No file found at path '%s'. Please supply a valid OUI database path.", ouiDBPath)
+			}
+		}
+
+		outputPath, err := cmd.PersistentFlags().GetString("out")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+			logging.ErrorStringFf("A file already exists at the path '%s'. Please choose a different file path.", outputPath)
+		}
+
+		rankOnly, err := cmd.PersistentFlags().GetBool("rank")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if rankOnly {
+			if inputPath == "" {
+				logging.ErrorStringFf("Ranking OUIs requires a file of discovered addresses (--input or -i).")
+			}
+			return
+		}
+
+		ouiList, err := cmd.PersistentFlags().GetString("ouis")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if ouiList != "" {
+			if _, err := oui.ParseOUIs(ouiList); err != nil {
+				logging.ErrorF(err)
+			}
+		}
+
+		vendor, err := cmd.PersistentFlags().GetString("vendor")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if vendor != "" && ouiDBPath == "" {
+			logging.ErrorStringFf("Choosing OUIs by vendor requires an OUI database (--oui-db).")
+		}
+
+		if ouiList == "" && vendor == "" && inputPath == "" {
+			logging.ErrorStringFf("You must choose OUIs (--ouis or --vendor) or supply discovered addresses to learn them from (--input or -i).")
+		}
+
+		networkString, err := cmd.PersistentFlags().GetString("network")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if networkString != "" {
+			_, network, err := net.ParseCIDR(networkString)
+			if err != nil {
+				logging.ErrorF(err)
+			}
+			if ones, _ := network.Mask.Size(); ones > 64 || ones%4 != 0 {
+				logging.ErrorStringFf("The network must be a /64 or larger with a length that is divisible by 4 (got %s).", network)
+			}
+		} else if inputPath == "" {
+			logging.ErrorStringFf("You must supply a network (--network or -n) or discovered addresses to take /64 networks from (--input or -i).")
+		}
+
+		spread, err := cmd.PersistentFlags().GetInt("spread")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if spread < 0 {
+			logging.ErrorStringFf("The spread must not be negative (got %d).", spread)
+		}
+
+		genCount, err := cmd.PersistentFlags().GetInt("count")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if genCount <= 0 {
+			logging.ErrorStringFf("You must supply a generate count of greater than zero (got %d).", genCount)
+		}
+
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		inputPath, _ := cmd.PersistentFlags().GetString("input")
+		outputPath, _ := cmd.PersistentFlags().GetString("out")
+		networkString, _ := cmd.PersistentFlags().GetString("network")
+		ouiList, _ := cmd.PersistentFlags().GetString("ouis")
+		vendor, _ := cmd.PersistentFlags().GetString("vendor")
+		ouiDBPath, _ := cmd.PersistentFlags().GetString("oui-db")
+		topCount, _ := cmd.PersistentFlags().GetInt("top")
+		spread, _ := cmd.PersistentFlags().GetInt("spread")
+		genCount, _ := cmd.PersistentFlags().GetInt("count")
+		rankOnly, _ := cmd.PersistentFlags().GetBool("rank")
+		app.RunEUI64Gen(zrandom.Rand(), inputPath, networkString, ouiList, vendor, ouiDBPath, topCount, spread, genCount, rankOnly, outputPath)
+	},
+}
@@ -0,0 +1,254 @@
+package generate
+
+import (
+	"fmt"
+	"github.com/ekaley/ipv666/internal/app"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/modeling"
+	"github.com/ekaley/ipv666/internal/zrandom"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	var inputPath string
+	var outputPath string
+	var splitMethod string
+	var testShare float64
+	var splitPrefix int
+	var generators string
+	var models string
+	var checkCounts string
+	var minNybblePercents string
+	var jitters string
+	var genCount int
+	var workers int
+	var format string
+	evaluateCmd.PersistentFlags().StringVarP(&inputPath, "input", "i", "", "An input file containing IPv6 addresses to split into training and test sets.")
+	evaluateCmd.PersistentFlags().StringVarP(&outputPath, "out", "o", "", "The file path to write the evaluation report to.")
+	evaluateCmd.PersistentFlags().StringVar(&splitMethod, "split", modeling.RandomSplit, fmt.Sprintf("How to split the addresses into training and test sets ('%s' to hold out individual addresses, '%s' to hold out whole networks).", modeling.RandomSplit, modeling.PrefixSplit))
+	evaluateCmd.PersistentFlags().Float64Var(&testShare, "test-share", 0.2, "The share of the addresses (or networks, for a prefix split) to hold out for testing.")
+	evaluateCmd.PersistentFlags().IntVar(&splitPrefix, "split-prefix", 48, "The length of the networks to hold out for a prefix split (up to 64).")
+	evaluateCmd.PersistentFlags().StringVarP(&generators, "generators", "g", modeling.ClusterGeneratorType, fmt.Sprintf("A comma-separated list of generators to train and evaluate (any of %s).", strings.Join(modeling.GetGeneratorTypes(), ", ")))
+	evaluateCmd.PersistentFlags().StringVarP(&models, "models", "m", "", "A comma-separated list of cluster model files to evaluate alongside the trained generators (only these are evaluated unless --generators is also given).")
+	evaluateCmd.PersistentFlags().StringVar(&checkCounts, "check-counts", "", "A comma-separated list of check counts to train cluster models with (defaults to the configured ModelCheckCount).")
+	evaluateCmd.PersistentFlags().StringVar(&minNybblePercents, "min-nybble-percents", "", "A comma-separated list of minimum nybble percents to generate from cluster models with (defaults to the configured ModelMinNybblePercent).")
+	evaluateCmd.PersistentFlags().StringVar(&jitters, "jitters", "", "A comma-separated list of jitters to generate addresses with (defaults to the configured ModelGenerationJitter).")
+	evaluateCmd.PersistentFlags().IntVarP(&genCount, "count", "c", 100000, "The number of candidate addresses to generate for each evaluation.")
+	evaluateCmd.PersistentFlags().IntVarP(&workers, "workers", "w", 0, "The number of workers to build cluster models with (if 0, uses one per CPU).")
+	evaluateCmd.PersistentFlags().StringVar(&format, "format", app.TextReportFormat, fmt.Sprintf("The format of the report ('%s' or '%s').", app.TextReportFormat, app.JSONReportFormat))
+	evaluateCmd.MarkPersistentFlagRequired("input")
+	evaluateCmd.MarkPersistentFlagRequired("out")
+}
+
+var evaluateLongDesc = strings.TrimSpace(`
+This utility will measure how well address generators predict addresses they have not seen. The
+addresses in the input file are split into a training set and a held-out test set, either by picking
+test addresses at random or by holding out whole networks. Each generator is trained on the training
+set and generates candidate addresses, and the report shows how many candidates are in the test set
+and how many of the test /64 and /48 networks the candidates cover. Several generators, model files,
+check counts, minimum nybble percents and jitters can be compared in one report.
+`)
+
+var evaluateCmd = &cobra.Command{
+	Use:   "evaluate",
+	Short: "Evaluate address generators against held-out addresses",
+	Long:  evaluateLongDesc,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+
+		inputPath, err := cmd.PersistentFlags().GetString("input")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if _, err := os.Stat(inputPath); os.IsNotExist(err) {
+			logging.ErrorStringFf("No file found at path '%s'. Please supply a valid file path.", inputPath)
+		}
+
+		outputPath, err := cmd.PersistentFlags().GetString("out")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+			logging.ErrorStringFf("A file already exists at the path '%s'. Please choose a different file path.", outputPath)
+		}
+
+		splitMethod, err := cmd.PersistentFlags().GetString("split")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if err := modeling.ValidateSplitMethod(splitMethod); err != nil {
+			logging.ErrorF(err)
+		}
+
+		testShare, err := cmd.PersistentFlags().GetFloat64("test-share")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if testShare <= 0 || testShare >= 1 {
+			logging.ErrorStringFf("The test share must be between 0 and 1 (got %f).", testShare)
+		}
+
+		splitPrefix, err := cmd.PersistentFlags().GetInt("split-prefix")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if splitPrefix < 1 || splitPrefix > 64 {
+			logging.ErrorStringFf("The split prefix length must be between 1 and 64 (got %d).", splitPrefix)
+		}
+
+		generatorTypes, modelPaths := getEvaluateTargets(cmd)
+
+		for _, generatorType := range generatorTypes {
+			if err := modeling.ValidateGeneratorType(generatorType); err != nil {
+				logging.ErrorF(err)
+			}
+		}
+
+		for _, modelPath := range modelPaths {
+			if _, err := os.Stat(modelPath); os.IsNotExist(err) {
+				logging.ErrorStringFf("No model file found at path '%s'. Please supply a valid file path.", modelPath)
+			}
+		}
+
+		if len(generatorTypes) == 0 && len(modelPaths) == 0 {
+			logging.ErrorStringFf("You must supply at least one generator (--generators or -g) or model file (--models or -m) to evaluate.")
+		}
+
+		if _, err := getEvaluateSettings(cmd); err != nil {
+			logging.ErrorF(err)
+		}
+
+		genCount, err := cmd.PersistentFlags().GetInt("count")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if genCount <= 0 {
+			logging.ErrorStringFf("You must supply a generate count of greater than zero (got %d).", genCount)
+		}
+
+		workers, err := cmd.PersistentFlags().GetInt("workers")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if workers < 0 {
+			logging.ErrorStringFf("The number of workers must be 0 or greater (got %d).", workers)
+		}
+
+		format, err := cmd.PersistentFlags().GetString("format")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if err := app.ValidateReportFormat(format); err != nil {
+			logging.ErrorF(err)
+		}
+
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		inputPath, _ := cmd.PersistentFlags().GetString("input")
+		outputPath, _ := cmd.PersistentFlags().GetString("out")
+		settings, _ := getEvaluateSettings(cmd)
+		app.RunEvaluate(zrandom.Rand(), inputPath, settings, outputPath)
+	},
+}
+
+// Get the generator types and model files to evaluate. The default generator is only evaluated when no
+// model files are given, unless generators were asked for as well.
+func getEvaluateTargets(cmd *cobra.Command) ([]string, []string) {
+	generators, _ := cmd.PersistentFlags().GetString("generators")
+	models, _ := cmd.PersistentFlags().GetString("models")
+	modelPaths := splitEvaluateList(models)
+	if len(modelPaths) > 0 && !cmd.PersistentFlags().Changed("generators") {
+		return nil, modelPaths
+	}
+	return splitEvaluateList(generators), modelPaths
+}
+
+func getEvaluateSettings(cmd *cobra.Command) (*app.EvaluateSettings, error) {
+	splitMethod, _ := cmd.PersistentFlags().GetString("split")
+	testShare, _ := cmd.PersistentFlags().GetFloat64("test-share")
+	splitPrefix, _ := cmd.PersistentFlags().GetInt("split-prefix")
+	checkCountsList, _ := cmd.PersistentFlags().GetString("check-counts")
+	minNybblePercentsList, _ := cmd.PersistentFlags().GetString("min-nybble-percents")
+	jittersList, _ := cmd.PersistentFlags().GetString("jitters")
+	genCount, _ := cmd.PersistentFlags().GetInt("count")
+	workers, _ := cmd.PersistentFlags().GetInt("workers")
+	format, _ := cmd.PersistentFlags().GetString("format")
+	generatorTypes, modelPaths := getEvaluateTargets(cmd)
+	checkCounts := []int{viper.GetInt("ModelCheckCount")}
+	if checkCountsList != "" {
+		checkCounts = nil
+		for _, toParse := range splitEvaluateList(checkCountsList) {
+			checkCount, err := strconv.Atoi(toParse)
+			if err != nil || checkCount <= 0 {
+				return nil, fmt.Errorf("'%s' is not a valid check count (expected a number greater than zero)", toParse)
+			}
+			checkCounts = append(checkCounts, checkCount)
+		}
+	}
+	minNybblePercents, err := parseEvaluateFloats(minNybblePercentsList, viper.GetFloat64("ModelMinNybblePercent"), "minimum nybble percent")
+	if err != nil {
+		return nil, err
+	}
+	jitters, err := parseEvaluateFloats(jittersList, viper.GetFloat64("ModelGenerationJitter"), "jitter")
+	if err != nil {
+		return nil, err
+	}
+	return &app.EvaluateSettings{
+		SplitMethod:       splitMethod,
+		TestShare:         testShare,
+		SplitPrefix:       splitPrefix,
+		GeneratorTypes:    generatorTypes,
+		ModelPaths:        modelPaths,
+		CheckCounts:       checkCounts,
+		MinNybblePercents: minNybblePercents,
+		Jitters:           jitters,
+		GenerateCount:     genCount,
+		Workers:           workers,
+		ReportFormat:      format,
+	}, nil
+}
+
+// Parse a comma-separated list of values between 0 and 1, falling back to the configured value
+func parseEvaluateFloats(toParse string, configured float64, description string) ([]float64, error) {
+	if toParse == "" {
+		return []float64{configured}, nil
+	}
+	var toReturn []float64
+	for _, value := range splitEvaluateList(toParse) {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			return nil, fmt.Errorf("'%s' is not a valid %s (expected a number between 0 and 1)", value, description)
+		}
+		toReturn = append(toReturn, parsed)
+	}
+	return toReturn, nil
+}
+
+func splitEvaluateList(toSplit string) []string {
+	var toReturn []string
+	for _, value := range strings.Split(toSplit, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			toReturn = append(toReturn, value)
+		}
+	}
+	return toReturn
+}
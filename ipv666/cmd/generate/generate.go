@@ -9,11 +9,18 @@ func init() {
 	Cmd.AddCommand(blgenCmd)
 	Cmd.AddCommand(modelgenCmd)
 	Cmd.AddCommand(addrgenCmd)
+	Cmd.AddCommand(eui64genCmd)
+	Cmd.AddCommand(evaluateCmd)
+	modelgenCmd.AddCommand(modelInspectCmd)
+	modelgenCmd.AddCommand(modelImportCmd)
+	modelgenCmd.AddCommand(modelMergeCmd)
+	modelgenCmd.AddCommand(modelMigrateCmd)
 }
 
 var generateLongDesc = strings.TrimSpace(`
 The generation utilities of IPv666 include (1) generating a network range blacklist, 
-(2) generating a predictive clustering model, and (3) generating IPv6 addresses.
+(2) generating a predictive clustering model, (3) generating IPv6 addresses, (4) generating 
+EUI-64 IPv6 addresses for vendor OUIs, and (5) evaluating address generators against held-out addresses.
 `)
 
 var Cmd = &cobra.Command{
@@ -2,7 +2,10 @@ package generate
 
 import (
 	"github.com/ekaley/ipv666/internal/app"
+	"github.com/ekaley/ipv666/internal/fs"
 	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/ekaley/ipv666/internal/validation"
+	"github.com/ekaley/ipv666/internal/zrandom"
 	"github.com/spf13/cobra"
 	"os"
 	"strings"
@@ -11,15 +14,25 @@ import (
 func init() {
 	var inputPath string
 	var outputPath string
-	modelgenCmd.PersistentFlags().StringVarP(&inputPath, "input", "i", "", "An input file containing IPv6 addresses to use for the model.")
-	modelgenCmd.PersistentFlags().StringVarP(&outputPath, "out", "o", "", "The file path to write the resulting model to.")
-	modelgenCmd.MarkPersistentFlagRequired("input") //TODO figure out why persistentflagrequired ain't working
-	modelgenCmd.MarkPersistentFlagRequired("out")
+	var workers int
+	var corpusSize int
+	var inputFormat string
+	modelgenCmd.Flags().StringVarP(&inputPath, "input", "i", "", "An input file, directory of files or - (for standard input) containing IPv6 addresses to use for the model. Inputs may be gzip, xz or zstd compressed.")
+	modelgenCmd.Flags().StringVar(&inputFormat, "input-format", fs.AutoFormat, "The format of the input (one of "+strings.Join(fs.GetInputFormatNames(false), ", ")+"). If auto, the format is told from the content of each input file.")
+	modelgenCmd.Flags().StringVarP(&outputPath, "out", "o", "", "The file path to write the resulting model to.")
+	modelgenCmd.Flags().IntVarP(&workers, "workers", "w", 0, "The number of workers to build the model with (if 0, uses one per CPU).")
+	modelgenCmd.Flags().IntVarP(&corpusSize, "corpus-size", "n", 0, "The most distinct addresses to build the model from, sampled at random from the input (if 0, uses the configured corpus size, which by default is every address).")
+	modelgenCmd.MarkFlagRequired("input")
+	modelgenCmd.MarkFlagRequired("out")
 }
 
 var modelgenLongDesc = strings.TrimSpace(`
 This utility will generate a predictive clustering model based on the contents of  
 an IPv6 address file. 
+
+The input may be a directory of files or standard input, and may be compressed. Repeated addresses are 
+only counted once, and a corpus size limits how many addresses the model is built from so that very large 
+inputs can be sampled instead of held in memory.
 `)
 
 var modelgenCmd = &cobra.Command{
@@ -28,7 +41,7 @@ var modelgenCmd = &cobra.Command{
 	Long:  modelgenLongDesc,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 
-		inputPath, err := cmd.PersistentFlags().GetString("input")
+		inputPath, err := cmd.Flags().GetString("input")
 
 		if err != nil {
 			logging.ErrorF(err)
@@ -38,11 +51,21 @@ var modelgenCmd = &cobra.Command{
 			logging.ErrorStringFf("No input path supplied (-input or -i)")
 		}
 
-		if _, err := os.Stat(inputPath); os.IsNotExist(err) {
+		if !fs.InputExists(inputPath) {
 			logging.ErrorStringFf("No file found at path '%s'. Please supply a valid file path.", inputPath)
 		}
 
-		outputPath, err := cmd.PersistentFlags().GetString("out")
+		inputFormat, err := cmd.Flags().GetString("input-format")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if err := validation.ValidateInputFormat(inputFormat); err != nil {
+			logging.ErrorF(err)
+		}
+
+		outputPath, err := cmd.Flags().GetString("out")
 
 		if err != nil {
 			logging.ErrorF(err)
@@ -52,10 +75,33 @@ var modelgenCmd = &cobra.Command{
 			logging.ErrorStringFf("A file already exists at the path '%s'. Please choose a different file path.", outputPath)
 		}
 
+		workers, err := cmd.Flags().GetInt("workers")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if workers < 0 {
+			logging.ErrorStringFf("The number of workers must be 0 or greater (got %d).", workers)
+		}
+
+		corpusSize, err := cmd.Flags().GetInt("corpus-size")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if corpusSize < 0 {
+			logging.ErrorStringFf("The corpus size must be 0 or greater (got %d).", corpusSize)
+		}
+
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		inputPath, _ := cmd.PersistentFlags().GetString("input")
-		outputPath, _ := cmd.PersistentFlags().GetString("out")
-		app.RunModelgen(inputPath, outputPath)
+		inputPath, _ := cmd.Flags().GetString("input")
+		outputPath, _ := cmd.Flags().GetString("out")
+		workers, _ := cmd.Flags().GetInt("workers")
+		corpusSize, _ := cmd.Flags().GetInt("corpus-size")
+		inputFormat, _ := cmd.Flags().GetString("input-format")
+		app.RunModelgen(zrandom.Rand(), inputPath, inputFormat, outputPath, workers, corpusSize)
 	},
 }
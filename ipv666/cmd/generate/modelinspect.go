@@ -0,0 +1,122 @@
+package generate
+
+import (
+	"github.com/ekaley/ipv666/internal/app"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+func init() {
+	var modelPath string
+	var outputPath string
+	var topCount int
+	var asJSON bool
+	modelInspectCmd.PersistentFlags().StringVarP(&modelPath, "model", "m", "", "Local file path to the model to inspect (if empty, uses the default model packaged with IPv666).")
+	modelInspectCmd.PersistentFlags().StringVarP(&outputPath, "out", "o", "", "The file path to write the model report (or the JSON export) to.")
+	modelInspectCmd.PersistentFlags().IntVarP(&topCount, "top", "t", 100, "The number of the densest clusters to list (if 0, lists all of them).")
+	modelInspectCmd.PersistentFlags().BoolVar(&asJSON, "json", false, "Export the whole model as JSON instead of writing a report. The JSON can be edited and read back in with 'generate model import'.")
+	modelInspectCmd.MarkPersistentFlagRequired("out")
+	var inputPath string
+	var importOutputPath string
+	modelImportCmd.PersistentFlags().StringVarP(&inputPath, "input", "i", "", "A model exported to JSON by 'generate model inspect --json'.")
+	modelImportCmd.PersistentFlags().StringVarP(&importOutputPath, "out", "o", "", "The file path to write the resulting model to.")
+	modelImportCmd.MarkPersistentFlagRequired("input")
+	modelImportCmd.MarkPersistentFlagRequired("out")
+}
+
+var modelInspectLongDesc = strings.TrimSpace(`
+This utility will describe the contents of a predictive clustering model. The report lists the
+model's clusters from the densest to the sparsest as address patterns (with '?' marking wildcard
+nybbles) alongside how many addresses each captured and how large it is, followed by how often each
+nybble occurs at each position of the model's stardust addresses. With --json, the whole model is
+exported to JSON instead.
+`)
+
+var modelInspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "Describe or export a predictive model",
+	Long:  modelInspectLongDesc,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+
+		modelPath, err := cmd.PersistentFlags().GetString("model")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if modelPath != "" {
+			if _, err := os.Stat(modelPath); os.IsNotExist(err) {
+				logging.ErrorStringFf("No file found at path '%s'. Please supply a valid file path.", modelPath)
+			}
+		}
+
+		outputPath, err := cmd.PersistentFlags().GetString("out")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+			logging.ErrorStringFf("A file already exists at the path '%s'. Please choose a different file path.", outputPath)
+		}
+
+		topCount, err := cmd.PersistentFlags().GetInt("top")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if topCount < 0 {
+			logging.ErrorStringFf("The number of clusters to list must be 0 or greater (got %d).", topCount)
+		}
+
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		modelPath, _ := cmd.PersistentFlags().GetString("model")
+		outputPath, _ := cmd.PersistentFlags().GetString("out")
+		topCount, _ := cmd.PersistentFlags().GetInt("top")
+		asJSON, _ := cmd.PersistentFlags().GetBool("json")
+		app.RunModelInspect(modelPath, topCount, asJSON, outputPath)
+	},
+}
+
+var modelImportLongDesc = strings.TrimSpace(`
+This utility will read a predictive clustering model that was exported to JSON (and possibly edited
+by hand or built by other tooling) and write it out as a model file that IPv666 can use.
+`)
+
+var modelImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import a predictive model from JSON",
+	Long:  modelImportLongDesc,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+
+		inputPath, err := cmd.PersistentFlags().GetString("input")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if _, err := os.Stat(inputPath); os.IsNotExist(err) {
+			logging.ErrorStringFf("No file found at path '%s'. Please supply a valid file path.", inputPath)
+		}
+
+		outputPath, err := cmd.PersistentFlags().GetString("out")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+			logging.ErrorStringFf("A file already exists at the path '%s'. Please choose a different file path.", outputPath)
+		}
+
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		inputPath, _ := cmd.PersistentFlags().GetString("input")
+		outputPath, _ := cmd.PersistentFlags().GetString("out")
+		app.RunModelImport(inputPath, outputPath)
+	},
+}
@@ -0,0 +1,65 @@
+package generate
+
+import (
+	"github.com/ekaley/ipv666/internal/app"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+func init() {
+	var modelPaths []string
+	var outputPath string
+	modelMergeCmd.PersistentFlags().StringSliceVarP(&modelPaths, "model", "m", nil, "Local file path to a model to merge. Give more than once (or as a comma-separated list) to name all of the models to merge.")
+	modelMergeCmd.PersistentFlags().StringVarP(&outputPath, "out", "o", "", "The file path to write the merged model to.")
+	modelMergeCmd.MarkPersistentFlagRequired("model")
+	modelMergeCmd.MarkPersistentFlagRequired("out")
+}
+
+var modelMergeLongDesc = strings.TrimSpace(`
+This utility will merge several predictive clustering models (such as ones trained for different
+customers or regions) into one. Clusters that fall within a larger cluster of any of the models are
+dropped, with the addresses they captured credited to the larger cluster, and the nybble counts of
+the models' stardust are added together.
+`)
+
+var modelMergeCmd = &cobra.Command{
+	Use:   "merge",
+	Short: "Merge several predictive models into one",
+	Long:  modelMergeLongDesc,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+
+		modelPaths, err := cmd.PersistentFlags().GetStringSlice("model")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if len(modelPaths) < 2 {
+			logging.ErrorStringFf("You must supply at least two models to merge (got %d).", len(modelPaths))
+		}
+
+		for _, modelPath := range modelPaths {
+			if _, err := os.Stat(modelPath); os.IsNotExist(err) {
+				logging.ErrorStringFf("No file found at path '%s'. Please supply a valid model path.", modelPath)
+			}
+		}
+
+		outputPath, err := cmd.PersistentFlags().GetString("out")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+			logging.ErrorStringFf("A file already exists at the path '%s'. Please choose a different file path.", outputPath)
+		}
+
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		modelPaths, _ := cmd.PersistentFlags().GetStringSlice("model")
+		outputPath, _ := cmd.PersistentFlags().GetString("out")
+		app.RunModelMerge(modelPaths, outputPath)
+	},
+}
@@ -0,0 +1,60 @@
+package generate
+
+import (
+	"github.com/ekaley/ipv666/internal/app"
+	"github.com/ekaley/ipv666/internal/logging"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+func init() {
+	var inputPath string
+	var outputPath string
+	modelMigrateCmd.PersistentFlags().StringVarP(&inputPath, "input", "i", "", "Local file path to the model to migrate (if empty, migrates the default model packaged with IPv666).")
+	modelMigrateCmd.PersistentFlags().StringVarP(&outputPath, "out", "o", "", "The file path to write the migrated model to.")
+	modelMigrateCmd.MarkPersistentFlagRequired("out")
+}
+
+var modelMigrateLongDesc = strings.TrimSpace(`
+This utility will rewrite a predictive clustering model in the current model file format. Model files
+now start with a header holding a format version, the generator type, how the model was trained and
+a checksum. Model files from before the header was added can still be read, and this rewrites them
+so that they are checked when they are loaded.
+`)
+
+var modelMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Rewrite a predictive model in the current file format",
+	Long:  modelMigrateLongDesc,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+
+		inputPath, err := cmd.PersistentFlags().GetString("input")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if inputPath != "" {
+			if _, err := os.Stat(inputPath); os.IsNotExist(err) {
+				logging.ErrorStringFf("No file found at path '%s'. Please supply a valid file path.", inputPath)
+			}
+		}
+
+		outputPath, err := cmd.PersistentFlags().GetString("out")
+
+		if err != nil {
+			logging.ErrorF(err)
+		}
+
+		if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+			logging.ErrorStringFf("A file already exists at the path '%s'. Please choose a different file path.", outputPath)
+		}
+
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		inputPath, _ := cmd.PersistentFlags().GetString("input")
+		outputPath, _ := cmd.PersistentFlags().GetString("out")
+		app.RunModelMigrate(inputPath, outputPath)
+	},
+}
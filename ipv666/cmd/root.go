@@ -7,6 +7,7 @@ import (
 	"github.com/ekaley/ipv666/internal/logging"
 	"github.com/ekaley/ipv666/internal/shell"
 	"github.com/ekaley/ipv666/internal/validation"
+	"github.com/ekaley/ipv666/internal/zrandom"
 	"github.com/ekaley/ipv666/ipv666/cmd/generate"
 	"github.com/ekaley/ipv666/ipv666/cmd/scan"
 	"github.com/spf13/cobra"
@@ -21,10 +22,14 @@ import (
 func init() {
 	var logLevel string
 	var forceAccept bool
+	var seed int64
 	rootCmd.PersistentFlags().StringVarP(&logLevel, "log", "l", viper.GetString("LogLevel"), "The log level to emit logs at (one of debug, info, success, warn, error).")
 	rootCmd.PersistentFlags().BoolVarP(&forceAccept, "force", "f", viper.GetBool("ForceAcceptPrompts"), "Whether or not to force accept all prompts (useful for daemonized scanning).")
 	viper.BindPFlag("LogLevel", rootCmd.PersistentFlags().Lookup("log"))
 	viper.BindPFlag("ForceAcceptPrompts", rootCmd.PersistentFlags().Lookup("force"))
+	rootCmd.PersistentFlags().Int64Var(&seed, "seed", viper.GetInt64("RandomSeed"), "The seed for all randomness in address generation and alias checking. Runs with the same seed and inputs generate the same addresses (if 0, seeds from the clock).")
+	viper.BindPFlag("RandomSeed", rootCmd.PersistentFlags().Lookup("seed"))
+	cobra.OnInitialize(seedRandomness)
 
 	rootCmd.AddCommand(cleanCmd)
 	rootCmd.AddCommand(convertCmd)
@@ -110,6 +115,15 @@ func cloudSyncOptIn() error {
 	return nil
 }
 
+// Seed the default source of randomness once the flags have been parsed (subcommands replace the root
+// command's pre-run, so this can't happen there)
+func seedRandomness() {
+	if seed := viper.GetInt64("RandomSeed"); seed != 0 {
+		logging.Infof("Seeding randomness with %d.", seed)
+		zrandom.Seed(seed)
+	}
+}
+
 var rootLongDesc = strings.TrimSpace(`
 An IPv6 host enumeration tool set intended for the discovery of hosts within the 
 vast IPv6 address space. This tool set includes capabilities for scanning the global 
@@ -2,6 +2,7 @@ package scan
 
 import (
 	"github.com/ekaley/ipv666/internal/app"
+	"github.com/ekaley/ipv666/internal/zrandom"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"strings"
@@ -20,6 +21,6 @@ var aliasCmd = &cobra.Command{
 	Short: "Test a network range for aliased characteristics",
 	Long:  aliasLongDesc,
 	Run: func(cmd *cobra.Command, args []string) {
-		app.RunAlias(viper.GetString("ScanTargetNetwork"))
+		app.RunAlias(zrandom.Rand(), viper.GetString("ScanTargetNetwork"))
 	},
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/ekaley/ipv666/internal/logging"
 	"github.com/ekaley/ipv666/internal/shell"
 	"github.com/ekaley/ipv666/internal/validation"
+	"github.com/ekaley/ipv666/internal/zrandom"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"os"
@@ -16,15 +17,30 @@ import (
 func init() {
 	var outputFileName string
 	var outputFileType string
+	var targetNetworks string
+	var targetNetworksFile string
+	var generatorType string
+	var patternRulesFile string
 	discoverCmd.PersistentFlags().StringVarP(&outputFileName, "output", "o", viper.GetString("OutputFileName"), "The path to the file where discovered addresses should be written.")
 	discoverCmd.PersistentFlags().StringVarP(&outputFileType, "output-type", "t", viper.GetString("OutputFileType"), "The type of output to write to the output file (txt or bin).")
 	viper.BindPFlag("OutputFileName", discoverCmd.PersistentFlags().Lookup("output"))
 	viper.BindPFlag("OutputFileType", discoverCmd.PersistentFlags().Lookup("output-type"))
+	discoverCmd.PersistentFlags().StringVar(&targetNetworks, "networks", viper.GetString("ScanTargetNetworks"), "A comma-separated list of IPv6 CIDR ranges to scan, each optionally followed by @<weight> (e.g. 2600:1234::/32@2). Overrides --network.")
+	discoverCmd.PersistentFlags().StringVar(&targetNetworksFile, "networks-file", viper.GetString("ScanTargetNetworksFile"), "The path to a file listing IPv6 CIDR ranges to scan, one per line in the same format as --networks.")
+	viper.BindPFlag("ScanTargetNetworks", discoverCmd.PersistentFlags().Lookup("networks"))
+	viper.BindPFlag("ScanTargetNetworksFile", discoverCmd.PersistentFlags().Lookup("networks-file"))
+	discoverCmd.PersistentFlags().StringVarP(&generatorType, "generator", "g", viper.GetString("CandidateGenerator"), "The generator to create candidate addresses with (cluster, spacetree or entropyip). The spacetree and entropyip generators are built from the addresses discovered so far.")
+	viper.BindPFlag("CandidateGenerator", discoverCmd.PersistentFlags().Lookup("generator"))
+	discoverCmd.PersistentFlags().StringVar(&patternRulesFile, "pattern-rules", viper.GetString("FanOutPatternRulesFile"), "The path to a file of interface identifier pattern rules to fan out to discovered /64 networks with. The built-in rules are used if not specified.")
+	viper.BindPFlag("FanOutPatternRulesFile", discoverCmd.PersistentFlags().Lookup("pattern-rules"))
 }
 
 var discoverLongDesc = strings.TrimSpace(`
 This utility scans for live hosts over IPv6 based on the network range you specify. If no 
 range is specified, then this utility scans the global IPv6 address space (e.g. 2000::/4). 
+Several network ranges can be scanned at once with --networks or --networks-file, in which 
+case the addresses generated each round are split between them according to their weights 
+and the hit rates seen so far. 
 The scanning process generates candidate addresses, scans for them, tests the network ranges 
 where live addresses are found for aliased conditions, and adds legitimate discovered IPv6 
 addresses to an output list.
@@ -41,6 +57,28 @@ var discoverCmd = &cobra.Command{
 			logging.ErrorF(err)
 		}
 
+		if err := validation.ValidateGeneratorType(viper.GetString("CandidateGenerator")); err != nil {
+			logging.ErrorF(err)
+		}
+
+		if networksFile := viper.GetString("ScanTargetNetworksFile"); networksFile != "" {
+			if err := validation.ValidateFileExists(networksFile); err != nil {
+				logging.ErrorF(err)
+			}
+		}
+
+		if err := validation.ValidatePatternRulesFile(viper.GetString("FanOutPatternRulesFile")); err != nil {
+			logging.ErrorF(err)
+		}
+
+		if err := validation.ValidateRegionPrefixLength(viper.GetInt("RegionPrefixLength")); err != nil {
+			logging.ErrorF(err)
+		}
+
+		if _, err := config.GetTargetNetworks(); err != nil {
+			logging.ErrorF(err)
+		}
+
 		if _, err := os.Stat(config.GetOutputFilePath()); !os.IsNotExist(err) {
 			if !viper.GetBool("ForceAcceptPrompts") {
 				prompt := fmt.Sprintf("Output file already exists at path '%s,' continue (will append to existing file)? [y/N]", config.GetOutputFilePath())
@@ -56,6 +94,6 @@ var discoverCmd = &cobra.Command{
 
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		app.RunDiscovery()
+		app.RunDiscovery(zrandom.Rand())
 	},
 }
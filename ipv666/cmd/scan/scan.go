@@ -13,10 +13,13 @@ import (
 func init() {
 	var bandwidth string
 	var targetNetwork string
+	var probeType string
 	Cmd.PersistentFlags().StringVarP(&bandwidth, "bandwidth", "b", viper.GetString("PingScanBandwidth"), "The maximum bandwidth to use for ping scanning")
 	Cmd.PersistentFlags().StringVarP(&targetNetwork, "network", "n", viper.GetString("ScanTargetNetwork"), "The IPv6 CIDR range to scan.")
+	Cmd.PersistentFlags().StringVar(&probeType, "probe", viper.GetString("ProbeType"), "The type of probe to scan with (icmp, tcp-syn with a list of ports such as tcp-syn:80,443, or udp with an optional list of ports out of 53, 123, 161 and 500).")
 	viper.BindPFlag("PingScanBandwidth", Cmd.PersistentFlags().Lookup("bandwidth"))
 	viper.BindPFlag("ScanTargetNetwork", Cmd.PersistentFlags().Lookup("network"))
+	viper.BindPFlag("ProbeType", Cmd.PersistentFlags().Lookup("probe"))
 	Cmd.AddCommand(discoverCmd)
 	Cmd.AddCommand(aliasCmd)
 }
@@ -39,6 +42,10 @@ var Cmd = &cobra.Command{
 			logging.ErrorF(err)
 		}
 
+		if err := validation.ValidateProbeType(viper.GetString("ProbeType")); err != nil {
+			logging.ErrorF(err)
+		}
+
 		targetNetwork := viper.GetString("ScanTargetNetwork")
 
 		if err := validation.ValidateIPv6NetworkString(targetNetwork); err != nil {
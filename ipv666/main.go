@@ -7,8 +7,6 @@ import (
 	"github.com/ekaley/ipv666/internal/setup"
 	"github.com/ekaley/ipv666/internal/splash"
 	"github.com/ekaley/ipv666/ipv666/cmd"
-	"math/rand"
-	"time"
 )
 
 func main() {
@@ -23,6 +21,5 @@ func main() {
 	if err != nil {
 		logging.ErrorF(err)
 	}
-	rand.Seed(time.Now().UTC().UnixNano())
 	cmd.Execute()
 }